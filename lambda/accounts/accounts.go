@@ -0,0 +1,203 @@
+// Package accounts resolves the account, region and role of the managed streams, so that Nemesis can scale streams
+// outside of the account and region it runs in
+package accounts
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Target is where a stream lives and how it is reached. An empty Region is the region Nemesis runs in, an empty
+// RoleARN its own credentials
+type Target struct {
+	StreamName string
+	AccountID  string
+	Region     string
+	RoleARN    string
+	ExternalID string
+}
+
+// Account is a role to assume for every managed stream of the account
+type Account struct {
+	AccountID  string `json:"accountId"`
+	RoleARN    string `json:"roleArn"`
+	ExternalID string `json:"externalId,omitempty"`
+}
+
+// Stream is a managed stream addressed by ARN. The role of the stream overrides the one of its account
+type Stream struct {
+	ARN        string `json:"arn"`
+	RoleARN    string `json:"roleArn,omitempty"`
+	ExternalID string `json:"externalId,omitempty"`
+}
+
+// Registry is the stream registry: the roles of the accounts and the streams outside of the account and region
+// Nemesis runs in
+type Registry struct {
+	Accounts []Account `json:"accounts,omitempty"`
+	Streams  []Stream  `json:"streams,omitempty"`
+}
+
+// ARN is the part of an ARN Nemesis resolves targets from
+type ARN struct {
+	Service   string
+	Region    string
+	AccountID string
+	Resource  string
+}
+
+// ParseARN splits an ARN into its parts
+func ParseARN(arn string) (ARN, error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] == "" {
+		return ARN{}, fmt.Errorf("invalid arn %q", arn)
+	}
+
+	return ARN{
+		Service:   parts[2],
+		Region:    parts[3],
+		AccountID: parts[4],
+		Resource:  parts[5],
+	}, nil
+}
+
+// ParseStreamARN returns the target of a kinesis stream ARN, arn:aws:kinesis:<region>:<account>:stream/<name>
+func ParseStreamARN(arn string) (Target, error) {
+	parsed, err := ParseARN(arn)
+	if err != nil {
+		return Target{}, err
+	}
+
+	if parsed.Service != "kinesis" || !strings.HasPrefix(parsed.Resource, "stream/") || parsed.Region == "" || parsed.AccountID == "" {
+		return Target{}, fmt.Errorf("invalid kinesis stream arn %q", arn)
+	}
+
+	return Target{
+		StreamName: strings.TrimPrefix(parsed.Resource, "stream/"),
+		AccountID:  parsed.AccountID,
+		Region:     parsed.Region,
+	}, nil
+}
+
+// Validate checks the ARNs of the registry
+func (r Registry) Validate() error {
+	for _, account := range r.Accounts {
+		if account.AccountID == "" {
+			return errors.New("registry account needs an account id")
+		}
+		if err := validateRoleARN(account.RoleARN); err != nil {
+			return fmt.Errorf("account %s: %w", account.AccountID, err)
+		}
+	}
+
+	for _, stream := range r.Streams {
+		if _, err := ParseStreamARN(stream.ARN); err != nil {
+			return err
+		}
+		if stream.RoleARN == "" {
+			continue
+		}
+		if err := validateRoleARN(stream.RoleARN); err != nil {
+			return fmt.Errorf("stream %s: %w", stream.ARN, err)
+		}
+	}
+
+	return nil
+}
+
+// validateRoleARN checks that the ARN is the ARN of an IAM role
+func validateRoleARN(roleARN string) error {
+	parsed, err := ParseARN(roleARN)
+	if err != nil {
+		return err
+	}
+	if parsed.Service != "iam" || !strings.HasPrefix(parsed.Resource, "role/") {
+		return fmt.Errorf("%q is not an iam role arn", roleARN)
+	}
+
+	return nil
+}
+
+// ForAlarm returns the target of the stream a scaling alarm watches. The alarm lives in the account and region of
+// its stream, so they come from its ARN and the role from the registry
+func (r Registry) ForAlarm(alarmArn, streamName string) (Target, error) {
+	parsed, err := ParseARN(alarmArn)
+	if err != nil {
+		return Target{}, err
+	}
+
+	target := Target{
+		StreamName: streamName,
+		AccountID:  parsed.AccountID,
+		Region:     parsed.Region,
+	}
+	r.assignRole(&target)
+
+	return target, nil
+}
+
+// ForStream returns the target of a stream given by ARN or by name. A name is looked up in the registry, and a stream
+// that is not registered is in the account and region Nemesis runs in
+func (r Registry) ForStream(stream string) Target {
+	if target, err := ParseStreamARN(stream); err == nil {
+		r.assignRole(&target)
+		return target
+	}
+
+	for _, registered := range r.Streams {
+		if target, err := ParseStreamARN(registered.ARN); err == nil && target.StreamName == stream {
+			r.assignRole(&target)
+			return target
+		}
+	}
+
+	return Target{StreamName: stream}
+}
+
+// Matches checks if the stream, given by ARN or by name as in the configuration, is the target. A name that is not
+// registered is the stream in the account and region Nemesis runs in, which only matches a local target
+func (r Registry) Matches(stream string, target Target) bool {
+	resolved := r.ForStream(stream)
+	if resolved.StreamName != target.StreamName {
+		return false
+	}
+	if resolved.Local() && target.Local() {
+		return true
+	}
+
+	return resolved.AccountID == target.AccountID && resolved.Region == target.Region
+}
+
+// Local checks if the target is in the account and region Nemesis runs in: a stream given by name, or one in the
+// region of AWS_REGION that is reached without assuming a role
+func (t Target) Local() bool {
+	if t.AccountID == "" && t.Region == "" {
+		return true
+	}
+
+	region := os.Getenv("AWS_REGION")
+	return t.RoleARN == "" && (region == "" || t.Region == region)
+}
+
+// assignRole sets the role of the registered stream or of its account on the target
+func (r Registry) assignRole(target *Target) {
+	for _, stream := range r.Streams {
+		registered, err := ParseStreamARN(stream.ARN)
+		if err != nil || stream.RoleARN == "" {
+			continue
+		}
+		if registered.StreamName == target.StreamName && registered.AccountID == target.AccountID && registered.Region == target.Region {
+			target.RoleARN, target.ExternalID = stream.RoleARN, stream.ExternalID
+			return
+		}
+	}
+
+	for _, account := range r.Accounts {
+		if account.AccountID == target.AccountID {
+			target.RoleARN, target.ExternalID = account.RoleARN, account.ExternalID
+			return
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package accounts
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var registry = Registry{
+	Accounts: []Account{
+		{AccountID: "111111111111", RoleARN: "arn:aws:iam::111111111111:role/nemesis", ExternalID: "nemesis"},
+	},
+	Streams: []Stream{
+		{ARN: "arn:aws:kinesis:eu-west-1:111111111111:stream/orders", RoleARN: "arn:aws:iam::111111111111:role/nemesis-orders"},
+		{ARN: "arn:aws:kinesis:ap-south-1:222222222222:stream/payments"},
+	},
+}
+
+func TestRegistry_ForAlarm(t *testing.T) {
+	target, err := registry.ForAlarm("arn:aws:cloudwatch:eu-west-1:111111111111:alarm:orders-scale-up", "orders")
+	assert.NoError(t, err)
+	assert.Equal(t, Target{StreamName: "orders", AccountID: "111111111111", Region: "eu-west-1",
+		RoleARN: "arn:aws:iam::111111111111:role/nemesis-orders"}, target)
+
+	// Other streams of the account use the role of the account
+	target, err = registry.ForAlarm("arn:aws:cloudwatch:us-east-1:111111111111:alarm:clicks-scale-up", "clicks")
+	assert.NoError(t, err)
+	assert.Equal(t, "arn:aws:iam::111111111111:role/nemesis", target.RoleARN)
+	assert.Equal(t, "nemesis", target.ExternalID)
+
+	// Unknown accounts use the credentials of Nemesis in the region of the alarm
+	target, err = registry.ForAlarm("arn:aws:cloudwatch:us-west-2:333333333333:alarm:logs-scale-up", "logs")
+	assert.NoError(t, err)
+	assert.Equal(t, Target{StreamName: "logs", AccountID: "333333333333", Region: "us-west-2"}, target)
+
+	_, err = registry.ForAlarm("logs-scale-up", "logs")
+	assert.Error(t, err)
+}
+
+func TestRegistry_ForStream(t *testing.T) {
+	assert.Equal(t, Target{StreamName: "payments", AccountID: "222222222222", Region: "ap-south-1"}, registry.ForStream("payments"))
+	assert.Equal(t, "arn:aws:iam::111111111111:role/nemesis", registry.ForStream("arn:aws:kinesis:eu-west-1:111111111111:stream/clicks").RoleARN)
+	assert.Equal(t, Target{StreamName: "local"}, registry.ForStream("local"))
+}
+
+func TestRegistry_Matches(t *testing.T) {
+	t.Setenv("AWS_REGION", "us-east-1")
+
+	local, err := registry.ForAlarm("arn:aws:cloudwatch:us-east-1:333333333333:alarm:orders-scale-up", "orders")
+	assert.NoError(t, err)
+	orders, err := registry.ForAlarm("arn:aws:cloudwatch:eu-west-1:111111111111:alarm:orders-scale-up", "orders")
+	assert.NoError(t, err)
+
+	// The name of a registered stream is that stream, and not the local one of the same name
+	assert.True(t, registry.Matches("orders", orders))
+	assert.False(t, registry.Matches("orders", local))
+	assert.True(t, registry.Matches("arn:aws:kinesis:eu-west-1:111111111111:stream/orders", orders))
+
+	// The name of a stream that is not registered is the local stream
+	assert.True(t, registry.Matches("clicks", Target{StreamName: "clicks", AccountID: "333333333333", Region: "us-east-1"}))
+	assert.True(t, registry.Matches("clicks", Target{StreamName: "clicks"}))
+	assert.False(t, registry.Matches("clicks", Target{StreamName: "clicks", AccountID: "333333333333", Region: "eu-west-1"}))
+	assert.False(t, registry.Matches("clicks", Target{StreamName: "views"}))
+}
+
+func TestRegistry_Validate(t *testing.T) {
+	assert.NoError(t, registry.Validate())
+	assert.Error(t, Registry{Streams: []Stream{{ARN: "arn:aws:sqs:eu-west-1:111111111111:orders"}}}.Validate())
+	assert.Error(t, Registry{Accounts: []Account{{AccountID: "111111111111", RoleARN: "arn:aws:iam::111111111111:user/nemesis"}}}.Validate())
+	assert.Error(t, Registry{Accounts: []Account{{RoleARN: "arn:aws:iam::111111111111:role/nemesis"}}}.Validate())
+}
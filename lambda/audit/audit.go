@@ -0,0 +1,189 @@
+// Package audit contains the scaling audit trail for Nemesis
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/vmanikes/Nemesis/accounts"
+	"github.com/vmanikes/Nemesis/logging"
+	"go.uber.org/zap"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// timestampLayout is a fixed width UTC layout, so that stored timestamps sort lexicographically
+const timestampLayout = "2006-01-02T15:04:05.000000000Z"
+
+// Outcome is the result of a single scaling decision
+type Outcome string
+
+const (
+	// OutcomeApplied is recorded when the stream was resharded and the alarms were updated
+	OutcomeApplied Outcome = "Applied"
+	// OutcomeRejected is recorded when the scaling event was rejected by the cooldown
+	OutcomeRejected Outcome = "Rejected"
+	// OutcomeSkipped is recorded when there was nothing to do for the scaling event
+	OutcomeSkipped Outcome = "Skipped"
+	// OutcomeFailed is recorded when any step of the scaling event failed
+	OutcomeFailed Outcome = "Failed"
+	// OutcomeFrozen is recorded when the scaling event was blocked by a freeze window
+	OutcomeFrozen Outcome = "Frozen"
+	// OutcomeResumed is recorded when the steps an interrupted scaling left behind were completed
+	OutcomeResumed Outcome = "Resumed"
+	// OutcomeRolledBack is recorded when an interrupted scaling was dropped before it updated the shard count
+	OutcomeRolledBack Outcome = "RolledBack"
+)
+
+// ScalingEvent is a single scaling decision along with the inputs that were used to make it
+type ScalingEvent struct {
+	StreamName string `json:"streamName"`
+	// AccountID and Region are set for streams outside of the account and region Nemesis runs in, so that streams of
+	// the same name in other accounts and regions have a history of their own
+	AccountID        string          `json:"accountId,omitempty"`
+	Region           string          `json:"region,omitempty"`
+	Timestamp        time.Time       `json:"timestamp"`
+	RequestID        string          `json:"requestId,omitempty"`
+	AlarmName        string          `json:"alarmName,omitempty"`
+	Action           string          `json:"action,omitempty"`
+	Alarm            json.RawMessage `json:"alarm,omitempty"`
+	UsageFactors     []float64       `json:"usageFactors,omitempty"`
+	LastScaled       string          `json:"lastScaled,omitempty"`
+	ShardCount       int             `json:"shardCount,omitempty"`
+	TargetShardCount int             `json:"targetShardCount,omitempty"`
+	Outcome          Outcome         `json:"outcome"`
+	Reason           string          `json:"reason,omitempty"`
+	Error            string          `json:"error,omitempty"`
+	Forecast         *Forecast       `json:"forecast,omitempty"`
+	// Flapping is set when the stream changed direction too often in the recent scaling actions
+	Flapping bool `json:"flapping,omitempty"`
+	// Decision is how the scaling strategy of the stream arrived at the target shard count
+	Decision string `json:"decision,omitempty"`
+	// Resharded is set once the shard count update went through, whatever the outcome of the steps after it
+	Resharded bool `json:"resharded,omitempty"`
+}
+
+// Forecast is the load a predictive scaling decision was based on
+type Forecast struct {
+	// Start is the first forecast period, every following value is PeriodMinutes later
+	Start           time.Time `json:"start"`
+	PeriodMinutes   int       `json:"periodMinutes"`
+	IncomingBytes   []float64 `json:"incomingBytes"`
+	IncomingRecords []float64 `json:"incomingRecords"`
+	// PeakUsageFactor is the highest forecast usage factor at the shard count of the stream
+	PeakUsageFactor float64 `json:"peakUsageFactor"`
+	// Accuracy compares the forecast recorded before this one with the traffic that arrived since
+	Accuracy *ForecastAccuracy `json:"accuracy,omitempty"`
+}
+
+// ForecastAccuracy is how close an earlier forecast came to the traffic that arrived
+type ForecastAccuracy struct {
+	// ForecastAt is the time of the scaling event the forecast was recorded with
+	ForecastAt time.Time `json:"forecastAt"`
+	// Periods is the number of forecast periods that were compared
+	Periods int `json:"periods"`
+	// IncomingBytesError and IncomingRecordsError are mean absolute percentage errors, 0.1 is 10%
+	IncomingBytesError   float64 `json:"incomingBytesError"`
+	IncomingRecordsError float64 `json:"incomingRecordsError"`
+}
+
+// SetOutcome sets the outcome of the scaling event along with the reason for it
+func (e *ScalingEvent) SetOutcome(outcome Outcome, reason string) {
+	e.Outcome = outcome
+	e.Reason = reason
+}
+
+// SetLocation sets the account and region of the stream at the target, when it is outside of the account and region
+// Nemesis runs in
+func (e *ScalingEvent) SetLocation(location accounts.Target) {
+	if !location.Local() {
+		e.AccountID, e.Region = location.AccountID, location.Region
+	}
+}
+
+// Fail marks the scaling event as failed with the reason and the error that caused it
+func (e *ScalingEvent) Fail(reason string, err error) {
+	e.SetOutcome(OutcomeFailed, reason)
+	if err != nil {
+		e.Error = err.Error()
+	}
+}
+
+// Store persists scaling events and returns the history of a stream
+type Store interface {
+	// Record persists a single scaling event
+	Record(ctx context.Context, event ScalingEvent) error
+	// History returns the scaling events of the stream at the target that happened at or after since, oldest first
+	History(ctx context.Context, location accounts.Target, since time.Time) ([]ScalingEvent, error)
+}
+
+// Open takes in a store URI and returns the store for it. Supported URIs are dynamodb://<table>,
+// s3://<bucket>/<prefix> and file://<path>. An empty URI returns a store that discards all events
+func Open(ctx context.Context, uri string) (Store, error) {
+	logger := logging.WithContext(ctx)
+
+	switch {
+	case uri == "":
+		return Discard{}, nil
+	case strings.HasPrefix(uri, "dynamodb://"):
+		return NewDynamoDBStore(ctx, strings.TrimPrefix(uri, "dynamodb://"))
+	case strings.HasPrefix(uri, "s3://"):
+		location := strings.TrimPrefix(uri, "s3://")
+		bucket, prefix := location, ""
+		if i := strings.Index(location, "/"); i >= 0 {
+			bucket, prefix = location[:i], location[i+1:]
+		}
+		return NewS3Store(ctx, bucket, prefix)
+	case strings.HasPrefix(uri, "file://"):
+		return NewFileStore(strings.TrimPrefix(uri, "file://")), nil
+	}
+
+	err := errors.New("unsupported audit store uri")
+	logger.Error(err.Error(),
+		zap.String("uri", uri))
+	return nil, err
+}
+
+// Discard is a store that drops every event. It is used when no audit store is configured
+type Discard struct{}
+
+// Record drops the event
+func (Discard) Record(context.Context, ScalingEvent) error {
+	return nil
+}
+
+// History always returns an empty history
+func (Discard) History(context.Context, accounts.Target, time.Time) ([]ScalingEvent, error) {
+	return nil, nil
+}
+
+// streamKey is the key the events of a stream are stored under: the stream name, prefixed with the account and region
+// of streams outside of the account and region Nemesis runs in
+func streamKey(accountID, region, streamName string) string {
+	if accountID == "" && region == "" {
+		return streamName
+	}
+	return path.Join(accountID, region, streamName)
+}
+
+// eventKey is the key the event is stored under
+func eventKey(event ScalingEvent) string {
+	return streamKey(event.AccountID, event.Region, event.StreamName)
+}
+
+// locationKey is the key the events of the stream at the target are stored under
+func locationKey(location accounts.Target) string {
+	if location.Local() {
+		return location.StreamName
+	}
+	return streamKey(location.AccountID, location.Region, location.StreamName)
+}
+
+// sortEvents sorts the events by timestamp, oldest first
+func sortEvents(events []ScalingEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+}
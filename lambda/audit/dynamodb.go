@@ -0,0 +1,130 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/vmanikes/Nemesis/accounts"
+	"github.com/vmanikes/Nemesis/clients"
+	"github.com/vmanikes/Nemesis/logging"
+	"go.uber.org/zap"
+	"time"
+)
+
+// DynamoDBStore stores scaling events in a DynamoDB table. The table must have StreamName as the partition key and
+// Timestamp as the sort key, both strings. The StreamName of streams outside of the account and region Nemesis runs in
+// is <account>/<region>/<stream>
+type DynamoDBStore struct {
+	tableName      string
+	dynamoDBClient DynamoDBAPI
+}
+
+// DynamoDBAPI is the part of the dynamodb API that the store uses
+type DynamoDBAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
+// NewDynamoDBStore creates a store backed by the given DynamoDB table
+func NewDynamoDBStore(ctx context.Context, tableName string) (*DynamoDBStore, error) {
+	logger := logging.WithContext(ctx)
+
+	cfg, err := clients.Default().Config(ctx, accounts.Target{})
+	if err != nil {
+		logger.Error("unable to load the default config for aws")
+		return nil, err
+	}
+
+	return NewDynamoDBStoreFromAPI(dynamodb.NewFromConfig(cfg), tableName), nil
+}
+
+// NewDynamoDBStoreFromAPI creates a store backed by the given DynamoDB table with an existing API implementation
+func NewDynamoDBStoreFromAPI(api DynamoDBAPI, tableName string) *DynamoDBStore {
+	return &DynamoDBStore{
+		tableName:      tableName,
+		dynamoDBClient: api,
+	}
+}
+
+// Record puts the event as an item in the table
+func (s *DynamoDBStore) Record(ctx context.Context, event ScalingEvent) error {
+	logger := logging.WithContext(ctx)
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("unable to marshal scaling event",
+			zap.Error(err))
+		return err
+	}
+
+	_, err = s.dynamoDBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item: map[string]types.AttributeValue{
+			"StreamName": &types.AttributeValueMemberS{Value: eventKey(event)},
+			"Timestamp":  &types.AttributeValueMemberS{Value: event.Timestamp.UTC().Format(timestampLayout)},
+			"Outcome":    &types.AttributeValueMemberS{Value: string(event.Outcome)},
+			"Event":      &types.AttributeValueMemberS{Value: string(body)},
+		},
+	})
+	if err != nil {
+		logger.Error("unable to put scaling event",
+			zap.String("table-name", s.tableName),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// History queries the table for the events of the stream at the target that happened at or after since
+func (s *DynamoDBStore) History(ctx context.Context, location accounts.Target, since time.Time) ([]ScalingEvent, error) {
+	logger := logging.WithContext(ctx)
+
+	paginator := dynamodb.NewQueryPaginator(s.dynamoDBClient, &dynamodb.QueryInput{
+		TableName:              aws.String(s.tableName),
+		KeyConditionExpression: aws.String("StreamName = :stream AND #ts >= :since"),
+		ExpressionAttributeNames: map[string]string{
+			"#ts": "Timestamp",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":stream": &types.AttributeValueMemberS{Value: locationKey(location)},
+			":since":  &types.AttributeValueMemberS{Value: since.UTC().Format(timestampLayout)},
+		},
+	})
+
+	events := make([]ScalingEvent, 0)
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			logger.Error("unable to query scaling events",
+				zap.String("table-name", s.tableName),
+				zap.Error(err))
+			return nil, err
+		}
+
+		for _, item := range page.Items {
+			body, ok := item["Event"].(*types.AttributeValueMemberS)
+			if !ok {
+				continue
+			}
+
+			var event ScalingEvent
+			err = json.Unmarshal([]byte(body.Value), &event)
+			if err != nil {
+				logger.Error("unable to unmarshal scaling event",
+					zap.String("table-name", s.tableName),
+					zap.Error(err))
+				return nil, err
+			}
+
+			events = append(events, event)
+		}
+	}
+
+	sortEvents(events)
+
+	return events, nil
+}
@@ -0,0 +1,151 @@
+package audit
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmanikes/Nemesis/accounts"
+	"sort"
+	"testing"
+	"time"
+)
+
+// fakeDynamoDB keeps the items of a single table in memory and evaluates the key condition the store queries with.
+// Queries return at most pageSize items per page
+type fakeDynamoDB struct {
+	items    []map[string]types.AttributeValue
+	pageSize int
+	queries  int
+}
+
+func (f *fakeDynamoDB) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.items = append(f.items, params.Item)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) Query(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	f.queries++
+
+	stream := attributeString(params.ExpressionAttributeValues[":stream"])
+	since := attributeString(params.ExpressionAttributeValues[":since"])
+
+	after := ""
+	if params.ExclusiveStartKey != nil {
+		after = attributeString(params.ExclusiveStartKey["Timestamp"])
+	}
+
+	matches := make([]map[string]types.AttributeValue, 0)
+	for _, item := range f.items {
+		timestamp := attributeString(item["Timestamp"])
+		if attributeString(item["StreamName"]) == stream && timestamp >= since && timestamp > after {
+			matches = append(matches, item)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return attributeString(matches[i]["Timestamp"]) < attributeString(matches[j]["Timestamp"])
+	})
+
+	output := &dynamodb.QueryOutput{Items: matches}
+	if len(matches) > f.pageSize {
+		output.Items = matches[:f.pageSize]
+		last := output.Items[f.pageSize-1]
+		output.LastEvaluatedKey = map[string]types.AttributeValue{
+			"StreamName": last["StreamName"],
+			"Timestamp":  last["Timestamp"],
+		}
+	}
+
+	return output, nil
+}
+
+func attributeString(value types.AttributeValue) string {
+	s, ok := value.(*types.AttributeValueMemberS)
+	if !ok {
+		return ""
+	}
+	return s.Value
+}
+
+func TestDynamoDBStore_History(t *testing.T) {
+	ctx := context.Background()
+	api := &fakeDynamoDB{pageSize: 1}
+	store := NewDynamoDBStoreFromAPI(api, "nemesis-audit")
+
+	events, err := store.History(ctx, accounts.Target{StreamName: "test-stream"}, time.Time{})
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, store.Record(ctx, ScalingEvent{StreamName: "test-stream", Timestamp: now, Outcome: OutcomeApplied}))
+	assert.NoError(t, store.Record(ctx, ScalingEvent{StreamName: "test-stream", Timestamp: now.Add(-time.Hour), Outcome: OutcomeRejected}))
+	assert.NoError(t, store.Record(ctx, ScalingEvent{StreamName: "other-stream", Timestamp: now, Outcome: OutcomeApplied}))
+	assert.NoError(t, store.Record(ctx, ScalingEvent{StreamName: "test-stream", Timestamp: now.Add(-48 * time.Hour), Outcome: OutcomeSkipped}))
+
+	assert.Equal(t, "test-stream", attributeString(api.items[0]["StreamName"]))
+	assert.Equal(t, "2022-09-01T12:00:00.000000000Z", attributeString(api.items[0]["Timestamp"]))
+	assert.Equal(t, "Applied", attributeString(api.items[0]["Outcome"]))
+
+	// Both events in the window come back, one page each
+	api.queries = 0
+	events, err = store.History(ctx, accounts.Target{StreamName: "test-stream"}, now.Add(-24*time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, OutcomeRejected, events[0].Outcome)
+	assert.Equal(t, OutcomeApplied, events[1].Outcome)
+	assert.Equal(t, 2, api.queries)
+}
+
+func TestDynamoDBStore_HistoryByLocation(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "us-east-1")
+	api := &fakeDynamoDB{pageSize: 10}
+	store := NewDynamoDBStoreFromAPI(api, "nemesis-audit")
+
+	local := accounts.Target{StreamName: "test-stream", AccountID: "123456789012", Region: "us-east-1"}
+	remote := accounts.Target{StreamName: "test-stream", AccountID: "999999999999", Region: "eu-west-1"}
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, location := range []accounts.Target{local, remote} {
+		event := ScalingEvent{StreamName: "test-stream", Timestamp: now, Outcome: OutcomeApplied, Action: location.Region}
+		event.SetLocation(location)
+		assert.NoError(t, store.Record(ctx, event))
+	}
+
+	assert.Equal(t, "test-stream", attributeString(api.items[0]["StreamName"]))
+	assert.Equal(t, "999999999999/eu-west-1/test-stream", attributeString(api.items[1]["StreamName"]))
+
+	events, err := store.History(ctx, local, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "us-east-1", events[0].Action)
+
+	events, err = store.History(ctx, remote, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "999999999999", events[0].AccountID)
+	assert.Equal(t, "eu-west-1", events[0].Region)
+}
+
+func TestDynamoDBStore_HistoryError(t *testing.T) {
+	ctx := context.Background()
+	api := &fakeDynamoDB{pageSize: 10}
+	store := NewDynamoDBStoreFromAPI(api, "nemesis-audit")
+
+	api.items = append(api.items, map[string]types.AttributeValue{
+		"StreamName": &types.AttributeValueMemberS{Value: "test-stream"},
+		"Timestamp":  &types.AttributeValueMemberS{Value: "2022-09-01T12:00:00.000000000Z"},
+		"Event":      &types.AttributeValueMemberS{Value: "{"},
+	})
+
+	_, err := store.History(ctx, accounts.Target{StreamName: "test-stream"}, time.Time{})
+	assert.Error(t, err)
+
+	// Items without an event body are skipped
+	api.items[0]["Event"] = &types.AttributeValueMemberN{Value: "1"}
+
+	events, err := store.History(ctx, accounts.Target{StreamName: "test-stream"}, time.Time{})
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+}
@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/vmanikes/Nemesis/accounts"
+	"github.com/vmanikes/Nemesis/logging"
+	"go.uber.org/zap"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileStore stores scaling events as JSON lines in a local file. It is meant for local runs and tests
+type FileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileStore returns a store that appends the events to the file at path
+func NewFileStore(path string) *FileStore {
+	return &FileStore{
+		path: path,
+	}
+}
+
+// Record appends the event to the file
+func (s *FileStore) Record(ctx context.Context, event ScalingEvent) error {
+	logger := logging.WithContext(ctx)
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("unable to marshal scaling event",
+			zap.Error(err))
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		logger.Error("unable to open audit file",
+			zap.String("path", s.path),
+			zap.Error(err))
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		logger.Error("unable to write scaling event",
+			zap.String("path", s.path),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// History reads the file and returns the events of the stream at the target that happened at or after since
+func (s *FileStore) History(ctx context.Context, location accounts.Target, since time.Time) ([]ScalingEvent, error) {
+	logger := logging.WithContext(ctx)
+
+	key := locationKey(location)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		logger.Error("unable to open audit file",
+			zap.String("path", s.path),
+			zap.Error(err))
+		return nil, err
+	}
+	defer file.Close()
+
+	events := make([]ScalingEvent, 0)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event ScalingEvent
+		err = json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			logger.Error("unable to unmarshal scaling event",
+				zap.String("path", s.path),
+				zap.Error(err))
+			return nil, err
+		}
+
+		if eventKey(event) == key && !event.Timestamp.Before(since) {
+			events = append(events, event)
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		logger.Error("unable to read audit file",
+			zap.String("path", s.path),
+			zap.Error(err))
+		return nil, err
+	}
+
+	sortEvents(events)
+
+	return events, nil
+}
@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmanikes/Nemesis/accounts"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStore_History(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileStore(filepath.Join(t.TempDir(), "audit.jsonl"))
+
+	events, err := store.History(ctx, accounts.Target{StreamName: "test-stream"}, time.Time{})
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, store.Record(ctx, ScalingEvent{StreamName: "test-stream", Timestamp: now, Outcome: OutcomeApplied}))
+	assert.NoError(t, store.Record(ctx, ScalingEvent{StreamName: "test-stream", Timestamp: now.Add(-time.Hour), Outcome: OutcomeRejected}))
+	assert.NoError(t, store.Record(ctx, ScalingEvent{StreamName: "other-stream", Timestamp: now, Outcome: OutcomeApplied}))
+	assert.NoError(t, store.Record(ctx, ScalingEvent{StreamName: "test-stream", Timestamp: now.Add(-48 * time.Hour), Outcome: OutcomeSkipped}))
+
+	events, err = store.History(ctx, accounts.Target{StreamName: "test-stream"}, now.Add(-24*time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, OutcomeRejected, events[0].Outcome)
+	assert.Equal(t, OutcomeApplied, events[1].Outcome)
+}
+
+func TestFileStore_HistoryByLocation(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "us-east-1")
+	store := NewFileStore(filepath.Join(t.TempDir(), "audit.jsonl"))
+
+	local := accounts.Target{StreamName: "test-stream", AccountID: "123456789012", Region: "us-east-1"}
+	remote := accounts.Target{StreamName: "test-stream", AccountID: "999999999999", Region: "eu-west-1"}
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, location := range []accounts.Target{local, remote} {
+		event := ScalingEvent{StreamName: "test-stream", Timestamp: now, Outcome: OutcomeApplied, Action: location.Region}
+		event.SetLocation(location)
+		assert.NoError(t, store.Record(ctx, event))
+	}
+
+	// The stream in the account and region Nemesis runs in keeps the history of its name
+	events, err := store.History(ctx, accounts.Target{StreamName: "test-stream"}, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "us-east-1", events[0].Action)
+	assert.Empty(t, events[0].AccountID)
+
+	events, err = store.History(ctx, local, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "us-east-1", events[0].Action)
+
+	events, err = store.History(ctx, remote, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "999999999999", events[0].AccountID)
+	assert.Equal(t, "eu-west-1", events[0].Region)
+}
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := Open(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, Discard{}, store)
+
+	store, err = Open(ctx, "file:///tmp/audit.jsonl")
+	assert.NoError(t, err)
+	assert.IsType(t, &FileStore{}, store)
+
+	_, err = Open(ctx, "ftp://audit")
+	assert.Error(t, err)
+}
+
+func TestScalingEvent_Fail(t *testing.T) {
+	event := ScalingEvent{}
+	event.Fail("unable to update shard count", assert.AnError)
+
+	assert.Equal(t, OutcomeFailed, event.Outcome)
+	assert.Equal(t, "unable to update shard count", event.Reason)
+	assert.Equal(t, assert.AnError.Error(), event.Error)
+}
@@ -0,0 +1,156 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/vmanikes/Nemesis/accounts"
+	"github.com/vmanikes/Nemesis/clients"
+	"github.com/vmanikes/Nemesis/logging"
+	"go.uber.org/zap"
+	"path"
+	"time"
+)
+
+// S3Store stores every scaling event as a JSON object under <prefix>/<stream>/<timestamp>-<request id>.json, and
+// under <prefix>/<account>/<region>/<stream>/ for streams outside of the account and region Nemesis runs in
+type S3Store struct {
+	bucket   string
+	prefix   string
+	s3Client S3API
+}
+
+// S3API is the part of the s3 API that the store uses
+type S3API interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// NewS3Store creates a store backed by the given S3 bucket and key prefix
+func NewS3Store(ctx context.Context, bucket, prefix string) (*S3Store, error) {
+	logger := logging.WithContext(ctx)
+
+	cfg, err := clients.Default().Config(ctx, accounts.Target{})
+	if err != nil {
+		logger.Error("unable to load the default config for aws")
+		return nil, err
+	}
+
+	return NewS3StoreFromAPI(s3.NewFromConfig(cfg), bucket, prefix), nil
+}
+
+// NewS3StoreFromAPI creates a store backed by the given S3 bucket and key prefix with an existing API implementation
+func NewS3StoreFromAPI(api S3API, bucket, prefix string) *S3Store {
+	return &S3Store{
+		bucket:   bucket,
+		prefix:   prefix,
+		s3Client: api,
+	}
+}
+
+// Record puts the event as an object in the bucket
+func (s *S3Store) Record(ctx context.Context, event ScalingEvent) error {
+	logger := logging.WithContext(ctx)
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("unable to marshal scaling event",
+			zap.Error(err))
+		return err
+	}
+
+	key := path.Join(s.prefix, eventKey(event), event.Timestamp.UTC().Format(timestampLayout)+"-"+event.RequestID+".json")
+
+	_, err = s.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		logger.Error("unable to put scaling event",
+			zap.String("bucket", s.bucket),
+			zap.String("key", key),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// History lists the objects of the stream at the target starting at since and returns their events
+func (s *S3Store) History(ctx context.Context, location accounts.Target, since time.Time) ([]ScalingEvent, error) {
+	logger := logging.WithContext(ctx)
+
+	key := locationKey(location)
+	streamPrefix := path.Join(s.prefix, key) + "/"
+
+	paginator := s3.NewListObjectsV2Paginator(s.s3Client, &s3.ListObjectsV2Input{
+		Bucket:     aws.String(s.bucket),
+		Prefix:     aws.String(streamPrefix),
+		StartAfter: aws.String(streamPrefix + since.UTC().Format(timestampLayout)),
+	})
+
+	events := make([]ScalingEvent, 0)
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			logger.Error("unable to list scaling events",
+				zap.String("bucket", s.bucket),
+				zap.String("prefix", streamPrefix),
+				zap.Error(err))
+			return nil, err
+		}
+
+		for _, object := range page.Contents {
+			event, err := s.getEvent(ctx, aws.ToString(object.Key))
+			if err != nil {
+				return nil, err
+			}
+
+			// The prefix of a stream named like an account also lists the streams of the account
+			if eventKey(event) == key && !event.Timestamp.Before(since) {
+				events = append(events, event)
+			}
+		}
+	}
+
+	sortEvents(events)
+
+	return events, nil
+}
+
+// getEvent reads a single event object from the bucket
+func (s *S3Store) getEvent(ctx context.Context, key string) (ScalingEvent, error) {
+	logger := logging.WithContext(ctx)
+
+	var event ScalingEvent
+
+	response, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		logger.Error("unable to get scaling event",
+			zap.String("bucket", s.bucket),
+			zap.String("key", key),
+			zap.Error(err))
+		return event, err
+	}
+	defer response.Body.Close()
+
+	err = json.NewDecoder(response.Body).Decode(&event)
+	if err != nil {
+		logger.Error("unable to unmarshal scaling event",
+			zap.String("bucket", s.bucket),
+			zap.String("key", key),
+			zap.Error(err))
+		return event, err
+	}
+
+	return event, nil
+}
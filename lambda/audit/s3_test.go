@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmanikes/Nemesis/accounts"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeS3 keeps the objects of a single bucket in memory. Listings are in key order and return at most pageSize keys
+// per page
+type fakeS3 struct {
+	objects  map[string][]byte
+	pageSize int
+	lists    int
+}
+
+func (f *fakeS3) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	body, ok := f.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, errors.New("no such key")
+	}
+
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(body))}, nil
+}
+
+func (f *fakeS3) ListObjectsV2(_ context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	f.lists++
+
+	after := aws.ToString(params.StartAfter)
+	if params.ContinuationToken != nil {
+		after = aws.ToString(params.ContinuationToken)
+	}
+
+	keys := make([]string, 0)
+	for key := range f.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	output := &s3.ListObjectsV2Output{}
+	if len(keys) > f.pageSize {
+		keys = keys[:f.pageSize]
+		output.IsTruncated = true
+		output.NextContinuationToken = aws.String(keys[len(keys)-1])
+	}
+
+	for _, key := range keys {
+		output.Contents = append(output.Contents, types.Object{Key: aws.String(key)})
+	}
+
+	return output, nil
+}
+
+func (f *fakeS3) PutObject(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	f.objects[aws.ToString(params.Key)] = body
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) keys() []string {
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestS3Store_History(t *testing.T) {
+	ctx := context.Background()
+	api := &fakeS3{objects: map[string][]byte{}, pageSize: 1}
+	store := NewS3StoreFromAPI(api, "nemesis-audit", "events")
+
+	events, err := store.History(ctx, accounts.Target{StreamName: "test-stream"}, time.Time{})
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, store.Record(ctx, ScalingEvent{StreamName: "test-stream", RequestID: "a", Timestamp: now, Outcome: OutcomeApplied}))
+	assert.NoError(t, store.Record(ctx, ScalingEvent{StreamName: "test-stream", RequestID: "b", Timestamp: now.Add(-time.Hour), Outcome: OutcomeRejected}))
+	assert.NoError(t, store.Record(ctx, ScalingEvent{StreamName: "other-stream", RequestID: "c", Timestamp: now, Outcome: OutcomeApplied}))
+	assert.NoError(t, store.Record(ctx, ScalingEvent{StreamName: "test-stream", RequestID: "d", Timestamp: now.Add(-48 * time.Hour), Outcome: OutcomeSkipped}))
+
+	assert.Equal(t, []string{
+		"events/other-stream/2022-09-01T12:00:00.000000000Z-c.json",
+		"events/test-stream/2022-08-30T12:00:00.000000000Z-d.json",
+		"events/test-stream/2022-09-01T11:00:00.000000000Z-b.json",
+		"events/test-stream/2022-09-01T12:00:00.000000000Z-a.json",
+	}, api.keys())
+
+	// The listing starts after the window, and both events in it come back one page each
+	api.lists = 0
+	events, err = store.History(ctx, accounts.Target{StreamName: "test-stream"}, now.Add(-24*time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, OutcomeRejected, events[0].Outcome)
+	assert.Equal(t, OutcomeApplied, events[1].Outcome)
+	assert.Equal(t, 2, api.lists)
+}
+
+func TestS3Store_HistoryByLocation(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "us-east-1")
+	api := &fakeS3{objects: map[string][]byte{}, pageSize: 10}
+	store := NewS3StoreFromAPI(api, "nemesis-audit", "events")
+
+	local := accounts.Target{StreamName: "test-stream", AccountID: "123456789012", Region: "us-east-1"}
+	remote := accounts.Target{StreamName: "test-stream", AccountID: "999999999999", Region: "eu-west-1"}
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, location := range []accounts.Target{local, remote} {
+		event := ScalingEvent{StreamName: "test-stream", RequestID: location.Region, Timestamp: now, Outcome: OutcomeApplied, Action: location.Region}
+		event.SetLocation(location)
+		assert.NoError(t, store.Record(ctx, event))
+	}
+
+	// A stream named like the account lists the objects of the streams in the account under its prefix
+	assert.NoError(t, store.Record(ctx, ScalingEvent{StreamName: "999999999999", RequestID: "named", Timestamp: now, Outcome: OutcomeSkipped}))
+
+	assert.Equal(t, []string{
+		"events/999999999999/2022-09-01T12:00:00.000000000Z-named.json",
+		"events/999999999999/eu-west-1/test-stream/2022-09-01T12:00:00.000000000Z-eu-west-1.json",
+		"events/test-stream/2022-09-01T12:00:00.000000000Z-us-east-1.json",
+	}, api.keys())
+
+	events, err := store.History(ctx, local, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "us-east-1", events[0].Action)
+
+	events, err = store.History(ctx, remote, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "999999999999", events[0].AccountID)
+	assert.Equal(t, "eu-west-1", events[0].Region)
+
+	events, err = store.History(ctx, accounts.Target{StreamName: "999999999999"}, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, OutcomeSkipped, events[0].Outcome)
+}
@@ -0,0 +1,222 @@
+// Package clients provides the AWS configs and clients of Nemesis. A single provider is kept per process, so that warm
+// Lambda invocations reuse the loaded config, the assumed role credentials and the clients built from them
+package clients
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/vmanikes/Nemesis/accounts"
+	"github.com/vmanikes/Nemesis/logging"
+	"go.uber.org/zap"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sessionName is the role session name of the assumed roles, it shows up in the CloudTrail of the target accounts
+const sessionName = "nemesis"
+
+// Options configures the calls of every client
+type Options struct {
+	// RetryMode is standard or adaptive, adaptive when empty. Adaptive retries slow down on throttling, which the
+	// control plane APIs Nemesis calls are quick to do
+	RetryMode string `json:"retryMode,omitempty"`
+	// MaxAttempts is the most attempts of a call, the first one included, 5 when 0
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// TimeoutSeconds bounds every attempt of a call, 10 when 0
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+	// Endpoint replaces the endpoint of every service, e.g. http://localhost:4566 for LocalStack
+	Endpoint string `json:"endpoint,omitempty"`
+	// Endpoints replace the endpoints of single services, keyed by their lower case service id, e.g. kinesis
+	Endpoints map[string]string `json:"endpoints,omitempty"`
+}
+
+// WithDefaults returns the options with the defaults for the unset fields
+func (o Options) WithDefaults() Options {
+	if o.RetryMode == "" {
+		o.RetryMode = string(aws.RetryModeAdaptive)
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 5
+	}
+	if o.TimeoutSeconds <= 0 {
+		o.TimeoutSeconds = 10
+	}
+	return o
+}
+
+// Validate checks the retry mode
+func (o Options) Validate() error {
+	if o.RetryMode == "" {
+		return nil
+	}
+	if _, err := aws.ParseRetryMode(o.RetryMode); err != nil {
+		return fmt.Errorf("invalid aws retry mode: %w", err)
+	}
+
+	return nil
+}
+
+// apply sets the options on the config
+func (o Options) apply(cfg *aws.Config) {
+	o = o.WithDefaults()
+
+	cfg.RetryMode, _ = aws.ParseRetryMode(o.RetryMode)
+	cfg.RetryMaxAttempts = o.MaxAttempts
+	cfg.HTTPClient = awshttp.NewBuildableClient().WithTimeout(time.Duration(o.TimeoutSeconds) * time.Second)
+
+	if o.Endpoint == "" && len(o.Endpoints) == 0 {
+		return
+	}
+
+	cfg.EndpointResolverWithOptions = aws.EndpointResolverWithOptionsFunc(func(service, region string, _ ...interface{}) (aws.Endpoint, error) {
+		url, ok := o.Endpoints[strings.ToLower(service)]
+		if !ok {
+			url = o.Endpoint
+		}
+		if url == "" {
+			// Falls back to the default endpoint of the service
+			return aws.Endpoint{}, &aws.EndpointNotFoundError{}
+		}
+
+		return aws.Endpoint{
+			URL:               url,
+			SigningRegion:     region,
+			HostnameImmutable: true,
+		}, nil
+	})
+}
+
+// key identifies a cached config or client. The stream is not part of it, the streams of an account and region share
+// their config and clients
+type key struct {
+	region     string
+	roleARN    string
+	externalID string
+	service    string
+}
+
+// Provider returns the AWS config and clients of every target. It is safe for concurrent use
+type Provider struct {
+	options Options
+
+	mu      sync.Mutex
+	base    *aws.Config
+	configs map[key]aws.Config
+	clients map[key]interface{}
+	// loadBase loads the config of Nemesis itself. Defaults to config.LoadDefaultConfig
+	loadBase func(ctx context.Context) (aws.Config, error)
+}
+
+// NewProvider returns a provider with an empty cache
+func NewProvider(options Options) *Provider {
+	return &Provider{
+		options: options,
+		configs: make(map[key]aws.Config),
+		clients: make(map[key]interface{}),
+		loadBase: func(ctx context.Context) (aws.Config, error) {
+			return config.LoadDefaultConfig(ctx)
+		},
+	}
+}
+
+var (
+	defaultMu       sync.Mutex
+	defaultProvider *Provider
+)
+
+// Init replaces the process-level provider with one for the options. It is called once at startup, before the first
+// client is created
+func Init(options Options) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	defaultProvider = NewProvider(options)
+}
+
+// Default returns the process-level provider, with the default options when Init was not called
+func Default() *Provider {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultProvider == nil {
+		defaultProvider = NewProvider(Options{})
+	}
+
+	return defaultProvider
+}
+
+// Config returns the AWS config for the region and role of the target
+func (p *Provider) Config(ctx context.Context, target accounts.Target) (aws.Config, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.config(ctx, target)
+}
+
+// Client returns the client of the service for the target, built from its config on first use. The caller asserts
+// the type of the client it built
+func (p *Provider) Client(ctx context.Context, target accounts.Target, service string, build func(aws.Config) interface{}) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	clientKey := key{region: target.Region, roleARN: target.RoleARN, externalID: target.ExternalID, service: service}
+	if client, ok := p.clients[clientKey]; ok {
+		return client, nil
+	}
+
+	cfg, err := p.config(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	client := build(cfg)
+	p.clients[clientKey] = client
+
+	return client, nil
+}
+
+// config returns the cached config of the target. The caller must hold mu
+func (p *Provider) config(ctx context.Context, target accounts.Target) (aws.Config, error) {
+	logger := logging.WithContext(ctx)
+
+	configKey := key{region: target.Region, roleARN: target.RoleARN, externalID: target.ExternalID}
+	if cfg, ok := p.configs[configKey]; ok {
+		return cfg, nil
+	}
+
+	if p.base == nil {
+		base, err := p.loadBase(ctx)
+		if err != nil {
+			logger.Error("unable to load the default config for aws",
+				zap.Error(err))
+			return aws.Config{}, err
+		}
+		p.options.apply(&base)
+		p.base = &base
+	}
+
+	cfg := p.base.Copy()
+	if configKey.region != "" {
+		cfg.Region = configKey.region
+	}
+
+	if configKey.roleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(*p.base), configKey.roleARN, func(options *stscreds.AssumeRoleOptions) {
+			options.RoleSessionName = sessionName
+			if configKey.externalID != "" {
+				options.ExternalID = aws.String(configKey.externalID)
+			}
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+
+	p.configs[configKey] = cfg
+
+	return cfg, nil
+}
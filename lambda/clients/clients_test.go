@@ -0,0 +1,98 @@
+package clients
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmanikes/Nemesis/accounts"
+	"sync"
+	"testing"
+)
+
+func newTestProvider(options Options) (*Provider, *int) {
+	loads := 0
+	provider := NewProvider(options)
+	provider.loadBase = func(context.Context) (aws.Config, error) {
+		loads++
+		return aws.Config{Region: "us-east-1"}, nil
+	}
+
+	return provider, &loads
+}
+
+func TestProvider_Config(t *testing.T) {
+	ctx := context.Background()
+	provider, loads := newTestProvider(Options{})
+
+	local, err := provider.Config(ctx, accounts.Target{StreamName: "local"})
+	assert.NoError(t, err)
+	assert.Equal(t, "us-east-1", local.Region)
+	assert.Nil(t, local.Credentials)
+	assert.Equal(t, aws.RetryModeAdaptive, local.RetryMode)
+	assert.Equal(t, 5, local.RetryMaxAttempts)
+
+	orders, err := provider.Config(ctx, accounts.Target{StreamName: "orders", Region: "eu-west-1", RoleARN: "arn:aws:iam::111111111111:role/nemesis"})
+	assert.NoError(t, err)
+	assert.Equal(t, "eu-west-1", orders.Region)
+	assert.IsType(t, &aws.CredentialsCache{}, orders.Credentials)
+
+	// The streams of a role and region share the config and its cached credentials
+	clicks, err := provider.Config(ctx, accounts.Target{StreamName: "clicks", Region: "eu-west-1", RoleARN: "arn:aws:iam::111111111111:role/nemesis"})
+	assert.NoError(t, err)
+	assert.Same(t, orders.Credentials, clicks.Credentials)
+	assert.Equal(t, 1, *loads)
+}
+
+func TestProvider_Client(t *testing.T) {
+	ctx := context.Background()
+	provider, loads := newTestProvider(Options{})
+
+	builds := 0
+	build := func(cfg aws.Config) interface{} {
+		builds++
+		return &cfg
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := provider.Client(ctx, accounts.Target{Region: "eu-west-1"}, "kinesis", build)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	_, err := provider.Client(ctx, accounts.Target{Region: "eu-west-1"}, "cloudwatch", build)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, builds)
+	assert.Equal(t, 1, *loads)
+}
+
+func TestOptions(t *testing.T) {
+	ctx := context.Background()
+	provider, _ := newTestProvider(Options{
+		RetryMode:   "standard",
+		MaxAttempts: 3,
+		Endpoint:    "http://localhost:4566",
+		Endpoints:   map[string]string{"kinesis": "http://localhost:4567"},
+	})
+
+	cfg, err := provider.Config(ctx, accounts.Target{})
+	assert.NoError(t, err)
+	assert.Equal(t, aws.RetryModeStandard, cfg.RetryMode)
+	assert.Equal(t, 3, cfg.RetryMaxAttempts)
+
+	endpoint, err := cfg.EndpointResolverWithOptions.ResolveEndpoint("Kinesis", "us-east-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:4567", endpoint.URL)
+
+	endpoint, err = cfg.EndpointResolverWithOptions.ResolveEndpoint("CloudWatch", "us-east-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:4566", endpoint.URL)
+
+	assert.NoError(t, Options{}.Validate())
+	assert.Error(t, Options{RetryMode: "eventually"}.Validate())
+}
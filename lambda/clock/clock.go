@@ -0,0 +1,69 @@
+// Package clock contains the clock the scaling decisions read the time from, and the parsing and formatting of the
+// timestamps Nemesis reads from cloudwatch and writes to the alarm tags
+package clock
+
+import (
+	"fmt"
+	"time"
+)
+
+// LegacyLayout is the layout of the LastScaledTimestamp tag and of the StateChangeTime of the alarm notifications. The
+// zone is always UTC
+const LegacyLayout = "2006-01-02T15:04:05.000+0000"
+
+// Layout is the RFC 3339 layout Nemesis writes timestamps in, with milliseconds like the legacy layout
+const Layout = "2006-01-02T15:04:05.000Z07:00"
+
+// layouts are the timestamp layouts Parse accepts. Cloudwatch sends StateChangeTime with milliseconds and a +0000
+// offset, the API and the console use RFC 3339 with or without fractional seconds
+var layouts = []string{
+	"2006-01-02T15:04:05.999999999-0700",
+	"2006-01-02T15:04:05-0700",
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+}
+
+// Clock tells the time
+type Clock interface {
+	Now() time.Time
+}
+
+// System is the clock of the machine, in UTC
+var System Clock = systemClock{}
+
+type systemClock struct{}
+
+// Now returns the current time in UTC
+func (systemClock) Now() time.Time {
+	return time.Now().UTC()
+}
+
+// Fixed is a clock that always tells the same time
+type Fixed time.Time
+
+// Now returns the time of the clock in UTC
+func (f Fixed) Now() time.Time {
+	return time.Time(f).UTC()
+}
+
+// Parse reads a timestamp in any of the layouts cloudwatch uses and returns it in UTC. A timestamp without an offset is
+// taken to be in UTC
+func Parse(value string) (time.Time, error) {
+	for _, layout := range layouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed.UTC(), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unsupported timestamp %q", value)
+}
+
+// Format writes the time in Layout in UTC
+func Format(t time.Time) string {
+	return t.UTC().Format(Layout)
+}
+
+// FormatLegacy writes the time in LegacyLayout
+func FormatLegacy(t time.Time) string {
+	return t.UTC().Format(LegacyLayout)
+}
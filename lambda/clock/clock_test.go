@@ -0,0 +1,46 @@
+package clock
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	expected := time.Date(2020, 4, 23, 21, 17, 44, 775000000, time.UTC)
+
+	for _, value := range []string{
+		"2020-04-23T21:17:44.775+0000",
+		"2020-04-23T21:17:44.775Z",
+		"2020-04-23T21:17:44.775+00:00",
+		"2020-04-23T23:17:44.775+0200",
+		"2020-04-23T17:17:44.775-04:00",
+		"2020-04-23T21:17:44.775",
+	} {
+		parsed, err := Parse(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, parsed, value)
+		assert.Equal(t, time.UTC, parsed.Location(), value)
+	}
+
+	parsed, err := Parse("2020-04-23T21:17:44Z")
+	assert.NoError(t, err)
+	assert.Equal(t, expected.Truncate(time.Second), parsed)
+
+	parsed, err = Parse("2020-04-23T21:17:44+0000")
+	assert.NoError(t, err)
+	assert.Equal(t, expected.Truncate(time.Second), parsed)
+
+	for _, value := range []string{"", "yesterday", "2020-04-23", "23/04/2020 21:17"} {
+		_, err = Parse(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	at := time.Date(2020, 4, 23, 23, 17, 44, 775000000, time.FixedZone("CEST", 2*60*60))
+
+	assert.Equal(t, "2020-04-23T21:17:44.775Z", Format(at))
+	assert.Equal(t, "2020-04-23T21:17:44.775+0000", FormatLegacy(at))
+	assert.Equal(t, at.UTC(), Fixed(at).Now())
+}
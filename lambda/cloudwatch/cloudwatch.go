@@ -5,73 +5,130 @@ import (
 	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
 	kinesis "github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/vmanikes/Nemesis/accounts"
+	"github.com/vmanikes/Nemesis/clients"
 	"github.com/vmanikes/Nemesis/constants"
 	"github.com/vmanikes/Nemesis/logging"
 	"go.uber.org/zap"
+	"sort"
 	"strconv"
 	"strings"
 )
 
+// API is the part of the cloudwatch API that Nemesis uses
+type API interface {
+	DeleteAlarms(ctx context.Context, params *cloudwatch.DeleteAlarmsInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.DeleteAlarmsOutput, error)
+	DescribeAlarms(ctx context.Context, params *cloudwatch.DescribeAlarmsInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.DescribeAlarmsOutput, error)
+	GetMetricData(ctx context.Context, params *cloudwatch.GetMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.GetMetricDataOutput, error)
+	ListTagsForResource(ctx context.Context, params *cloudwatch.ListTagsForResourceInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.ListTagsForResourceOutput, error)
+	PutMetricAlarm(ctx context.Context, params *cloudwatch.PutMetricAlarmInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricAlarmOutput, error)
+	SetAlarmState(ctx context.Context, params *cloudwatch.SetAlarmStateInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.SetAlarmStateOutput, error)
+	TagResource(ctx context.Context, params *cloudwatch.TagResourceInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.TagResourceOutput, error)
+	UntagResource(ctx context.Context, params *cloudwatch.UntagResourceInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.UntagResourceOutput, error)
+}
+
 type Client struct {
-	cloudwatchClient *cloudwatch.Client
+	cloudwatchClient API
 }
 
-// New creates and initialized the cloudwatch client
+// New returns the cloudwatch client of the account and region Nemesis runs in
 func New(ctx context.Context) (*Client, error) {
-	logger := logging.WithContext(ctx)
-	cfg, err := config.LoadDefaultConfig(ctx)
+	return NewFor(ctx, accounts.Target{})
+}
+
+// NewFor returns the cloudwatch client of the account and region of the target. The clients are built once per process
+// and shared
+func NewFor(ctx context.Context, target accounts.Target) (*Client, error) {
+	client, err := clients.Default().Client(ctx, target, "cloudwatch", func(cfg aws.Config) interface{} {
+		return NewFromConfig(cfg)
+	})
 	if err != nil {
-		logger.Error("unable to load the default config for aws")
 		return nil, err
 	}
 
+	return client.(*Client), nil
+}
+
+// NewFromConfig creates the client from an existing aws config, e.g. the config of another account or region
+func NewFromConfig(cfg aws.Config) *Client {
+	return NewFromAPI(cloudwatch.NewFromConfig(cfg))
+}
+
+// NewFromAPI creates the client on top of an existing cloudwatch API implementation
+func NewFromAPI(api API) *Client {
 	return &Client{
-		cloudwatchClient: cloudwatch.NewFromConfig(cfg),
-	}, nil
+		cloudwatchClient: api,
+	}
 }
 
 // GetAlarmNames takes in the triggered alarm name and ARN. It returns the scale up and scale down alarm names along with
-// the action
-func (c *Client) GetAlarmNames(ctx context.Context, currentAlarmName, currentAlarmArn string) (
-	scaleUpAlarmName, scaleDownAlarmName, currentAction, lastAlarmActionTimestamp string, err error){
+// the action and the metadata of the alarm. The pair and the action come from the ScaleAction and ComplimentaryAlarm
+// tags of the alarm, the throttling alarm is paired with the scale-up alarm and triggers the Emergency action. Alarms
+// without these tags are matched against the naming, and alarms that match neither have an empty action. Metadata in
+// an older tag layout is written again in the current one
+func (c *Client) GetAlarmNames(ctx context.Context, currentAlarmName, currentAlarmArn string, naming AlarmNaming) (
+	scaleUpAlarmName, scaleDownAlarmName, currentAction string, metadata AlarmMetadata, err error) {
 
 	logger := logging.WithContext(ctx)
-	response, err := c.cloudwatchClient.ListTagsForResource(ctx, &cloudwatch.ListTagsForResourceInput{
-		ResourceARN: aws.String(currentAlarmArn),
-	})
+
+	tags, err := c.GetAlarmTags(ctx, currentAlarmArn)
 	if err != nil {
-		logger.Error("unable to list tags for resource",
-			zap.String("alarm-name", currentAlarmName),
-			zap.String("alarm-arn", currentAlarmArn))
-		return "", "", "", "", err
+		return "", "", "", AlarmMetadata{}, err
 	}
 
-	var (
-		scaleDownSuffix = "-scale-down"
-		scaleUpSuffix = "-scale-up"
-	)
+	// Broken metadata does not block the scaling, the pairing tags are read before anything that can fail
+	metadata, err = ParseMetadata(tags)
+	if err != nil {
+		logger.Error("invalid alarm metadata",
+			zap.String("alarm-name", currentAlarmName),
+			zap.Error(err))
+		metadata.Version = 0
+	}
 
-	if strings.HasSuffix(currentAlarmName, scaleUpSuffix) {
-		currentAction = "Up"
-		scaleUpAlarmName = currentAlarmName
-		scaleDownAlarmName = currentAlarmName[0:len(currentAlarmName)-len(scaleUpSuffix)] + scaleDownSuffix
-	} else if strings.HasSuffix(currentAlarmName, scaleDownSuffix) {
-		currentAction = "Down"
-		scaleUpAlarmName = currentAlarmName[0:len(currentAlarmName)-len(scaleDownSuffix)] + scaleUpSuffix
-		scaleDownAlarmName = currentAlarmName
+	// The migration is best effort, the next scaling action writes the current layout anyway
+	if metadata.Migrated() {
+		err = c.SetAlarmTags(ctx, currentAlarmArn, metadata.Tags())
+		if err == nil {
+			logger.Info("migrated alarm metadata",
+				zap.String("alarm-name", currentAlarmName),
+				zap.Int("from-version", metadata.Version),
+				zap.Int("to-version", MetadataVersion))
+		}
 	}
 
-	for _, tag := range response.Tags {
-		if aws.ToString(tag.Key) == "LastScaledTimestamp" {
-			lastAlarmActionTimestamp = aws.ToString(tag.Value)
+	currentAction, complementary := metadata.ScaleAction, metadata.ComplimentaryAlarm
+
+	if complementary != "" {
+		switch currentAction {
+		case "Up":
+			return currentAlarmName, complementary, currentAction, metadata, nil
+		case "Down":
+			return complementary, currentAlarmName, currentAction, metadata, nil
+		case "Emergency":
+			scaleDownAlarmName, err = c.complementaryAlarm(ctx, complementary)
+			if err != nil {
+				return "", "", "", AlarmMetadata{}, err
+			}
+			if scaleDownAlarmName != "" {
+				return complementary, scaleDownAlarmName, currentAction, metadata, nil
+			}
 		}
 	}
 
-	return scaleUpAlarmName, scaleDownAlarmName, currentAction, lastAlarmActionTimestamp, nil
+	streamName, action, ok := naming.Match(currentAlarmName)
+	if !ok {
+		return "", "", "", metadata, nil
+	}
+	if currentAction == "" {
+		currentAction = action
+	}
+
+	scaleUpAlarmName, scaleDownAlarmName = naming.Names(streamName)
+
+	return scaleUpAlarmName, scaleDownAlarmName, currentAction, metadata, nil
 }
 
 // SetAlarmState takes alarm name, state and reason and changes the state of the alarm
@@ -79,9 +136,9 @@ func (c *Client) SetAlarmState(ctx context.Context, alarmName, state, reason str
 	logger := logging.WithContext(ctx)
 
 	_, err := c.cloudwatchClient.SetAlarmState(ctx, &cloudwatch.SetAlarmStateInput{
-		AlarmName:       aws.String(alarmName),
-		StateReason:     &reason,
-		StateValue: types.StateValue(state),
+		AlarmName:   aws.String(alarmName),
+		StateReason: &reason,
+		StateValue:  types.StateValue(state),
 	})
 	if err != nil {
 		logger.Error("unable to set alarm state",
@@ -92,23 +149,81 @@ func (c *Client) SetAlarmState(ctx context.Context, alarmName, state, reason str
 	return nil
 }
 
+// ReadSide configures the optional read-side usage factors of the alarms
+type ReadSide struct {
+	// Enabled folds the read-side usage factors into MaxIncomingUsageFactor
+	Enabled bool `json:"enabled"`
+	// StandardConsumers is the number of standard consumers registered against the stream. They share the 2 MB/s
+	// per shard read limit, so every one of them reads the incoming bytes again. Enhanced fan-out consumers have their
+	// own throughput and are not counted
+	StandardConsumers int `json:"standardConsumers"`
+}
+
+// AlarmSettings are the period, evaluation periods, datapoints and thresholds of the scaling alarms of a stream
+type AlarmSettings struct {
+	ScalePeriodMinutes         int64
+	ScaleUpEvaluationPeriods   int64
+	ScaleDownEvaluationPeriods int64
+	DataPointsToScaleUp        int64
+	DataPointsToScaleDown      int64
+	ScaleUpThreshold           float64
+	// ScaleDownThreshold is -1 for a stream at its minimum shard count, so that the scale-down alarm stays in OK
+	ScaleDownThreshold         float64
+	ScaleDownMinIterAgeMinutes int64
+}
+
+// DefaultAlarmSettings returns the settings of the current constants
+func DefaultAlarmSettings() AlarmSettings {
+	return AlarmSettings{
+		ScalePeriodMinutes:         constants.ScalePeriodMinutes,
+		ScaleUpEvaluationPeriods:   constants.ScaleUpEvaluationPeriodMinutes,
+		ScaleDownEvaluationPeriods: constants.ScaleDownEvaluationPeriodMinutes,
+		DataPointsToScaleUp:        constants.DataPointsToScaleUp,
+		DataPointsToScaleDown:      constants.DataPointsToScaleDown,
+		ScaleUpThreshold:           constants.ScaleUpThreshold,
+		ScaleDownThreshold:         constants.ScaleDownThreshold,
+		ScaleDownMinIterAgeMinutes: constants.ScaleDownMinIterAgeMinutes,
+	}
+}
+
 // UpdateAlarm updates the alarm metrics with the new shard count
-func (c *Client) UpdateAlarm(ctx context.Context, alarmName, streamName, snsARN string, isScaleDown bool, shardCount int) error {
+func (c *Client) UpdateAlarm(ctx context.Context, alarmName, streamName, snsARN string, isScaleDown bool, shardCount int, readSide ReadSide, settings AlarmSettings) error {
 	logger := logging.WithContext(ctx)
 
+	input, err := BuildAlarmInput(alarmName, streamName, snsARN, isScaleDown, shardCount, readSide, settings)
+	if err != nil {
+		logger.Error("invalid alarm metric math",
+			zap.String("alarm-name", alarmName),
+			zap.Error(err))
+		return err
+	}
+
+	_, err = c.cloudwatchClient.PutMetricAlarm(ctx, input)
+	if err != nil {
+		logger.Error("unable to update alarm",
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// BuildAlarmInput builds the definition UpdateAlarm puts for the alarm, from the settings. It fails when the metric
+// math of the definition does not compile
+func BuildAlarmInput(alarmName, streamName, snsARN string, isScaleDown bool, shardCount int, readSide ReadSide, settings AlarmSettings) (*cloudwatch.PutMetricAlarmInput, error) {
 	input := &cloudwatch.PutMetricAlarmInput{
-		AlarmName:          aws.String(alarmName),
-		AlarmDescription:   aws.String("Alarm to scale Kinesis stream"),
-		ActionsEnabled:     aws.Bool(true),
-		AlarmActions:       []string{snsARN},
-		TreatMissingData:   aws.String("ignore"),
+		AlarmName:        aws.String(alarmName),
+		AlarmDescription: aws.String("Alarm to scale Kinesis stream"),
+		ActionsEnabled:   aws.Bool(true),
+		AlarmActions:     []string{snsARN},
+		TreatMissingData: aws.String("ignore"),
 	}
 
 	metrics := make([]types.MetricDataQuery, 0)
 
 	metrics = append(metrics, types.MetricDataQuery{
-		Id:         aws.String("m1"),
-		Label:      aws.String(string(kinesis.MetricsNameIncomingBytes)),
+		Id:    aws.String("m1"),
+		Label: aws.String(string(kinesis.MetricsNameIncomingBytes)),
 		MetricStat: &types.MetricStat{
 			Metric: &types.Metric{
 				Dimensions: []types.Dimension{
@@ -120,15 +235,15 @@ func (c *Client) UpdateAlarm(ctx context.Context, alarmName, streamName, snsARN
 				MetricName: aws.String(string(kinesis.MetricsNameIncomingBytes)),
 				Namespace:  aws.String("AWS/Kinesis"),
 			},
-			Period: aws.Int32(int32(60 * constants.ScalePeriodMinutes)),
+			Period: aws.Int32(int32(60 * settings.ScalePeriodMinutes)),
 			Stat:   aws.String(string(types.StatisticSum)),
 		},
 		ReturnData: aws.Bool(false),
 	})
 
 	metrics = append(metrics, types.MetricDataQuery{
-		Id:         aws.String("m2"),
-		Label:      aws.String(string(kinesis.MetricsNameIncomingRecords)),
+		Id:    aws.String("m2"),
+		Label: aws.String(string(kinesis.MetricsNameIncomingRecords)),
 		MetricStat: &types.MetricStat{
 			Metric: &types.Metric{
 				Dimensions: []types.Dimension{
@@ -140,16 +255,19 @@ func (c *Client) UpdateAlarm(ctx context.Context, alarmName, streamName, snsARN
 				MetricName: aws.String(string(kinesis.MetricsNameIncomingRecords)),
 				Namespace:  aws.String("AWS/Kinesis"),
 			},
-			Period: aws.Int32(int32(60 * constants.ScalePeriodMinutes)),
+			Period: aws.Int32(int32(60 * settings.ScalePeriodMinutes)),
 			Stat:   aws.String(string(types.StatisticSum)),
 		},
 		ReturnData: aws.Bool(false),
 	})
 
+	// usageFactors are the expressions e6 takes the maximum of
+	usageFactors := []string{"e3", "e4"}
+
 	if isScaleDown {
-		input.Threshold = aws.Float64(constants.ScaleDownThreshold)
-		input.DatapointsToAlarm = aws.Int32(int32(constants.DataPointsToScaleDown))
-		input.EvaluationPeriods = aws.Int32(int32(constants.ScaleDownEvaluationPeriodMinutes))
+		input.Threshold = aws.Float64(settings.ScaleDownThreshold)
+		input.DatapointsToAlarm = aws.Int32(int32(settings.DataPointsToScaleDown))
+		input.EvaluationPeriods = aws.Int32(int32(settings.ScaleDownEvaluationPeriods))
 		input.ComparisonOperator = types.ComparisonOperatorLessThanThreshold
 
 		metrics = append(metrics, types.MetricDataQuery{
@@ -167,46 +285,51 @@ func (c *Client) UpdateAlarm(ctx context.Context, alarmName, streamName, snsARN
 						},
 					},
 				},
-				Period: aws.Int32(int32(60 * constants.ScalePeriodMinutes)),
+				Period: aws.Int32(int32(60 * settings.ScalePeriodMinutes)),
 				Stat:   aws.String(string(types.StatisticMaximum)),
 			},
 		})
 
 		metrics = append(metrics, types.MetricDataQuery{
 			Id:         aws.String("e5"),
-			Expression: aws.String(fmt.Sprintf("(FILL(m3,0)/1000/60)*(%0.5f/s2)", constants.ScaleDownThreshold)),
+			Expression: aws.String(fmt.Sprintf("(FILL(m3,0)/1000/60)*(%0.5f/s2)", settings.ScaleDownThreshold)),
 			Label:      aws.String("IteratorAgeAdjustedFactor"),
 			ReturnData: aws.Bool(false),
 		})
 
-		metrics = append(metrics, types.MetricDataQuery{
-			Id:         aws.String("e6"),
-			Expression: aws.String("MAX([e3,e4,e5])"),
-			Label:      aws.String("MaxIncomingUsageFactor"),
-			ReturnData: aws.Bool(true),
-		})
+		usageFactors = append(usageFactors, "e5")
 
 		metrics = append(metrics, types.MetricDataQuery{
 			Id:         aws.String("s2"),
-			Expression: aws.String(fmt.Sprintf("%d", constants.ScaleDownMinIterAgeMinutes)),
+			Expression: aws.String(fmt.Sprintf("%d", settings.ScaleDownMinIterAgeMinutes)),
 			Label:      aws.String("IteratorAgeMinutesToBlockScaleDowns"),
 			ReturnData: aws.Bool(false),
 		})
 
 	} else {
-		input.Threshold = aws.Float64(constants.ScaleUpThreshold)
-		input.DatapointsToAlarm = aws.Int32(int32(constants.DataPointsToScaleUp))
-		input.EvaluationPeriods = aws.Int32(int32(constants.ScaleUpEvaluationPeriodMinutes))
+		input.Threshold = aws.Float64(settings.ScaleUpThreshold)
+		input.DatapointsToAlarm = aws.Int32(int32(settings.DataPointsToScaleUp))
+		input.EvaluationPeriods = aws.Int32(int32(settings.ScaleUpEvaluationPeriods))
 		input.ComparisonOperator = types.ComparisonOperatorGreaterThanOrEqualToThreshold
 
-		metrics = append(metrics, types.MetricDataQuery{
-			Id:         aws.String("e6"),
-			Expression: aws.String("MAX([e3,e4])"), // Scale up doesn't look at iterator age, only bytes/sec, records/sec
-			Label:      aws.String("MaxIncomingUsageFactor"),
-			ReturnData: aws.Bool(true),
-		})
+		// Scale up doesn't look at iterator age, only bytes/sec, records/sec
+	}
+
+	if readSide.Enabled {
+		metrics = append(metrics, readSideMetrics(streamName, readSide, settings.ScalePeriodMinutes)...)
+		usageFactors = append(usageFactors, "e7", "e9")
+		if readSide.StandardConsumers > 0 {
+			usageFactors = append(usageFactors, "e8")
+		}
 	}
 
+	metrics = append(metrics, types.MetricDataQuery{
+		Id:         aws.String("e6"),
+		Expression: aws.String(fmt.Sprintf("MAX([%s])", strings.Join(usageFactors, ","))),
+		Label:      aws.String("MaxIncomingUsageFactor"),
+		ReturnData: aws.Bool(true),
+	})
+
 	metrics = append(metrics, types.MetricDataQuery{
 		Id:         aws.String("e1"),
 		Expression: aws.String("FILL(m1,0)"),
@@ -221,13 +344,13 @@ func (c *Client) UpdateAlarm(ctx context.Context, alarmName, streamName, snsARN
 	})
 	metrics = append(metrics, types.MetricDataQuery{
 		Id:         aws.String("e3"),
-		Expression: aws.String(fmt.Sprintf("e1/(1024*1024*60*%d*s1)", constants.ScalePeriodMinutes)),
+		Expression: aws.String(fmt.Sprintf("e1/(1024*1024*60*%d*s1)", settings.ScalePeriodMinutes)),
 		Label:      aws.String("IncomingBytesUsageFactor"),
 		ReturnData: aws.Bool(false),
 	})
 	metrics = append(metrics, types.MetricDataQuery{
 		Id:         aws.String("e4"),
-		Expression: aws.String(fmt.Sprintf("e2/(1000*60*%d*s1)", constants.ScalePeriodMinutes)),
+		Expression: aws.String(fmt.Sprintf("e2/(1000*60*%d*s1)", settings.ScalePeriodMinutes)),
 		Label:      aws.String("IncomingRecordsUsageFactor"),
 		ReturnData: aws.Bool(false),
 	})
@@ -242,14 +365,90 @@ func (c *Client) UpdateAlarm(ctx context.Context, alarmName, streamName, snsARN
 
 	input.Metrics = metrics
 
-	_, err := c.cloudwatchClient.PutMetricAlarm(ctx, input)
+	_, err := CompileMetrics(metrics)
 	if err != nil {
-		logger.Error("unable to update alarm",
-			zap.Error(err))
-		return err
+		return nil, err
 	}
 
-	return nil
+	return input, nil
+}
+
+// readSideMetrics returns the metrics and expressions for the read-side usage factors. Reads are limited to 2 MB/s and
+// 5 GetRecords calls per second per shard
+func readSideMetrics(streamName string, readSide ReadSide, scalePeriodMinutes int64) []types.MetricDataQuery {
+	metrics := make([]types.MetricDataQuery, 0)
+
+	metrics = append(metrics, types.MetricDataQuery{
+		Id:         aws.String("m4"),
+		Label:      aws.String("GetRecords.Bytes"),
+		ReturnData: aws.Bool(false),
+		MetricStat: &types.MetricStat{
+			Metric: &types.Metric{
+				Namespace:  aws.String("AWS/Kinesis"),
+				MetricName: aws.String("GetRecords.Bytes"),
+				Dimensions: []types.Dimension{
+					{
+						Name:  aws.String("StreamName"),
+						Value: aws.String(streamName),
+					},
+				},
+			},
+			Period: aws.Int32(int32(60 * scalePeriodMinutes)),
+			Stat:   aws.String(string(types.StatisticSum)),
+		},
+	})
+
+	metrics = append(metrics, types.MetricDataQuery{
+		Id:         aws.String("m5"),
+		Label:      aws.String("ReadProvisionedThroughputExceeded"),
+		ReturnData: aws.Bool(false),
+		MetricStat: &types.MetricStat{
+			Metric: &types.Metric{
+				Namespace:  aws.String("AWS/Kinesis"),
+				MetricName: aws.String("ReadProvisionedThroughputExceeded"),
+				Dimensions: []types.Dimension{
+					{
+						Name:  aws.String("StreamName"),
+						Value: aws.String(streamName),
+					},
+				},
+			},
+			Period: aws.Int32(int32(60 * scalePeriodMinutes)),
+			Stat:   aws.String(string(types.StatisticSum)),
+		},
+	})
+
+	metrics = append(metrics, types.MetricDataQuery{
+		Id:         aws.String("e7"),
+		Expression: aws.String(fmt.Sprintf("FILL(m4,0)/(2*1024*1024*60*%d*s1)", scalePeriodMinutes)),
+		Label:      aws.String("OutgoingBytesUsageFactor"),
+		ReturnData: aws.Bool(false),
+	})
+
+	metrics = append(metrics, types.MetricDataQuery{
+		Id:         aws.String("e9"),
+		Expression: aws.String(fmt.Sprintf("FILL(m5,0)/(5*60*%d*s1)", scalePeriodMinutes)),
+		Label:      aws.String("ReadThrottleUsageFactor"),
+		ReturnData: aws.Bool(false),
+	})
+
+	if readSide.StandardConsumers > 0 {
+		metrics = append(metrics, types.MetricDataQuery{
+			Id:         aws.String("e8"),
+			Expression: aws.String("e3*s3/2"),
+			Label:      aws.String("ConsumerFanOutUsageFactor"),
+			ReturnData: aws.Bool(false),
+		})
+
+		metrics = append(metrics, types.MetricDataQuery{
+			Id:         aws.String("s3"),
+			Expression: aws.String(strconv.Itoa(readSide.StandardConsumers)),
+			Label:      aws.String("StandardConsumerCount"),
+			ReturnData: aws.Bool(false),
+		})
+	}
+
+	return metrics
 }
 
 // GetAlarmArns takes in the scale up and scale dpwn alarm names and returns their arns
@@ -266,7 +465,7 @@ func (c *Client) GetAlarmArns(ctx context.Context, scaleUpAlarmName, scaleDownAl
 	}
 
 	var (
-		scaleUpAlarmArn string
+		scaleUpAlarmArn   string
 		scaleDownAlarmArn string
 	)
 
@@ -290,15 +489,15 @@ func (c *Client) TagAlarm(ctx context.Context, alarmArn, actionValue, alarmName,
 		ResourceARN: &alarmArn,
 		Tags: []types.Tag{
 			{
-				Key:   aws.String("ScaleAction"),
+				Key:   aws.String(ScaleActionTag),
 				Value: &actionValue,
 			},
 			{
-				Key:   aws.String("ComplimentaryAlarm"),
+				Key:   aws.String(ComplimentaryAlarmTag),
 				Value: &alarmName,
 			},
 			{
-				Key:   aws.String("LastScaledTimestamp"),
+				Key:   aws.String(LastScaledTag),
 				Value: &lastScaleTimestamp,
 			},
 		},
@@ -310,4 +509,82 @@ func (c *Client) TagAlarm(ctx context.Context, alarmArn, actionValue, alarmName,
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// DescribeAlarms returns the definitions and states of the metric alarms with the given names, or of every metric
+// alarm when no names are given
+func (c *Client) DescribeAlarms(ctx context.Context, alarmNames ...string) ([]types.MetricAlarm, error) {
+	logger := logging.WithContext(ctx)
+
+	paginator := cloudwatch.NewDescribeAlarmsPaginator(c.cloudwatchClient, &cloudwatch.DescribeAlarmsInput{
+		AlarmNames: alarmNames,
+	})
+
+	alarms := make([]types.MetricAlarm, 0)
+	for paginator.HasMorePages() {
+		response, err := paginator.NextPage(ctx)
+		if err != nil {
+			logger.Error("unable to describe alarms",
+				zap.Strings("alarm-names", alarmNames),
+				zap.Error(err))
+			return nil, err
+		}
+
+		alarms = append(alarms, response.MetricAlarms...)
+	}
+
+	return alarms, nil
+}
+
+// GetAlarmTags returns the tags of the alarm
+func (c *Client) GetAlarmTags(ctx context.Context, alarmArn string) (map[string]string, error) {
+	logger := logging.WithContext(ctx)
+
+	response, err := c.cloudwatchClient.ListTagsForResource(ctx, &cloudwatch.ListTagsForResourceInput{
+		ResourceARN: aws.String(alarmArn),
+	})
+	if err != nil {
+		logger.Error("unable to list tags for resource",
+			zap.String("alarm-arn", alarmArn),
+			zap.Error(err))
+		return nil, err
+	}
+
+	tags := make(map[string]string, len(response.Tags))
+	for _, tag := range response.Tags {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	return tags, nil
+}
+
+// SetAlarmTags adds the tags to the alarm, overwriting the values of existing keys
+func (c *Client) SetAlarmTags(ctx context.Context, alarmArn string, tags map[string]string) error {
+	logger := logging.WithContext(ctx)
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	input := &cloudwatch.TagResourceInput{
+		ResourceARN: aws.String(alarmArn),
+	}
+	for _, key := range keys {
+		input.Tags = append(input.Tags, types.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(tags[key]),
+		})
+	}
+
+	_, err := c.cloudwatchClient.TagResource(ctx, input)
+	if err != nil {
+		logger.Error("unable to tag alarm",
+			zap.String("alarm-arn", alarmArn),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
@@ -1 +1,256 @@
 package cloudwatch
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmanikes/Nemesis/metricmath"
+	"github.com/vmanikes/Nemesis/nemesistest"
+	"testing"
+	"time"
+)
+
+func TestReadSideMetrics(t *testing.T) {
+	ids := func(readSide ReadSide) []string {
+		result := make([]string, 0)
+		for _, metric := range readSideMetrics("test-stream", readSide, 5) {
+			result = append(result, aws.ToString(metric.Id))
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"m4", "m5", "e7", "e9"}, ids(ReadSide{Enabled: true}))
+	assert.Equal(t, []string{"m4", "m5", "e7", "e9", "e8", "s3"}, ids(ReadSide{Enabled: true, StandardConsumers: 3}))
+}
+
+func TestClient_GetAlarmNames(t *testing.T) {
+	fake := nemesistest.NewCloudWatch()
+	fake.AddAlarm(cloudwatch.PutMetricAlarmInput{AlarmName: aws.String("stream-scale-down")}, types.StateValueAlarm,
+		map[string]string{"LastScaledTimestamp": "2020-04-23T21:16:44.775+0000"})
+	fake.AddAlarm(cloudwatch.PutMetricAlarmInput{AlarmName: aws.String("stream-scale-up-throttling")}, types.StateValueAlarm, nil)
+
+	client := NewFromAPI(fake)
+
+	scaleUp, scaleDown, action, metadata, err := client.GetAlarmNames(context.Background(), "stream-scale-down", nemesistest.AlarmArn("stream-scale-down"), AlarmNaming{})
+	assert.NoError(t, err)
+	assert.Equal(t, "stream-scale-up", scaleUp)
+	assert.Equal(t, "stream-scale-down", scaleDown)
+	assert.Equal(t, "Down", action)
+	assert.Equal(t, "2020-04-23T21:16:44.775Z", metadata.LastScaled())
+
+	// The metadata of the older layout is written again in the current one
+	alarm, _ := fake.Alarm("stream-scale-down")
+	assert.Equal(t, map[string]string{
+		MetadataVersionTag: "3",
+		LastScaledTag:      "2020-04-23T21:16:44.775+0000",
+		LastScaledAtTag:    "2020-04-23T21:16:44.775Z",
+	}, alarm.Tags)
+
+	scaleUp, scaleDown, action, _, err = client.GetAlarmNames(context.Background(), "stream-scale-up-throttling", nemesistest.AlarmArn("stream-scale-up-throttling"), AlarmNaming{})
+	assert.NoError(t, err)
+	assert.Equal(t, "stream-scale-up", scaleUp)
+	assert.Equal(t, "stream-scale-down", scaleDown)
+	assert.Equal(t, "Emergency", action)
+
+	_, _, _, _, err = client.GetAlarmNames(context.Background(), "missing-scale-up", nemesistest.AlarmArn("missing-scale-up"), AlarmNaming{})
+	assert.Error(t, err)
+}
+
+func TestClient_GetAlarmNamesFromTags(t *testing.T) {
+	fake := nemesistest.NewCloudWatch()
+	fake.AddAlarm(cloudwatch.PutMetricAlarmInput{AlarmName: aws.String("orders high throughput")}, types.StateValueAlarm,
+		map[string]string{ScaleActionTag: "Up", ComplimentaryAlarmTag: "orders low throughput"})
+	fake.AddAlarm(cloudwatch.PutMetricAlarmInput{AlarmName: aws.String("orders throttled")}, types.StateValueAlarm,
+		map[string]string{ScaleActionTag: "Emergency", ComplimentaryAlarmTag: "orders high throughput"})
+	fake.AddAlarm(cloudwatch.PutMetricAlarmInput{AlarmName: aws.String("kinesis-payments-down")}, types.StateValueAlarm, nil)
+
+	client := NewFromAPI(fake)
+	ctx := context.Background()
+
+	scaleUp, scaleDown, action, _, err := client.GetAlarmNames(ctx, "orders high throughput", nemesistest.AlarmArn("orders high throughput"), AlarmNaming{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders high throughput", "orders low throughput", "Up"}, []string{scaleUp, scaleDown, action})
+
+	// The throttling alarm is paired with the scale-up alarm, which is paired with the scale-down alarm
+	scaleUp, scaleDown, action, _, err = client.GetAlarmNames(ctx, "orders throttled", nemesistest.AlarmArn("orders throttled"), AlarmNaming{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders high throughput", "orders low throughput", "Emergency"}, []string{scaleUp, scaleDown, action})
+
+	naming := AlarmNaming{ScaleUp: "kinesis-{stream}-up", ScaleDown: "kinesis-{stream}-down", Throttling: "kinesis-{stream}-throttled"}
+	scaleUp, scaleDown, action, _, err = client.GetAlarmNames(ctx, "kinesis-payments-down", nemesistest.AlarmArn("kinesis-payments-down"), naming)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"kinesis-payments-up", "kinesis-payments-down", "Down"}, []string{scaleUp, scaleDown, action})
+
+	_, _, action, _, err = client.GetAlarmNames(ctx, "kinesis-payments-down", nemesistest.AlarmArn("kinesis-payments-down"), AlarmNaming{})
+	assert.NoError(t, err)
+	assert.Empty(t, action)
+}
+
+func TestClient_StreamAlarmNames(t *testing.T) {
+	fake := nemesistest.NewCloudWatch()
+	for _, alarm := range []struct {
+		name, action, complementary string
+		scaleDown                   bool
+	}{
+		{"orders high throughput", "Up", "orders low throughput", false},
+		{"orders low throughput", "Down", "orders high throughput", true},
+	} {
+		input, err := BuildAlarmInput(alarm.name, "orders", "arn:aws:sns:us-east-1:123456789012:nemesis", alarm.scaleDown, 2, ReadSide{}, DefaultAlarmSettings())
+		assert.NoError(t, err)
+		fake.AddAlarm(*input, types.StateValueOk, map[string]string{ScaleActionTag: alarm.action, ComplimentaryAlarmTag: alarm.complementary})
+	}
+
+	client := NewFromAPI(fake)
+	ctx := context.Background()
+
+	scaleUp, scaleDown, err := client.StreamAlarmNames(ctx, "orders", AlarmNaming{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders high throughput", "orders low throughput"}, []string{scaleUp, scaleDown})
+
+	// A stream without tagged alarms falls back to the naming
+	scaleUp, scaleDown, err = client.StreamAlarmNames(ctx, "payments", AlarmNaming{ScaleUp: "kinesis-{stream}-up", ScaleDown: "kinesis-{stream}-down"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"kinesis-payments-up", "kinesis-payments-down"}, []string{scaleUp, scaleDown})
+}
+
+func TestAlarmNaming(t *testing.T) {
+	naming := AlarmNaming{ScaleUp: "scale-up-{stream}", Throttling: "scale-up-throttling-{stream}"}
+
+	streamName, action, ok := naming.Match("scale-up-throttling-orders")
+	assert.True(t, ok)
+	assert.Equal(t, "orders", streamName)
+	assert.Equal(t, "Emergency", action)
+
+	streamName, action, ok = naming.Match("orders-scale-down")
+	assert.True(t, ok)
+	assert.Equal(t, "orders", streamName)
+	assert.Equal(t, "Down", action)
+
+	_, _, ok = naming.Match("scale-up-")
+	assert.False(t, ok)
+
+	assert.NoError(t, naming.Validate())
+	assert.Error(t, AlarmNaming{ScaleUp: "scale-up"}.Validate())
+	assert.Error(t, AlarmNaming{ScaleUp: "{stream}-scale-down"}.Validate())
+}
+
+func TestClient_UpdateAlarm(t *testing.T) {
+	fake := nemesistest.NewCloudWatch()
+	client := NewFromAPI(fake)
+
+	err := client.UpdateAlarm(context.Background(), "stream-scale-up", "stream", "arn:aws:sns:us-east-1:123456789012:topic", false, 8, ReadSide{}, DefaultAlarmSettings())
+	assert.NoError(t, err)
+
+	alarm, ok := fake.Alarm("stream-scale-up")
+	assert.True(t, ok)
+	assert.Equal(t, types.ComparisonOperatorGreaterThanOrEqualToThreshold, alarm.Definition.ComparisonOperator)
+
+	expressions := make(map[string]string)
+	for _, metric := range alarm.Definition.Metrics {
+		expressions[aws.ToString(metric.Id)] = aws.ToString(metric.Expression)
+	}
+	assert.Equal(t, "8", expressions["s1"])
+	assert.Equal(t, "MAX([e3,e4])", expressions["e6"])
+
+	fake.FailOn("PutMetricAlarm", assert.AnError)
+	assert.Error(t, client.UpdateAlarm(context.Background(), "stream-scale-up", "stream", "", false, 8, ReadSide{}, DefaultAlarmSettings()))
+}
+
+func TestClient_GetStreamMetrics(t *testing.T) {
+	from := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	fake := nemesistest.NewCloudWatch()
+	fake.AddMetricData("IncomingBytes", "test-stream", map[time.Time]float64{
+		from:                      100,
+		from.Add(time.Minute):     200,
+		from.Add(5 * time.Minute): 300,
+	})
+	fake.AddMetricData("GetRecords.IteratorAgeMilliseconds", "test-stream", map[time.Time]float64{
+		from:                  1000,
+		from.Add(time.Minute): 3000,
+	})
+	fake.AddMetricData("IncomingBytes", "other-stream", map[time.Time]float64{
+		from: 999,
+	})
+
+	client := NewFromAPI(fake)
+
+	datapoints, err := client.GetStreamMetrics(context.Background(), "test-stream", from, from.Add(15*time.Minute), 5*time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []StreamDatapoint{
+		{Timestamp: from, IncomingBytes: 300, IteratorAgeMilliseconds: 3000},
+		{Timestamp: from.Add(5 * time.Minute), IncomingBytes: 300},
+		{Timestamp: from.Add(10 * time.Minute)},
+	}, datapoints)
+}
+
+func TestClient_GetAlarmValues(t *testing.T) {
+	now := time.Date(2022, 9, 1, 12, 2, 0, 0, time.UTC)
+
+	fake := nemesistest.NewCloudWatch()
+	client := NewFromAPI(fake)
+	assert.NoError(t, client.UpdateAlarm(context.Background(), "stream-scale-up", "test-stream", "", false, 1, ReadSide{}, DefaultAlarmSettings()))
+
+	// 0.5 and 0.8 MiB/s on 1 shard in the last two periods
+	fake.AddMetricData("IncomingBytes", "test-stream", map[time.Time]float64{
+		time.Date(2022, 9, 1, 11, 50, 0, 0, time.UTC): 0.5 * 1024 * 1024 * 300,
+		time.Date(2022, 9, 1, 11, 55, 0, 0, time.UTC): 0.8 * 1024 * 1024 * 300,
+	})
+
+	values, err := client.GetAlarmValues(context.Background(), "stream-scale-up", now)
+	assert.NoError(t, err)
+	if assert.True(t, len(values) >= 2) {
+		assert.InDelta(t, 0.8, values[0], 0.001)
+		assert.InDelta(t, 0.5, values[1], 0.001)
+	}
+
+	_, err = client.GetAlarmValues(context.Background(), "missing-alarm", now)
+	assert.EqualError(t, err, "alarm not found")
+}
+
+func TestClient_UpdateAlarmMetricMath(t *testing.T) {
+	fake := nemesistest.NewCloudWatch()
+	client := NewFromAPI(fake)
+
+	timestamp := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	series := func(value float64) metricmath.Series {
+		return metricmath.Series{Timestamps: []time.Time{timestamp}, Values: []float64{value}}
+	}
+
+	// 2 shards receiving half of their byte limit and a tenth of their record limit over the 5 minute period
+	data := map[string]metricmath.Series{
+		"m1": series(0.5 * 2 * 1024 * 1024 * 60 * 5),
+		"m2": series(0.1 * 2 * 1000 * 60 * 5),
+		"m3": series(0),
+		"m4": series(0.25 * 2 * 2 * 1024 * 1024 * 60 * 5),
+	}
+
+	tests := []struct {
+		name      string
+		scaleDown bool
+		readSide  ReadSide
+		expected  float64
+	}{
+		{name: "scale-up", expected: 0.5},
+		{name: "scale-down", scaleDown: true, expected: 0.5},
+		{name: "read-side", readSide: ReadSide{Enabled: true}, expected: 0.5},
+		{name: "fan-out", readSide: ReadSide{Enabled: true, StandardConsumers: 3}, expected: 0.75},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := client.UpdateAlarm(context.Background(), test.name, "stream", "", test.scaleDown, 2, test.readSide, DefaultAlarmSettings())
+			assert.NoError(t, err)
+
+			alarm, _ := fake.Alarm(test.name)
+			program, err := CompileMetrics(alarm.Definition.Metrics)
+			assert.NoError(t, err)
+
+			values, err := program.Evaluate(data, []time.Time{timestamp})
+			assert.NoError(t, err)
+			assert.InDelta(t, test.expected, values["e6"].Values[0], 1e-9)
+		})
+	}
+}
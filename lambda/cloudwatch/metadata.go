@@ -0,0 +1,256 @@
+package cloudwatch
+
+import (
+	"fmt"
+	"github.com/vmanikes/Nemesis/clock"
+	"github.com/vmanikes/Nemesis/scaling"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetadataVersion is the version of the tag layout Nemesis writes on the scaling alarms. Version 1 is the layout
+// before versioning, with only ScaleAction, ComplimentaryAlarm and LastScaledTimestamp. Version 3 is the layout with
+// every metadata tag, no alarm was ever tagged with version 2
+const MetadataVersion = 3
+
+// The tags of the alarm metadata, besides ScaleActionTag and ComplimentaryAlarmTag
+const (
+	MetadataVersionTag    = "NemesisTagSchema"
+	LastScaledTag         = "LastScaledTimestamp"
+	LastScaledAtTag       = "LastScaledAt"
+	PreviousShardCountTag = "PreviousShardCount"
+	ShardCountTag         = "ShardCount"
+	LastReasonTag         = "LastDecisionReason"
+	LastRequestIDTag      = "LastRequestId"
+	NemesisVersionTag     = "NemesisVersion"
+	RecentActionsTag      = "RecentActions"
+)
+
+// MetadataTagKeys are the keys of every tag of the alarm metadata
+var MetadataTagKeys = []string{ScaleActionTag, ComplimentaryAlarmTag, MetadataVersionTag, LastScaledTag, LastScaledAtTag,
+	PreviousShardCountTag, ShardCountTag, LastReasonTag, LastRequestIDTag, NemesisVersionTag, RecentActionsTag}
+
+// maxRecentActions is the number of scaling actions the metadata keeps, enough to count the reshard quota of a day
+// without an audit store, and few enough to fit the 256 characters of a tag value
+const maxRecentActions = 10
+
+// maxTagValueLength is the longest tag value cloudwatch accepts
+const maxTagValueLength = 256
+
+// invalidTagValueCharacters are the characters cloudwatch does not accept in tag values
+var invalidTagValueCharacters = regexp.MustCompile(`[^\pL\pZ\pN_.:/=+\-@]`)
+
+// RecentAction is a scaling action in the metadata of an alarm
+type RecentAction struct {
+	Action    string
+	Timestamp time.Time
+}
+
+// AlarmMetadata is what Nemesis keeps in the tags of a scaling alarm
+type AlarmMetadata struct {
+	// Version is the tag layout the metadata was read from, 0 for an alarm without any metadata
+	Version            int
+	ScaleAction        string
+	ComplimentaryAlarm string
+	// LastScaledTimestamp is the last scaling time in clock.LegacyLayout, for older Nemesis versions, and LastScaledAt
+	// the same time in RFC 3339
+	LastScaledTimestamp string
+	LastScaledAt        string
+	PreviousShardCount  int
+	ShardCount          int
+	LastReason          string
+	LastRequestID       string
+	NemesisVersion      string
+	// RecentActions are the last scaling actions of the stream, oldest first
+	RecentActions []RecentAction
+}
+
+// Scaling is what the metadata records of a scaling action
+type Scaling struct {
+	Action             string
+	PreviousShardCount int
+	ShardCount         int
+	Timestamp          time.Time
+	Reason             string
+	RequestID          string
+	NemesisVersion     string
+}
+
+// ParseMetadata reads the metadata from the tags of an alarm, in any tag layout
+func ParseMetadata(tags map[string]string) (AlarmMetadata, error) {
+	metadata := AlarmMetadata{
+		ScaleAction:         tags[ScaleActionTag],
+		ComplimentaryAlarm:  tags[ComplimentaryAlarmTag],
+		LastScaledTimestamp: tags[LastScaledTag],
+		LastScaledAt:        tags[LastScaledAtTag],
+	}
+
+	// The layout before versioning only has the legacy timestamp
+	if metadata.LastScaledAt == "" {
+		if lastScaled, err := clock.Parse(metadata.LastScaledTimestamp); err == nil {
+			metadata.LastScaledAt = clock.Format(lastScaled)
+		}
+	}
+
+	version, ok := tags[MetadataVersionTag]
+	if !ok {
+		if metadata.ScaleAction != "" || metadata.ComplimentaryAlarm != "" || metadata.LastScaledTimestamp != "" {
+			metadata.Version = 1
+		}
+		return metadata, nil
+	}
+
+	var err error
+	metadata.Version, err = strconv.Atoi(version)
+	if err != nil || metadata.Version < MetadataVersion {
+		return metadata, fmt.Errorf("invalid %s tag %q", MetadataVersionTag, version)
+	}
+	if metadata.Version > MetadataVersion {
+		return metadata, fmt.Errorf("%s tag %d is newer than the supported version %d", MetadataVersionTag, metadata.Version, MetadataVersion)
+	}
+
+	metadata.LastReason = tags[LastReasonTag]
+	metadata.LastRequestID = tags[LastRequestIDTag]
+	metadata.NemesisVersion = tags[NemesisVersionTag]
+
+	for key, value := range map[string]*int{PreviousShardCountTag: &metadata.PreviousShardCount, ShardCountTag: &metadata.ShardCount} {
+		if tags[key] == "" {
+			continue
+		}
+		if *value, err = strconv.Atoi(tags[key]); err != nil {
+			return metadata, fmt.Errorf("invalid %s tag: %w", key, err)
+		}
+	}
+
+	metadata.RecentActions, err = parseRecentActions(tags[RecentActionsTag])
+	if err != nil {
+		return metadata, err
+	}
+
+	return metadata, nil
+}
+
+// parseRecentActions reads the actions of the RecentActions tag, e.g. Up/1664798400 Down/1664809200
+func parseRecentActions(value string) ([]RecentAction, error) {
+	actions := make([]RecentAction, 0)
+	for _, field := range strings.Fields(value) {
+		parts := strings.SplitN(field, "/", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid %s tag entry %q", RecentActionsTag, field)
+		}
+
+		seconds, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s tag entry %q", RecentActionsTag, field)
+		}
+
+		actions = append(actions, RecentAction{Action: parts[0], Timestamp: time.Unix(seconds, 0).UTC()})
+	}
+
+	return actions, nil
+}
+
+// LastScaled returns the last scaling time, in RFC 3339 unless the legacy timestamp could not be parsed
+func (m AlarmMetadata) LastScaled() string {
+	if m.LastScaledAt != "" {
+		return m.LastScaledAt
+	}
+	return m.LastScaledTimestamp
+}
+
+// Actions returns the scaling actions the metadata keeps at or after since, oldest first. Tag layouts without
+// RecentActions only know the time of the last scaling, which is returned as an action without a direction
+func (m AlarmMetadata) Actions(since time.Time) []scaling.Action {
+	actions := make([]scaling.Action, 0, len(m.RecentActions))
+	for _, action := range m.RecentActions {
+		if !action.Timestamp.Before(since) {
+			actions = append(actions, scaling.Action{Action: action.Action, Timestamp: action.Timestamp})
+		}
+	}
+	if len(m.RecentActions) > 0 {
+		return actions
+	}
+
+	if lastScaled, err := clock.Parse(m.LastScaled()); err == nil && !lastScaled.Before(since) {
+		actions = append(actions, scaling.Action{Timestamp: lastScaled})
+	}
+
+	return actions
+}
+
+// Migrated checks if the metadata was read from an older tag layout, and has to be written again in the current one
+func (m AlarmMetadata) Migrated() bool {
+	return m.Version > 0 && m.Version < MetadataVersion
+}
+
+// Record returns the metadata of the alarm after the scaling action
+func (m AlarmMetadata) Record(action, complementaryAlarm string, scaling Scaling) AlarmMetadata {
+	recent := append(append([]RecentAction(nil), m.RecentActions...), RecentAction{Action: scaling.Action, Timestamp: scaling.Timestamp.UTC()})
+	if len(recent) > maxRecentActions {
+		recent = recent[len(recent)-maxRecentActions:]
+	}
+
+	return AlarmMetadata{
+		Version:             MetadataVersion,
+		ScaleAction:         action,
+		ComplimentaryAlarm:  complementaryAlarm,
+		LastScaledTimestamp: clock.FormatLegacy(scaling.Timestamp),
+		LastScaledAt:        clock.Format(scaling.Timestamp),
+		PreviousShardCount:  scaling.PreviousShardCount,
+		ShardCount:          scaling.ShardCount,
+		LastReason:          scaling.Reason,
+		LastRequestID:       scaling.RequestID,
+		NemesisVersion:      scaling.NemesisVersion,
+		RecentActions:       recent,
+	}
+}
+
+// Tags returns the tags of the metadata in the current layout. Fields that are not set are left out
+func (m AlarmMetadata) Tags() map[string]string {
+	tags := map[string]string{
+		MetadataVersionTag: strconv.Itoa(MetadataVersion),
+	}
+
+	set := func(key, value string) {
+		if value != "" {
+			tags[key] = tagValue(value)
+		}
+	}
+	set(ScaleActionTag, m.ScaleAction)
+	set(ComplimentaryAlarmTag, m.ComplimentaryAlarm)
+	set(LastScaledTag, m.LastScaledTimestamp)
+	set(LastScaledAtTag, m.LastScaledAt)
+	set(LastReasonTag, m.LastReason)
+	set(LastRequestIDTag, m.LastRequestID)
+	set(NemesisVersionTag, m.NemesisVersion)
+
+	if m.ShardCount > 0 {
+		tags[PreviousShardCountTag] = strconv.Itoa(m.PreviousShardCount)
+		tags[ShardCountTag] = strconv.Itoa(m.ShardCount)
+	}
+
+	if len(m.RecentActions) > 0 {
+		entries := make([]string, 0, len(m.RecentActions))
+		for _, action := range m.RecentActions {
+			entries = append(entries, action.Action+"/"+strconv.FormatInt(action.Timestamp.Unix(), 10))
+		}
+		tags[RecentActionsTag] = strings.Join(entries, " ")
+	}
+
+	return tags
+}
+
+// tagValue replaces the characters cloudwatch does not accept in tag values and cuts the value to the longest one it
+// accepts
+func tagValue(value string) string {
+	value = invalidTagValueCharacters.ReplaceAllString(value, " ")
+
+	runes := []rune(value)
+	if len(runes) > maxTagValueLength {
+		runes = runes[:maxTagValueLength]
+	}
+
+	return string(runes)
+}
@@ -0,0 +1,110 @@
+package cloudwatch
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/vmanikes/Nemesis/scaling"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMetadata(t *testing.T) {
+	metadata, err := ParseMetadata(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, metadata.Version)
+	assert.False(t, metadata.Migrated())
+
+	metadata, err = ParseMetadata(map[string]string{
+		ScaleActionTag:        "Up",
+		ComplimentaryAlarmTag: "stream-scale-down",
+		LastScaledTag:         "2020-04-23T21:16:44.775+0000",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, metadata.Version)
+	assert.True(t, metadata.Migrated())
+	assert.Equal(t, map[string]string{
+		MetadataVersionTag:    "3",
+		ScaleActionTag:        "Up",
+		ComplimentaryAlarmTag: "stream-scale-down",
+		LastScaledTag:         "2020-04-23T21:16:44.775+0000",
+		LastScaledAtTag:       "2020-04-23T21:16:44.775Z",
+	}, metadata.Tags())
+
+	metadata, err = ParseMetadata(map[string]string{
+		MetadataVersionTag:    "3",
+		ScaleActionTag:        "Down",
+		PreviousShardCountTag: "4",
+		ShardCountTag:         "2",
+		RecentActionsTag:      "Up/1587676604 Down/1587720000",
+	})
+	assert.NoError(t, err)
+	assert.False(t, metadata.Migrated())
+	assert.Equal(t, 4, metadata.PreviousShardCount)
+	assert.Equal(t, 2, metadata.ShardCount)
+	assert.Equal(t, []RecentAction{
+		{Action: "Up", Timestamp: time.Unix(1587676604, 0).UTC()},
+		{Action: "Down", Timestamp: time.Unix(1587720000, 0).UTC()},
+	}, metadata.RecentActions)
+
+	for _, tags := range []map[string]string{
+		{MetadataVersionTag: "one"},
+		{MetadataVersionTag: "1"},
+		{MetadataVersionTag: "2"},
+		{MetadataVersionTag: "4"},
+		{MetadataVersionTag: "3", ShardCountTag: "many"},
+		{MetadataVersionTag: "3", RecentActionsTag: "Up-1587676604"},
+	} {
+		_, err = ParseMetadata(tags)
+		assert.Error(t, err, tags)
+	}
+}
+
+func TestAlarmMetadata_Record(t *testing.T) {
+	start := time.Date(2020, 4, 24, 10, 0, 0, 0, time.UTC)
+
+	var metadata AlarmMetadata
+	for i := 0; i < maxRecentActions+2; i++ {
+		metadata = metadata.Record("Up", "stream-scale-down", Scaling{
+			Action:             "Up",
+			PreviousShardCount: i + 1,
+			ShardCount:         i + 2,
+			Timestamp:          start.Add(time.Duration(i) * time.Hour),
+			Reason:             "alarm stream-scale-up (usage factor > 0.25)",
+			NemesisVersion:     "v1.2.0",
+		})
+	}
+
+	assert.Len(t, metadata.RecentActions, maxRecentActions)
+	assert.Equal(t, start.Add(2*time.Hour), metadata.RecentActions[0].Timestamp)
+	assert.Equal(t, "2020-04-24T21:00:00.000+0000", metadata.LastScaledTimestamp)
+	assert.Equal(t, "2020-04-24T21:00:00.000Z", metadata.LastScaled())
+
+	tags := metadata.Tags()
+	assert.Equal(t, "alarm stream-scale-up  usage factor   0.25 ", tags[LastReasonTag])
+	assert.Empty(t, tags[LastRequestIDTag])
+
+	parsed, err := ParseMetadata(tags)
+	assert.NoError(t, err)
+	assert.Equal(t, metadata.RecentActions, parsed.RecentActions)
+	assert.Equal(t, metadata.ShardCount, parsed.ShardCount)
+	assert.Equal(t, metadata.PreviousShardCount, parsed.PreviousShardCount)
+
+	assert.Len(t, tagValue(strings.Repeat("a", 300)), maxTagValueLength)
+}
+
+func TestAlarmMetadata_Actions(t *testing.T) {
+	start := time.Date(2020, 4, 24, 10, 0, 0, 0, time.UTC)
+
+	metadata := AlarmMetadata{RecentActions: []RecentAction{
+		{Action: "Up", Timestamp: start},
+		{Action: "Down", Timestamp: start.Add(time.Hour)},
+	}}
+	assert.Equal(t, []scaling.Action{{Action: "Down", Timestamp: start.Add(time.Hour)}}, metadata.Actions(start.Add(time.Minute)))
+
+	// The legacy layout only knows when the stream was last scaled
+	legacy, err := ParseMetadata(map[string]string{LastScaledTag: "2020-04-24T10:00:00.000+0000"})
+	assert.NoError(t, err)
+	assert.Equal(t, []scaling.Action{{Timestamp: start}}, legacy.Actions(start))
+	assert.Empty(t, legacy.Actions(start.Add(time.Minute)))
+	assert.Empty(t, AlarmMetadata{}.Actions(time.Time{}))
+}
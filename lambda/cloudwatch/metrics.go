@@ -0,0 +1,278 @@
+package cloudwatch
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/vmanikes/Nemesis/logging"
+	"github.com/vmanikes/Nemesis/metricmath"
+	"go.uber.org/zap"
+	"sort"
+	"time"
+)
+
+// Datapoint is a single value of a metric series
+type Datapoint struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// StreamDatapoint holds the stream metrics the scaling alarms are built on for one period
+type StreamDatapoint struct {
+	Timestamp               time.Time
+	IncomingBytes           float64
+	IncomingRecords         float64
+	IteratorAgeMilliseconds float64
+}
+
+// GetMetricData runs the queries between from and to and returns the datapoints of every returned query ID, oldest
+// first
+func (c *Client) GetMetricData(ctx context.Context, queries []types.MetricDataQuery, from, to time.Time) (map[string][]Datapoint, error) {
+	logger := logging.WithContext(ctx)
+
+	paginator := cloudwatch.NewGetMetricDataPaginator(c.cloudwatchClient, &cloudwatch.GetMetricDataInput{
+		MetricDataQueries: queries,
+		StartTime:         aws.Time(from),
+		EndTime:           aws.Time(to),
+		ScanBy:            types.ScanByTimestampAscending,
+	})
+
+	series := make(map[string][]Datapoint)
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			logger.Error("unable to get metric data",
+				zap.Time("from", from),
+				zap.Time("to", to),
+				zap.Error(err))
+			return nil, err
+		}
+
+		for _, result := range page.MetricDataResults {
+			id := aws.ToString(result.Id)
+			for i, timestamp := range result.Timestamps {
+				if i >= len(result.Values) {
+					break
+				}
+				series[id] = append(series[id], Datapoint{
+					Timestamp: timestamp,
+					Value:     result.Values[i],
+				})
+			}
+		}
+	}
+
+	for id := range series {
+		datapoints := series[id]
+		sort.SliceStable(datapoints, func(i, j int) bool {
+			return datapoints[i].Timestamp.Before(datapoints[j].Timestamp)
+		})
+	}
+
+	return series, nil
+}
+
+// GetStreamMetrics returns IncomingBytes, IncomingRecords and the maximum GetRecords.IteratorAgeMilliseconds of the
+// stream for every period between from and to. Periods without data are returned as zeros
+func (c *Client) GetStreamMetrics(ctx context.Context, streamName string, from, to time.Time, period time.Duration) ([]StreamDatapoint, error) {
+	seconds := aws.Int32(int32(period / time.Second))
+
+	stat := func(id, metricName, statistic string) types.MetricDataQuery {
+		return types.MetricDataQuery{
+			Id: aws.String(id),
+			MetricStat: &types.MetricStat{
+				Metric: &types.Metric{
+					Namespace:  aws.String("AWS/Kinesis"),
+					MetricName: aws.String(metricName),
+					Dimensions: []types.Dimension{
+						{
+							Name:  aws.String("StreamName"),
+							Value: aws.String(streamName),
+						},
+					},
+				},
+				Period: seconds,
+				Stat:   aws.String(statistic),
+			},
+			ReturnData: aws.Bool(true),
+		}
+	}
+
+	from = from.UTC().Truncate(period)
+
+	series, err := c.GetMetricData(ctx, []types.MetricDataQuery{
+		stat("bytes", "IncomingBytes", "Sum"),
+		stat("records", "IncomingRecords", "Sum"),
+		stat("iterator", "GetRecords.IteratorAgeMilliseconds", "Maximum"),
+	}, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	datapoints := make([]StreamDatapoint, 0, int(to.Sub(from)/period))
+	index := make(map[time.Time]int)
+
+	for timestamp := from; timestamp.Before(to); timestamp = timestamp.Add(period) {
+		index[timestamp] = len(datapoints)
+		datapoints = append(datapoints, StreamDatapoint{Timestamp: timestamp})
+	}
+
+	set := func(id string, value func(*StreamDatapoint) *float64) {
+		for _, datapoint := range series[id] {
+			i, ok := index[datapoint.Timestamp.UTC().Truncate(period)]
+			if ok {
+				*value(&datapoints[i]) = datapoint.Value
+			}
+		}
+	}
+
+	set("bytes", func(d *StreamDatapoint) *float64 { return &d.IncomingBytes })
+	set("records", func(d *StreamDatapoint) *float64 { return &d.IncomingRecords })
+	set("iterator", func(d *StreamDatapoint) *float64 { return &d.IteratorAgeMilliseconds })
+
+	return datapoints, nil
+}
+
+// GetIteratorAgeMinutes returns the maximum GetRecords.IteratorAgeMilliseconds of the stream over the window up to now,
+// in minutes. It is 0 when nothing reads the stream
+func (c *Client) GetIteratorAgeMinutes(ctx context.Context, streamName string, now time.Time, window time.Duration) (float64, error) {
+	datapoints, err := c.GetStreamMetrics(ctx, streamName, now.Add(-window), now, time.Minute)
+	if err != nil {
+		return 0, err
+	}
+
+	maximum := 0.0
+	for _, datapoint := range datapoints {
+		if datapoint.IteratorAgeMilliseconds > maximum {
+			maximum = datapoint.IteratorAgeMilliseconds
+		}
+	}
+
+	return maximum / 1000 / 60, nil
+}
+
+// GetAlarmValues evaluates the metric math of the alarm over its evaluation periods up to now and returns the values
+// of the expression it compares with its threshold, the most recent first. For the scaling alarms these are the usage
+// factors their notifications carry in the state reason
+func (c *Client) GetAlarmValues(ctx context.Context, alarmName string, now time.Time) ([]float64, error) {
+	logger := logging.WithContext(ctx)
+
+	alarms, err := c.DescribeAlarms(ctx, alarmName)
+	if err != nil {
+		return nil, err
+	}
+	if len(alarms) == 0 {
+		err = errors.New("alarm not found")
+		logger.Error(err.Error(),
+			zap.String("alarm-name", alarmName))
+		return nil, err
+	}
+	definition := alarms[0]
+
+	program, err := CompileMetrics(definition.Metrics)
+	if err != nil {
+		logger.Error("unable to compile the alarm metric math",
+			zap.String("alarm-name", alarmName),
+			zap.Error(err))
+		return nil, err
+	}
+
+	// Only the metrics are fetched, the expressions are evaluated from them
+	var (
+		returnID string
+		period   time.Duration
+	)
+	queries := make([]types.MetricDataQuery, 0)
+	for _, query := range definition.Metrics {
+		if aws.ToBool(query.ReturnData) {
+			returnID = aws.ToString(query.Id)
+		}
+		if query.MetricStat == nil {
+			continue
+		}
+
+		period = time.Duration(aws.ToInt32(query.MetricStat.Period)) * time.Second
+		query.ReturnData = aws.Bool(true)
+		queries = append(queries, query)
+	}
+	if period == 0 || returnID == "" {
+		err = errors.New("alarm has no metrics or no returned expression")
+		logger.Error(err.Error(),
+			zap.String("alarm-name", alarmName))
+		return nil, err
+	}
+
+	end := now.UTC().Truncate(period)
+	start := end.Add(-time.Duration(aws.ToInt32(definition.EvaluationPeriods)) * period)
+
+	timestamps := make([]time.Time, 0)
+	for timestamp := start; timestamp.Before(end); timestamp = timestamp.Add(period) {
+		timestamps = append(timestamps, timestamp)
+	}
+
+	fetched, err := c.GetMetricData(ctx, queries, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make(map[string]metricmath.Series, len(fetched))
+	for id, datapoints := range fetched {
+		series := metricmath.Series{Timestamps: make([]time.Time, 0), Values: make([]float64, 0)}
+		for _, datapoint := range datapoints {
+			series.Timestamps = append(series.Timestamps, datapoint.Timestamp.UTC())
+			series.Values = append(series.Values, datapoint.Value)
+		}
+		data[id] = series
+	}
+
+	values, err := program.Evaluate(data, timestamps)
+	if err != nil {
+		logger.Error("unable to evaluate the alarm metric math",
+			zap.String("alarm-name", alarmName),
+			zap.Error(err))
+		return nil, err
+	}
+
+	returned := values[returnID]
+	alarmValues := make([]float64, 0, len(timestamps))
+	for i := len(timestamps) - 1; i >= 0; i-- {
+		if value, ok := returned.At(timestamps[i]); ok {
+			alarmValues = append(alarmValues, value)
+		}
+	}
+
+	return alarmValues, nil
+}
+
+// CompileMetrics checks the metric math of the alarm queries and returns them as a program that can be evaluated
+// locally. Queries with a MetricStat are metrics whose series is supplied at evaluation
+func CompileMetrics(queries []types.MetricDataQuery) (*metricmath.Program, error) {
+	compiled := make([]metricmath.Query, 0, len(queries))
+	for _, query := range queries {
+		compiled = append(compiled, metricmath.Query{
+			ID:         aws.ToString(query.Id),
+			Expression: aws.ToString(query.Expression),
+		})
+	}
+
+	return metricmath.Compile(compiled)
+}
+
+// Breaches applies the comparison operator of an alarm to a datapoint. The anomaly detection operators never breach
+func Breaches(operator types.ComparisonOperator, value, threshold float64) bool {
+	switch operator {
+	case types.ComparisonOperatorGreaterThanOrEqualToThreshold:
+		return value >= threshold
+	case types.ComparisonOperatorGreaterThanThreshold:
+		return value > threshold
+	case types.ComparisonOperatorLessThanThreshold:
+		return value < threshold
+	case types.ComparisonOperatorLessThanOrEqualToThreshold:
+		return value <= threshold
+	default:
+		return false
+	}
+}
@@ -0,0 +1,193 @@
+package cloudwatch
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/vmanikes/Nemesis/logging"
+	"go.uber.org/zap"
+	"sort"
+	"strings"
+)
+
+// StreamPlaceholder is replaced by the stream name in the alarm name patterns
+const StreamPlaceholder = "{stream}"
+
+// The tags that pair the scaling alarms of a stream and tell their action
+const (
+	ScaleActionTag        = "ScaleAction"
+	ComplimentaryAlarmTag = "ComplimentaryAlarm"
+)
+
+// AlarmNaming is how the scaling alarms of a stream are named. The alarms are paired by their tags first, the names
+// are the fallback for untagged alarms and the way to find the alarms of a stream
+type AlarmNaming struct {
+	// ScaleUp is the name pattern of the scale-up alarm, {stream}-scale-up when empty
+	ScaleUp string `json:"scaleUp,omitempty"`
+	// ScaleDown is the name pattern of the scale-down alarm, {stream}-scale-down when empty
+	ScaleDown string `json:"scaleDown,omitempty"`
+	// Throttling is the name pattern of the throttling alarm, {stream}-scale-up-throttling when empty
+	Throttling string `json:"throttling,omitempty"`
+}
+
+// WithDefaults returns the naming with the defaults for the unset patterns
+func (n AlarmNaming) WithDefaults() AlarmNaming {
+	if n.ScaleUp == "" {
+		n.ScaleUp = StreamPlaceholder + "-scale-up"
+	}
+	if n.ScaleDown == "" {
+		n.ScaleDown = StreamPlaceholder + "-scale-down"
+	}
+	if n.Throttling == "" {
+		n.Throttling = StreamPlaceholder + "-scale-up-throttling"
+	}
+	return n
+}
+
+// Validate checks that every pattern holds the stream once and that the patterns differ
+func (n AlarmNaming) Validate() error {
+	n = n.WithDefaults()
+
+	patterns := []string{n.ScaleUp, n.ScaleDown, n.Throttling}
+	for i, pattern := range patterns {
+		if strings.Count(pattern, StreamPlaceholder) != 1 {
+			return fmt.Errorf("alarm name pattern %q must hold %s once", pattern, StreamPlaceholder)
+		}
+		for _, other := range patterns[:i] {
+			if pattern == other {
+				return fmt.Errorf("alarm name pattern %q is used twice", pattern)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Names returns the names of the scale-up and scale-down alarms of the stream
+func (n AlarmNaming) Names(streamName string) (scaleUpAlarmName, scaleDownAlarmName string) {
+	n = n.WithDefaults()
+	return strings.Replace(n.ScaleUp, StreamPlaceholder, streamName, 1), strings.Replace(n.ScaleDown, StreamPlaceholder, streamName, 1)
+}
+
+// Match returns the stream and the scale action of an alarm name. The longest patterns are tried first, so that a
+// pattern that extends another one wins
+func (n AlarmNaming) Match(alarmName string) (streamName, action string, ok bool) {
+	n = n.WithDefaults()
+
+	patterns := []struct{ pattern, action string }{
+		{n.Throttling, "Emergency"},
+		{n.ScaleUp, "Up"},
+		{n.ScaleDown, "Down"},
+	}
+	sort.SliceStable(patterns, func(i, j int) bool {
+		return len(patterns[i].pattern) > len(patterns[j].pattern)
+	})
+
+	for _, pattern := range patterns {
+		if streamName, ok = matchPattern(pattern.pattern, alarmName); ok {
+			return streamName, pattern.action, true
+		}
+	}
+
+	return "", "", false
+}
+
+// matchPattern returns the stream of the alarm name when it follows the pattern
+func matchPattern(pattern, alarmName string) (string, bool) {
+	parts := strings.SplitN(pattern, StreamPlaceholder, 2)
+	if len(parts) != 2 {
+		return "", false
+	}
+
+	prefix, suffix := parts[0], parts[1]
+	if len(alarmName) <= len(prefix)+len(suffix) || !strings.HasPrefix(alarmName, prefix) || !strings.HasSuffix(alarmName, suffix) {
+		return "", false
+	}
+
+	return alarmName[len(prefix) : len(alarmName)-len(suffix)], true
+}
+
+// complementaryAlarm returns the scale-down alarm the scale-up alarm is paired with by its tags, or an empty name when
+// it is not tagged with one
+func (c *Client) complementaryAlarm(ctx context.Context, scaleUpAlarmName string) (string, error) {
+	logger := logging.WithContext(ctx)
+
+	alarms, err := c.DescribeAlarms(ctx, scaleUpAlarmName)
+	if err != nil {
+		return "", err
+	}
+	if len(alarms) == 0 {
+		logger.Info("paired scale-up alarm not found",
+			zap.String("alarm-name", scaleUpAlarmName))
+		return "", nil
+	}
+
+	tags, err := c.GetAlarmTags(ctx, aws.ToString(alarms[0].AlarmArn))
+	if err != nil {
+		return "", err
+	}
+	if tags[ScaleActionTag] != "Up" {
+		return "", nil
+	}
+
+	return tags[ComplimentaryAlarmTag], nil
+}
+
+// StreamAlarmNames returns the names of the scale-up and scale-down alarms of the stream. The pair comes from the
+// ScaleAction and ComplimentaryAlarm tags of the alarms on the metrics of the stream, the naming is the fallback when
+// none of them is tagged with its pair
+func (c *Client) StreamAlarmNames(ctx context.Context, streamName string, naming AlarmNaming) (scaleUpAlarmName, scaleDownAlarmName string, err error) {
+	alarms, err := c.DescribeAlarms(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	sort.Slice(alarms, func(i, j int) bool {
+		return aws.ToString(alarms[i].AlarmName) < aws.ToString(alarms[j].AlarmName)
+	})
+
+	for _, alarm := range alarms {
+		if AlarmStream(alarm) != streamName {
+			continue
+		}
+
+		tags, err := c.GetAlarmTags(ctx, aws.ToString(alarm.AlarmArn))
+		if err != nil {
+			return "", "", err
+		}
+
+		complementary := tags[ComplimentaryAlarmTag]
+		if complementary == "" {
+			continue
+		}
+
+		switch tags[ScaleActionTag] {
+		case "Up":
+			return aws.ToString(alarm.AlarmName), complementary, nil
+		case "Down":
+			return complementary, aws.ToString(alarm.AlarmName), nil
+		}
+	}
+
+	scaleUpAlarmName, scaleDownAlarmName = naming.Names(streamName)
+	return scaleUpAlarmName, scaleDownAlarmName, nil
+}
+
+// AlarmStream returns the stream in the StreamName dimension of the metrics of the alarm, or an empty name when it
+// has none
+func AlarmStream(alarm types.MetricAlarm) string {
+	dimensions := alarm.Dimensions
+	for _, query := range alarm.Metrics {
+		if query.MetricStat != nil && query.MetricStat.Metric != nil {
+			dimensions = append(dimensions, query.MetricStat.Metric.Dimensions...)
+		}
+	}
+
+	for _, dimension := range dimensions {
+		if aws.ToString(dimension.Name) == "StreamName" {
+			return aws.ToString(dimension.Value)
+		}
+	}
+
+	return ""
+}
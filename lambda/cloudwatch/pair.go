@@ -0,0 +1,271 @@
+package cloudwatch
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/vmanikes/Nemesis/logging"
+	"go.uber.org/zap"
+	"sync"
+)
+
+// AlarmPair is the scale-up and scale-down alarm of a stream, which always watch the same shard count
+type AlarmPair struct {
+	StreamName         string
+	ScaleUpAlarmName   string
+	ScaleDownAlarmName string
+	TopicArn           string
+	ReadSide           ReadSide
+	// Settings are the settings of the alarms at the shard count of the scaling
+	Settings AlarmSettings
+}
+
+// pairMember is one alarm of the pair along with what UpdateAlarmPair puts for it and what it had before
+type pairMember struct {
+	name       string
+	action     string
+	complement string
+	input      *cloudwatch.PutMetricAlarmInput
+
+	// previous is nil when the alarm did not exist, the update creates it and the rollback deletes it
+	previous     *types.MetricAlarm
+	previousTags map[string]string
+	arn          string
+}
+
+// UpdateAlarmPair moves both alarms of the pair to the shard count as a single unit: each alarm is updated, set to
+// INSUFFICIENT_DATA and tagged with the metadata of the scaling, the two alarms concurrently. The definitions and tags of both
+// are snapshotted first, and restored when any step fails, so the pair never watches two different shard counts. A
+// missing alarm is created, and deleted again on rollback. The error of the failed step is returned
+func (c *Client) UpdateAlarmPair(ctx context.Context, pair AlarmPair, scaling Scaling) error {
+	logger := logging.WithContext(ctx)
+
+	members := []*pairMember{
+		{name: pair.ScaleUpAlarmName, action: "Up", complement: pair.ScaleDownAlarmName},
+		{name: pair.ScaleDownAlarmName, action: "Down", complement: pair.ScaleUpAlarmName},
+	}
+
+	for _, member := range members {
+		var err error
+		member.input, err = BuildAlarmInput(member.name, pair.StreamName, pair.TopicArn, member.action == "Down", scaling.ShardCount, pair.ReadSide, pair.Settings)
+		if err != nil {
+			logger.Error("invalid alarm metric math",
+				zap.String("alarm-name", member.name),
+				zap.Error(err))
+			return err
+		}
+	}
+
+	err := c.snapshotPair(ctx, members)
+	if err != nil {
+		return err
+	}
+
+	err = forEachMember(members, func(member *pairMember) error {
+		return c.updateMember(ctx, member, scaling)
+	})
+	if err == nil {
+		return nil
+	}
+
+	logger.Error("unable to update the alarm pair, rolling back",
+		zap.Int("shard-count", scaling.ShardCount),
+		zap.Error(err))
+
+	rollbackErr := forEachMember(members, func(member *pairMember) error {
+		return c.restoreMember(ctx, member)
+	})
+	if rollbackErr != nil {
+		logger.Error("unable to roll back the alarm pair",
+			zap.Error(rollbackErr))
+	}
+
+	return err
+}
+
+// snapshotPair records the definitions and tags of the alarms that exist
+func (c *Client) snapshotPair(ctx context.Context, members []*pairMember) error {
+	alarms, err := c.DescribeAlarms(ctx, members[0].name, members[1].name)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		for i := range alarms {
+			if aws.ToString(alarms[i].AlarmName) == member.name {
+				member.previous = &alarms[i]
+				member.arn = aws.ToString(alarms[i].AlarmArn)
+			}
+		}
+	}
+
+	return forEachMember(members, func(member *pairMember) error {
+		if member.previous == nil {
+			return nil
+		}
+
+		var err error
+		member.previousTags, err = c.GetAlarmTags(ctx, member.arn)
+		return err
+	})
+}
+
+// updateMember puts the new definition of the alarm, resets its state and tags it with the metadata of the scaling
+func (c *Client) updateMember(ctx context.Context, member *pairMember, scaling Scaling) error {
+	logger := logging.WithContext(ctx)
+
+	_, err := c.cloudwatchClient.PutMetricAlarm(ctx, member.input)
+	if err != nil {
+		logger.Error("unable to update alarm",
+			zap.String("alarm-name", member.name),
+			zap.Error(err))
+		return err
+	}
+
+	err = c.SetAlarmState(ctx, member.name, string(types.StateValueInsufficientData), "Metric math and threshold value update")
+	if err != nil {
+		return err
+	}
+
+	alarmArn := member.arn
+	if alarmArn == "" {
+		alarmArn, err = c.getAlarmArn(ctx, member.name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The metadata of an alarm that was tagged by hand starts over
+	previous, err := ParseMetadata(member.previousTags)
+	if err != nil {
+		logger.Error("invalid alarm metadata",
+			zap.String("alarm-name", member.name),
+			zap.Error(err))
+		previous = AlarmMetadata{}
+	}
+
+	return c.SetAlarmTags(ctx, alarmArn, previous.Record(member.action, member.complement, scaling).Tags())
+}
+
+// restoreMember puts the snapshotted definition of the alarm back, and the snapshotted values of the metadata tags. An
+// alarm the update created is deleted
+func (c *Client) restoreMember(ctx context.Context, member *pairMember) error {
+	logger := logging.WithContext(ctx)
+
+	if member.previous == nil {
+		_, err := c.cloudwatchClient.DeleteAlarms(ctx, &cloudwatch.DeleteAlarmsInput{AlarmNames: []string{member.name}})
+		if err != nil {
+			logger.Error("unable to delete alarm",
+				zap.String("alarm-name", member.name),
+				zap.Error(err))
+			return err
+		}
+		return nil
+	}
+
+	_, err := c.cloudwatchClient.PutMetricAlarm(ctx, alarmInput(*member.previous))
+	if err != nil {
+		logger.Error("unable to restore metric alarm",
+			zap.String("alarm-name", member.name),
+			zap.Error(err))
+		return err
+	}
+
+	alarmArn := member.arn
+	restore := make(map[string]string)
+	var remove []string
+
+	for _, key := range MetadataTagKeys {
+		if value, ok := member.previousTags[key]; ok {
+			restore[key] = value
+		} else {
+			remove = append(remove, key)
+		}
+	}
+
+	if len(restore) > 0 {
+		if err = c.SetAlarmTags(ctx, alarmArn, restore); err != nil {
+			return err
+		}
+	}
+
+	if len(remove) > 0 {
+		_, err = c.cloudwatchClient.UntagResource(ctx, &cloudwatch.UntagResourceInput{
+			ResourceARN: aws.String(alarmArn),
+			TagKeys:     remove,
+		})
+		if err != nil {
+			logger.Error("unable to untag alarm",
+				zap.String("alarm-arn", alarmArn),
+				zap.Error(err))
+			return err
+		}
+	}
+
+	return nil
+}
+
+// forEachMember runs the step for both alarms concurrently and returns the error of the scale-up alarm first
+func forEachMember(members []*pairMember, step func(member *pairMember) error) error {
+	errs := make([]error, len(members))
+
+	var wg sync.WaitGroup
+	for i, member := range members {
+		wg.Add(1)
+		go func(i int, member *pairMember) {
+			defer wg.Done()
+			errs[i] = step(member)
+		}(i, member)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getAlarmArn returns the arn of the alarm
+func (c *Client) getAlarmArn(ctx context.Context, alarmName string) (string, error) {
+	alarms, err := c.DescribeAlarms(ctx, alarmName)
+	if err != nil {
+		return "", err
+	}
+	if len(alarms) == 0 {
+		return "", fmt.Errorf("alarm %s not found", alarmName)
+	}
+
+	return aws.ToString(alarms[0].AlarmArn), nil
+}
+
+// alarmInput returns the PutMetricAlarm input that recreates the described alarm
+func alarmInput(alarm types.MetricAlarm) *cloudwatch.PutMetricAlarmInput {
+	return &cloudwatch.PutMetricAlarmInput{
+		AlarmName:                        alarm.AlarmName,
+		ActionsEnabled:                   alarm.ActionsEnabled,
+		AlarmActions:                     alarm.AlarmActions,
+		AlarmDescription:                 alarm.AlarmDescription,
+		ComparisonOperator:               alarm.ComparisonOperator,
+		DatapointsToAlarm:                alarm.DatapointsToAlarm,
+		Dimensions:                       alarm.Dimensions,
+		EvaluateLowSampleCountPercentile: alarm.EvaluateLowSampleCountPercentile,
+		EvaluationPeriods:                alarm.EvaluationPeriods,
+		ExtendedStatistic:                alarm.ExtendedStatistic,
+		InsufficientDataActions:          alarm.InsufficientDataActions,
+		MetricName:                       alarm.MetricName,
+		Metrics:                          alarm.Metrics,
+		Namespace:                        alarm.Namespace,
+		OKActions:                        alarm.OKActions,
+		Period:                           alarm.Period,
+		Statistic:                        alarm.Statistic,
+		Threshold:                        alarm.Threshold,
+		ThresholdMetricId:                alarm.ThresholdMetricId,
+		TreatMissingData:                 alarm.TreatMissingData,
+		Unit:                             alarm.Unit,
+	}
+}
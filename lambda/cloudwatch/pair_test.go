@@ -0,0 +1,118 @@
+package cloudwatch
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmanikes/Nemesis/nemesistest"
+	"testing"
+	"time"
+)
+
+func TestClient_UpdateAlarmPair(t *testing.T) {
+	pair := AlarmPair{
+		StreamName:         "stream",
+		ScaleUpAlarmName:   "stream-scale-up",
+		ScaleDownAlarmName: "stream-scale-down",
+		TopicArn:           "arn:aws:sns:us-east-1:123456789012:topic",
+	}
+
+	scaling := Scaling{
+		Action:             "Up",
+		PreviousShardCount: 2,
+		ShardCount:         4,
+		Timestamp:          time.Date(2020, 4, 24, 10, 0, 0, 0, time.UTC),
+		Reason:             "alarm stream-scale-up",
+		RequestID:          "request-1",
+		NemesisVersion:     "v1.2.0",
+	}
+
+	newFake := func(t *testing.T) (*nemesistest.CloudWatch, *Client) {
+		fake := nemesistest.NewCloudWatch()
+		client := NewFromAPI(fake)
+
+		for _, scaleDown := range []bool{false, true} {
+			name := pair.ScaleUpAlarmName
+			if scaleDown {
+				name = pair.ScaleDownAlarmName
+			}
+			input, err := BuildAlarmInput(name, pair.StreamName, pair.TopicArn, scaleDown, 2, ReadSide{}, DefaultAlarmSettings())
+			assert.NoError(t, err)
+			fake.AddAlarm(*input, types.StateValueOk, map[string]string{"LastScaledTimestamp": "2020-04-23T21:16:44.775+0000"})
+		}
+
+		return fake, client
+	}
+
+	shardCount := func(fake *nemesistest.CloudWatch, alarmName string) string {
+		alarm, _ := fake.Alarm(alarmName)
+		for _, metric := range alarm.Definition.Metrics {
+			if aws.ToString(metric.Id) == "s1" {
+				return aws.ToString(metric.Expression)
+			}
+		}
+		return ""
+	}
+
+	t.Run("updates both alarms", func(t *testing.T) {
+		fake, client := newFake(t)
+
+		err := client.UpdateAlarmPair(context.Background(), pair, scaling)
+		assert.NoError(t, err)
+
+		for _, name := range []string{pair.ScaleUpAlarmName, pair.ScaleDownAlarmName} {
+			assert.Equal(t, "4", shardCount(fake, name))
+
+			alarm, _ := fake.Alarm(name)
+			assert.Equal(t, types.StateValueInsufficientData, alarm.State)
+			assert.Equal(t, "2020-04-24T10:00:00.000+0000", alarm.Tags["LastScaledTimestamp"])
+		}
+
+		up, _ := fake.Alarm(pair.ScaleUpAlarmName)
+		assert.Equal(t, "Up", up.Tags["ScaleAction"])
+		assert.Equal(t, pair.ScaleDownAlarmName, up.Tags["ComplimentaryAlarm"])
+
+		metadata, err := ParseMetadata(up.Tags)
+		assert.NoError(t, err)
+		assert.Equal(t, MetadataVersion, metadata.Version)
+		assert.Equal(t, 2, metadata.PreviousShardCount)
+		assert.Equal(t, 4, metadata.ShardCount)
+		assert.Equal(t, "alarm stream-scale-up", metadata.LastReason)
+		assert.Equal(t, "request-1", metadata.LastRequestID)
+		assert.Equal(t, "v1.2.0", metadata.NemesisVersion)
+		assert.Equal(t, []RecentAction{{Action: "Up", Timestamp: scaling.Timestamp}}, metadata.RecentActions)
+	})
+
+	t.Run("rolls both alarms back when a step fails", func(t *testing.T) {
+		fake, client := newFake(t)
+		fake.FailOn("SetAlarmState", assert.AnError)
+
+		err := client.UpdateAlarmPair(context.Background(), pair, scaling)
+		assert.ErrorIs(t, err, assert.AnError)
+
+		for _, name := range []string{pair.ScaleUpAlarmName, pair.ScaleDownAlarmName} {
+			assert.Equal(t, "2", shardCount(fake, name))
+
+			alarm, _ := fake.Alarm(name)
+			assert.Equal(t, map[string]string{"LastScaledTimestamp": "2020-04-23T21:16:44.775+0000"}, alarm.Tags)
+		}
+	})
+
+	t.Run("deletes the alarm it created on rollback", func(t *testing.T) {
+		fake := nemesistest.NewCloudWatch()
+		fake.AddAlarm(cloudwatch.PutMetricAlarmInput{AlarmName: aws.String(pair.ScaleUpAlarmName)}, types.StateValueOk, nil)
+		fake.FailOn("TagResource", assert.AnError)
+
+		err := NewFromAPI(fake).UpdateAlarmPair(context.Background(), pair, scaling)
+		assert.Error(t, err)
+
+		_, ok := fake.Alarm(pair.ScaleDownAlarmName)
+		assert.False(t, ok)
+
+		up, ok := fake.Alarm(pair.ScaleUpAlarmName)
+		assert.True(t, ok)
+		assert.Empty(t, up.Definition.Metrics)
+	})
+}
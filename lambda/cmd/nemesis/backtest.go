@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/vmanikes/Nemesis/accounts"
+	"github.com/vmanikes/Nemesis/audit"
+	"github.com/vmanikes/Nemesis/cloudwatch"
+	"github.com/vmanikes/Nemesis/constants"
+	"github.com/vmanikes/Nemesis/kinesis"
+	"github.com/vmanikes/Nemesis/simulate"
+	"os"
+	"time"
+)
+
+// runBacktest replays the historical traffic of a stream through the current or a candidate policy and compares it
+// with what actually ran
+func runBacktest(ctx context.Context, args []string) error {
+	cfg := simulate.DefaultConfig()
+	now := time.Now().UTC()
+
+	flags := flag.NewFlagSet("backtest", flag.ExitOnError)
+	from := flags.String("from", now.Add(-7*24*time.Hour).Format(time.RFC3339), "start of the backtest, RFC3339")
+	to := flags.String("to", now.Format(time.RFC3339), "end of the backtest, RFC3339")
+	csvPath := flags.String("csv", "", "read the traffic from a CSV file instead of cloudwatch, see simulate")
+	storeURI := flags.String("store", os.Getenv(constants.AuditStoreEnv), "audit store URI with the actual scaling events, defaults to $"+constants.AuditStoreEnv)
+	flags.IntVar(&cfg.ReshardMinutes, "reshard-minutes", cfg.ReshardMinutes, "minutes a stream stays UPDATING after a reshard")
+	flags.BoolVar(&cfg.ThrottlingAlarm, "throttling-alarm", cfg.ThrottlingAlarm, "simulate the throttling alarm")
+	flags.Float64Var(&cfg.ShardHourPrice, "shard-hour-price", cfg.ShardHourPrice, "price of one shard hour")
+	addPolicyFlags(flags, &cfg.Policy)
+	asJSON := flags.Bool("json", false, "print the full backtest as JSON")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("backtest takes exactly one stream name")
+	}
+	if err := validatePolicy(cfg.Policy); err != nil {
+		return err
+	}
+
+	streamName := flags.Arg(0)
+
+	start, err := time.Parse(time.RFC3339, *from)
+	if err != nil {
+		return fmt.Errorf("invalid -from: %w", err)
+	}
+	end, err := time.Parse(time.RFC3339, *to)
+	if err != nil {
+		return fmt.Errorf("invalid -to: %w", err)
+	}
+	if !start.Before(end) {
+		return errors.New("-from must be before -to")
+	}
+
+	var source simulate.Source = simulate.FileSource{Path: *csvPath}
+	if *csvPath == "" {
+		cloudwatchClient, err := cloudwatch.New(ctx)
+		if err != nil {
+			return err
+		}
+		source = simulate.CloudWatchSource{Client: cloudwatchClient}
+	}
+
+	profile, err := source.Profile(ctx, streamName, start, end)
+	if err != nil {
+		return err
+	}
+	if len(profile) == 0 {
+		return errors.New("no traffic to backtest")
+	}
+
+	if profile[0].ShardCount == 0 && *csvPath == "" {
+		profile, err = withActualShardCounts(ctx, profile, streamName, start, *storeURI)
+		if err != nil {
+			return err
+		}
+	}
+
+	cfg.Start = start
+	if err = withConfiguredScaling(ctx, &cfg, streamName); err != nil {
+		return err
+	}
+
+	backtest, err := simulate.RunBacktest(profile, cfg)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(backtest)
+	}
+
+	if err = printTimeline(backtest.Result); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	printResult(backtest.Result)
+
+	if !backtest.ActualKnown {
+		fmt.Println("actual:             unknown, the traffic has no shard counts")
+		return nil
+	}
+
+	fmt.Printf("actual reshards:    %d\n", backtest.ActualReshards)
+	fmt.Printf("actual shard hours: %.2f\n", backtest.ActualShardHours)
+	fmt.Printf("actual cost:        %.2f\n", backtest.ActualCost)
+	fmt.Printf("cost difference:    %+.2f\n", backtest.CostDifference)
+
+	return nil
+}
+
+// withActualShardCounts adds the shard counts the stream actually had to the profile, from the applied events of the
+// audit trail and the current shard count of the stream
+func withActualShardCounts(ctx context.Context, profile simulate.Profile, streamName string, start time.Time, storeURI string) (simulate.Profile, error) {
+	kinesisClient, err := kinesis.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := kinesisClient.GetShardCount(ctx, streamName)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []audit.ScalingEvent
+
+	if storeURI == "" {
+		fmt.Fprintln(os.Stderr, "nemesis: no audit store configured, assuming the current shard count for the whole backtest")
+	} else {
+		store, err := audit.Open(ctx, storeURI)
+		if err != nil {
+			return nil, err
+		}
+
+		events, err = store.History(ctx, accounts.Target{StreamName: streamName}, start)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return profile.WithShardCounts(start, events, current), nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/vmanikes/Nemesis/cloudwatch"
+	"github.com/vmanikes/Nemesis/config"
+	"github.com/vmanikes/Nemesis/drift"
+	"github.com/vmanikes/Nemesis/kinesis"
+	"os"
+	"text/tabwriter"
+)
+
+// runDrift compares the scaling alarms of the managed streams with the definitions Nemesis puts for them
+func runDrift(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("drift", flag.ExitOnError)
+	topicArn := flags.String("topic", "", "SNS topic the alarms notify, the alarm actions are not compared without it")
+	fix := flags.Bool("fix", false, "put the expected definition and tags of the drifted alarms")
+	asJSON := flags.Bool("json", false, "print the drift reports as JSON")
+	_ = flags.Parse(args)
+
+	// The read-side usage factors are part of the definition, they come from the same configuration as the handler's
+	cfg, err := config.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	cloudwatchClient, err := cloudwatch.New(ctx)
+	if err != nil {
+		return err
+	}
+
+	kinesisClient, err := kinesis.New(ctx)
+	if err != nil {
+		return err
+	}
+
+	streamNames := flags.Args()
+	if len(streamNames) == 0 {
+		streamNames, err = drift.ManagedStreams(ctx, cloudwatchClient, cfg.AlarmNaming)
+		if err != nil {
+			return err
+		}
+	}
+
+	reports := make([]drift.Report, 0, len(streamNames))
+	drifted := 0
+
+	for _, streamName := range streamNames {
+		shardCount, err := kinesisClient.GetShardCount(ctx, streamName)
+		if err != nil {
+			return err
+		}
+
+		settings := cfg.Settings(cfg.Registry.ForStream(streamName))
+		report, err := drift.Check(ctx, cloudwatchClient, drift.Stream{
+			Name:          streamName,
+			ShardCount:    shardCount,
+			TopicArn:      *topicArn,
+			ReadSide:      cfg.ReadSide,
+			Settings:      settings.Alarms,
+			MinShardCount: settings.MinShardCount,
+			Naming:        cfg.AlarmNaming,
+		})
+		if err != nil {
+			return err
+		}
+
+		if report.Drifted() {
+			drifted++
+			if *fix {
+				if err = drift.Fix(ctx, cloudwatchClient, report); err != nil {
+					return err
+				}
+			}
+		}
+		reports = append(reports, report)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(reports); err != nil {
+			return err
+		}
+	} else if err = printDrift(reports); err != nil {
+		return err
+	}
+
+	switch {
+	case drifted == 0:
+		return nil
+	case *fix:
+		fmt.Fprintf(os.Stderr, "fixed the alarms of %d of %d streams\n", drifted, len(reports))
+		return nil
+	default:
+		return fmt.Errorf("the alarms of %d of %d streams drifted", drifted, len(reports))
+	}
+}
+
+// printDrift prints the differences of every drifted alarm
+func printDrift(reports []drift.Report) error {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "ALARM\tFIELD\tEXPECTED\tACTUAL")
+
+	for _, report := range reports {
+		for _, alarm := range report.Alarms {
+			if alarm.Missing {
+				fmt.Fprintf(writer, "%s\t-\tpresent\tmissing\n", alarm.Name)
+			}
+			for _, difference := range alarm.Differences {
+				fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", alarm.Name, difference.Field, orDash(difference.Expected),
+					orDash(difference.Actual))
+			}
+		}
+	}
+
+	return writer.Flush()
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/vmanikes/Nemesis/cloudwatch"
+	"github.com/vmanikes/Nemesis/config"
+	"github.com/vmanikes/Nemesis/explain"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runExplain evaluates the scaling alarms of a stream locally and shows why they are or are not firing
+func runExplain(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("explain", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the full explanation as JSON")
+	verbose := flags.Bool("v", false, "print every datapoint of the evaluation window")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("explain takes exactly one stream name")
+	}
+
+	// The alarms are paired by their tags or else by the naming of the configuration, and checked against the cooldowns
+	// of the stream
+	cfg, err := config.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	cloudwatchClient, err := cloudwatch.New(ctx)
+	if err != nil {
+		return err
+	}
+
+	cooldowns := cfg.Settings(cfg.Registry.ForStream(flags.Arg(0))).Cooldowns
+	report, err := explain.Explain(ctx, cloudwatchClient, flags.Arg(0), cfg.AlarmNaming, cooldowns, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	for _, alarm := range report.Alarms {
+		if err = printAlarm(alarm, *verbose); err != nil {
+			return err
+		}
+		fmt.Println()
+	}
+
+	switch {
+	case report.LastScaledTimestamp == "":
+		fmt.Println("cooldown: the stream was never scaled")
+	case report.CooldownBlocks():
+		for _, alarm := range report.Alarms {
+			if alarm.CooldownRemaining > 0 {
+				fmt.Printf("cooldown: blocks the scale-%s for another %s (last scaled %s)\n",
+					alarm.Action, alarm.CooldownRemaining.Round(time.Second), report.LastScaledTimestamp)
+			}
+		}
+	default:
+		fmt.Printf("cooldown: over (last scaled %s)\n", report.LastScaledTimestamp)
+	}
+
+	return nil
+}
+
+// printAlarm prints the series of an alarm and how its last evaluation window compares with the threshold
+func printAlarm(alarm explain.Alarm, verbose bool) error {
+	fmt.Printf("%s: %s\n", alarm.Name, alarm.State)
+	if alarm.StateReason != "" {
+		fmt.Printf("  %s\n", alarm.StateReason)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tLABEL\tEXPRESSION\tLATEST\tMIN\tMAX")
+	for _, series := range alarm.Series {
+		latest, minimum, maximum := "-", "-", "-"
+		if value, ok := series.Latest(); ok {
+			latest = fmt.Sprintf("%.4g", value)
+			sorted := append([]float64(nil), series.Values...)
+			sort.Float64s(sorted)
+			minimum, maximum = fmt.Sprintf("%.4g", sorted[0]), fmt.Sprintf("%.4g", sorted[len(sorted)-1])
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			series.ID, series.Label, series.Expression, latest, minimum, maximum)
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	verdict := "would not alarm"
+	if alarm.WouldAlarm {
+		verdict = "would alarm"
+	}
+	fmt.Printf("%s %s %g: %d of %d datapoints breached, %d needed to alarm -> %s\n",
+		alarm.ReturnID, alarm.ComparisonOperator, alarm.Threshold, alarm.Breaching, alarm.EvaluationPeriods,
+		alarm.DatapointsToAlarm, verdict)
+
+	if len(alarm.Dominance) > 0 {
+		inputs := make([]string, 0, len(alarm.Dominance))
+		for input := range alarm.Dominance {
+			inputs = append(inputs, input)
+		}
+		sort.Slice(inputs, func(i, j int) bool {
+			return alarm.Dominance[inputs[i]] > alarm.Dominance[inputs[j]]
+		})
+
+		counts := make([]string, 0, len(inputs))
+		for _, input := range inputs {
+			counts = append(counts, fmt.Sprintf("%s in %d", input, alarm.Dominance[input]))
+		}
+		fmt.Printf("%s is dominated by %s (latest datapoint: %s)\n", alarm.ReturnID, strings.Join(counts, ", "), alarm.Dominant())
+	}
+
+	if !verbose {
+		return nil
+	}
+
+	writer = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "TIMESTAMP\tVALUE\tBREACHING\tDOMINANT")
+	for _, datapoint := range alarm.Datapoints {
+		fmt.Fprintf(writer, "%s\t%.4g\t%t\t%s\n",
+			datapoint.Timestamp.Format(time.RFC3339), datapoint.Value, datapoint.Breaching, datapoint.Dominant)
+	}
+
+	return writer.Flush()
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/vmanikes/Nemesis/audit"
+	"github.com/vmanikes/Nemesis/cloudwatch"
+	"github.com/vmanikes/Nemesis/config"
+	"github.com/vmanikes/Nemesis/constants"
+	"github.com/vmanikes/Nemesis/forecast"
+	"github.com/vmanikes/Nemesis/kinesis"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// runForecast forecasts the load of a stream as predictive scaling would, and summarises how accurate the recorded
+// forecasts were
+func runForecast(ctx context.Context, args []string) error {
+	cfg, err := config.Load(ctx)
+	if err != nil {
+		return err
+	}
+	forecastConfig := cfg.Forecast.WithDefaults()
+
+	flags := flag.NewFlagSet("forecast", flag.ExitOnError)
+	flags.IntVar(&forecastConfig.Weeks, "weeks", forecastConfig.Weeks, "weeks of history the model is fitted on")
+	flags.IntVar(&forecastConfig.PeriodMinutes, "period", forecastConfig.PeriodMinutes, "resolution of the model in minutes")
+	flags.IntVar(&forecastConfig.SeasonHours, "season-hours", forecastConfig.SeasonHours, "length of a season in hours")
+	flags.IntVar(&forecastConfig.HorizonMinutes, "horizon", forecastConfig.HorizonMinutes, "how far ahead to forecast in minutes")
+	storeURI := flags.String("store", os.Getenv(constants.AuditStoreEnv), "audit store URI with the recorded forecasts, defaults to $"+constants.AuditStoreEnv)
+	since := flags.Duration("since", 7*24*time.Hour, "how far back to look for recorded forecasts")
+	asJSON := flags.Bool("json", false, "print the forecast as JSON")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("forecast takes exactly one stream name")
+	}
+	streamName := flags.Arg(0)
+
+	cloudwatchClient, err := cloudwatch.New(ctx)
+	if err != nil {
+		return err
+	}
+
+	kinesisClient, err := kinesis.New(ctx)
+	if err != nil {
+		return err
+	}
+
+	shardCount, err := kinesisClient.GetShardCount(ctx, streamName)
+	if err != nil {
+		return err
+	}
+
+	prediction, err := forecast.Predict(ctx, cloudwatchClient, streamName, forecastConfig, time.Now())
+	if err != nil {
+		return err
+	}
+	prediction.Forecast.PeakUsageFactor, _ = forecast.Peak(prediction.Forecast, shardCount)
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(prediction.Forecast); err != nil {
+			return err
+		}
+	} else if err = printForecast(prediction.Forecast, shardCount, cfg.Settings(cfg.Registry.ForStream(streamName)).Alarms.ScaleUpThreshold); err != nil {
+		return err
+	}
+
+	if *storeURI == "" {
+		return nil
+	}
+
+	store, err := audit.Open(ctx, *storeURI)
+	if err != nil {
+		return err
+	}
+
+	events, err := store.History(ctx, cfg.Registry.ForStream(streamName), time.Now().Add(-*since))
+	if err != nil {
+		return err
+	}
+
+	printForecastAccuracy(events)
+
+	return nil
+}
+
+// printForecast prints the forecast load and usage factor of every period, and the shard count that keeps the peak
+// below the scale-up threshold
+func printForecast(prediction audit.Forecast, shardCount int, scaleUpThreshold float64) error {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "PERIOD\tINCOMING BYTES\tINCOMING RECORDS\tUSAGE")
+
+	for i, usage := range forecast.UsageFactors(prediction, shardCount) {
+		fmt.Fprintf(writer, "%s\t%.0f\t%.0f\t%.3f\n",
+			prediction.Start.Add(time.Duration(i*prediction.PeriodMinutes)*time.Minute).Format(time.RFC3339),
+			prediction.IncomingBytes[i], prediction.IncomingRecords[i], usage)
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	peak, at := forecast.Peak(prediction, shardCount)
+	fmt.Printf("peak usage factor %.3f at %s on %d shards, %d shards keep it below the scale-up threshold of %g\n",
+		peak, at.Format(time.RFC3339), shardCount, forecast.RequiredShardCount(prediction, scaleUpThreshold),
+		scaleUpThreshold)
+
+	return nil
+}
+
+// printForecastAccuracy prints the mean errors of the recorded forecasts
+func printForecastAccuracy(events []audit.ScalingEvent) {
+	var (
+		forecasts, compared, periods int
+		bytesError, recordsError     float64
+	)
+
+	for _, event := range events {
+		if event.Forecast == nil {
+			continue
+		}
+		forecasts++
+
+		if accuracy := event.Forecast.Accuracy; accuracy != nil {
+			compared++
+			periods += accuracy.Periods
+			bytesError += accuracy.IncomingBytesError
+			recordsError += accuracy.IncomingRecordsError
+		}
+	}
+
+	if compared == 0 {
+		fmt.Printf("%d recorded forecasts, none compared with the traffic yet\n", forecasts)
+		return
+	}
+
+	fmt.Printf("%d recorded forecasts, %d compared over %d periods: mean error %.1f%% of the incoming bytes, %.1f%% of the incoming records\n",
+		forecasts, compared, periods, 100*bytesError/float64(compared), 100*recordsError/float64(compared))
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/vmanikes/Nemesis/cloudwatch"
+	"github.com/vmanikes/Nemesis/config"
+	"github.com/vmanikes/Nemesis/drift"
+	"github.com/vmanikes/Nemesis/freeze"
+	"github.com/vmanikes/Nemesis/kinesis"
+	"time"
+)
+
+// runFreeze tags streams with a freeze window, which stops Nemesis from scaling them until it expires
+func runFreeze(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("freeze", flag.ExitOnError)
+	until := flags.String("until", "", "RFC3339 time the freeze expires at")
+	duration := flags.Duration("for", 0, "how long the freeze lasts, instead of -until")
+	allowScaleUp := flags.Bool("allow-scale-up", false, "only block the scale-downs")
+	reason := flags.String("reason", "", "why the streams are frozen, shown in the alarm states and the audit trail")
+	all := flags.Bool("all", false, "freeze every stream with scaling alarms")
+	_ = flags.Parse(args)
+
+	window := freeze.Window{
+		AllowScaleUp: *allowScaleUp,
+		Reason:       *reason,
+	}
+
+	switch {
+	case *until != "" && *duration != 0:
+		return errors.New("either -until or -for can be set, not both")
+	case *until != "":
+		var err error
+		window.Until, err = time.Parse(time.RFC3339, *until)
+		if err != nil {
+			return fmt.Errorf("invalid -until: %w", err)
+		}
+	case *duration > 0:
+		window.Until = time.Now().Add(*duration)
+	default:
+		return errors.New("a freeze must expire, set -until or -for")
+	}
+
+	if !window.Until.After(time.Now()) {
+		return errors.New("the freeze expires in the past")
+	}
+
+	kinesisClient, err := kinesis.New(ctx)
+	if err != nil {
+		return err
+	}
+
+	streamNames, err := freezeTargets(ctx, flags.Args(), *all)
+	if err != nil {
+		return err
+	}
+
+	for _, streamName := range streamNames {
+		if err = kinesisClient.TagStream(ctx, streamName, window.Tags()); err != nil {
+			return err
+		}
+		fmt.Printf("%s frozen %s\n", streamName, window)
+	}
+
+	return nil
+}
+
+// runUnfreeze removes the freeze tags from streams. Freezes from the configuration expire on their own
+func runUnfreeze(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("unfreeze", flag.ExitOnError)
+	all := flags.Bool("all", false, "unfreeze every stream with scaling alarms")
+	_ = flags.Parse(args)
+
+	kinesisClient, err := kinesis.New(ctx)
+	if err != nil {
+		return err
+	}
+
+	streamNames, err := freezeTargets(ctx, flags.Args(), *all)
+	if err != nil {
+		return err
+	}
+
+	for _, streamName := range streamNames {
+		if err = kinesisClient.UntagStream(ctx, streamName, freeze.TagKeys); err != nil {
+			return err
+		}
+		fmt.Printf("%s unfrozen\n", streamName)
+	}
+
+	return nil
+}
+
+// freezeTargets returns the streams named on the command line, or every managed stream with -all
+func freezeTargets(ctx context.Context, streamNames []string, all bool) ([]string, error) {
+	switch {
+	case all && len(streamNames) > 0:
+		return nil, errors.New("either -all or stream names can be given, not both")
+	case len(streamNames) > 0:
+		return streamNames, nil
+	case !all:
+		return nil, errors.New("name the streams or set -all")
+	}
+
+	cfg, err := config.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cloudwatchClient, err := cloudwatch.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return drift.ManagedStreams(ctx, cloudwatchClient, cfg.AlarmNaming)
+}
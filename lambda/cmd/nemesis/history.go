@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/vmanikes/Nemesis/accounts"
+	"github.com/vmanikes/Nemesis/audit"
+	"github.com/vmanikes/Nemesis/constants"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// runHistory prints the recorded scaling events of a stream, given by name or by ARN, oldest first
+func runHistory(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	storeURI := flags.String("store", os.Getenv(constants.AuditStoreEnv), "audit store URI, defaults to $"+constants.AuditStoreEnv)
+	since := flags.Duration("since", 7*24*time.Hour, "how far back to look")
+	asJSON := flags.Bool("json", false, "print the events as JSON lines")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("history takes exactly one stream name or ARN")
+	}
+	if *storeURI == "" {
+		return errors.New("no audit store configured, use -store or $" + constants.AuditStoreEnv)
+	}
+
+	store, err := audit.Open(ctx, *storeURI)
+	if err != nil {
+		return err
+	}
+
+	events, err := store.History(ctx, accounts.Registry{}.ForStream(flags.Arg(0)), time.Now().Add(-*since))
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, event := range events {
+			if err = encoder.Encode(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "TIMESTAMP\tACTION\tOUTCOME\tSHARDS\tUSAGE\tREQUEST ID\tREASON")
+	for _, event := range events {
+		usage := "-"
+		if len(event.UsageFactors) > 0 {
+			usage = fmt.Sprintf("%.3f", event.UsageFactors[0])
+		}
+
+		shards := "-"
+		if event.ShardCount > 0 {
+			shards = fmt.Sprintf("%d -> %d", event.ShardCount, event.TargetShardCount)
+		}
+
+		reason := event.Reason
+		if event.Error != "" {
+			reason += ": " + event.Error
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			event.Timestamp.UTC().Format(time.RFC3339), event.Action, event.Outcome, shards, usage, event.RequestID, reason)
+	}
+
+	return writer.Flush()
+}
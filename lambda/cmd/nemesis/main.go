@@ -0,0 +1,105 @@
+// Command nemesis is the operator CLI for Nemesis. It queries and inspects the scaling of the managed streams
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/vmanikes/Nemesis/config"
+	"os"
+	"sort"
+)
+
+// command is a single nemesis sub command
+type command struct {
+	usage string
+	run   func(ctx context.Context, args []string) error
+	// noConfig skips loading the configuration, for the commands that check it
+	noConfig bool
+}
+
+var commands = map[string]command{
+	"backtest": {
+		usage: "backtest [flags] <stream>\treplay the historical traffic of a stream through a scaling policy",
+		run:   runBacktest,
+	},
+	"drift": {
+		usage: "drift [flags] [stream...]\tcompare the scaling alarms with the definitions nemesis puts for them",
+		run:   runDrift,
+	},
+	"explain": {
+		usage: "explain [flags] <stream>\tshow why the scaling alarms of a stream are or are not firing",
+		run:   runExplain,
+	},
+	"forecast": {
+		usage: "forecast [flags] <stream>\tforecast the load of a stream and show how accurate the recorded forecasts were",
+		run:   runForecast,
+	},
+	"freeze": {
+		usage: "freeze [flags] [stream...]\tstop nemesis from scaling streams until the freeze expires",
+		run:   runFreeze,
+	},
+	"history": {
+		usage: "history [flags] <stream>\tshow the scaling timeline of a stream",
+		run:   runHistory,
+	},
+	"simulate": {
+		usage: "simulate [flags]\treplay a traffic profile through the scaling alarms and decisions",
+		run:   runSimulate,
+	},
+	"unfreeze": {
+		usage: "unfreeze [flags] [stream...]\tremove the freeze from streams",
+		run:   runUnfreeze,
+	},
+	"validate": {
+		usage:    "validate [policy...]\tcheck scaling policy documents, defaults to $NEMESIS_POLICY",
+		run:      runValidate,
+		noConfig: true,
+	},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+
+	// Local runs can point the clients at other endpoints through the aws section of the configuration
+	if !cmd.noConfig {
+		err := config.InitClients(ctx)
+		if err == nil {
+			_, err = config.Load(ctx)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "nemesis:", err)
+			os.Exit(1)
+		}
+	}
+
+	err := cmd.run(ctx, os.Args[2:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "nemesis:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: nemesis <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr)
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  "+commands[name].usage)
+	}
+}
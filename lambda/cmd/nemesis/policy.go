@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"github.com/vmanikes/Nemesis/simulate"
+)
+
+// addPolicyFlags adds a flag for every scaling constant of the policy, defaulting to its current value
+func addPolicyFlags(flags *flag.FlagSet, policy *simulate.Policy) {
+	flags.Int64Var(&policy.ScalePeriodMinutes, "scale-period-minutes", policy.ScalePeriodMinutes, "ScalePeriodMinutes")
+	flags.Int64Var(&policy.ScaleUpEvaluationPeriodMinutes, "scale-up-evaluation-periods", policy.ScaleUpEvaluationPeriodMinutes, "ScaleUpEvaluationPeriodMinutes")
+	flags.Int64Var(&policy.ScaleDownEvaluationPeriodMinutes, "scale-down-evaluation-periods", policy.ScaleDownEvaluationPeriodMinutes, "ScaleDownEvaluationPeriodMinutes")
+	flags.Int64Var(&policy.DataPointsToScaleUp, "datapoints-to-scale-up", policy.DataPointsToScaleUp, "DataPointsToScaleUp")
+	flags.Int64Var(&policy.DataPointsToScaleDown, "datapoints-to-scale-down", policy.DataPointsToScaleDown, "DataPointsToScaleDown")
+	flags.Int64Var(&policy.ScaleDownMinIterAgeMinutes, "scale-down-min-iter-age-minutes", policy.ScaleDownMinIterAgeMinutes, "ScaleDownMinIterAgeMinutes")
+	flags.Float64Var(&policy.ScaleUpThreshold, "scale-up-threshold", policy.ScaleUpThreshold, "ScaleUpThreshold")
+	flags.Float64Var(&policy.ScaleDownThreshold, "scale-down-threshold", policy.ScaleDownThreshold, "ScaleDownThreshold")
+	flags.IntVar(&policy.MaxShardCount, "max-shard-count", policy.MaxShardCount, "MaxShardCount")
+	flags.IntVar(&policy.MaxReshardsPerDay, "max-reshards-per-day", policy.MaxReshardsPerDay, "MaxReshardsPerDay")
+}
+
+// validatePolicy rejects policies the simulation cannot run
+func validatePolicy(policy simulate.Policy) error {
+	if policy.ScalePeriodMinutes <= 0 {
+		return errors.New("scale-period-minutes must be positive")
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/vmanikes/Nemesis/config"
+	"github.com/vmanikes/Nemesis/simulate"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// runSimulate replays a traffic profile through a local model of the alarms and the scaling decisions
+func runSimulate(ctx context.Context, args []string) error {
+	defaults := simulate.DefaultConfig()
+
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	csvPath := flags.String("csv", "", "CSV file with the per minute bytes and records, instead of a synthetic shape")
+	shape := flags.String("shape", "constant", "synthetic shape: constant, ramp, sine or spike")
+	minutes := flags.Int("minutes", 24*60, "length of the synthetic profile in minutes")
+	bytesPerSecond := flags.Float64("bytes-per-sec", 512*1024, "base bytes per second of the synthetic profile")
+	recordsPerSecond := flags.Float64("records-per-sec", 500, "base records per second of the synthetic profile")
+	peakFactor := flags.Float64("peak-factor", 4, "multiplier of the base traffic at the peak of the synthetic shape")
+	shards := flags.Int("shards", defaults.InitialShardCount, "initial shard count")
+	reshardMinutes := flags.Int("reshard-minutes", defaults.ReshardMinutes, "minutes a stream stays UPDATING after a reshard")
+	throttling := flags.Bool("throttling-alarm", defaults.ThrottlingAlarm, "simulate the throttling alarm")
+	shardHourPrice := flags.Float64("shard-hour-price", defaults.ShardHourPrice, "price of one shard hour")
+	addPolicyFlags(flags, &defaults.Policy)
+	asJSON := flags.Bool("json", false, "print the full result as JSON")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		return errors.New("simulate takes no arguments")
+	}
+
+	var (
+		profile simulate.Profile
+		err     error
+	)
+
+	if *csvPath != "" {
+		profile, err = simulate.FileSource{Path: *csvPath}.Profile(ctx, "", time.Time{}, time.Time{})
+		if err != nil {
+			return err
+		}
+	} else {
+		profile, err = simulate.Synthetic{
+			Shape:            *shape,
+			Minutes:          *minutes,
+			BytesPerSecond:   *bytesPerSecond,
+			RecordsPerSecond: *recordsPerSecond,
+			PeakFactor:       *peakFactor,
+		}.Profile()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = validatePolicy(defaults.Policy); err != nil {
+		return err
+	}
+
+	cfg := defaults
+	cfg.InitialShardCount = *shards
+	cfg.ReshardMinutes = *reshardMinutes
+	cfg.ThrottlingAlarm = *throttling
+	cfg.ShardHourPrice = *shardHourPrice
+
+	if err = withConfiguredScaling(ctx, &cfg, ""); err != nil {
+		return err
+	}
+
+	result, err := simulate.Run(profile, cfg)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+
+	if err = printTimeline(result); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	printResult(result)
+
+	return nil
+}
+
+// withConfiguredScaling sets the scaling strategy and the cooldowns of the configuration on the simulation, those of the
+// stream when one is given and the defaults otherwise
+func withConfiguredScaling(ctx context.Context, cfg *simulate.Config, streamName string) error {
+	configuration, err := config.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	location := configuration.Registry.ForStream(streamName)
+	cfg.Strategy, err = configuration.Strategy(location)
+	if err != nil {
+		return err
+	}
+	cfg.Cooldowns = configuration.Settings(location).Cooldowns
+
+	return nil
+}
+
+// printTimeline prints every simulated invocation of the Lambda
+func printTimeline(result simulate.Result) error {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "MINUTE\tACTION\tOUTCOME\tSHARDS\tUSAGE\tREASON")
+	for _, action := range result.Timeline {
+		shardCount := fmt.Sprintf("%d", action.ShardCount)
+		if action.TargetCount > 0 {
+			shardCount = fmt.Sprintf("%d -> %d", action.ShardCount, action.TargetCount)
+		}
+
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%.3f\t%s\n",
+			action.Minute, action.Action, action.Outcome, shardCount, action.UsageFactor, action.Reason)
+	}
+
+	return writer.Flush()
+}
+
+// printResult prints the totals of a simulation
+func printResult(result simulate.Result) {
+	fmt.Printf("minutes:            %d\n", result.Minutes)
+	fmt.Printf("reshards:           %d\n", result.Reshards)
+	fmt.Printf("throttled minutes:  %d (%.0f records)\n", result.ThrottledMinutes, result.ThrottledRecords)
+	fmt.Printf("shard hours:        %.2f\n", result.ShardHours)
+	fmt.Printf("cost:               %.2f\n", result.Cost)
+}
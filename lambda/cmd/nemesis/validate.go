@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/vmanikes/Nemesis/constants"
+	"github.com/vmanikes/Nemesis/policy"
+	"os"
+)
+
+// runValidate checks scaling policy documents, printing every error with its line and column so that CI can point at
+// them
+func runValidate(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	_ = flags.Parse(args)
+
+	sources := flags.Args()
+	if len(sources) == 0 {
+		source := os.Getenv(constants.PolicyEnv)
+		if source == "" {
+			return errors.New("validate takes the policy documents to check, or reads $" + constants.PolicyEnv)
+		}
+		sources = []string{source}
+	}
+
+	invalid := 0
+	for _, source := range sources {
+		body, err := policy.Read(ctx, source)
+		if err != nil {
+			return err
+		}
+
+		document, err := policy.Parse(body)
+		if err == nil {
+			fmt.Printf("%s: ok, %d policies\n", source, len(document.Policies))
+			continue
+		}
+
+		invalid++
+
+		var errs policy.Errors
+		if !errors.As(err, &errs) {
+			return err
+		}
+		for _, e := range errs {
+			if e.Path == "" {
+				fmt.Printf("%s:%d:%d: %s\n", source, e.Line, e.Column, e.Message)
+			} else {
+				fmt.Printf("%s:%d:%d: %s: %s\n", source, e.Line, e.Column, e.Path, e.Message)
+			}
+		}
+	}
+
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d policy documents are invalid", invalid, len(sources))
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+// Package config contains the runtime configuration of Nemesis
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/vmanikes/Nemesis/accounts"
+	"github.com/vmanikes/Nemesis/clients"
+	"github.com/vmanikes/Nemesis/cloudwatch"
+	"github.com/vmanikes/Nemesis/constants"
+	"github.com/vmanikes/Nemesis/consumers"
+	"github.com/vmanikes/Nemesis/forecast"
+	"github.com/vmanikes/Nemesis/freeze"
+	"github.com/vmanikes/Nemesis/logging"
+	"github.com/vmanikes/Nemesis/notify"
+	"github.com/vmanikes/Nemesis/policy"
+	"github.com/vmanikes/Nemesis/scaling"
+	"github.com/vmanikes/Nemesis/schedule"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Config is the runtime configuration of Nemesis
+type Config struct {
+	// Notifications are the channels that are told about applied and failed scaling actions
+	Notifications []notify.Channel `json:"notifications,omitempty"`
+	// Consumers scales the Lambda consumers of the streams along with their shard count
+	Consumers consumers.Config `json:"consumers"`
+	// ReadSide adds read-side usage factors to the alarms, so that read pressure alone can trigger a scale-up
+	ReadSide cloudwatch.ReadSide `json:"readSide"`
+	// Schedules are the scheduled scaling rules of the streams, keyed by stream name
+	Schedules map[string][]schedule.Rule `json:"schedules,omitempty"`
+	// Forecast scales streams up ahead of the peaks their seasonality predicts
+	Forecast forecast.Config `json:"forecast"`
+	// Freezes stop the scaling of a stream, given by name or ARN, or of every stream when they have no stream, until they
+	// expire
+	Freezes []freeze.Window `json:"freezes,omitempty"`
+	// Cooldowns are the least times between scaling actions by their direction, and the flap detection
+	Cooldowns scaling.Cooldowns `json:"cooldowns"`
+	// Registry holds the roles to assume for the streams in other accounts, and the streams that are scheduled or
+	// forecast by name in another account or region
+	Registry accounts.Registry `json:"registry"`
+	// AWS configures the retries, timeouts and endpoints of the AWS clients
+	AWS clients.Options `json:"aws"`
+	// AlarmNaming is the naming of the scaling alarms, for the alarms that are not paired by their tags and for finding
+	// the alarms of a stream
+	AlarmNaming cloudwatch.AlarmNaming `json:"alarmNaming"`
+	// Strategies select the scaling strategy of every stream, the one that decides its target shard count when one of
+	// its alarms fires
+	Strategies scaling.Strategies `json:"strategies"`
+
+	// defaultPolicy and streamPolicies are the policies of the scaling policy document that Settings applies
+	defaultPolicy  *policy.Policy
+	streamPolicies map[string]policy.Policy
+}
+
+// InitClients makes the aws section of the configuration in NEMESIS_CONFIG the options of the process-level clients. It
+// is called once at startup before Load, so that the scaling policy is read from S3 or SSM with the configured
+// endpoints, retries and timeouts
+func InitClients(ctx context.Context) error {
+	cfg, err := Parse(ctx, os.Getenv(constants.ConfigEnv))
+	if err != nil {
+		return err
+	}
+
+	clients.Init(cfg.AWS)
+	return nil
+}
+
+// Load reads the configuration from the NEMESIS_CONFIG environment variable, which holds either the configuration as
+// JSON or the path to a JSON file. An empty configuration is returned when the variable is not set. The scaling policy
+// document at the source in NEMESIS_POLICY is applied on top of it. Forecasts need the audit store of
+// NEMESIS_AUDIT_STORE
+func Load(ctx context.Context) (*Config, error) {
+	logger := logging.WithContext(ctx)
+
+	cfg, err := Parse(ctx, os.Getenv(constants.ConfigEnv))
+	if err != nil {
+		return nil, err
+	}
+
+	source := strings.TrimSpace(os.Getenv(constants.PolicyEnv))
+	if source != "" {
+		document, err := policy.Load(ctx, source)
+		if err != nil {
+			logger.Error("invalid scaling policy",
+				zap.String("source", source),
+				zap.Error(err))
+			return nil, err
+		}
+
+		err = cfg.ApplyPolicy(document)
+		if err != nil {
+			logger.Error("invalid scaling policy",
+				zap.String("source", source),
+				zap.Error(err))
+			return nil, err
+		}
+	}
+
+	// The forecasts are made once per period and scored against the previous one, both found in the audit trail
+	if cfg.Forecast.Enabled && strings.TrimSpace(os.Getenv(constants.AuditStoreEnv)) == "" {
+		err = errors.New("forecast is enabled without an audit store, set " + constants.AuditStoreEnv)
+		logger.Error("invalid forecast config",
+			zap.Error(err))
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Parse reads the configuration from inline JSON or from the JSON file at the given path
+func Parse(ctx context.Context, source string) (*Config, error) {
+	logger := logging.WithContext(ctx)
+
+	cfg := &Config{}
+
+	source = strings.TrimSpace(source)
+	if source == "" {
+		return cfg, nil
+	}
+
+	body := []byte(source)
+	if !strings.HasPrefix(source, "{") {
+		var err error
+		body, err = ioutil.ReadFile(source)
+		if err != nil {
+			logger.Error("unable to read config file",
+				zap.String("path", source),
+				zap.Error(err))
+			return nil, err
+		}
+	}
+
+	err := json.Unmarshal(body, cfg)
+	if err != nil {
+		logger.Error("unable to unmarshal config",
+			zap.Error(err))
+		return nil, err
+	}
+
+	err = schedule.Validate(cfg.Schedules)
+	if err != nil {
+		logger.Error("invalid scheduled scaling rules",
+			zap.Error(err))
+		return nil, err
+	}
+
+	err = freeze.Validate(cfg.Freezes)
+	if err != nil {
+		logger.Error("invalid freeze windows",
+			zap.Error(err))
+		return nil, err
+	}
+
+	err = cfg.Registry.Validate()
+	if err != nil {
+		logger.Error("invalid stream registry",
+			zap.Error(err))
+		return nil, err
+	}
+
+	err = cfg.AWS.Validate()
+	if err != nil {
+		logger.Error("invalid aws client options",
+			zap.Error(err))
+		return nil, err
+	}
+
+	err = cfg.AlarmNaming.Validate()
+	if err != nil {
+		logger.Error("invalid alarm naming",
+			zap.Error(err))
+		return nil, err
+	}
+
+	err = cfg.Strategies.Validate()
+	if err != nil {
+		logger.Error("invalid scaling strategies",
+			zap.Error(err))
+		return nil, err
+	}
+
+	return cfg, nil
+}
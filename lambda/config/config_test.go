@@ -0,0 +1,126 @@
+package config
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmanikes/Nemesis/accounts"
+	"github.com/vmanikes/Nemesis/constants"
+	"github.com/vmanikes/Nemesis/freeze"
+	"github.com/vmanikes/Nemesis/notify"
+	"github.com/vmanikes/Nemesis/scaling"
+	"github.com/vmanikes/Nemesis/schedule"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	ctx := context.Background()
+
+	cfg, err := Parse(ctx, "")
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.Notifications)
+
+	cfg, err = Parse(ctx, `{"notifications": [{"type": "slack", "target": "https://hooks.slack.com/x", "severities": ["error"]}]}`)
+	assert.NoError(t, err)
+	assert.Equal(t, []notify.Channel{
+		{Type: "slack", Target: "https://hooks.slack.com/x", Severities: []notify.Severity{notify.SeverityError}},
+	}, cfg.Notifications)
+
+	path := filepath.Join(t.TempDir(), "nemesis.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"notifications": [{"type": "sns", "target": "arn"}]}`), 0644))
+
+	cfg, err = Parse(ctx, path)
+	assert.NoError(t, err)
+	assert.Len(t, cfg.Notifications, 1)
+
+	_, err = Parse(ctx, "{")
+	assert.Error(t, err)
+}
+
+func TestParseSchedules(t *testing.T) {
+	ctx := context.Background()
+
+	cfg, err := Parse(ctx, `{"schedules": {"test-stream": [{"name": "nightly-batch", "cron": "0 2 * * *", "durationMinutes": 120, "minShardCount": 8}]}}`)
+	assert.NoError(t, err)
+	assert.Len(t, cfg.Schedules["test-stream"], 1)
+
+	_, err = Parse(ctx, `{"schedules": {"test-stream": [{"name": "nightly-batch", "cron": "0 2 * *", "durationMinutes": 120, "minShardCount": 8}]}}`)
+	assert.Error(t, err)
+}
+
+func TestLoad_ForecastWithoutAuditStore(t *testing.T) {
+	t.Setenv(constants.PolicyEnv, "")
+	t.Setenv(constants.ConfigEnv, `{"forecast": {"enabled": true, "streams": ["test-stream"]}}`)
+	t.Setenv(constants.AuditStoreEnv, "")
+
+	_, err := Load(context.Background())
+	assert.Error(t, err)
+
+	t.Setenv(constants.AuditStoreEnv, "dynamodb://nemesis-audit")
+	cfg, err := Load(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, cfg.Forecast.Covers("test-stream"))
+}
+
+func TestStreamLookups(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "us-east-1")
+
+	cfg, err := Parse(ctx, `{
+		"strategies": {"streams": {
+			"orders": {"name": "targetTracking"},
+			"arn:aws:kinesis:eu-west-1:999999999999:stream/orders": {"name": "step"}
+		}},
+		"schedules": {
+			"orders": [{"name": "local", "cron": "0 2 * * *", "durationMinutes": 60, "minShardCount": 2}],
+			"arn:aws:kinesis:us-east-1:123456789012:stream/orders": [{"name": "by-arn", "cron": "0 4 * * *", "durationMinutes": 60, "minShardCount": 4}],
+			"arn:aws:kinesis:eu-west-1:999999999999:stream/orders": [{"name": "remote", "cron": "0 2 * * *", "durationMinutes": 60, "minShardCount": 8}]
+		},
+		"freezes": [
+			{"until": "2022-10-03T12:00:00Z", "reason": "all"},
+			{"stream": "orders", "until": "2022-10-03T12:00:00Z", "reason": "local"},
+			{"stream": "arn:aws:kinesis:eu-west-1:999999999999:stream/orders", "until": "2022-10-03T12:00:00Z", "reason": "remote"}
+		]
+	}`)
+	assert.NoError(t, err)
+
+	local := accounts.Target{StreamName: "orders", AccountID: "123456789012", Region: "us-east-1"}
+	remote := accounts.Target{StreamName: "orders", AccountID: "999999999999", Region: "eu-west-1"}
+
+	strategy, err := cfg.Strategy(local)
+	assert.NoError(t, err)
+	assert.Equal(t, scaling.TargetTracking{TargetUsageFactor: 0.15, MaxIteratorAgeMinutes: 30}, strategy)
+
+	strategy, err = cfg.Strategy(remote)
+	assert.NoError(t, err)
+	assert.Equal(t, scaling.Step{ScaleUpPercent: 50, ScaleDownPercent: 25}, strategy)
+
+	strategy, err = cfg.Strategy(accounts.Target{StreamName: "clicks"})
+	assert.NoError(t, err)
+	assert.Equal(t, scaling.Doubling{}, strategy)
+
+	names := func(rules []schedule.Rule) []string {
+		result := make([]string, 0, len(rules))
+		for _, rule := range rules {
+			result = append(result, rule.Name)
+		}
+		return result
+	}
+	assert.ElementsMatch(t, []string{"local", "by-arn"}, names(cfg.Schedule(local)))
+	assert.Equal(t, []string{"remote"}, names(cfg.Schedule(remote)))
+
+	reasons := func(windows []freeze.Window) []string {
+		result := make([]string, 0, len(windows))
+		for _, window := range windows {
+			result = append(result, window.Reason)
+		}
+		return result
+	}
+	assert.Equal(t, []string{"all", "local"}, reasons(cfg.FreezeWindows(local)))
+	assert.Equal(t, []string{"all", "remote"}, reasons(cfg.FreezeWindows(remote)))
+	assert.Equal(t, []string{"all"}, reasons(cfg.FreezeWindows(accounts.Target{StreamName: "clicks"})))
+
+	// The local stream is named by ARN and by name, and is scheduled once
+	assert.Equal(t, []accounts.Target{remote, local}, cfg.ScheduledStreams())
+}
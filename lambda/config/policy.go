@@ -0,0 +1,70 @@
+package config
+
+import (
+	"github.com/vmanikes/Nemesis/freeze"
+	"github.com/vmanikes/Nemesis/policy"
+	"github.com/vmanikes/Nemesis/scaling"
+	"github.com/vmanikes/Nemesis/schedule"
+)
+
+// ApplyPolicy merges the scaling policy document into the configuration. The strategies, schedules, notifications and
+// freezes of a policy are added for its streams. The thresholds, periods, datapoints, iterator age block, bounds and
+// cooldowns of the default policy and of the policy of a stream are returned by Settings
+func (c *Config) ApplyPolicy(document *policy.Document) error {
+	for _, p := range document.Policies {
+		if len(p.Streams) == 0 {
+			c.applyDefaultPolicy(p)
+			continue
+		}
+
+		for _, streamName := range p.Streams {
+			if c.streamPolicies == nil {
+				c.streamPolicies = make(map[string]policy.Policy)
+			}
+			c.streamPolicies[streamName] = p
+
+			if p.Strategy != nil {
+				if c.Strategies.Streams == nil {
+					c.Strategies.Streams = make(map[string]scaling.StrategyConfig)
+				}
+				c.Strategies.Streams[streamName] = *p.Strategy
+			}
+
+			if len(p.Schedules) > 0 {
+				if c.Schedules == nil {
+					c.Schedules = make(map[string][]schedule.Rule)
+				}
+				c.Schedules[streamName] = append(c.Schedules[streamName], p.Schedules...)
+			}
+
+			for _, window := range p.Freezes {
+				window.StreamName = streamName
+				c.Freezes = append(c.Freezes, window)
+			}
+		}
+
+		for _, channel := range p.Notifications {
+			channel.Streams = p.Streams
+			c.Notifications = append(c.Notifications, channel)
+		}
+	}
+
+	// The rules of a stream in the configuration and in its policy must not clash
+	err := schedule.Validate(c.Schedules)
+	if err != nil {
+		return err
+	}
+
+	return freeze.Validate(c.Freezes)
+}
+
+// applyDefaultPolicy sets the fields of the default policy
+func (c *Config) applyDefaultPolicy(p policy.Policy) {
+	c.defaultPolicy = &p
+
+	if p.Strategy != nil {
+		c.Strategies.Default = *p.Strategy
+	}
+	c.Notifications = append(c.Notifications, p.Notifications...)
+	c.Freezes = append(c.Freezes, p.Freezes...)
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmanikes/Nemesis/accounts"
+	"github.com/vmanikes/Nemesis/clients"
+	"github.com/vmanikes/Nemesis/constants"
+	"github.com/vmanikes/Nemesis/scaling"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad_Policy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`version: 1
+policies:
+  - name: default
+    thresholds:
+      scaleUp: 0.3
+      scaleDown: 0.1
+    bounds:
+      minShardCount: 1
+      maxShardCount: 64
+    cooldowns:
+      scaleUpMinutes: 10
+    strategy:
+      name: step
+  - name: checkout
+    streams: [orders, payments]
+    thresholds:
+      scaleUp: 0.5
+      scaleDown: 0.2
+    periods:
+      scalePeriodMinutes: 1
+      scaleUpEvaluationMinutes: 5
+      scaleDownEvaluationMinutes: 60
+    bounds:
+      minShardCount: 4
+      maxShardCount: 16
+    cooldowns:
+      scaleUpMinutes: 2
+    strategy:
+      name: doubling
+    schedules:
+      - name: nightly-batch
+        cron: "0 2 * * *"
+        durationMinutes: 120
+        minShardCount: 8
+    notifications:
+      - type: sns
+        target: arn:aws:sns:us-east-1:123456789012:checkout
+    freezes:
+      - until: 2026-12-01T00:00:00Z
+`), 0644))
+
+	t.Setenv(constants.ConfigEnv, `{"notifications": [{"type": "sns", "target": "arn:aws:sns:us-east-1:123456789012:all"}]}`)
+	t.Setenv(constants.PolicyEnv, path)
+
+	cfg, err := Load(context.Background())
+	assert.NoError(t, err)
+
+	// The policies do not change the constants every stream starts from
+	assert.Equal(t, 0.25, constants.ScaleUpThreshold)
+	assert.Equal(t, 10000, constants.MaxShardCount)
+
+	settings := cfg.Settings(accounts.Target{StreamName: "invoices"})
+	assert.Equal(t, 0.3, settings.Alarms.ScaleUpThreshold)
+	assert.Equal(t, int64(5), settings.Alarms.ScalePeriodMinutes)
+	assert.Equal(t, scaling.Bounds{MinShardCount: 1, MaxShardCount: 64, ScheduledMinimum: 2}, settings.Bounds(2))
+	assert.Equal(t, 10, settings.Cooldowns.ScaleUpMinutes)
+
+	settings = cfg.Settings(accounts.Target{StreamName: "orders"})
+	assert.Equal(t, 0.5, settings.Alarms.ScaleUpThreshold)
+	assert.Equal(t, 0.2, settings.Alarms.ScaleDownThreshold)
+	assert.Equal(t, int64(1), settings.Alarms.ScalePeriodMinutes)
+	assert.Equal(t, int64(60), settings.Alarms.ScaleDownEvaluationPeriods)
+	// The datapoints are those of the constants, the default policy does not set them
+	assert.Equal(t, int64(5), settings.Alarms.DataPointsToScaleUp)
+	assert.Equal(t, 16, settings.Capped(32))
+	assert.Equal(t, 4, settings.MinShardCount)
+	assert.Equal(t, 2, settings.Cooldowns.ScaleUpMinutes)
+
+	assert.Equal(t, "step", cfg.Strategies.Default.Name)
+	assert.Equal(t, "doubling", cfg.Strategies.Streams["orders"].Name)
+	assert.Equal(t, "doubling", cfg.Strategies.Streams["payments"].Name)
+
+	assert.Len(t, cfg.Schedules["orders"], 1)
+	assert.Len(t, cfg.Schedules["payments"], 1)
+
+	assert.Len(t, cfg.Notifications, 2)
+	assert.Empty(t, cfg.Notifications[0].Streams)
+	assert.Equal(t, []string{"orders", "payments"}, cfg.Notifications[1].Streams)
+
+	assert.Len(t, cfg.Freezes, 2)
+	assert.Equal(t, "orders", cfg.Freezes[0].StreamName)
+	assert.Equal(t, "payments", cfg.Freezes[1].StreamName)
+}
+
+func TestLoad_InvalidPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("version: 1\npolicies:\n  - name: default\n    bounds: 4\n"), 0644))
+
+	t.Setenv(constants.ConfigEnv, "")
+	t.Setenv(constants.PolicyEnv, path)
+
+	_, err := Load(context.Background())
+	assert.EqualError(t, err, "line 4, column 13: policies[0].bounds: expected a mapping")
+}
+
+func TestInitClients_PolicyFromS3(t *testing.T) {
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		_, _ = w.Write([]byte("version: 1\npolicies:\n  - name: default\n    bounds:\n      minShardCount: 1\n      maxShardCount: 32\n"))
+	}))
+	defer server.Close()
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv(constants.ConfigEnv, `{"aws": {"endpoint": "`+server.URL+`", "maxAttempts": 1}}`)
+	t.Setenv(constants.PolicyEnv, "s3://nemesis-config/policy.yaml")
+	t.Cleanup(func() {
+		clients.Init(clients.Options{})
+	})
+
+	// The policy is read from the endpoint of the aws section, not from S3
+	assert.NoError(t, InitClients(context.Background()))
+	cfg, err := Load(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/nemesis-config/policy.yaml", requested)
+		assert.Equal(t, 32, cfg.Settings(accounts.Target{StreamName: "orders"}).MaxShardCount)
+	}
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"github.com/vmanikes/Nemesis/accounts"
+	"github.com/vmanikes/Nemesis/cloudwatch"
+	"github.com/vmanikes/Nemesis/constants"
+	"github.com/vmanikes/Nemesis/policy"
+	"github.com/vmanikes/Nemesis/scaling"
+)
+
+// StreamSettings are the settings a stream is scaled with: those of the constants and the configuration, overridden
+// by the default policy and then by the policy of the stream
+type StreamSettings struct {
+	// Alarms are the period, evaluation periods, datapoints and thresholds of the alarms of the stream
+	Alarms        cloudwatch.AlarmSettings
+	MinShardCount int
+	MaxShardCount int
+	Cooldowns     scaling.Cooldowns
+}
+
+// Bounds returns the shard count bounds of the stream with the scheduled minimum
+func (s StreamSettings) Bounds(scheduledMinimum int) scaling.Bounds {
+	return scaling.Bounds{
+		MinShardCount:    s.MinShardCount,
+		MaxShardCount:    s.MaxShardCount,
+		ScheduledMinimum: scheduledMinimum,
+	}
+}
+
+// Capped returns the shard count, lowered to the maximum shard count of the stream
+func (s StreamSettings) Capped(shardCount int) int {
+	if shardCount > s.MaxShardCount {
+		return s.MaxShardCount
+	}
+	return shardCount
+}
+
+// Settings returns the settings of the stream at the target
+func (c *Config) Settings(location accounts.Target) StreamSettings {
+	settings := StreamSettings{
+		Alarms:        cloudwatch.DefaultAlarmSettings(),
+		MinShardCount: constants.MinShardCount,
+		MaxShardCount: constants.MaxShardCount,
+		Cooldowns:     c.Cooldowns,
+	}
+
+	if c.defaultPolicy != nil {
+		settings.apply(*c.defaultPolicy)
+	}
+	keys := make([]string, 0, len(c.streamPolicies))
+	for stream := range c.streamPolicies {
+		keys = append(keys, stream)
+	}
+	if stream, ok := c.streamKey(location, keys); ok {
+		settings.apply(c.streamPolicies[stream])
+	}
+
+	return settings
+}
+
+// apply overrides the settings with those the policy sets
+func (s *StreamSettings) apply(p policy.Policy) {
+	if t := p.Thresholds; t != nil {
+		s.Alarms.ScaleUpThreshold = t.ScaleUp
+		s.Alarms.ScaleDownThreshold = t.ScaleDown
+	}
+	if periods := p.Periods; periods != nil {
+		s.Alarms.ScalePeriodMinutes = periods.ScalePeriodMinutes
+		s.Alarms.ScaleUpEvaluationPeriods = periods.ScaleUpEvaluationMinutes / periods.ScalePeriodMinutes
+		s.Alarms.ScaleDownEvaluationPeriods = periods.ScaleDownEvaluationMinutes / periods.ScalePeriodMinutes
+	}
+	if datapoints := p.Datapoints; datapoints != nil {
+		s.Alarms.DataPointsToScaleUp = datapoints.ScaleUp
+		s.Alarms.DataPointsToScaleDown = datapoints.ScaleDown
+	}
+	if p.IteratorAgeBlockMinutes > 0 {
+		s.Alarms.ScaleDownMinIterAgeMinutes = p.IteratorAgeBlockMinutes
+	}
+	if b := p.Bounds; b != nil {
+		s.MinShardCount = b.MinShardCount
+		s.MaxShardCount = b.MaxShardCount
+	}
+	if p.Cooldowns != nil {
+		s.Cooldowns = *p.Cooldowns
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"github.com/vmanikes/Nemesis/accounts"
+	"github.com/vmanikes/Nemesis/freeze"
+	"github.com/vmanikes/Nemesis/scaling"
+	"github.com/vmanikes/Nemesis/schedule"
+	"sort"
+)
+
+// Strategy returns the scaling strategy of the stream at the target
+func (c *Config) Strategy(location accounts.Target) (scaling.ScalingStrategy, error) {
+	keys := make([]string, 0, len(c.Strategies.Streams))
+	for stream := range c.Strategies.Streams {
+		keys = append(keys, stream)
+	}
+
+	if stream, ok := c.streamKey(location, keys); ok {
+		return c.Strategies.For(stream)
+	}
+	return c.Strategies.Fallback()
+}
+
+// Schedule returns the scheduled scaling rules of the stream at the target, of every stream name or ARN that names it
+func (c *Config) Schedule(location accounts.Target) []schedule.Rule {
+	keys := make([]string, 0, len(c.Schedules))
+	for stream := range c.Schedules {
+		keys = append(keys, stream)
+	}
+
+	rules := make([]schedule.Rule, 0)
+	for _, stream := range c.streamKeys(location, keys) {
+		rules = append(rules, c.Schedules[stream]...)
+	}
+
+	return rules
+}
+
+// FreezeWindows returns the freeze windows of every stream and those of every stream name or ARN that names the stream
+// at the target
+func (c *Config) FreezeWindows(location accounts.Target) []freeze.Window {
+	windows := make([]freeze.Window, 0)
+	for _, window := range c.Freezes {
+		if window.StreamName == "" || c.Registry.Matches(window.StreamName, location) {
+			windows = append(windows, window)
+		}
+	}
+
+	return windows
+}
+
+// ScheduledStreams returns the targets of the streams with scheduled scaling rules, once each
+func (c *Config) ScheduledStreams() []accounts.Target {
+	keys := make([]string, 0, len(c.Schedules))
+	for stream := range c.Schedules {
+		keys = append(keys, stream)
+	}
+	sort.Strings(keys)
+
+	locations := make([]accounts.Target, 0, len(keys))
+	for _, stream := range keys {
+		if !c.scheduled(stream, locations) {
+			locations = append(locations, c.Registry.ForStream(stream))
+		}
+	}
+
+	return locations
+}
+
+// scheduled checks if the stream, given by ARN or by name, is one of the targets
+func (c *Config) scheduled(stream string, locations []accounts.Target) bool {
+	for _, location := range locations {
+		if c.Registry.Matches(stream, location) {
+			return true
+		}
+	}
+	return false
+}
+
+// streamKey returns the stream name or ARN among the keys that names the stream at the target, an ARN before a name
+func (c *Config) streamKey(location accounts.Target, keys []string) (string, bool) {
+	matching := c.streamKeys(location, keys)
+	if len(matching) == 0 {
+		return "", false
+	}
+
+	for _, stream := range matching {
+		if _, err := accounts.ParseStreamARN(stream); err == nil {
+			return stream, true
+		}
+	}
+
+	return matching[0], true
+}
+
+// streamKeys returns the sorted stream names and ARNs among the keys that name the stream at the target
+func (c *Config) streamKeys(location accounts.Target, keys []string) []string {
+	matching := make([]string, 0)
+	for _, stream := range keys {
+		if c.Registry.Matches(stream, location) {
+			matching = append(matching, stream)
+		}
+	}
+	sort.Strings(matching)
+
+	return matching
+}
@@ -9,13 +9,37 @@ var (
 	// ScaleDownEvaluationPeriodMinutes specifies the evaluation period for scaling down streams. Default is 300 minutes
 	ScaleDownEvaluationPeriodMinutes = 300 / ScalePeriodMinutes
 	// DataPointsToScaleUp specifies the number of data points to scale up
-	DataPointsToScaleUp              = 25 / ScalePeriodMinutes
+	DataPointsToScaleUp = 25 / ScalePeriodMinutes
 	// DataPointsToScaleDown specifies the number of data points to scale down
-	DataPointsToScaleDown            = 285 / ScalePeriodMinutes
+	DataPointsToScaleDown = 285 / ScalePeriodMinutes
 	// ScaleDownMinIterAgeMinutes Will wait for the lambdas/shards to clear backlog
 	ScaleDownMinIterAgeMinutes int64 = 30
 	// ScaleUpThreshold sets the upper limit at crossing which the shards will scale up
-	ScaleUpThreshold                 = 0.25
+	ScaleUpThreshold = 0.25
 	// ScaleDownThreshold sets the lower limit at crossing which the shards will scale down
-	ScaleDownThreshold               = 0.075
+	ScaleDownThreshold = 0.075
+	// MinShardCount is the lowest shard count a stream is scaled down to
+	MinShardCount = 1
+	// MaxShardCount is the highest shard count a stream is scaled up to
+	MaxShardCount = 10000
+	// MaxReshardsPerDay is the number of shard count updates kinesis allows per stream in a rolling 24 hour period
+	MaxReshardsPerDay = 10
+	// ScheduleLeadMinutes is how long before a scheduled scaling window its minimum shard count is applied, to cover
+	// the resharding time. Rules can override it
+	ScheduleLeadMinutes = 30
+)
+
+// Version is the Nemesis version the binary was built from, set at build time with
+// -ldflags "-X github.com/vmanikes/Nemesis/constants.Version=<version>"
+var Version = "dev"
+
+const (
+	// AuditStoreEnv is the environment variable that holds the URI of the audit store, e.g. dynamodb://nemesis-audit.
+	// Scaling events are not persisted when it is not set
+	AuditStoreEnv = "NEMESIS_AUDIT_STORE"
+	// ConfigEnv is the environment variable that holds the Nemesis configuration, either inline JSON or a file path
+	ConfigEnv = "NEMESIS_CONFIG"
+	// PolicyEnv is the environment variable that holds the source of the scaling policy document, a file path,
+	// s3://<bucket>/<key> or ssm:<parameter name>. No policy is applied when it is not set
+	PolicyEnv = "NEMESIS_POLICY"
 )
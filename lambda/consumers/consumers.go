@@ -0,0 +1,289 @@
+// Package consumers contains the methods to scale the Lambda consumers of a kinesis stream along with its shards
+package consumers
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/vmanikes/Nemesis/accounts"
+	"github.com/vmanikes/Nemesis/clients"
+	"github.com/vmanikes/Nemesis/logging"
+	"go.uber.org/zap"
+	"math"
+	"strings"
+)
+
+const (
+	// minParallelizationFactor and maxParallelizationFactor are the bounds Lambda accepts for kinesis event sources
+	minParallelizationFactor = 1
+	maxParallelizationFactor = 10
+)
+
+// Config configures how the consumers follow the shard count of their stream
+type Config struct {
+	// Enabled turns on consumer scaling after every reshard
+	Enabled bool `json:"enabled"`
+	// ConcurrencyPerShard is the number of concurrent consumer invocations wanted per shard. It sets the
+	// parallelization factor of the event source mappings, rounded up and bounded to 1-10
+	ConcurrencyPerShard float64 `json:"concurrencyPerShard"`
+	// ReserveConcurrency sets the reserved concurrency of the consumer functions to what their mappings need. It
+	// defaults to true, when false the reserved concurrency is left as it is, e.g. as an operator set it
+	ReserveConcurrency *bool `json:"reserveConcurrency,omitempty"`
+	// MaxConcurrency is the ceiling of the concurrency of a single consumer function. The parallelization factor of
+	// its mappings is lowered so that they stay under it at the new shard count, and its reserved concurrency is
+	// capped by it. 0 means no ceiling
+	MaxConcurrency int32 `json:"maxConcurrency,omitempty"`
+	// FunctionMaxConcurrency overrides MaxConcurrency for single consumer functions, by function name
+	FunctionMaxConcurrency map[string]int32 `json:"functionMaxConcurrency,omitempty"`
+}
+
+// Reserves checks if the reserved concurrency of the consumer functions is set
+func (c Config) Reserves() bool {
+	return c.ReserveConcurrency == nil || *c.ReserveConcurrency
+}
+
+// Ceiling returns the ceiling of the concurrency of the function, 0 when it has none
+func (c Config) Ceiling(functionArn string) int32 {
+	if ceiling, ok := c.FunctionMaxConcurrency[functionName(functionArn)]; ok {
+		return ceiling
+	}
+
+	return c.MaxConcurrency
+}
+
+// ParallelizationFactor returns the parallelization factor of the mappings of a function that consumes the given
+// number of shards through the given number of event source mappings: the configured concurrency per shard, lowered
+// so that the function stays under its ceiling
+func (c Config) ParallelizationFactor(functionArn string, shardCount, mappingCount int) int32 {
+	factor := int32(math.Ceil(c.ConcurrencyPerShard))
+	if factor > maxParallelizationFactor {
+		factor = maxParallelizationFactor
+	}
+
+	ceiling := c.Ceiling(functionArn)
+	if ceiling > 0 && shardCount*mappingCount > 0 {
+		if fitting := ceiling / int32(shardCount*mappingCount); fitting < factor {
+			factor = fitting
+		}
+	}
+
+	if factor < minParallelizationFactor {
+		return minParallelizationFactor
+	}
+
+	return factor
+}
+
+// ReservedConcurrency returns the reserved concurrency a function needs to consume the given number of shards through
+// the given number of event source mappings
+func (c Config) ReservedConcurrency(functionArn string, shardCount, mappingCount int) int32 {
+	concurrency := int32(shardCount*mappingCount) * c.ParallelizationFactor(functionArn, shardCount, mappingCount)
+	if ceiling := c.Ceiling(functionArn); ceiling > 0 && concurrency > ceiling {
+		return ceiling
+	}
+
+	return concurrency
+}
+
+// functionName returns the name of the function of an ARN, which can be qualified with a version or an alias
+func functionName(functionArn string) string {
+	parts := strings.Split(functionArn, ":")
+	if len(parts) < 7 {
+		return functionArn
+	}
+
+	return parts[6]
+}
+
+// EventSourceMapping is a Lambda function consuming a kinesis stream
+type EventSourceMapping struct {
+	UUID                  string
+	FunctionArn           string
+	ParallelizationFactor int32
+}
+
+// API is the part of the lambda API that Nemesis uses
+type API interface {
+	ListEventSourceMappings(ctx context.Context, params *lambda.ListEventSourceMappingsInput, optFns ...func(*lambda.Options)) (*lambda.ListEventSourceMappingsOutput, error)
+	UpdateEventSourceMapping(ctx context.Context, params *lambda.UpdateEventSourceMappingInput, optFns ...func(*lambda.Options)) (*lambda.UpdateEventSourceMappingOutput, error)
+	PutFunctionConcurrency(ctx context.Context, params *lambda.PutFunctionConcurrencyInput, optFns ...func(*lambda.Options)) (*lambda.PutFunctionConcurrencyOutput, error)
+}
+
+type Client struct {
+	lambdaClient API
+}
+
+// New returns the lambda client of the account and region Nemesis runs in
+func New(ctx context.Context) (*Client, error) {
+	return NewFor(ctx, accounts.Target{})
+}
+
+// NewFor returns the lambda client of the account and region of the target. The clients are built once per process
+// and shared
+func NewFor(ctx context.Context, target accounts.Target) (*Client, error) {
+	client, err := clients.Default().Client(ctx, target, "lambda", func(cfg aws.Config) interface{} {
+		return NewFromConfig(cfg)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return client.(*Client), nil
+}
+
+// NewFromConfig creates the client from an existing aws config, e.g. the config of another account or region
+func NewFromConfig(cfg aws.Config) *Client {
+	return NewFromAPI(lambda.NewFromConfig(cfg))
+}
+
+// NewFromAPI creates the client on top of an existing lambda API implementation
+func NewFromAPI(api API) *Client {
+	return &Client{
+		lambdaClient: api,
+	}
+}
+
+// GetEventSourceMappings takes in a stream arn and returns the event source mappings that consume the stream
+func (c *Client) GetEventSourceMappings(ctx context.Context, streamArn string) ([]EventSourceMapping, error) {
+	logger := logging.WithContext(ctx)
+
+	paginator := lambda.NewListEventSourceMappingsPaginator(c.lambdaClient, &lambda.ListEventSourceMappingsInput{
+		EventSourceArn: aws.String(streamArn),
+	})
+
+	mappings := make([]EventSourceMapping, 0)
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			logger.Error("unable to list event source mappings",
+				zap.String("stream-arn", streamArn),
+				zap.Error(err))
+			return nil, err
+		}
+
+		for _, mapping := range page.EventSourceMappings {
+			mappings = append(mappings, EventSourceMapping{
+				UUID:                  aws.ToString(mapping.UUID),
+				FunctionArn:           aws.ToString(mapping.FunctionArn),
+				ParallelizationFactor: aws.ToInt32(mapping.ParallelizationFactor),
+			})
+		}
+	}
+
+	return mappings, nil
+}
+
+// Scale updates the parallelization factor of every event source mapping of the stream and, unless ReserveConcurrency
+// is false, the reserved concurrency of their functions to follow the new shard count
+func (c *Client) Scale(ctx context.Context, streamArn string, shardCount int, cfg Config) error {
+	logger := logging.WithContext(ctx)
+
+	mappings, err := c.GetEventSourceMappings(ctx, streamArn)
+	if err != nil {
+		return err
+	}
+
+	mappingsPerFunction := make(map[string]int)
+	for _, mapping := range mappings {
+		mappingsPerFunction[mapping.FunctionArn]++
+	}
+
+	for _, mapping := range mappings {
+		parallelizationFactor := cfg.ParallelizationFactor(mapping.FunctionArn, shardCount, mappingsPerFunction[mapping.FunctionArn])
+		if mapping.ParallelizationFactor == parallelizationFactor {
+			continue
+		}
+
+		_, err = c.lambdaClient.UpdateEventSourceMapping(ctx, &lambda.UpdateEventSourceMappingInput{
+			UUID:                  aws.String(mapping.UUID),
+			ParallelizationFactor: aws.Int32(parallelizationFactor),
+		})
+		if err != nil {
+			logger.Error("unable to update event source mapping",
+				zap.String("uuid", mapping.UUID),
+				zap.String("function-arn", mapping.FunctionArn),
+				zap.Int32("parallelization-factor", parallelizationFactor),
+				zap.Error(err))
+			return err
+		}
+	}
+
+	if cfg.Reserves() {
+		err = c.reserveConcurrency(ctx, streamArn, shardCount, mappingsPerFunction, cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.Info("scaled stream consumers",
+		zap.Int("mappings", len(mappings)),
+		zap.Int("functions", len(mappingsPerFunction)))
+
+	return nil
+}
+
+// reserveConcurrency sets the reserved concurrency of the functions to what their mappings of the stream need. Functions
+// that also consume other event sources are left as they are
+func (c *Client) reserveConcurrency(ctx context.Context, streamArn string, shardCount int, mappingsPerFunction map[string]int,
+	cfg Config) error {
+
+	logger := logging.WithContext(ctx)
+
+	for functionArn, mappingCount := range mappingsPerFunction {
+		// The reservation of a function that also consumes other event sources covers them too, the need of this
+		// stream alone would overwrite it
+		shared, err := c.consumesOtherSources(ctx, functionArn, streamArn)
+		if err != nil {
+			return err
+		}
+		if shared {
+			logger.Info("not reserving the concurrency of a function that consumes other event sources",
+				zap.String("function-arn", functionArn))
+			continue
+		}
+
+		concurrency := cfg.ReservedConcurrency(functionArn, shardCount, mappingCount)
+
+		_, err = c.lambdaClient.PutFunctionConcurrency(ctx, &lambda.PutFunctionConcurrencyInput{
+			FunctionName:                 aws.String(functionArn),
+			ReservedConcurrentExecutions: aws.Int32(concurrency),
+		})
+		if err != nil {
+			logger.Error("unable to put function concurrency",
+				zap.String("function-arn", functionArn),
+				zap.Int32("reserved-concurrency", concurrency),
+				zap.Error(err))
+			return err
+		}
+	}
+
+	return nil
+}
+
+// consumesOtherSources checks if the function has event source mappings of other event sources than the stream
+func (c *Client) consumesOtherSources(ctx context.Context, functionArn, streamArn string) (bool, error) {
+	logger := logging.WithContext(ctx)
+
+	paginator := lambda.NewListEventSourceMappingsPaginator(c.lambdaClient, &lambda.ListEventSourceMappingsInput{
+		FunctionName: aws.String(functionArn),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			logger.Error("unable to list event source mappings",
+				zap.String("function-arn", functionArn),
+				zap.Error(err))
+			return false, err
+		}
+
+		for _, mapping := range page.EventSourceMappings {
+			if aws.ToString(mapping.EventSourceArn) != streamArn {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,147 @@
+package consumers
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmanikes/Nemesis/nemesistest"
+	"testing"
+)
+
+func TestConfig_ParallelizationFactor(t *testing.T) {
+	const consumer = "arn:aws:lambda:us-east-1:123456789012:function:consumer"
+
+	assert.Equal(t, int32(1), Config{}.ParallelizationFactor(consumer, 4, 1))
+	assert.Equal(t, int32(1), Config{ConcurrencyPerShard: 0.5}.ParallelizationFactor(consumer, 4, 1))
+	assert.Equal(t, int32(3), Config{ConcurrencyPerShard: 2.5}.ParallelizationFactor(consumer, 4, 1))
+	assert.Equal(t, int32(10), Config{ConcurrencyPerShard: 40}.ParallelizationFactor(consumer, 4, 1))
+
+	// The factor is lowered as the shards grow so that the function stays under its ceiling
+	cfg := Config{ConcurrencyPerShard: 4, MaxConcurrency: 32}
+	assert.Equal(t, int32(4), cfg.ParallelizationFactor(consumer, 4, 1))
+	assert.Equal(t, int32(2), cfg.ParallelizationFactor(consumer, 16, 1))
+	assert.Equal(t, int32(1), cfg.ParallelizationFactor(consumer, 16, 2))
+	assert.Equal(t, int32(1), cfg.ParallelizationFactor(consumer, 64, 1))
+
+	cfg.FunctionMaxConcurrency = map[string]int32{"consumer": 64}
+	assert.Equal(t, int32(4), cfg.ParallelizationFactor(consumer, 16, 1))
+	assert.Equal(t, int32(4), cfg.ParallelizationFactor(consumer+":live", 16, 1))
+	assert.Equal(t, int32(2), cfg.ParallelizationFactor("arn:aws:lambda:us-east-1:123456789012:function:other", 16, 1))
+}
+
+func TestConfig_ReservedConcurrency(t *testing.T) {
+	const consumer = "arn:aws:lambda:us-east-1:123456789012:function:consumer"
+
+	cfg := Config{ConcurrencyPerShard: 2}
+	assert.Equal(t, int32(16), cfg.ReservedConcurrency(consumer, 8, 1))
+	assert.Equal(t, int32(32), cfg.ReservedConcurrency(consumer, 8, 2))
+
+	cfg.MaxConcurrency = 20
+	assert.Equal(t, int32(16), cfg.ReservedConcurrency(consumer, 8, 1))
+	assert.Equal(t, int32(16), cfg.ReservedConcurrency(consumer, 8, 2))
+	assert.Equal(t, int32(20), cfg.ReservedConcurrency(consumer, 32, 1))
+}
+
+func TestConfig_Reserves(t *testing.T) {
+	reserve := false
+
+	assert.True(t, Config{}.Reserves())
+	assert.False(t, Config{ReserveConcurrency: &reserve}.Reserves())
+}
+
+const streamArn = "arn:aws:kinesis:us-east-1:123456789012:stream/test-stream"
+
+func TestClient_Scale(t *testing.T) {
+	fake := nemesistest.NewLambda()
+	fake.AddEventSourceMapping("arn:aws:lambda:us-east-1:123456789012:function:consumer", streamArn, 1)
+	fake.AddEventSourceMapping("arn:aws:lambda:us-east-1:123456789012:function:consumer", streamArn, 1)
+
+	err := NewFromAPI(fake).Scale(context.Background(), streamArn, 4, Config{Enabled: true, ConcurrencyPerShard: 2})
+	assert.NoError(t, err)
+
+	for _, mapping := range fake.EventSourceMappings("arn:aws:lambda:us-east-1:123456789012:function:consumer") {
+		assert.Equal(t, int32(2), mapping.ParallelizationFactor)
+	}
+	concurrency, ok := fake.ReservedConcurrency("arn:aws:lambda:us-east-1:123456789012:function:consumer")
+	assert.True(t, ok)
+	assert.Equal(t, int32(16), concurrency)
+}
+
+func TestClient_Scale_ParallelizationFactorUnchanged(t *testing.T) {
+	fake := nemesistest.NewLambda()
+	fake.AddEventSourceMapping("arn:aws:lambda:us-east-1:123456789012:function:consumer", streamArn, 2)
+
+	err := NewFromAPI(fake).Scale(context.Background(), streamArn, 4, Config{Enabled: true, ConcurrencyPerShard: 2})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 0, fake.CallCount("UpdateEventSourceMapping"))
+}
+
+func TestClient_Scale_LeavesReservationsWithoutReserveConcurrency(t *testing.T) {
+	fake := nemesistest.NewLambda()
+	fake.AddEventSourceMapping("arn:aws:lambda:us-east-1:123456789012:function:consumer", streamArn, 1)
+	fake.SetReservedConcurrency("arn:aws:lambda:us-east-1:123456789012:function:consumer", 50)
+
+	reserve := false
+	err := NewFromAPI(fake).Scale(context.Background(), streamArn, 8, Config{Enabled: true, ConcurrencyPerShard: 2, ReserveConcurrency: &reserve})
+	assert.NoError(t, err)
+
+	concurrency, ok := fake.ReservedConcurrency("arn:aws:lambda:us-east-1:123456789012:function:consumer")
+	assert.True(t, ok)
+	assert.Equal(t, int32(50), concurrency)
+	assert.Equal(t, 0, fake.CallCount("PutFunctionConcurrency"))
+}
+
+func TestClient_Scale_FollowsShardCount(t *testing.T) {
+	fake := nemesistest.NewLambda()
+	fake.AddEventSourceMapping("arn:aws:lambda:us-east-1:123456789012:function:consumer", streamArn, 4)
+
+	cfg := Config{Enabled: true, ConcurrencyPerShard: 4, MaxConcurrency: 40}
+
+	// Doubling the shards halves the factor to stay under the ceiling
+	err := NewFromAPI(fake).Scale(context.Background(), streamArn, 10, cfg)
+	assert.NoError(t, err)
+
+	assert.Equal(t, int32(4), fake.EventSourceMappings("arn:aws:lambda:us-east-1:123456789012:function:consumer")[0].ParallelizationFactor)
+	concurrency, _ := fake.ReservedConcurrency("arn:aws:lambda:us-east-1:123456789012:function:consumer")
+	assert.Equal(t, int32(40), concurrency)
+
+	err = NewFromAPI(fake).Scale(context.Background(), streamArn, 20, cfg)
+	assert.NoError(t, err)
+
+	assert.Equal(t, int32(2), fake.EventSourceMappings("arn:aws:lambda:us-east-1:123456789012:function:consumer")[0].ParallelizationFactor)
+	concurrency, _ = fake.ReservedConcurrency("arn:aws:lambda:us-east-1:123456789012:function:consumer")
+	assert.Equal(t, int32(40), concurrency)
+
+	// Halving them back restores it
+	err = NewFromAPI(fake).Scale(context.Background(), streamArn, 10, cfg)
+	assert.NoError(t, err)
+
+	assert.Equal(t, int32(4), fake.EventSourceMappings("arn:aws:lambda:us-east-1:123456789012:function:consumer")[0].ParallelizationFactor)
+}
+
+func TestClient_Scale_SharedFunction(t *testing.T) {
+	fake := nemesistest.NewLambda()
+	fake.AddEventSourceMapping("arn:aws:lambda:us-east-1:123456789012:function:shared", streamArn, 1)
+	fake.AddEventSourceMapping("arn:aws:lambda:us-east-1:123456789012:function:shared", "arn:aws:kinesis:us-east-1:123456789012:stream/other-stream", 1)
+	fake.AddEventSourceMapping("arn:aws:lambda:us-east-1:123456789012:function:dedicated", streamArn, 1)
+	fake.SetReservedConcurrency("arn:aws:lambda:us-east-1:123456789012:function:shared", 100)
+
+	err := NewFromAPI(fake).Scale(context.Background(), streamArn, 4, Config{Enabled: true, ConcurrencyPerShard: 1})
+	assert.NoError(t, err)
+
+	// The reservation of the shared function also covers the other stream
+	concurrency, _ := fake.ReservedConcurrency("arn:aws:lambda:us-east-1:123456789012:function:shared")
+	assert.Equal(t, int32(100), concurrency)
+
+	concurrency, _ = fake.ReservedConcurrency("arn:aws:lambda:us-east-1:123456789012:function:dedicated")
+	assert.Equal(t, int32(4), concurrency)
+}
+
+func TestClient_Scale_Error(t *testing.T) {
+	fake := nemesistest.NewLambda()
+	fake.AddEventSourceMapping("arn:aws:lambda:us-east-1:123456789012:function:consumer", streamArn, 1)
+	fake.FailOn("PutFunctionConcurrency", assert.AnError)
+
+	err := NewFromAPI(fake).Scale(context.Background(), streamArn, 4, Config{Enabled: true})
+	assert.ErrorIs(t, err, assert.AnError)
+}
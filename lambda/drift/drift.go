@@ -0,0 +1,390 @@
+// Package drift compares the scaling alarms of a stream with the definitions Nemesis puts for them, to find alarms
+// that were edited by hand or overwritten by a terraform apply
+package drift
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awscloudwatch "github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/vmanikes/Nemesis/cloudwatch"
+	"github.com/vmanikes/Nemesis/logging"
+	"github.com/vmanikes/Nemesis/scaling"
+	"go.uber.org/zap"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Stream is a managed stream and the inputs its alarm definitions are built from
+type Stream struct {
+	Name       string
+	ShardCount int
+	// TopicArn is the SNS topic the alarms notify. The alarm actions are not compared when it is empty
+	TopicArn string
+	ReadSide cloudwatch.ReadSide
+	// Settings are the settings the alarms of the stream are put with
+	Settings cloudwatch.AlarmSettings
+	// MinShardCount is the minimum shard count of the stream, the scale-down alarm has a threshold of -1 at it
+	MinShardCount int
+	// Naming names the alarms of the stream
+	Naming cloudwatch.AlarmNaming
+}
+
+// alarmSettings returns the settings of the alarms at the shard count of the stream, with the same minimum shard count
+// rule as the handler
+func (s Stream) alarmSettings() cloudwatch.AlarmSettings {
+	settings := s.Settings
+	settings.ScaleDownThreshold = scaling.ScaleDownThreshold(s.ShardCount, s.MinShardCount, settings.ScaleDownThreshold)
+	return settings
+}
+
+// Difference is a single field of an alarm that does not match its expected definition
+type Difference struct {
+	Field    string `json:"field"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// Alarm is the drift of one of the scaling alarms of a stream
+type Alarm struct {
+	Name        string       `json:"name"`
+	Missing     bool         `json:"missing"`
+	Differences []Difference `json:"differences"`
+
+	scaleDown bool
+	actions   []string
+}
+
+// Drifted checks if the alarm is missing or differs from its expected definition
+func (a Alarm) Drifted() bool {
+	return a.Missing || len(a.Differences) > 0
+}
+
+// Report is the drift of the scaling alarms of a stream
+type Report struct {
+	StreamName string  `json:"streamName"`
+	ShardCount int     `json:"shardCount"`
+	Alarms     []Alarm `json:"alarms"`
+
+	stream Stream
+}
+
+// Drifted checks if any of the alarms drifted
+func (r Report) Drifted() bool {
+	for _, alarm := range r.Alarms {
+		if alarm.Drifted() {
+			return true
+		}
+	}
+	return false
+}
+
+// ManagedStreams returns the streams that have a scale-up alarm, sorted by name. The alarms tagged with a ScaleAction
+// are scale-up alarms by the tag, the untagged ones by the naming
+func ManagedStreams(ctx context.Context, client *cloudwatch.Client, naming cloudwatch.AlarmNaming) ([]string, error) {
+	alarms, err := client.DescribeAlarms(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	streams := make([]string, 0)
+	for _, alarm := range alarms {
+		tags, err := client.GetAlarmTags(ctx, aws.ToString(alarm.AlarmArn))
+		if err != nil {
+			return nil, err
+		}
+
+		var streamName string
+		if action, ok := tags[cloudwatch.ScaleActionTag]; ok {
+			if action == "Up" {
+				streamName = cloudwatch.AlarmStream(alarm)
+			}
+		} else if name, action, ok := naming.Match(aws.ToString(alarm.AlarmName)); ok && action == "Up" {
+			streamName = name
+		}
+
+		if streamName != "" && !seen[streamName] {
+			seen[streamName] = true
+			streams = append(streams, streamName)
+		}
+	}
+	sort.Strings(streams)
+
+	return streams, nil
+}
+
+// Check builds the expected definitions of the scale-up and scale-down alarms of the stream with the same code as
+// UpdateAlarm, and compares them with the alarms in cloudwatch. The pair is found by its tags, or else by the naming
+func Check(ctx context.Context, client *cloudwatch.Client, stream Stream) (Report, error) {
+	logger := logging.WithContext(ctx)
+
+	report := Report{
+		StreamName: stream.Name,
+		ShardCount: stream.ShardCount,
+		stream:     stream,
+	}
+
+	upName, downName, err := client.StreamAlarmNames(ctx, stream.Name, stream.Naming)
+	if err != nil {
+		return report, err
+	}
+
+	alarms, err := client.DescribeAlarms(ctx, upName, downName)
+	if err != nil {
+		return report, err
+	}
+
+	for _, pair := range []struct {
+		name, complementary, action string
+		scaleDown                   bool
+	}{
+		{upName, downName, "Up", false},
+		{downName, upName, "Down", true},
+	} {
+		alarm := Alarm{
+			Name:      pair.name,
+			Missing:   true,
+			scaleDown: pair.scaleDown,
+		}
+
+		expected, err := cloudwatch.BuildAlarmInput(pair.name, stream.Name, stream.TopicArn, pair.scaleDown,
+			stream.ShardCount, stream.ReadSide, stream.alarmSettings())
+		if err != nil {
+			logger.Error("unable to build the expected alarm definition",
+				zap.String("alarm-name", pair.name),
+				zap.Error(err))
+			return report, err
+		}
+
+		for _, actual := range alarms {
+			if aws.ToString(actual.AlarmName) != pair.name {
+				continue
+			}
+
+			alarm.Missing = false
+			alarm.actions = actual.AlarmActions
+			alarm.Differences = compare(expected, actual, stream.TopicArn != "")
+
+			tags, err := client.GetAlarmTags(ctx, aws.ToString(actual.AlarmArn))
+			if err != nil {
+				return report, err
+			}
+			alarm.Differences = append(alarm.Differences, compareTags(expectedTags(pair.action, pair.complementary), tags)...)
+		}
+
+		report.Alarms = append(report.Alarms, alarm)
+	}
+
+	return report, nil
+}
+
+// Fix puts the expected definition and tags of every drifted alarm of the report and sets the alarm to
+// INSUFFICIENT_DATA, as the handler does after updating an alarm. Without a topic in the stream, existing alarms keep
+// their first action and missing alarms can not be created
+func Fix(ctx context.Context, client *cloudwatch.Client, report Report) error {
+	logger := logging.WithContext(ctx)
+
+	stream := report.stream
+
+	var upName, downName string
+	for _, alarm := range report.Alarms {
+		if alarm.scaleDown {
+			downName = alarm.Name
+		} else {
+			upName = alarm.Name
+		}
+	}
+
+	fixed := false
+	for _, alarm := range report.Alarms {
+		if !alarm.Drifted() {
+			continue
+		}
+
+		topicArn := stream.TopicArn
+		if topicArn == "" && len(alarm.actions) > 0 {
+			topicArn = alarm.actions[0]
+		}
+		if topicArn == "" {
+			err := fmt.Errorf("no SNS topic to put %s with", alarm.Name)
+			logger.Error("unable to fix alarm",
+				zap.String("alarm-name", alarm.Name),
+				zap.Error(err))
+			return err
+		}
+
+		err := client.UpdateAlarm(ctx, alarm.Name, stream.Name, topicArn, alarm.scaleDown, stream.ShardCount, stream.ReadSide,
+			stream.alarmSettings())
+		if err != nil {
+			return err
+		}
+
+		err = client.SetAlarmState(ctx, alarm.Name, string(types.StateValueInsufficientData), "Alarm definition drift fixed")
+		if err != nil {
+			return err
+		}
+		fixed = true
+	}
+
+	if !fixed {
+		return nil
+	}
+
+	upArn, downArn, err := client.GetAlarmArns(ctx, upName, downName)
+	if err != nil {
+		return err
+	}
+
+	if err = client.SetAlarmTags(ctx, upArn, expectedTags("Up", downName)); err != nil {
+		return err
+	}
+
+	return client.SetAlarmTags(ctx, downArn, expectedTags("Down", upName))
+}
+
+// expectedTags are the pairing tags of the alarm, the metadata tags change with every scaling action
+func expectedTags(action, complementary string) map[string]string {
+	return map[string]string{
+		cloudwatch.ScaleActionTag:        action,
+		cloudwatch.ComplimentaryAlarmTag: complementary,
+	}
+}
+
+// compare returns the differences between the expected definition and the actual alarm
+func compare(expected *awscloudwatch.PutMetricAlarmInput, actual types.MetricAlarm, compareActions bool) []Difference {
+	differences := make([]Difference, 0)
+	add := func(field, expected, actual string) {
+		if expected != actual {
+			differences = append(differences, Difference{Field: field, Expected: expected, Actual: actual})
+		}
+	}
+
+	add("Threshold", formatFloat(expected.Threshold), formatFloat(actual.Threshold))
+	add("ComparisonOperator", string(expected.ComparisonOperator), string(actual.ComparisonOperator))
+	add("EvaluationPeriods", formatInt(expected.EvaluationPeriods), formatInt(actual.EvaluationPeriods))
+	add("DatapointsToAlarm", formatInt(expected.DatapointsToAlarm), formatInt(actual.DatapointsToAlarm))
+	add("TreatMissingData", aws.ToString(expected.TreatMissingData), aws.ToString(actual.TreatMissingData))
+	add("ActionsEnabled", strconv.FormatBool(aws.ToBool(expected.ActionsEnabled)), strconv.FormatBool(aws.ToBool(actual.ActionsEnabled)))
+	if compareActions {
+		add("AlarmActions", formatList(expected.AlarmActions), formatList(actual.AlarmActions))
+	}
+
+	actualQueries := make(map[string]types.MetricDataQuery, len(actual.Metrics))
+	for _, query := range actual.Metrics {
+		actualQueries[aws.ToString(query.Id)] = query
+	}
+
+	for _, query := range expected.Metrics {
+		id := aws.ToString(query.Id)
+		field := "Metrics[" + id + "]"
+
+		actualQuery, ok := actualQueries[id]
+		if !ok {
+			add(field, describeQuery(query), "")
+			continue
+		}
+		delete(actualQueries, id)
+
+		add(field+".Expression", aws.ToString(query.Expression), aws.ToString(actualQuery.Expression))
+		add(field+".ReturnData", strconv.FormatBool(aws.ToBool(query.ReturnData)), strconv.FormatBool(aws.ToBool(actualQuery.ReturnData)))
+
+		expectedStat, actualStat := query.MetricStat, actualQuery.MetricStat
+		if expectedStat == nil || actualStat == nil {
+			if expectedStat != actualStat {
+				add(field+".MetricStat", describeQuery(query), describeQuery(actualQuery))
+			}
+			continue
+		}
+
+		add(field+".Metric", metricName(expectedStat.Metric), metricName(actualStat.Metric))
+		add(field+".Dimensions", dimensions(expectedStat.Metric), dimensions(actualStat.Metric))
+		add(field+".Period", formatInt(expectedStat.Period), formatInt(actualStat.Period))
+		add(field+".Stat", aws.ToString(expectedStat.Stat), aws.ToString(actualStat.Stat))
+	}
+
+	unexpected := make([]string, 0, len(actualQueries))
+	for id := range actualQueries {
+		unexpected = append(unexpected, id)
+	}
+	sort.Strings(unexpected)
+
+	for _, id := range unexpected {
+		add("Metrics["+id+"]", "", describeQuery(actualQueries[id]))
+	}
+
+	return differences
+}
+
+// compareTags returns the expected tags the alarm is missing or has a different value for
+func compareTags(expected, actual map[string]string) []Difference {
+	keys := make([]string, 0, len(expected))
+	for key := range expected {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	differences := make([]Difference, 0)
+	for _, key := range keys {
+		if expected[key] != actual[key] {
+			differences = append(differences, Difference{Field: "Tags[" + key + "]", Expected: expected[key], Actual: actual[key]})
+		}
+	}
+
+	return differences
+}
+
+// describeQuery returns the expression of the query, or its metric, dimensions, period and stat
+func describeQuery(query types.MetricDataQuery) string {
+	if query.MetricStat == nil {
+		return aws.ToString(query.Expression)
+	}
+
+	stat := query.MetricStat
+	return fmt.Sprintf("%s{%s} %s/%ds", metricName(stat.Metric), dimensions(stat.Metric), aws.ToString(stat.Stat),
+		aws.ToInt32(stat.Period))
+}
+
+func metricName(metric *types.Metric) string {
+	if metric == nil {
+		return ""
+	}
+	return aws.ToString(metric.Namespace) + "/" + aws.ToString(metric.MetricName)
+}
+
+// dimensions returns the dimensions of the metric as sorted name=value pairs
+func dimensions(metric *types.Metric) string {
+	if metric == nil {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(metric.Dimensions))
+	for _, dimension := range metric.Dimensions {
+		pairs = append(pairs, aws.ToString(dimension.Name)+"="+aws.ToString(dimension.Value))
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+func formatFloat(value *float64) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*value, 'g', -1, 64)
+}
+
+func formatInt(value *int32) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.Itoa(int(*value))
+}
+
+func formatList(values []string) string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
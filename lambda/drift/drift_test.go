@@ -0,0 +1,164 @@
+package drift
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmanikes/Nemesis/cloudwatch"
+	"github.com/vmanikes/Nemesis/nemesistest"
+	"testing"
+)
+
+const topicArn = "arn:aws:sns:us-east-1:123456789012:nemesis"
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	fake := nemesistest.NewCloudWatch()
+	client := cloudwatch.NewFromAPI(fake)
+
+	stream := Stream{Name: "test-stream", ShardCount: 4, TopicArn: topicArn, Settings: cloudwatch.DefaultAlarmSettings()}
+
+	assert.NoError(t, client.UpdateAlarm(ctx, "test-stream-scale-up", "test-stream", topicArn, false, 4, cloudwatch.ReadSide{}, cloudwatch.DefaultAlarmSettings()))
+	assert.NoError(t, client.UpdateAlarm(ctx, "test-stream-scale-down", "test-stream", topicArn, true, 4, cloudwatch.ReadSide{}, cloudwatch.DefaultAlarmSettings()))
+	assert.NoError(t, client.TagAlarm(ctx, nemesistest.AlarmArn("test-stream-scale-up"), "Up", "test-stream-scale-down", "2022-09-01T12:00:00.000+0000"))
+	assert.NoError(t, client.TagAlarm(ctx, nemesistest.AlarmArn("test-stream-scale-down"), "Down", "test-stream-scale-up", "2022-09-01T12:00:00.000+0000"))
+
+	report, err := Check(ctx, client, stream)
+	assert.NoError(t, err)
+	assert.False(t, report.Drifted())
+
+	// A terraform apply puts the scale-down alarm back with its own threshold, an untagged alarm and no iterator age
+	alarm, _ := fake.Alarm("test-stream-scale-down")
+	definition := alarm.Definition
+	definition.Threshold = aws.Float64(0.1)
+	definition.DatapointsToAlarm = nil
+	metrics := make([]types.MetricDataQuery, 0)
+	for _, query := range definition.Metrics {
+		switch aws.ToString(query.Id) {
+		case "m3", "s2":
+			continue
+		case "e5":
+			query.Expression = aws.String("e1*0")
+		case "s1":
+			query.Expression = aws.String("2")
+		}
+		metrics = append(metrics, query)
+	}
+	definition.Metrics = metrics
+	fake.AddAlarm(definition, types.StateValueOk, nil)
+
+	report, err = Check(ctx, client, stream)
+	assert.NoError(t, err)
+	assert.True(t, report.Drifted())
+	assert.False(t, report.Alarms[0].Drifted())
+
+	down := report.Alarms[1]
+	assert.Equal(t, "test-stream-scale-down", down.Name)
+	assert.Equal(t, []Difference{
+		{Field: "Threshold", Expected: "0.075", Actual: "0.1"},
+		{Field: "DatapointsToAlarm", Expected: "57", Actual: ""},
+		{Field: "Metrics[m3]", Expected: "AWS/Kinesis/GetRecords.IteratorAgeMilliseconds{StreamName=test-stream} Maximum/300s", Actual: ""},
+		{Field: "Metrics[e5].Expression", Expected: "(FILL(m3,0)/1000/60)*(0.07500/s2)", Actual: "e1*0"},
+		{Field: "Metrics[s2]", Expected: "30", Actual: ""},
+		{Field: "Metrics[s1].Expression", Expected: "4", Actual: "2"},
+		{Field: "Tags[ComplimentaryAlarm]", Expected: "test-stream-scale-up", Actual: ""},
+		{Field: "Tags[ScaleAction]", Expected: "Down", Actual: ""},
+	}, down.Differences)
+
+	// Without a topic the actions are not compared, and the fix keeps the actions of the alarm
+	report, err = Check(ctx, client, Stream{Name: "test-stream", ShardCount: 4, Settings: cloudwatch.DefaultAlarmSettings()})
+	assert.NoError(t, err)
+	assert.NoError(t, Fix(ctx, client, report))
+
+	report, err = Check(ctx, client, stream)
+	assert.NoError(t, err)
+	assert.False(t, report.Drifted())
+
+	alarm, _ = fake.Alarm("test-stream-scale-down")
+	assert.Equal(t, types.StateValueInsufficientData, alarm.State)
+
+	// The fix does not touch the cooldown of the alarms
+	alarm, _ = fake.Alarm("test-stream-scale-up")
+	assert.Equal(t, "2022-09-01T12:00:00.000+0000", alarm.Tags["LastScaledTimestamp"])
+}
+
+func TestCheck_MinimumShardCount(t *testing.T) {
+	ctx := context.Background()
+	fake := nemesistest.NewCloudWatch()
+	client := cloudwatch.NewFromAPI(fake)
+
+	stream := Stream{Name: "test-stream", ShardCount: 1, TopicArn: topicArn, Settings: cloudwatch.DefaultAlarmSettings(), MinShardCount: 1}
+
+	// The handler puts the scale-down alarm of a stream at the minimum with a threshold of -1
+	atMinimum := cloudwatch.DefaultAlarmSettings()
+	atMinimum.ScaleDownThreshold = -1
+	assert.NoError(t, client.UpdateAlarm(ctx, "test-stream-scale-up", "test-stream", topicArn, false, 1, cloudwatch.ReadSide{}, atMinimum))
+	assert.NoError(t, client.UpdateAlarm(ctx, "test-stream-scale-down", "test-stream", topicArn, true, 1, cloudwatch.ReadSide{}, atMinimum))
+	assert.NoError(t, client.TagAlarm(ctx, nemesistest.AlarmArn("test-stream-scale-up"), "Up", "test-stream-scale-down", "2022-09-01T12:00:00.000+0000"))
+	assert.NoError(t, client.TagAlarm(ctx, nemesistest.AlarmArn("test-stream-scale-down"), "Down", "test-stream-scale-up", "2022-09-01T12:00:00.000+0000"))
+
+	report, err := Check(ctx, client, stream)
+	assert.NoError(t, err)
+	assert.False(t, report.Drifted())
+
+	// An alarm put back with the threshold of the streams above the minimum is fixed to -1
+	alarm, _ := fake.Alarm("test-stream-scale-down")
+	definition := alarm.Definition
+	definition.Threshold = aws.Float64(0.075)
+	fake.AddAlarm(definition, types.StateValueAlarm, alarm.Tags)
+
+	report, err = Check(ctx, client, stream)
+	assert.NoError(t, err)
+	assert.Equal(t, []Difference{{Field: "Threshold", Expected: "-1", Actual: "0.075"}}, report.Alarms[1].Differences)
+	assert.NoError(t, Fix(ctx, client, report))
+
+	alarm, _ = fake.Alarm("test-stream-scale-down")
+	assert.Equal(t, -1.0, aws.ToFloat64(alarm.Definition.Threshold))
+}
+
+func TestFixMissingAlarm(t *testing.T) {
+	ctx := context.Background()
+	fake := nemesistest.NewCloudWatch()
+	client := cloudwatch.NewFromAPI(fake)
+
+	report, err := Check(ctx, client, Stream{Name: "test-stream", ShardCount: 2, Settings: cloudwatch.DefaultAlarmSettings()})
+	assert.NoError(t, err)
+	assert.True(t, report.Alarms[0].Missing)
+	assert.Error(t, Fix(ctx, client, report))
+
+	report, err = Check(ctx, client, Stream{Name: "test-stream", ShardCount: 2, TopicArn: topicArn, Settings: cloudwatch.DefaultAlarmSettings()})
+	assert.NoError(t, err)
+	assert.NoError(t, Fix(ctx, client, report))
+
+	streams, err := ManagedStreams(ctx, client, cloudwatch.AlarmNaming{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"test-stream"}, streams)
+
+	alarm, ok := fake.Alarm("test-stream-scale-up")
+	assert.True(t, ok)
+	assert.Equal(t, []string{topicArn}, alarm.Definition.AlarmActions)
+	assert.Equal(t, "Up", alarm.Tags["ScaleAction"])
+}
+
+func TestCheck_TaggedPair(t *testing.T) {
+	ctx := context.Background()
+	fake := nemesistest.NewCloudWatch()
+	client := cloudwatch.NewFromAPI(fake)
+
+	// The alarms are named by hand and paired by their tags only
+	assert.NoError(t, client.UpdateAlarm(ctx, "orders high throughput", "orders", topicArn, false, 2, cloudwatch.ReadSide{}, cloudwatch.DefaultAlarmSettings()))
+	assert.NoError(t, client.UpdateAlarm(ctx, "orders low throughput", "orders", topicArn, true, 2, cloudwatch.ReadSide{}, cloudwatch.DefaultAlarmSettings()))
+	assert.NoError(t, client.TagAlarm(ctx, nemesistest.AlarmArn("orders high throughput"), "Up", "orders low throughput", "2022-09-01T12:00:00.000+0000"))
+	assert.NoError(t, client.TagAlarm(ctx, nemesistest.AlarmArn("orders low throughput"), "Down", "orders high throughput", "2022-09-01T12:00:00.000+0000"))
+
+	streams, err := ManagedStreams(ctx, client, cloudwatch.AlarmNaming{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders"}, streams)
+
+	report, err := Check(ctx, client, Stream{Name: "orders", ShardCount: 2, TopicArn: topicArn, Settings: cloudwatch.DefaultAlarmSettings()})
+	assert.NoError(t, err)
+	assert.False(t, report.Drifted())
+	assert.Equal(t, "orders high throughput", report.Alarms[0].Name)
+	assert.Equal(t, "orders low throughput", report.Alarms[1].Name)
+}
@@ -0,0 +1,304 @@
+// Package explain evaluates the scaling alarms of a stream locally, to show why they are or are not firing
+package explain
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/vmanikes/Nemesis/cloudwatch"
+	"github.com/vmanikes/Nemesis/logging"
+	"github.com/vmanikes/Nemesis/metricmath"
+	"github.com/vmanikes/Nemesis/scaling"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Series is one query of an alarm, evaluated over the evaluation window
+type Series struct {
+	ID         string      `json:"id"`
+	Label      string      `json:"label"`
+	Expression string      `json:"expression,omitempty"`
+	Timestamps []time.Time `json:"timestamps"`
+	Values     []float64   `json:"values"`
+}
+
+// Latest returns the last value of the series
+func (s Series) Latest() (float64, bool) {
+	if len(s.Values) == 0 {
+		return 0, false
+	}
+	return s.Values[len(s.Values)-1], true
+}
+
+// Datapoint is a single datapoint of the series the alarm compares with its threshold
+type Datapoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+	Breaching bool      `json:"breaching"`
+	// Dominant is the input of the returned expression with the highest value at the datapoint
+	Dominant string `json:"dominant,omitempty"`
+}
+
+// Alarm explains a single scaling alarm
+type Alarm struct {
+	Name               string        `json:"name"`
+	State              string        `json:"state"`
+	StateReason        string        `json:"stateReason"`
+	ComparisonOperator string        `json:"comparisonOperator"`
+	Threshold          float64       `json:"threshold"`
+	EvaluationPeriods  int           `json:"evaluationPeriods"`
+	DatapointsToAlarm  int           `json:"datapointsToAlarm"`
+	Period             time.Duration `json:"period"`
+	// ReturnID is the query the alarm compares with its threshold, e6 for the scaling alarms
+	ReturnID string `json:"returnId"`
+	// Series holds every query of the alarm in the order of its definition
+	Series     []Series    `json:"series"`
+	Datapoints []Datapoint `json:"datapoints"`
+	// Breaching is the number of datapoints that breach the threshold, the alarm fires at DatapointsToAlarm
+	Breaching  int  `json:"breaching"`
+	WouldAlarm bool `json:"wouldAlarm"`
+	// Dominance counts the datapoints every input of the returned expression dominated
+	Dominance map[string]int `json:"dominance"`
+	// Action is the scaling action of the alarm, and CooldownRemaining how long the cooldowns hold it back
+	Action            string        `json:"action"`
+	CooldownRemaining time.Duration `json:"cooldownRemaining"`
+}
+
+// Report explains the scaling alarms of a stream
+type Report struct {
+	StreamName          string    `json:"streamName"`
+	Time                time.Time `json:"time"`
+	LastScaledTimestamp string    `json:"lastScaledTimestamp"`
+	// CooldownRemaining is the longest time the cooldowns hold back the action of an alarm
+	CooldownRemaining time.Duration `json:"cooldownRemaining"`
+	Alarms            []Alarm       `json:"alarms"`
+}
+
+// CooldownBlocks checks if the cooldowns since the recent scaling actions would block the action of an alarm now
+func (r Report) CooldownBlocks() bool {
+	return r.CooldownRemaining > 0
+}
+
+// Explain fetches the scale-up and scale-down alarms of the stream, paired by their tags or else by the naming, and the metric data of their last evaluation
+// window, and evaluates every query of the alarms locally. The recent scaling actions in the alarm metadata are
+// checked against the cooldowns of the stream
+func Explain(ctx context.Context, client *cloudwatch.Client, streamName string, naming cloudwatch.AlarmNaming,
+	cooldowns scaling.Cooldowns, now time.Time) (Report, error) {
+	logger := logging.WithContext(ctx)
+
+	report := Report{
+		StreamName: streamName,
+		Time:       now,
+	}
+
+	scaleUpAlarmName, scaleDownAlarmName, err := client.StreamAlarmNames(ctx, streamName, naming)
+	if err != nil {
+		return report, err
+	}
+	names := []string{scaleUpAlarmName, scaleDownAlarmName}
+
+	alarms, err := client.DescribeAlarms(ctx, names...)
+	if err != nil {
+		return report, err
+	}
+	if len(alarms) == 0 {
+		err = errors.New("no scaling alarms found for the stream")
+		logger.Error(err.Error(),
+			zap.String("stream-name", streamName))
+		return report, err
+	}
+
+	var history []scaling.Action
+	actions := []string{"Up", "Down"}
+	for i, name := range names {
+		for _, definition := range alarms {
+			if aws.ToString(definition.AlarmName) != name {
+				continue
+			}
+
+			alarm, err := explainAlarm(ctx, client, definition, now)
+			if err != nil {
+				return report, err
+			}
+			alarm.Action = actions[i]
+
+			tags, err := client.GetAlarmTags(ctx, aws.ToString(definition.AlarmArn))
+			if err != nil {
+				return report, err
+			}
+			// The pairing and timestamp tags are read even when the rest of the metadata is broken
+			metadata, _ := cloudwatch.ParseMetadata(tags)
+			if metadata.ScaleAction != "" {
+				alarm.Action = metadata.ScaleAction
+			}
+			if report.LastScaledTimestamp == "" {
+				report.LastScaledTimestamp = metadata.LastScaled()
+				history = metadata.Actions(now.Add(-cooldowns.Window()))
+			}
+
+			report.Alarms = append(report.Alarms, alarm)
+		}
+	}
+
+	for i, alarm := range report.Alarms {
+		report.Alarms[i].CooldownRemaining = cooldowns.Remaining(history, alarm.Action, now)
+		if report.Alarms[i].CooldownRemaining > report.CooldownRemaining {
+			report.CooldownRemaining = report.Alarms[i].CooldownRemaining
+		}
+	}
+
+	return report, nil
+}
+
+// explainAlarm evaluates the alarm over its last evaluation window
+func explainAlarm(ctx context.Context, client *cloudwatch.Client, definition types.MetricAlarm, now time.Time) (Alarm, error) {
+	logger := logging.WithContext(ctx)
+
+	alarm := Alarm{
+		Name:               aws.ToString(definition.AlarmName),
+		State:              string(definition.StateValue),
+		StateReason:        aws.ToString(definition.StateReason),
+		ComparisonOperator: string(definition.ComparisonOperator),
+		Threshold:          aws.ToFloat64(definition.Threshold),
+		EvaluationPeriods:  int(aws.ToInt32(definition.EvaluationPeriods)),
+		DatapointsToAlarm:  int(aws.ToInt32(definition.DatapointsToAlarm)),
+		Dominance:          make(map[string]int),
+	}
+	if alarm.DatapointsToAlarm == 0 {
+		alarm.DatapointsToAlarm = alarm.EvaluationPeriods
+	}
+
+	program, err := cloudwatch.CompileMetrics(definition.Metrics)
+	if err != nil {
+		logger.Error("unable to compile the alarm metric math",
+			zap.String("alarm-name", alarm.Name),
+			zap.Error(err))
+		return alarm, err
+	}
+
+	// The alarm queries only return the expression the alarm compares, the metrics are fetched on their own
+	queries := make([]types.MetricDataQuery, 0)
+	for _, query := range definition.Metrics {
+		if aws.ToBool(query.ReturnData) {
+			alarm.ReturnID = aws.ToString(query.Id)
+		}
+		if query.MetricStat == nil {
+			continue
+		}
+
+		alarm.Period = time.Duration(aws.ToInt32(query.MetricStat.Period)) * time.Second
+		query.ReturnData = aws.Bool(true)
+		queries = append(queries, query)
+	}
+	if alarm.Period == 0 || alarm.ReturnID == "" {
+		err = errors.New("alarm has no metrics or no returned expression")
+		logger.Error(err.Error(),
+			zap.String("alarm-name", alarm.Name))
+		return alarm, err
+	}
+
+	end := now.UTC().Truncate(alarm.Period)
+	start := end.Add(-time.Duration(alarm.EvaluationPeriods) * alarm.Period)
+
+	timestamps := make([]time.Time, 0, alarm.EvaluationPeriods)
+	for timestamp := start; timestamp.Before(end); timestamp = timestamp.Add(alarm.Period) {
+		timestamps = append(timestamps, timestamp)
+	}
+
+	fetched, err := client.GetMetricData(ctx, queries, start, end)
+	if err != nil {
+		return alarm, err
+	}
+
+	data := make(map[string]metricmath.Series, len(fetched))
+	for id, datapoints := range fetched {
+		series := metricmath.Series{Timestamps: make([]time.Time, 0), Values: make([]float64, 0)}
+		for _, datapoint := range datapoints {
+			series.Timestamps = append(series.Timestamps, datapoint.Timestamp.UTC())
+			series.Values = append(series.Values, datapoint.Value)
+		}
+		data[id] = series
+	}
+
+	values, err := program.Evaluate(data, timestamps)
+	if err != nil {
+		logger.Error("unable to evaluate the alarm metric math",
+			zap.String("alarm-name", alarm.Name),
+			zap.Error(err))
+		return alarm, err
+	}
+
+	for _, query := range definition.Metrics {
+		id := aws.ToString(query.Id)
+		alarm.Series = append(alarm.Series, seriesOf(id, aws.ToString(query.Label), aws.ToString(query.Expression),
+			values[id], timestamps))
+	}
+
+	var inputs []string
+	if expression := program.Expression(alarm.ReturnID); expression != nil {
+		inputs = expression.References()
+	}
+
+	returned := values[alarm.ReturnID]
+	for _, timestamp := range timestamps {
+		value, ok := returned.At(timestamp)
+		if !ok {
+			continue
+		}
+
+		datapoint := Datapoint{
+			Timestamp: timestamp,
+			Value:     value,
+			Breaching: cloudwatch.Breaches(definition.ComparisonOperator, value, alarm.Threshold),
+		}
+
+		dominantValue := 0.0
+		for _, input := range inputs {
+			v, ok := values[input].At(timestamp)
+			if ok && (datapoint.Dominant == "" || v > dominantValue) {
+				datapoint.Dominant, dominantValue = input, v
+			}
+		}
+		if datapoint.Dominant != "" {
+			alarm.Dominance[datapoint.Dominant]++
+		}
+
+		if datapoint.Breaching {
+			alarm.Breaching++
+		}
+		alarm.Datapoints = append(alarm.Datapoints, datapoint)
+	}
+
+	alarm.WouldAlarm = alarm.Breaching >= alarm.DatapointsToAlarm
+
+	return alarm, nil
+}
+
+// Dominant returns the input that dominated the latest datapoint
+func (a Alarm) Dominant() string {
+	if len(a.Datapoints) == 0 {
+		return ""
+	}
+	return a.Datapoints[len(a.Datapoints)-1].Dominant
+}
+
+// seriesOf expands scalars over the timestamps so that every series can be shown side by side
+func seriesOf(id, label, expression string, value metricmath.Series, timestamps []time.Time) Series {
+	series := Series{
+		ID:         id,
+		Label:      label,
+		Expression: expression,
+		Timestamps: make([]time.Time, 0, len(timestamps)),
+		Values:     make([]float64, 0, len(timestamps)),
+	}
+
+	for _, timestamp := range timestamps {
+		if v, ok := value.At(timestamp); ok {
+			series.Timestamps = append(series.Timestamps, timestamp)
+			series.Values = append(series.Values, v)
+		}
+	}
+
+	return series
+}
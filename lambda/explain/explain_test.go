@@ -0,0 +1,104 @@
+package explain
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awscloudwatch "github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmanikes/Nemesis/cloudwatch"
+	"github.com/vmanikes/Nemesis/nemesistest"
+	"github.com/vmanikes/Nemesis/scaling"
+	"testing"
+	"time"
+)
+
+func TestExplain(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 9, 1, 12, 2, 0, 0, time.UTC)
+
+	fake := nemesistest.NewCloudWatch()
+	client := cloudwatch.NewFromAPI(fake)
+
+	assert.NoError(t, client.UpdateAlarm(ctx, "test-stream-scale-up", "test-stream", "", false, 2, cloudwatch.ReadSide{}, cloudwatch.DefaultAlarmSettings()))
+	assert.NoError(t, client.UpdateAlarm(ctx, "test-stream-scale-down", "test-stream", "", true, 2, cloudwatch.ReadSide{}, cloudwatch.DefaultAlarmSettings()))
+	assert.NoError(t, client.TagAlarm(ctx, nemesistest.AlarmArn("test-stream-scale-up"), "Up", "test-stream-scale-down",
+		now.Add(-2*time.Minute).Format("2006-01-02T15:04:05.000+0000")))
+
+	// The last 5 minute periods run at half of the byte limit and a tenth of the record limit of 2 shards
+	bytes := make(map[time.Time]float64)
+	records := make(map[time.Time]float64)
+	for i := 1; i <= 5; i++ {
+		timestamp := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC).Add(-time.Duration(i) * 5 * time.Minute)
+		bytes[timestamp] = 0.5 * 2 * 1024 * 1024 * 60 * 5
+		records[timestamp] = 0.1 * 2 * 1000 * 60 * 5
+	}
+	fake.AddMetricData("IncomingBytes", "test-stream", bytes)
+	fake.AddMetricData("IncomingRecords", "test-stream", records)
+
+	report, err := Explain(ctx, client, "test-stream", cloudwatch.AlarmNaming{}, scaling.Cooldowns{}, now)
+	assert.NoError(t, err)
+
+	assert.True(t, report.CooldownBlocks())
+	assert.Equal(t, 3*time.Minute, report.CooldownRemaining)
+	assert.Len(t, report.Alarms, 2)
+	assert.Equal(t, 3*time.Minute, report.Alarms[1].CooldownRemaining)
+
+	up := report.Alarms[0]
+	assert.Equal(t, "test-stream-scale-up", up.Name)
+	assert.Equal(t, "e6", up.ReturnID)
+	assert.Len(t, up.Datapoints, 5)
+	assert.Equal(t, 5, up.Breaching)
+	assert.True(t, up.WouldAlarm)
+	assert.Equal(t, "e3", up.Dominant())
+	assert.Equal(t, map[string]int{"e3": 5}, up.Dominance)
+
+	for _, series := range up.Series {
+		if series.ID == "e4" {
+			latest, ok := series.Latest()
+			assert.True(t, ok)
+			assert.InDelta(t, 0.1, latest, 1e-9)
+		}
+	}
+
+	down := report.Alarms[1]
+	assert.Equal(t, "test-stream-scale-down", down.Name)
+	assert.Len(t, down.Datapoints, 60)
+	// The periods without traffic breach the scale-down threshold
+	assert.Equal(t, 55, down.Breaching)
+	assert.False(t, down.WouldAlarm)
+}
+
+func TestExplainNoAlarms(t *testing.T) {
+	fake := nemesistest.NewCloudWatch()
+	fake.AddAlarm(awscloudwatch.PutMetricAlarmInput{AlarmName: aws.String("other-stream-scale-up")}, types.StateValueOk, nil)
+
+	_, err := Explain(context.Background(), cloudwatch.NewFromAPI(fake), "test-stream", cloudwatch.AlarmNaming{}, scaling.Cooldowns{}, time.Now())
+	assert.Error(t, err)
+}
+
+func TestExplain_Cooldowns(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 9, 1, 12, 2, 0, 0, time.UTC)
+
+	fake := nemesistest.NewCloudWatch()
+	client := cloudwatch.NewFromAPI(fake)
+
+	assert.NoError(t, client.UpdateAlarm(ctx, "test-stream-scale-up", "test-stream", "", false, 2, cloudwatch.ReadSide{}, cloudwatch.DefaultAlarmSettings()))
+	assert.NoError(t, client.UpdateAlarm(ctx, "test-stream-scale-down", "test-stream", "", true, 2, cloudwatch.ReadSide{}, cloudwatch.DefaultAlarmSettings()))
+
+	// The stream was scaled up 10 minutes ago
+	scaled := cloudwatch.AlarmMetadata{}.Record("Up", "test-stream-scale-down", cloudwatch.Scaling{Action: "Up", Timestamp: now.Add(-10 * time.Minute)})
+	assert.NoError(t, client.SetAlarmTags(ctx, nemesistest.AlarmArn("test-stream-scale-up"), scaled.Tags()))
+	scaled.ScaleAction, scaled.ComplimentaryAlarm = "Down", "test-stream-scale-up"
+	assert.NoError(t, client.SetAlarmTags(ctx, nemesistest.AlarmArn("test-stream-scale-down"), scaled.Tags()))
+
+	report, err := Explain(ctx, client, "test-stream", cloudwatch.AlarmNaming{}, scaling.Cooldowns{ScaleUpMinutes: 15, ScaleDownAfterScaleUpMinutes: 60}, now)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Up", report.Alarms[0].Action)
+	assert.Equal(t, 5*time.Minute, report.Alarms[0].CooldownRemaining)
+	assert.Equal(t, "Down", report.Alarms[1].Action)
+	assert.Equal(t, 50*time.Minute, report.Alarms[1].CooldownRemaining)
+	assert.Equal(t, 50*time.Minute, report.CooldownRemaining)
+}
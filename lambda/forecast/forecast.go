@@ -0,0 +1,219 @@
+// Package forecast predicts the load of a stream from its seasonality, so that Nemesis can scale up ahead of a peak
+// instead of reacting to it
+package forecast
+
+import (
+	"context"
+	"github.com/vmanikes/Nemesis/audit"
+	"github.com/vmanikes/Nemesis/cloudwatch"
+	"github.com/vmanikes/Nemesis/logging"
+	"go.uber.org/zap"
+	"math"
+	"time"
+)
+
+const (
+	// bytesPerShardPerMinute and recordsPerShardPerMinute are the write limits of a single shard
+	bytesPerShardPerMinute   = 1024 * 1024 * 60
+	recordsPerShardPerMinute = 1000 * 60
+)
+
+// Config configures predictive scaling
+type Config struct {
+	// Enabled runs a forecast for every stream of Streams on the scheduled invocations
+	Enabled bool     `json:"enabled"`
+	Streams []string `json:"streams,omitempty"`
+	// Weeks is the history the model is fitted on, 3 when 0
+	Weeks int `json:"weeks,omitempty"`
+	// PeriodMinutes is the resolution of the model and how often a forecast is made, 15 when 0
+	PeriodMinutes int `json:"periodMinutes,omitempty"`
+	// SeasonHours is the length of a season, a week when 0
+	SeasonHours int `json:"seasonHours,omitempty"`
+	// HorizonMinutes is how far ahead the load is forecast, 120 when 0
+	HorizonMinutes int `json:"horizonMinutes,omitempty"`
+}
+
+// WithDefaults returns the config with the defaults for the unset fields
+func (c Config) WithDefaults() Config {
+	if c.Weeks <= 0 {
+		c.Weeks = 3
+	}
+	if c.PeriodMinutes <= 0 {
+		c.PeriodMinutes = 15
+	}
+	if c.SeasonHours <= 0 {
+		c.SeasonHours = 7 * 24
+	}
+	if c.HorizonMinutes <= 0 {
+		c.HorizonMinutes = 120
+	}
+	return c
+}
+
+// Period returns the resolution of the model
+func (c Config) Period() time.Duration {
+	return time.Duration(c.WithDefaults().PeriodMinutes) * time.Minute
+}
+
+// Covers checks if the stream is forecast
+func (c Config) Covers(streamName string) bool {
+	if !c.Enabled {
+		return false
+	}
+	for _, name := range c.Streams {
+		if name == streamName {
+			return true
+		}
+	}
+	return false
+}
+
+// Prediction is a forecast along with the history it was fitted on
+type Prediction struct {
+	Forecast audit.Forecast
+	History  []cloudwatch.StreamDatapoint
+}
+
+// Predict fits a Holt-Winters model to the IncomingBytes and IncomingRecords of the stream over the last weeks and
+// forecasts them over the horizon. The forecast starts at the current period, which is not complete yet
+func Predict(ctx context.Context, client *cloudwatch.Client, streamName string, cfg Config, now time.Time) (Prediction, error) {
+	logger := logging.WithContext(ctx)
+
+	cfg = cfg.WithDefaults()
+	period := cfg.Period()
+
+	end := now.UTC().Truncate(period)
+	start := end.Add(-time.Duration(cfg.Weeks) * 7 * 24 * time.Hour)
+
+	history, err := client.GetStreamMetrics(ctx, streamName, start, end, period)
+	if err != nil {
+		return Prediction{}, err
+	}
+
+	bytes := make([]float64, len(history))
+	records := make([]float64, len(history))
+	for i, datapoint := range history {
+		bytes[i], records[i] = datapoint.IncomingBytes, datapoint.IncomingRecords
+	}
+
+	seasonLength := cfg.SeasonHours * 60 / cfg.PeriodMinutes
+	horizon := (cfg.HorizonMinutes + cfg.PeriodMinutes - 1) / cfg.PeriodMinutes
+
+	prediction := Prediction{
+		Forecast: audit.Forecast{
+			Start:         end,
+			PeriodMinutes: cfg.PeriodMinutes,
+		},
+		History: history,
+	}
+
+	for _, series := range []struct {
+		values   []float64
+		forecast *[]float64
+	}{
+		{bytes, &prediction.Forecast.IncomingBytes},
+		{records, &prediction.Forecast.IncomingRecords},
+	} {
+		model, err := Fit(series.values, seasonLength)
+		if err != nil {
+			logger.Error("unable to fit the forecast model",
+				zap.Int("periods", len(series.values)),
+				zap.Int("season-length", seasonLength),
+				zap.Error(err))
+			return Prediction{}, err
+		}
+		*series.forecast = model.Forecast(horizon)
+	}
+
+	return prediction, nil
+}
+
+// UsageFactors returns the forecast usage factor of every period at the shard count, the higher of the bytes and the
+// records against the write limits, as in the scale-up alarm
+func UsageFactors(forecast audit.Forecast, shardCount int) []float64 {
+	minutes := float64(forecast.PeriodMinutes)
+	factors := make([]float64, len(forecast.IncomingBytes))
+
+	for i := range forecast.IncomingBytes {
+		bytes := forecast.IncomingBytes[i] / (bytesPerShardPerMinute * minutes * float64(shardCount))
+		records := 0.0
+		if i < len(forecast.IncomingRecords) {
+			records = forecast.IncomingRecords[i] / (recordsPerShardPerMinute * minutes * float64(shardCount))
+		}
+		factors[i] = math.Max(bytes, records)
+	}
+
+	return factors
+}
+
+// Peak returns the highest forecast usage factor at the shard count and the start of its period
+func Peak(forecast audit.Forecast, shardCount int) (float64, time.Time) {
+	peak, at := 0.0, forecast.Start
+	for i, factor := range UsageFactors(forecast, shardCount) {
+		if factor > peak {
+			peak, at = factor, forecast.Start.Add(time.Duration(i*forecast.PeriodMinutes)*time.Minute)
+		}
+	}
+
+	return peak, at
+}
+
+// RequiredShardCount returns the lowest shard count that keeps every forecast usage factor below the threshold
+func RequiredShardCount(forecast audit.Forecast, threshold float64) int {
+	peak, _ := Peak(forecast, 1)
+	return int(math.Floor(peak/threshold)) + 1
+}
+
+// Accuracy compares the forecast with the history of a later prediction. Only the periods that are complete in the
+// history and had traffic are compared. It returns nil when there is nothing to compare
+func Accuracy(forecast audit.Forecast, forecastAt time.Time, history []cloudwatch.StreamDatapoint) *audit.ForecastAccuracy {
+	if len(history) < 2 || forecast.PeriodMinutes <= 0 {
+		return nil
+	}
+
+	period := time.Duration(forecast.PeriodMinutes) * time.Minute
+	if history[1].Timestamp.Sub(history[0].Timestamp) != period {
+		return nil
+	}
+
+	actual := make(map[time.Time]cloudwatch.StreamDatapoint, len(history))
+	for _, datapoint := range history {
+		actual[datapoint.Timestamp.UTC()] = datapoint
+	}
+
+	accuracy := &audit.ForecastAccuracy{ForecastAt: forecastAt}
+	bytesPeriods, recordsPeriods := 0, 0
+
+	for i := range forecast.IncomingBytes {
+		datapoint, ok := actual[forecast.Start.UTC().Add(time.Duration(i)*period)]
+		if !ok {
+			continue
+		}
+
+		if datapoint.IncomingBytes > 0 {
+			accuracy.IncomingBytesError += math.Abs(forecast.IncomingBytes[i]-datapoint.IncomingBytes) / datapoint.IncomingBytes
+			bytesPeriods++
+		}
+		if i < len(forecast.IncomingRecords) && datapoint.IncomingRecords > 0 {
+			accuracy.IncomingRecordsError += math.Abs(forecast.IncomingRecords[i]-datapoint.IncomingRecords) / datapoint.IncomingRecords
+			recordsPeriods++
+		}
+	}
+
+	if bytesPeriods == 0 && recordsPeriods == 0 {
+		return nil
+	}
+
+	accuracy.Periods = bytesPeriods
+	if recordsPeriods > accuracy.Periods {
+		accuracy.Periods = recordsPeriods
+	}
+	if bytesPeriods > 0 {
+		accuracy.IncomingBytesError /= float64(bytesPeriods)
+	}
+	if recordsPeriods > 0 {
+		accuracy.IncomingRecordsError /= float64(recordsPeriods)
+	}
+
+	return accuracy
+}
@@ -0,0 +1,92 @@
+package forecast
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmanikes/Nemesis/audit"
+	"github.com/vmanikes/Nemesis/cloudwatch"
+	"github.com/vmanikes/Nemesis/nemesistest"
+	"math"
+	"testing"
+	"time"
+)
+
+// daily returns the value of a daily pattern with a peak of 4 times the base at 02:00
+func daily(hour int) float64 {
+	return 1000 + 3000*math.Max(0, math.Cos(float64(hour-2)*math.Pi/6))
+}
+
+func TestHoltWinters(t *testing.T) {
+	series := make([]float64, 0, 5*24)
+	for day := 0; day < 5; day++ {
+		for hour := 0; hour < 24; hour++ {
+			series = append(series, daily(hour)*(1+0.01*float64(day)))
+		}
+	}
+
+	model, err := Fit(series, 24)
+	assert.NoError(t, err)
+
+	forecast := model.Forecast(24)
+	assert.Len(t, forecast, 24)
+	for hour, value := range forecast {
+		assert.InDelta(t, daily(hour)*1.05, value, 0.05*daily(hour), "hour %d", hour)
+	}
+
+	_, err = Fit(series[:47], 24)
+	assert.ErrorIs(t, err, ErrShortSeries)
+}
+
+func TestPredict(t *testing.T) {
+	now := time.Date(2022, 9, 22, 1, 10, 0, 0, time.UTC)
+	cfg := Config{Weeks: 1, PeriodMinutes: 60, SeasonHours: 24, HorizonMinutes: 180}
+
+	bytes := make(map[time.Time]float64)
+	records := make(map[time.Time]float64)
+	for timestamp := now.Add(-8 * 24 * time.Hour).Truncate(time.Hour); timestamp.Before(now); timestamp = timestamp.Add(time.Hour) {
+		bytes[timestamp] = daily(timestamp.Hour()) * 1024 * 3600
+		records[timestamp] = daily(timestamp.Hour())
+	}
+
+	fake := nemesistest.NewCloudWatch()
+	fake.AddMetricData("IncomingBytes", "test-stream", bytes)
+	fake.AddMetricData("IncomingRecords", "test-stream", records)
+
+	prediction, err := Predict(context.Background(), cloudwatch.NewFromAPI(fake), "test-stream", cfg, now)
+	assert.NoError(t, err)
+
+	assert.Equal(t, time.Date(2022, 9, 22, 1, 0, 0, 0, time.UTC), prediction.Forecast.Start)
+	assert.Len(t, prediction.Forecast.IncomingBytes, 3)
+	assert.Len(t, prediction.History, 7*24)
+
+	// The 02:00 peak is 4000 KiB per second, a usage factor of 0.98 on 4 shards
+	peak, at := Peak(prediction.Forecast, 4)
+	assert.InDelta(t, 4000.0/1024/4, peak, 0.05)
+	assert.Equal(t, time.Date(2022, 9, 22, 2, 0, 0, 0, time.UTC), at)
+	assert.Equal(t, 16, RequiredShardCount(prediction.Forecast, 0.25))
+}
+
+func TestAccuracy(t *testing.T) {
+	start := time.Date(2022, 9, 22, 1, 0, 0, 0, time.UTC)
+	forecast := audit.Forecast{
+		Start:           start,
+		PeriodMinutes:   60,
+		IncomingBytes:   []float64{110, 180, 100},
+		IncomingRecords: []float64{10, 20, 10},
+	}
+
+	history := []cloudwatch.StreamDatapoint{
+		{Timestamp: start.Add(-time.Hour), IncomingBytes: 100, IncomingRecords: 10},
+		{Timestamp: start, IncomingBytes: 100, IncomingRecords: 10},
+		{Timestamp: start.Add(time.Hour), IncomingBytes: 200, IncomingRecords: 0},
+	}
+
+	accuracy := Accuracy(forecast, start.Add(-time.Minute), history)
+	if assert.NotNil(t, accuracy) {
+		assert.Equal(t, 2, accuracy.Periods)
+		assert.InDelta(t, 0.1, accuracy.IncomingBytesError, 1e-9)
+		assert.InDelta(t, 0, accuracy.IncomingRecordsError, 1e-9)
+	}
+
+	assert.Nil(t, Accuracy(forecast, start, history[:1]))
+}
@@ -0,0 +1,114 @@
+package forecast
+
+import (
+	"errors"
+	"math"
+)
+
+// ErrShortSeries is returned when the series does not cover two seasons, the least the model is initialised from
+var ErrShortSeries = errors.New("series must cover at least two seasons")
+
+// smoothing are the candidate parameters Fit searches. Trend is kept low, the series are mostly seasonal
+var (
+	alphas = []float64{0.05, 0.1, 0.2, 0.3, 0.5, 0.7, 0.9}
+	betas  = []float64{0, 0.01, 0.05, 0.1, 0.2}
+	gammas = []float64{0.05, 0.1, 0.2, 0.3, 0.5, 0.7, 0.9}
+)
+
+// HoltWinters is an additive Holt-Winters model: a level, a trend and a seasonal component of SeasonLength periods
+type HoltWinters struct {
+	Alpha, Beta, Gamma float64
+	SeasonLength       int
+	// SSE is the sum of the squared one step ahead errors over the fitted series
+	SSE float64
+
+	level    float64
+	trend    float64
+	seasonal []float64
+	// next is the position of the period after the series within the season
+	next int
+}
+
+// Fit fits the model to the series with the smoothing parameters that minimise the one step ahead errors
+func Fit(series []float64, seasonLength int) (*HoltWinters, error) {
+	var best *HoltWinters
+
+	for _, alpha := range alphas {
+		for _, beta := range betas {
+			for _, gamma := range gammas {
+				model, err := FitWith(series, seasonLength, alpha, beta, gamma)
+				if err != nil {
+					return nil, err
+				}
+				if best == nil || model.SSE < best.SSE {
+					best = model
+				}
+			}
+		}
+	}
+
+	return best, nil
+}
+
+// FitWith fits the model to the series with the given smoothing parameters. The level and trend start from the means
+// of the first two seasons and the seasonal component from the average deviation of every season from its mean
+func FitWith(series []float64, seasonLength int, alpha, beta, gamma float64) (*HoltWinters, error) {
+	if seasonLength <= 0 || len(series) < 2*seasonLength {
+		return nil, ErrShortSeries
+	}
+
+	seasons := len(series) / seasonLength
+	means := make([]float64, seasons)
+	for s := 0; s < seasons; s++ {
+		means[s] = mean(series[s*seasonLength : (s+1)*seasonLength])
+	}
+
+	model := &HoltWinters{
+		Alpha:        alpha,
+		Beta:         beta,
+		Gamma:        gamma,
+		SeasonLength: seasonLength,
+		level:        means[0],
+		trend:        (means[1] - means[0]) / float64(seasonLength),
+		seasonal:     make([]float64, seasonLength),
+	}
+
+	for i := 0; i < seasonLength; i++ {
+		for s := 0; s < seasons; s++ {
+			model.seasonal[i] += series[s*seasonLength+i] - means[s]
+		}
+		model.seasonal[i] /= float64(seasons)
+	}
+
+	for t, value := range series {
+		i := t % seasonLength
+		predicted := model.level + model.trend + model.seasonal[i]
+		model.SSE += (value - predicted) * (value - predicted)
+
+		level := alpha*(value-model.seasonal[i]) + (1-alpha)*(model.level+model.trend)
+		model.trend = beta*(level-model.level) + (1-beta)*model.trend
+		model.seasonal[i] = gamma*(value-level) + (1-gamma)*model.seasonal[i]
+		model.level = level
+	}
+	model.next = len(series) % seasonLength
+
+	return model, nil
+}
+
+// Forecast predicts the next periods after the fitted series. Load is never negative, so neither is the forecast
+func (m *HoltWinters) Forecast(periods int) []float64 {
+	forecast := make([]float64, periods)
+	for h := 0; h < periods; h++ {
+		forecast[h] = math.Max(0, m.level+float64(h+1)*m.trend+m.seasonal[(m.next+h)%m.SeasonLength])
+	}
+
+	return forecast
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
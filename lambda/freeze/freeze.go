@@ -0,0 +1,141 @@
+// Package freeze contains the scaling freezes, which stop Nemesis from resharding streams during incidents and
+// maintenance
+package freeze
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vmanikes/Nemesis/scaling"
+	"strconv"
+	"time"
+)
+
+// The tags a freeze is set with on a stream
+const (
+	UntilTag        = "NemesisFreezeUntil"
+	AllowScaleUpTag = "NemesisFreezeAllowScaleUp"
+	ReasonTag       = "NemesisFreezeReason"
+)
+
+// TagKeys are the keys of every freeze tag, for removing a freeze from a stream
+var TagKeys = []string{UntilTag, AllowScaleUpTag, ReasonTag}
+
+// Window stops the scaling of a stream, given by name or ARN, or of every stream when StreamName is empty, from From
+// until Until. With AllowScaleUp only the scale-downs are blocked
+type Window struct {
+	StreamName   string    `json:"stream,omitempty"`
+	From         time.Time `json:"from,omitempty"`
+	Until        time.Time `json:"until"`
+	AllowScaleUp bool      `json:"allowScaleUp,omitempty"`
+	Reason       string    `json:"reason,omitempty"`
+}
+
+// Validate checks that the window expires and starts before it does
+func (w Window) Validate() error {
+	if w.Until.IsZero() {
+		return errors.New("freeze window must have an until time")
+	}
+	if !w.From.IsZero() && !w.From.Before(w.Until) {
+		return fmt.Errorf("freeze window from %s must be before until %s", w.From.Format(time.RFC3339), w.Until.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// Active checks if now is within the window
+func (w Window) Active(now time.Time) bool {
+	return !now.Before(w.From) && now.Before(w.Until)
+}
+
+// Blocks checks if the window blocks the scale action
+func (w Window) Blocks(action string) bool {
+	return !w.AllowScaleUp || !scaling.IsScaleUp(action)
+}
+
+// String describes the window for the alarm state reasons and the audit trail
+func (w Window) String() string {
+	description := "until " + w.Until.UTC().Format(time.RFC3339)
+	if w.Reason != "" {
+		description = w.Reason + " " + description
+	}
+	if w.AllowScaleUp {
+		description += ", scale-ups allowed"
+	}
+
+	return description
+}
+
+// FromTags reads the freeze window a stream is tagged with. It returns false when the stream is not tagged with one
+func FromTags(streamName string, tags map[string]string) (Window, bool, error) {
+	until, ok := tags[UntilTag]
+	if !ok {
+		return Window{}, false, nil
+	}
+
+	window := Window{
+		StreamName: streamName,
+		Reason:     tags[ReasonTag],
+	}
+
+	var err error
+	window.Until, err = time.Parse(time.RFC3339, until)
+	if err != nil {
+		return Window{}, false, fmt.Errorf("invalid %s tag: %w", UntilTag, err)
+	}
+
+	if allowScaleUp, ok := tags[AllowScaleUpTag]; ok {
+		window.AllowScaleUp, err = strconv.ParseBool(allowScaleUp)
+		if err != nil {
+			return Window{}, false, fmt.Errorf("invalid %s tag: %w", AllowScaleUpTag, err)
+		}
+	}
+
+	return window, true, nil
+}
+
+// Tags returns the stream tags that set the window. Tag freezes start when they are set, so From is not kept
+func (w Window) Tags() map[string]string {
+	tags := map[string]string{
+		UntilTag:        w.Until.UTC().Format(time.RFC3339),
+		AllowScaleUpTag: strconv.FormatBool(w.AllowScaleUp),
+	}
+	if w.Reason != "" {
+		tags[ReasonTag] = w.Reason
+	}
+
+	return tags
+}
+
+// Find returns the window among the windows of a stream that blocks its scale action at now. When several do, the one
+// that expires last is returned
+func Find(windows []Window, action string, now time.Time) (Window, bool) {
+	var (
+		blocking Window
+		found    bool
+	)
+
+	for _, window := range windows {
+		if !window.Active(now) || !window.Blocks(action) {
+			continue
+		}
+		if !found || window.Until.After(blocking.Until) {
+			blocking, found = window, true
+		}
+	}
+
+	return blocking, found
+}
+
+// Validate checks every window
+func Validate(windows []Window) error {
+	for _, window := range windows {
+		if err := window.Validate(); err != nil {
+			if window.StreamName != "" {
+				return fmt.Errorf("stream %q: %w", window.StreamName, err)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package freeze
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFind(t *testing.T) {
+	now := time.Date(2022, 10, 3, 12, 0, 0, 0, time.UTC)
+
+	windows := []Window{
+		{Until: now.Add(time.Hour), AllowScaleUp: true, Reason: "consumer migration"},
+		{StreamName: "orders", Until: now.Add(2 * time.Hour), Reason: "incident"},
+	}
+
+	window, ok := Find(windows, "Up", now)
+	assert.True(t, ok)
+	assert.Equal(t, "incident", window.Reason)
+
+	// The global window lets scale-ups through
+	_, ok = Find(windows[:1], "Emergency", now)
+	assert.False(t, ok)
+
+	window, ok = Find(windows[:1], "Down", now)
+	assert.True(t, ok)
+	assert.Equal(t, "consumer migration until 2022-10-03T13:00:00Z, scale-ups allowed", window.String())
+
+	// Expired windows block nothing
+	_, ok = Find(windows, "Down", now.Add(2*time.Hour))
+	assert.False(t, ok)
+
+	// Windows that have not started block nothing, and the one that expires last wins
+	windows = append(windows, Window{StreamName: "orders", From: now.Add(time.Hour), Until: now.Add(3 * time.Hour)})
+
+	window, ok = Find(windows, "Down", now)
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(2*time.Hour), window.Until)
+
+	window, ok = Find(windows, "Up", now.Add(time.Hour))
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(3*time.Hour), window.Until)
+}
+
+func TestTags(t *testing.T) {
+	window := Window{Until: time.Date(2022, 10, 3, 12, 0, 0, 0, time.UTC), AllowScaleUp: true, Reason: "incident"}
+
+	read, ok, err := FromTags("orders", window.Tags())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Window{StreamName: "orders", Until: window.Until, AllowScaleUp: true, Reason: "incident"}, read)
+
+	_, ok, err = FromTags("orders", map[string]string{"team": "payments"})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, _, err = FromTags("orders", map[string]string{UntilTag: "tomorrow"})
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	until := time.Date(2022, 10, 3, 12, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, Validate([]Window{{Until: until}, {StreamName: "orders", From: until.Add(-time.Hour), Until: until}}))
+	assert.Error(t, Validate([]Window{{StreamName: "orders"}}))
+	assert.Error(t, Validate([]Window{{From: until, Until: until}}))
+}
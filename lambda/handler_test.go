@@ -0,0 +1,798 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sdkcloudwatch "github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cloudwatchtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	kinesistypes "github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmanikes/Nemesis/accounts"
+	"github.com/vmanikes/Nemesis/audit"
+	"github.com/vmanikes/Nemesis/clock"
+	"github.com/vmanikes/Nemesis/cloudwatch"
+	"github.com/vmanikes/Nemesis/constants"
+	"github.com/vmanikes/Nemesis/freeze"
+	"github.com/vmanikes/Nemesis/intent"
+	"github.com/vmanikes/Nemesis/kinesis"
+	"github.com/vmanikes/Nemesis/nemesistest"
+	types2 "github.com/vmanikes/Nemesis/types"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scenario wires handleRequest to the fakes, with a 2 shard test-stream and its pair of alarms
+type scenario struct {
+	t          *testing.T
+	cloudwatch *nemesistest.CloudWatch
+	kinesis    *nemesistest.Kinesis
+	auditStore *audit.FileStore
+}
+
+func newScenario(t *testing.T) *scenario {
+	s := &scenario{
+		t:          t,
+		cloudwatch: nemesistest.NewCloudWatch(),
+		kinesis:    nemesistest.NewKinesis(),
+	}
+
+	s.kinesis.AddStream("test-stream", 2)
+	for _, name := range []string{"alarm-scale-up", "alarm-scale-down", "alarm-scale-up-throttling"} {
+		s.cloudwatch.AddAlarm(sdkcloudwatch.PutMetricAlarmInput{AlarmName: aws.String(name)}, cloudwatchtypes.StateValueAlarm, nil)
+	}
+
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	s.auditStore = audit.NewFileStore(auditPath)
+	t.Setenv(constants.AuditStoreEnv, "file://"+auditPath)
+	t.Setenv(constants.ConfigEnv, "")
+	t.Setenv(constants.PolicyEnv, "")
+
+	previousCloudwatch, previousKinesis := newCloudwatchClient, newKinesisClient
+	newCloudwatchClient = func(context.Context, accounts.Target) (*cloudwatch.Client, error) {
+		return cloudwatch.NewFromAPI(s.cloudwatch), nil
+	}
+	newKinesisClient = func(context.Context, accounts.Target) (*kinesis.Client, error) {
+		return kinesis.NewFromAPI(s.kinesis), nil
+	}
+	t.Cleanup(func() {
+		newCloudwatchClient, newKinesisClient = previousCloudwatch, previousKinesis
+	})
+
+	return s
+}
+
+// fixClock makes the handler read the time from a clock fixed at the time
+func (s *scenario) fixClock(now time.Time) time.Time {
+	previous := systemClock
+	systemClock = clock.Fixed(now)
+	s.t.Cleanup(func() {
+		systemClock = previous
+	})
+
+	return now
+}
+
+// trigger sends the alarm1.json payload as if the named alarm had fired
+func (s *scenario) trigger(alarmName string) {
+	s.triggerWith(alarmName, func(types2.AlarmInformation) {})
+}
+
+// triggerWith sends the notification of alarm1.json for the alarm, changed by update
+func (s *scenario) triggerWith(alarmName string, update func(alarmInformation types2.AlarmInformation)) {
+	body, err := ioutil.ReadFile("tests/alarm1.json")
+	assert.NoError(s.t, err)
+
+	var alarmInformation types2.AlarmInformation
+	assert.NoError(s.t, json.Unmarshal(body, &alarmInformation))
+
+	alarmInformation["AlarmName"] = alarmName
+	alarmInformation["AlarmArn"] = nemesistest.AlarmArn(alarmName)
+	update(alarmInformation)
+
+	message, err := json.Marshal(alarmInformation)
+	assert.NoError(s.t, err)
+
+	handleRequest(context.Background(), events.SNSEvent{
+		Records: []events.SNSEventRecord{{SNS: events.SNSEntity{Message: string(message)}}},
+	})
+}
+
+// lastEvent returns the last recorded scaling event of test-stream
+func (s *scenario) lastEvent() audit.ScalingEvent {
+	events, err := s.auditStore.History(context.Background(), accounts.Target{StreamName: "test-stream"}, time.Time{})
+	assert.NoError(s.t, err)
+	if !assert.NotEmpty(s.t, events) {
+		return audit.ScalingEvent{}
+	}
+
+	return events[len(events)-1]
+}
+
+// shardCountExpression returns the s1 expression of the alarm
+func (s *scenario) shardCountExpression(alarmName string) string {
+	alarm, ok := s.cloudwatch.Alarm(alarmName)
+	assert.True(s.t, ok)
+
+	for _, metric := range alarm.Definition.Metrics {
+		if aws.ToString(metric.Id) == "s1" {
+			return aws.ToString(metric.Expression)
+		}
+	}
+
+	return ""
+}
+
+func TestHandleRequest_ScaleUp(t *testing.T) {
+	s := newScenario(t)
+	now := s.fixClock(time.Date(2020, 4, 23, 23, 30, 0, 0, time.FixedZone("CEST", 2*60*60)))
+
+	s.trigger("alarm-scale-up")
+
+	stream, _ := s.kinesis.Stream("test-stream")
+	assert.Equal(t, 4, stream.ShardCount)
+
+	assert.Equal(t, "4", s.shardCountExpression("alarm-scale-up"))
+	assert.Equal(t, "4", s.shardCountExpression("alarm-scale-down"))
+
+	scaleUpAlarm, _ := s.cloudwatch.Alarm("alarm-scale-up")
+	assert.Equal(t, cloudwatchtypes.StateValueInsufficientData, scaleUpAlarm.State)
+	assert.Equal(t, "Up", scaleUpAlarm.Tags["ScaleAction"])
+	assert.Equal(t, "alarm-scale-down", scaleUpAlarm.Tags["ComplimentaryAlarm"])
+	assert.NotEmpty(t, scaleUpAlarm.Tags["LastScaledTimestamp"])
+
+	metadata, err := cloudwatch.ParseMetadata(scaleUpAlarm.Tags)
+	assert.NoError(t, err)
+	assert.Equal(t, cloudwatch.MetadataVersion, metadata.Version)
+	assert.Equal(t, 2, metadata.PreviousShardCount)
+	assert.Equal(t, 4, metadata.ShardCount)
+	assert.Equal(t, "alarm alarm-scale-up: doubling 2 to 4 shards", metadata.LastReason)
+	assert.Equal(t, "2020-04-23T21:30:00.000+0000", metadata.LastScaledTimestamp)
+	assert.Equal(t, "2020-04-23T21:30:00.000Z", metadata.LastScaledAt)
+	assert.Equal(t, constants.Version, metadata.NemesisVersion)
+	assert.Len(t, metadata.RecentActions, 1)
+
+	event := s.lastEvent()
+	assert.Equal(t, audit.OutcomeApplied, event.Outcome)
+	assert.Equal(t, 2, event.ShardCount)
+	assert.Equal(t, 4, event.TargetShardCount)
+	assert.Equal(t, now.UTC(), event.Timestamp)
+}
+
+func TestHandleRequest_ScaleDownToMinimum(t *testing.T) {
+	s := newScenario(t)
+
+	s.trigger("alarm-scale-down")
+
+	stream, _ := s.kinesis.Stream("test-stream")
+	assert.Equal(t, 1, stream.ShardCount)
+
+	// The scale-down alarm of a stream at the minimum stays in OK, without changing the threshold of other streams
+	scaleDownAlarm, _ := s.cloudwatch.Alarm("alarm-scale-down")
+	assert.Equal(t, -1.0, aws.ToFloat64(scaleDownAlarm.Definition.Threshold))
+	assert.Equal(t, 0.075, constants.ScaleDownThreshold)
+}
+
+func TestHandleRequest_StreamPolicy(t *testing.T) {
+	s := newScenario(t)
+
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`version: 1
+policies:
+  - name: default
+  - name: test
+    streams: [test-stream]
+    thresholds:
+      scaleUp: 0.4
+      scaleDown: 0.1
+    bounds:
+      minShardCount: 1
+      maxShardCount: 3
+`), 0644))
+	t.Setenv(constants.PolicyEnv, path)
+
+	s.trigger("alarm-scale-up")
+
+	stream, _ := s.kinesis.Stream("test-stream")
+	assert.Equal(t, 3, stream.ShardCount)
+
+	scaleUpAlarm, _ := s.cloudwatch.Alarm("alarm-scale-up")
+	assert.Equal(t, 0.4, aws.ToFloat64(scaleUpAlarm.Definition.Threshold))
+	scaleDownAlarm, _ := s.cloudwatch.Alarm("alarm-scale-down")
+	assert.Equal(t, 0.1, aws.ToFloat64(scaleDownAlarm.Definition.Threshold))
+
+	assert.Equal(t, 0.25, constants.ScaleUpThreshold)
+}
+
+func TestHandleRequest_StreamStrategy(t *testing.T) {
+	s := newScenario(t)
+	t.Setenv(constants.ConfigEnv, `{"strategies": {"streams": {"test-stream": {"name": "targetTracking", "parameters": {"targetUsageFactor": 0.3}}}}}`)
+
+	// alarm1.json holds a usage factor of 0.43 on 2 shards
+	s.trigger("alarm-scale-up")
+
+	stream, _ := s.kinesis.Stream("test-stream")
+	assert.Equal(t, 3, stream.ShardCount)
+
+	event := s.lastEvent()
+	assert.Equal(t, audit.OutcomeApplied, event.Outcome)
+	assert.Equal(t, "usage factor 0.433 on 2 shards tracks 0.300 with 3 shards", event.Decision)
+}
+
+func TestHandleRequest_StrategyHoldsScaleDownOnIteratorAge(t *testing.T) {
+	s := newScenario(t)
+	t.Setenv(constants.ConfigEnv, `{"strategies": {"default": {"name": "targetTracking", "parameters": {"maxIteratorAgeMinutes": 30}}}}`)
+	now := s.fixClock(time.Date(2022, 9, 1, 12, 2, 0, 0, time.UTC))
+
+	// The consumers are 45 minutes behind
+	s.cloudwatch.AddMetricData("GetRecords.IteratorAgeMilliseconds", "test-stream", map[time.Time]float64{
+		now.Add(-2 * time.Minute): 45 * 60 * 1000,
+	})
+
+	s.trigger("alarm-scale-down")
+
+	assert.Equal(t, 0, s.kinesis.CallCount("UpdateShardCount"))
+	assert.Equal(t, "iterator age of 45 minutes is above 30 minutes, not scaling down", s.lastEvent().Decision)
+}
+
+func TestHandleRequest_StepAdjustmentsFromMetricData(t *testing.T) {
+	s := newScenario(t)
+	t.Setenv(constants.ConfigEnv, `{"strategies": {"default": {"name": "step", "parameters": {"stepAdjustments": [
+		{"lowerBound": 0, "upperBound": 0.5, "adjustmentPercent": 25},
+		{"lowerBound": 0.5, "adjustmentPercent": 100}
+	]}}}}`)
+	now := s.fixClock(time.Date(2022, 9, 1, 12, 2, 0, 0, time.UTC))
+
+	// The scale-up alarm of 2 shards compares the usage factor of 5 minute periods, 1 MiB/s per shard each
+	assert.NoError(t, cloudwatch.NewFromAPI(s.cloudwatch).UpdateAlarm(context.Background(), "alarm-scale-up", "test-stream", "", false, 2, cloudwatch.ReadSide{}, cloudwatch.DefaultAlarmSettings()))
+	bytes := make(map[time.Time]float64)
+	for timestamp := now.Add(-30 * time.Minute).Truncate(5 * time.Minute); timestamp.Before(now); timestamp = timestamp.Add(5 * time.Minute) {
+		bytes[timestamp] = 1.2 * 1024 * 1024 * 300 * 2
+	}
+	s.cloudwatch.AddMetricData("IncomingBytes", "test-stream", bytes)
+
+	// The state reason holds no datapoints, the usage factors are read from the metrics of the alarm
+	s.triggerWith("alarm-scale-up", func(alarmInformation types2.AlarmInformation) {
+		alarmInformation["NewStateReason"] = "Threshold Crossed: no datapoints were received"
+	})
+
+	stream, _ := s.kinesis.Stream("test-stream")
+	assert.Equal(t, 4, stream.ShardCount)
+
+	event := s.lastEvent()
+	assert.Equal(t, audit.OutcomeApplied, event.Outcome)
+	if assert.NotEmpty(t, event.UsageFactors) {
+		assert.InDelta(t, 1.2, event.UsageFactors[0], 0.001)
+	}
+	assert.Equal(t, "usage factor 1.200 is 0.800 above the threshold of 0.400, step of 100% from 2 to 4 shards", event.Decision)
+}
+
+func TestHandleRequest_UnparsableLastScaledTimestamp(t *testing.T) {
+	s := newScenario(t)
+
+	s.cloudwatch.AddAlarm(sdkcloudwatch.PutMetricAlarmInput{AlarmName: aws.String("alarm-scale-up")}, cloudwatchtypes.StateValueAlarm,
+		map[string]string{"LastScaledTimestamp": "23/04/2020 21:16"})
+
+	s.trigger("alarm-scale-up")
+
+	// The cooldown can not be checked, so the stream is not scaled
+	assert.Equal(t, 0, s.kinesis.CallCount("UpdateShardCount"))
+
+	event := s.lastEvent()
+	assert.Equal(t, audit.OutcomeFailed, event.Outcome)
+	assert.Equal(t, "unable to check the cooldown", event.Reason)
+	assert.Contains(t, event.Error, "invalid last scaled timestamp")
+}
+
+func TestHandleRequest_Cooldown(t *testing.T) {
+	s := newScenario(t)
+
+	// alarm1.json changed state at 2020-04-23T21:17:44.775+0000, a minute after the last scaling event
+	s.fixClock(time.Date(2020, 4, 23, 21, 17, 45, 0, time.UTC))
+	s.cloudwatch.AddAlarm(sdkcloudwatch.PutMetricAlarmInput{AlarmName: aws.String("alarm-scale-up")}, cloudwatchtypes.StateValueAlarm,
+		map[string]string{"LastScaledTimestamp": "2020-04-23T21:16:44.775+0000"})
+
+	s.trigger("alarm-scale-up")
+
+	assert.Equal(t, 0, s.kinesis.CallCount("UpdateShardCount"))
+
+	scaleUpAlarm, _ := s.cloudwatch.Alarm("alarm-scale-up")
+	assert.Equal(t, cloudwatchtypes.StateValueInsufficientData, scaleUpAlarm.State)
+
+	event := s.lastEvent()
+	assert.Equal(t, audit.OutcomeRejected, event.Outcome)
+	assert.Equal(t, "cooldown of 5m0s since the last scaling at 2020-04-23T21:16:44Z", event.Reason)
+}
+
+func TestHandleRequest_ConfiguredCooldown(t *testing.T) {
+	s := newScenario(t)
+	t.Setenv(constants.ConfigEnv, `{"cooldowns": {"scaleUpMinutes": 1}}`)
+
+	// The configured cooldown of a minute is over, whatever ScalePeriodMinutes is
+	s.fixClock(time.Date(2020, 4, 23, 21, 17, 45, 0, time.UTC))
+	s.cloudwatch.AddAlarm(sdkcloudwatch.PutMetricAlarmInput{AlarmName: aws.String("alarm-scale-up")}, cloudwatchtypes.StateValueAlarm,
+		map[string]string{"LastScaledTimestamp": "2020-04-23T21:16:44.775+0000"})
+
+	s.trigger("alarm-scale-up")
+
+	assert.Equal(t, 1, s.kinesis.CallCount("UpdateShardCount"))
+	assert.Equal(t, audit.OutcomeApplied, s.lastEvent().Outcome)
+}
+
+func TestHandleRequest_ScaledAfterStateChange(t *testing.T) {
+	s := newScenario(t)
+
+	// The stream was scaled after alarm1.json changed state at 2020-04-23T21:17:44.775+0000
+	s.cloudwatch.AddAlarm(sdkcloudwatch.PutMetricAlarmInput{AlarmName: aws.String("alarm-scale-up")}, cloudwatchtypes.StateValueAlarm,
+		map[string]string{"LastScaledTimestamp": "2020-04-23T21:18:44.775+0000"})
+
+	s.trigger("alarm-scale-up")
+
+	assert.Equal(t, 0, s.kinesis.CallCount("UpdateShardCount"))
+	assert.Equal(t, "alarm changed state before the last scaling event at 2020-04-23T21:18:44.775Z", s.lastEvent().Reason)
+}
+
+func TestHandleRequest_StreamUpdating(t *testing.T) {
+	s := newScenario(t)
+	s.kinesis.UpdatingDescribes = 3
+
+	s.trigger("alarm-scale-up")
+	assert.Equal(t, audit.OutcomeApplied, s.lastEvent().Outcome)
+
+	s.trigger("alarm-scale-up-throttling")
+	assert.Equal(t, audit.OutcomeSkipped, s.lastEvent().Outcome)
+	assert.Equal(t, 1, s.kinesis.CallCount("UpdateShardCount"))
+
+	s.kinesis.Settle()
+	stream, _ := s.kinesis.Stream("test-stream")
+	assert.Equal(t, kinesistypes.StreamStatusActive, stream.Status)
+	assert.Equal(t, 4, stream.ShardCount)
+}
+
+func TestHandleRequest_EmergencyBypassesCooldown(t *testing.T) {
+	s := newScenario(t)
+
+	s.cloudwatch.AddAlarm(sdkcloudwatch.PutMetricAlarmInput{AlarmName: aws.String("alarm-scale-up-throttling")}, cloudwatchtypes.StateValueAlarm,
+		map[string]string{"LastScaledTimestamp": "2020-04-23T21:16:44.775+0000"})
+
+	s.trigger("alarm-scale-up-throttling")
+
+	stream, _ := s.kinesis.Stream("test-stream")
+	assert.Equal(t, 4, stream.ShardCount)
+
+	throttlingAlarm, _ := s.cloudwatch.Alarm("alarm-scale-up-throttling")
+	assert.Equal(t, cloudwatchtypes.StateValueInsufficientData, throttlingAlarm.State)
+
+	event := s.lastEvent()
+	assert.Equal(t, audit.OutcomeApplied, event.Outcome)
+	assert.Equal(t, "Emergency", event.Action)
+}
+
+func TestHandleRequest_AlarmUpdateFails(t *testing.T) {
+	s := newScenario(t)
+	s.cloudwatch.FailOn("SetAlarmState", assert.AnError)
+
+	s.trigger("alarm-scale-up")
+
+	event := s.lastEvent()
+	assert.Equal(t, audit.OutcomeFailed, event.Outcome)
+	assert.Equal(t, "unable to update the scaling alarms", event.Reason)
+
+	// Both alarms are back to their definitions from before the reshard, without the scaling tags
+	for _, name := range []string{"alarm-scale-up", "alarm-scale-down"} {
+		alarm, _ := s.cloudwatch.Alarm(name)
+		assert.Empty(t, alarm.Definition.Metrics, name)
+		assert.Empty(t, alarm.Tags, name)
+	}
+}
+
+// streamTags returns the tags of test-stream
+func (s *scenario) streamTags() map[string]string {
+	stream, _ := s.kinesis.Stream("test-stream")
+	return stream.Tags
+}
+
+func TestHandleRequest_IntentOfFinishedScaling(t *testing.T) {
+	s := newScenario(t)
+
+	s.trigger("alarm-scale-up")
+	assert.Equal(t, audit.OutcomeApplied, s.lastEvent().Outcome)
+	assert.Equal(t, "4", s.streamTags()[intent.ToTag])
+
+	// Every step is done, the next invocation only removes the intent and goes on to the cooldown
+	s.trigger("alarm-scale-up")
+	assert.Equal(t, audit.OutcomeRejected, s.lastEvent().Outcome)
+	assert.NotContains(t, s.streamTags(), intent.ToTag)
+	assert.Equal(t, 2, s.cloudwatch.CallCount("PutMetricAlarm"))
+}
+
+func TestHandleRequest_ResumesInterruptedScaling(t *testing.T) {
+	s := newScenario(t)
+	s.cloudwatch.FailOn("SetAlarmState", assert.AnError)
+
+	s.trigger("alarm-scale-up")
+	assert.Equal(t, audit.OutcomeFailed, s.lastEvent().Outcome)
+	assert.Equal(t, "reshard alarms", s.streamTags()[intent.StepsTag])
+
+	s.cloudwatch.FailOn("SetAlarmState", nil)
+	s.trigger("alarm-scale-down")
+
+	event := s.lastEvent()
+	assert.Equal(t, audit.OutcomeResumed, event.Outcome)
+	assert.Equal(t, "completed the interrupted scale-Up from 2 to 4 shards", event.Reason)
+	assert.Equal(t, "Up", event.Action)
+	assert.Equal(t, "4", s.shardCountExpression("alarm-scale-up"))
+	assert.Equal(t, "4", s.shardCountExpression("alarm-scale-down"))
+	assert.NotContains(t, s.streamTags(), intent.ToTag)
+	assert.Equal(t, 1, s.kinesis.CallCount("UpdateShardCount"))
+}
+
+func TestHandleRequest_MalformedIntent(t *testing.T) {
+	s := newScenario(t)
+
+	pending := intent.Intent{Action: "Up", From: 2, To: 4, Steps: []string{intent.StepAlarms}, StartedAt: time.Now().UTC().Add(-time.Hour)}
+	tags := pending.Tags()
+	tags[intent.ToTag] = "four"
+	assert.NoError(t, kinesis.NewFromAPI(s.kinesis).TagStream(context.Background(), "test-stream", tags))
+
+	// The broken intent is dropped and the stream is scaled as if it had none
+	s.trigger("alarm-scale-up")
+	assert.Equal(t, audit.OutcomeApplied, s.lastEvent().Outcome)
+	assert.Equal(t, 1, s.kinesis.CallCount("UpdateShardCount"))
+	assert.Equal(t, "4", s.streamTags()[intent.ToTag])
+	assert.Equal(t, 1, s.kinesis.CallCount("RemoveTagsFromStream"))
+}
+
+func TestHandleRequest_RollsBackInterruptedIntent(t *testing.T) {
+	s := newScenario(t)
+
+	pending := intent.Intent{
+		Action:    "Up",
+		From:      2,
+		To:        4,
+		Steps:     []string{intent.StepReshard, intent.StepAlarms},
+		StartedAt: time.Now().UTC().Add(-time.Minute),
+	}
+	assert.NoError(t, kinesis.NewFromAPI(s.kinesis).TagStream(context.Background(), "test-stream", pending.Tags()))
+
+	// The invocation that wrote the intent may still be about to update the shard count
+	s.trigger("alarm-scale-up")
+	assert.Equal(t, audit.OutcomeSkipped, s.lastEvent().Outcome)
+	assert.Contains(t, s.streamTags(), intent.ToTag)
+
+	pending.StartedAt = time.Now().UTC().Add(-time.Hour)
+	assert.NoError(t, kinesis.NewFromAPI(s.kinesis).TagStream(context.Background(), "test-stream", pending.Tags()))
+
+	s.trigger("alarm-scale-up")
+
+	event := s.lastEvent()
+	assert.Equal(t, audit.OutcomeRolledBack, event.Outcome)
+	assert.Equal(t, "dropped the interrupted scale-Up from 2 to 4 shards, the stream has 2 shards", event.Reason)
+	assert.NotContains(t, s.streamTags(), intent.ToTag)
+	assert.Equal(t, 0, s.kinesis.CallCount("UpdateShardCount"))
+}
+
+// schedule configures a scheduled minimum of minShardCount for test-stream, active around now
+func (s *scenario) schedule(minShardCount int) {
+	s.scheduleStream("test-stream", minShardCount)
+}
+
+// scheduleStream configures an active scheduled scaling rule for the stream, given by name or by ARN
+func (s *scenario) scheduleStream(stream string, minShardCount int) {
+	now := time.Now().UTC()
+	s.t.Setenv(constants.ConfigEnv, fmt.Sprintf(`{"schedules": {%q: [{"name": "peak", "from": %q, "to": %q, "minShardCount": %d}]}}`,
+		stream, now.Add(-time.Hour).Format(time.RFC3339), now.Add(time.Hour).Format(time.RFC3339), minShardCount))
+}
+
+func TestHandleEvent_Schedule(t *testing.T) {
+	s := newScenario(t)
+	s.schedule(6)
+
+	scheduledEvent := []byte(`{"source": "aws.events", "detail-type": "Scheduled Event", "detail": {}}`)
+
+	// Kinesis allows at most doubling the shard count, the next invocation goes on once the stream is active again
+	handleEvent(context.Background(), scheduledEvent)
+
+	stream, _ := s.kinesis.Stream("test-stream")
+	assert.Equal(t, 4, stream.ShardCount)
+	assert.Equal(t, "4", s.shardCountExpression("test-stream-scale-down"))
+
+	event := s.lastEvent()
+	assert.Equal(t, "Scheduled", event.Action)
+	assert.Equal(t, audit.OutcomeApplied, event.Outcome)
+	assert.Equal(t, "raised towards the scheduled minimum of 6 shards from rule peak", event.Reason)
+
+	handleEvent(context.Background(), scheduledEvent)
+	stream, _ = s.kinesis.Stream("test-stream")
+	assert.Equal(t, 6, stream.ShardCount)
+
+	// At the minimum nothing is done or recorded
+	handleEvent(context.Background(), scheduledEvent)
+	assert.Equal(t, 2, s.kinesis.CallCount("UpdateShardCount"))
+}
+
+func TestHandleEvent_ReconcilesIntents(t *testing.T) {
+	s := newScenario(t)
+	s.schedule(2)
+	s.cloudwatch.FailOn("SetAlarmState", assert.AnError)
+
+	s.trigger("alarm-scale-up")
+	assert.Equal(t, audit.OutcomeFailed, s.lastEvent().Outcome)
+
+	s.cloudwatch.FailOn("SetAlarmState", nil)
+	handleEvent(context.Background(), []byte(`{"source": "aws.events", "detail-type": "Scheduled Event", "detail": {}}`))
+
+	event := s.lastEvent()
+	assert.Equal(t, audit.OutcomeResumed, event.Outcome)
+	assert.Equal(t, "test-stream", event.StreamName)
+	assert.NotContains(t, s.streamTags(), intent.ToTag)
+	assert.Equal(t, "4", s.shardCountExpression("test-stream-scale-up"))
+}
+
+func TestHandleRequest_ScheduledMinimum(t *testing.T) {
+	s := newScenario(t)
+	s.schedule(2)
+
+	s.trigger("alarm-scale-down")
+
+	assert.Equal(t, 0, s.kinesis.CallCount("UpdateShardCount"))
+
+	scaleDownAlarm, _ := s.cloudwatch.Alarm("alarm-scale-down")
+	assert.Equal(t, cloudwatchtypes.StateValueInsufficientData, scaleDownAlarm.State)
+
+	event := s.lastEvent()
+	assert.Equal(t, audit.OutcomeSkipped, event.Outcome)
+	assert.Equal(t, "scheduled minimum of 2 shards from rule peak", event.Reason)
+}
+
+func TestHandleRequest_ScheduledMinimumByArn(t *testing.T) {
+	s := newScenario(t)
+	t.Setenv("AWS_REGION", "us-east-1")
+	s.scheduleStream("arn:aws:kinesis:us-east-1:123456789012:stream/test-stream", 2)
+
+	s.trigger("alarm-scale-down")
+
+	assert.Equal(t, 0, s.kinesis.CallCount("UpdateShardCount"))
+	assert.Equal(t, "scheduled minimum of 2 shards from rule peak", s.lastEvent().Reason)
+}
+
+func TestHandleRequest_ScheduledMinimumOfAnotherAccount(t *testing.T) {
+	s := newScenario(t)
+	t.Setenv("AWS_REGION", "us-east-1")
+	s.scheduleStream("arn:aws:kinesis:eu-west-1:999999999999:stream/test-stream", 2)
+
+	// The rule is of the stream of the same name in another account
+	s.trigger("alarm-scale-down")
+
+	stream, _ := s.kinesis.Stream("test-stream")
+	assert.Equal(t, 1, stream.ShardCount)
+}
+
+func TestHandleEvent_Forecast(t *testing.T) {
+	s := newScenario(t)
+	t.Setenv(constants.ConfigEnv, `{"forecast": {"enabled": true, "streams": ["test-stream"], "weeks": 1, "periodMinutes": 60, "seasonHours": 24}}`)
+
+	// Every day, the next hour brings 1 MiB/s, a usage factor of 0.5 on 2 shards
+	now := time.Now().UTC()
+	bytes := make(map[time.Time]float64)
+	for timestamp := now.Add(-8 * 24 * time.Hour).Truncate(time.Hour); timestamp.Before(now); timestamp = timestamp.Add(time.Hour) {
+		bytes[timestamp] = 1024
+		if timestamp.Hour() == now.Add(time.Hour).Hour() {
+			bytes[timestamp] = 1024 * 1024 * 3600
+		}
+	}
+	s.cloudwatch.AddMetricData("IncomingBytes", "test-stream", bytes)
+
+	scheduledEvent := []byte(`{"source": "aws.events", "detail-type": "Scheduled Event", "detail": {}}`)
+	handleEvent(context.Background(), scheduledEvent)
+
+	stream, _ := s.kinesis.Stream("test-stream")
+	assert.Equal(t, 4, stream.ShardCount)
+
+	event := s.lastEvent()
+	assert.Equal(t, "Predicted", event.Action)
+	assert.Equal(t, audit.OutcomeApplied, event.Outcome)
+	if assert.NotNil(t, event.Forecast) {
+		assert.InDelta(t, 0.5, event.Forecast.PeakUsageFactor, 0.05)
+		assert.Nil(t, event.Forecast.Accuracy)
+	}
+
+	// A single forecast is made per period
+	handleEvent(context.Background(), scheduledEvent)
+	events, err := s.auditStore.History(context.Background(), accounts.Target{StreamName: "test-stream"}, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestHandleRequest_Frozen(t *testing.T) {
+	s := newScenario(t)
+
+	until := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	assert.NoError(t, kinesis.NewFromAPI(s.kinesis).TagStream(context.Background(), "test-stream",
+		freeze.Window{Until: until, Reason: "incident"}.Tags()))
+
+	s.trigger("alarm-scale-up")
+
+	assert.Equal(t, 0, s.kinesis.CallCount("UpdateShardCount"))
+
+	scaleUpAlarm, _ := s.cloudwatch.Alarm("alarm-scale-up")
+	assert.Equal(t, cloudwatchtypes.StateValueInsufficientData, scaleUpAlarm.State)
+
+	event := s.lastEvent()
+	assert.Equal(t, audit.OutcomeFrozen, event.Outcome)
+	assert.Equal(t, "frozen incident until "+until.Format(time.RFC3339), event.Reason)
+}
+
+func TestHandleRequest_FrozenAllowsScaleUp(t *testing.T) {
+	s := newScenario(t)
+	t.Setenv(constants.ConfigEnv, fmt.Sprintf(`{"freezes": [{"until": %q, "allowScaleUp": true}]}`,
+		time.Now().UTC().Add(time.Hour).Format(time.RFC3339)))
+
+	s.trigger("alarm-scale-down")
+	assert.Equal(t, audit.OutcomeFrozen, s.lastEvent().Outcome)
+
+	s.trigger("alarm-scale-up")
+	assert.Equal(t, audit.OutcomeApplied, s.lastEvent().Outcome)
+
+	stream, _ := s.kinesis.Stream("test-stream")
+	assert.Equal(t, 4, stream.ShardCount)
+}
+
+func TestHandleRequest_FrozenByArn(t *testing.T) {
+	s := newScenario(t)
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv(constants.ConfigEnv, fmt.Sprintf(`{"freezes": [{"stream": "arn:aws:kinesis:us-east-1:123456789012:stream/test-stream", "until": %q}]}`,
+		time.Now().UTC().Add(time.Hour).Format(time.RFC3339)))
+
+	s.trigger("alarm-scale-up")
+
+	assert.Equal(t, 0, s.kinesis.CallCount("UpdateShardCount"))
+	assert.Equal(t, audit.OutcomeFrozen, s.lastEvent().Outcome)
+}
+
+func TestHandleRequest_FrozenInAnotherAccount(t *testing.T) {
+	s := newScenario(t)
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv(constants.ConfigEnv, fmt.Sprintf(`{"freezes": [{"stream": "arn:aws:kinesis:eu-west-1:999999999999:stream/test-stream", "until": %q}]}`,
+		time.Now().UTC().Add(time.Hour).Format(time.RFC3339)))
+
+	// The freeze is of the stream of the same name in another account
+	s.trigger("alarm-scale-up")
+
+	assert.Equal(t, audit.OutcomeApplied, s.lastEvent().Outcome)
+}
+
+func TestHandleRequest_ScaleDownAfterScaleUp(t *testing.T) {
+	s := newScenario(t)
+	t.Setenv(constants.ConfigEnv, `{"cooldowns": {"scaleDownAfterScaleUpMinutes": 180}}`)
+
+	scaledUp := time.Now().UTC().Add(-time.Hour)
+	assert.NoError(t, s.auditStore.Record(context.Background(), audit.ScalingEvent{
+		StreamName: "test-stream",
+		Timestamp:  scaledUp,
+		Action:     "Up",
+		Outcome:    audit.OutcomeApplied,
+	}))
+
+	s.trigger("alarm-scale-down")
+
+	assert.Equal(t, 0, s.kinesis.CallCount("UpdateShardCount"))
+
+	scaleDownAlarm, _ := s.cloudwatch.Alarm("alarm-scale-down")
+	assert.Equal(t, cloudwatchtypes.StateValueInsufficientData, scaleDownAlarm.State)
+
+	event := s.lastEvent()
+	assert.Equal(t, audit.OutcomeRejected, event.Outcome)
+	assert.Equal(t, "cooldown of 3h0m0s since the scale-Up at "+scaledUp.Format(time.RFC3339), event.Reason)
+}
+
+func TestHandleRequest_CooldownFromAlarmMetadata(t *testing.T) {
+	s := newScenario(t)
+	t.Setenv(constants.AuditStoreEnv, "")
+	t.Setenv(constants.ConfigEnv, `{"cooldowns": {"scaleDownAfterScaleUpMinutes": 180}}`)
+
+	// Without an audit store the scale-up an hour ago is only known from the alarm metadata
+	scaledUp := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	s.cloudwatch.AddAlarm(sdkcloudwatch.PutMetricAlarmInput{AlarmName: aws.String("alarm-scale-down")}, cloudwatchtypes.StateValueAlarm,
+		map[string]string{
+			cloudwatch.MetadataVersionTag: "3",
+			cloudwatch.LastScaledTag:      "2020-04-23T10:00:00.000+0000",
+			cloudwatch.RecentActionsTag:   fmt.Sprintf("Up/%d", scaledUp.Unix()),
+		})
+
+	s.trigger("alarm-scale-down")
+
+	assert.Equal(t, 0, s.kinesis.CallCount("UpdateShardCount"))
+
+	scaleDownAlarm, _ := s.cloudwatch.Alarm("alarm-scale-down")
+	assert.Equal(t, cloudwatchtypes.StateValueInsufficientData, scaleDownAlarm.State)
+}
+
+func TestHandleRequest_ReshardQuotaFromAlarmMetadata(t *testing.T) {
+	s := newScenario(t)
+	t.Setenv(constants.AuditStoreEnv, "")
+
+	// Without an audit store the reshards of the last day are only known from the alarm metadata
+	now := time.Now().UTC().Truncate(time.Second)
+	actions := make([]string, 0, constants.MaxReshardsPerDay)
+	for i := constants.MaxReshardsPerDay; i > 0; i-- {
+		actions = append(actions, fmt.Sprintf("Up/%d", now.Add(-time.Duration(i+10)*time.Hour).Unix()))
+	}
+	s.cloudwatch.AddAlarm(sdkcloudwatch.PutMetricAlarmInput{AlarmName: aws.String("alarm-scale-up")}, cloudwatchtypes.StateValueAlarm,
+		map[string]string{
+			cloudwatch.MetadataVersionTag: "3",
+			cloudwatch.LastScaledTag:      "2020-04-23T10:00:00.000+0000",
+			cloudwatch.RecentActionsTag:   strings.Join(actions, " "),
+		})
+
+	s.trigger("alarm-scale-up")
+
+	assert.Equal(t, 0, s.kinesis.CallCount("UpdateShardCount"))
+}
+
+func TestHandleRequest_ReshardQuotaFromPartialHistory(t *testing.T) {
+	s := newScenario(t)
+
+	// The audit store missed most of the reshards the alarm metadata knows of
+	now := time.Now().UTC().Truncate(time.Second)
+	assert.NoError(t, s.auditStore.Record(context.Background(), audit.ScalingEvent{StreamName: "test-stream", Timestamp: now.Add(-11 * time.Hour), Outcome: audit.OutcomeApplied}))
+	actions := make([]string, 0, constants.MaxReshardsPerDay)
+	for i := constants.MaxReshardsPerDay; i > 0; i-- {
+		actions = append(actions, fmt.Sprintf("Up/%d", now.Add(-time.Duration(i+10)*time.Hour).Unix()))
+	}
+	s.cloudwatch.AddAlarm(sdkcloudwatch.PutMetricAlarmInput{AlarmName: aws.String("alarm-scale-up")}, cloudwatchtypes.StateValueAlarm,
+		map[string]string{
+			cloudwatch.MetadataVersionTag: "3",
+			cloudwatch.LastScaledTag:      "2020-04-23T10:00:00.000+0000",
+			cloudwatch.RecentActionsTag:   strings.Join(actions, " "),
+		})
+
+	s.trigger("alarm-scale-up")
+
+	assert.Equal(t, 0, s.kinesis.CallCount("UpdateShardCount"))
+	event := s.lastEvent()
+	assert.Equal(t, audit.OutcomeSkipped, event.Outcome)
+	assert.Equal(t, "reshard quota of 10 per 24 hours is used up", event.Reason)
+}
+
+func TestHandleRequest_CrossAccount(t *testing.T) {
+	s := newScenario(t)
+	t.Setenv(constants.ConfigEnv, `{"registry": {"accounts": [{"accountId": "123456789012", "roleArn": "arn:aws:iam::123456789012:role/nemesis"}]}}`)
+
+	var locations []accounts.Target
+	previous := newKinesisClient
+	newKinesisClient = func(ctx context.Context, location accounts.Target) (*kinesis.Client, error) {
+		locations = append(locations, location)
+		return previous(ctx, location)
+	}
+	t.Cleanup(func() {
+		newKinesisClient = previous
+	})
+
+	s.trigger("alarm-scale-up")
+
+	assert.Equal(t, []accounts.Target{{
+		StreamName: "test-stream",
+		AccountID:  nemesistest.AccountID,
+		Region:     nemesistest.Region,
+		RoleARN:    "arn:aws:iam::123456789012:role/nemesis",
+	}}, locations)
+
+	// The stream is audited apart from the stream of the same name in the account Nemesis runs in
+	events, err := s.auditStore.History(context.Background(), locations[0], time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, audit.OutcomeApplied, events[0].Outcome)
+		assert.Equal(t, nemesistest.AccountID, events[0].AccountID)
+		assert.Equal(t, nemesistest.Region, events[0].Region)
+	}
+
+	events, err = s.auditStore.History(context.Background(), accounts.Target{StreamName: "test-stream"}, time.Time{})
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+}
@@ -0,0 +1,134 @@
+// Package intent contains the write-ahead scaling intents. An intent is tagged on a stream before its shard count is
+// updated and removed once every step of the scaling is done, so that the steps an interrupted invocation left behind
+// can be completed or rolled back by the next one
+package intent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The steps of a scaling, in the order they run
+const (
+	StepReshard   = "reshard"
+	StepAlarms    = "alarms"
+	StepConsumers = "consumers"
+)
+
+// The tags an intent is kept in on a stream. Kinesis tag values can not hold JSON, so every field has its own tag
+const (
+	ActionTag    = "NemesisIntentAction"
+	FromTag      = "NemesisIntentFrom"
+	ToTag        = "NemesisIntentTo"
+	StepsTag     = "NemesisIntentSteps"
+	StartedAtTag = "NemesisIntentStartedAt"
+	RequestIDTag = "NemesisIntentRequestId"
+)
+
+// TagKeys are the keys of every intent tag, for removing an intent from a stream
+var TagKeys = []string{ActionTag, FromTag, ToTag, StepsTag, StartedAtTag, RequestIDTag}
+
+// Timeout is the longest an invocation works on an intent, the Lambda timeout. An intent that is older belongs to an
+// invocation that was interrupted
+const Timeout = 15 * time.Minute
+
+// Intent is a scaling of a stream from one shard count to another, with the steps that are not done yet
+type Intent struct {
+	StreamName string
+	Action     string
+	From       int
+	To         int
+	Steps      []string
+	StartedAt  time.Time
+	RequestID  string
+}
+
+// Pending checks if the step is not done yet
+func (i Intent) Pending(step string) bool {
+	for _, pending := range i.Steps {
+		if pending == step {
+			return true
+		}
+	}
+	return false
+}
+
+// Done removes the step from the pending steps
+func (i *Intent) Done(step string) {
+	steps := make([]string, 0, len(i.Steps))
+	for _, pending := range i.Steps {
+		if pending != step {
+			steps = append(steps, pending)
+		}
+	}
+	i.Steps = steps
+}
+
+// Interrupted checks if the invocation that started the intent can no longer be working on it
+func (i Intent) Interrupted(now time.Time) bool {
+	return now.Sub(i.StartedAt) >= Timeout
+}
+
+// String describes the intent for the audit trail
+func (i Intent) String() string {
+	return fmt.Sprintf("scale-%s from %d to %d shards", i.Action, i.From, i.To)
+}
+
+// Tags returns the stream tags that hold the intent
+func (i Intent) Tags() map[string]string {
+	tags := map[string]string{
+		ActionTag:    i.Action,
+		FromTag:      strconv.Itoa(i.From),
+		ToTag:        strconv.Itoa(i.To),
+		StepsTag:     strings.Join(i.Steps, " "),
+		StartedAtTag: i.StartedAt.UTC().Format(time.RFC3339),
+	}
+	if i.RequestID != "" {
+		tags[RequestIDTag] = i.RequestID
+	}
+
+	return tags
+}
+
+// FromTags reads the intent a stream is tagged with. It returns false when the stream is not tagged with one
+func FromTags(streamName string, tags map[string]string) (Intent, bool, error) {
+	action, ok := tags[ActionTag]
+	if !ok {
+		return Intent{}, false, nil
+	}
+
+	intent := Intent{
+		StreamName: streamName,
+		Action:     action,
+		Steps:      strings.Fields(tags[StepsTag]),
+		RequestID:  tags[RequestIDTag],
+	}
+
+	var err error
+	intent.From, err = strconv.Atoi(tags[FromTag])
+	if err != nil {
+		return Intent{}, false, fmt.Errorf("invalid %s tag: %w", FromTag, err)
+	}
+
+	intent.To, err = strconv.Atoi(tags[ToTag])
+	if err != nil {
+		return Intent{}, false, fmt.Errorf("invalid %s tag: %w", ToTag, err)
+	}
+
+	intent.StartedAt, err = time.Parse(time.RFC3339, tags[StartedAtTag])
+	if err != nil {
+		return Intent{}, false, fmt.Errorf("invalid %s tag: %w", StartedAtTag, err)
+	}
+
+	for _, step := range intent.Steps {
+		switch step {
+		case StepReshard, StepAlarms, StepConsumers:
+		default:
+			return Intent{}, false, fmt.Errorf("invalid %s tag: unknown step %q", StepsTag, step)
+		}
+	}
+
+	return intent, true, nil
+}
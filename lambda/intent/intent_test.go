@@ -0,0 +1,46 @@
+package intent
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTags(t *testing.T) {
+	intent := Intent{
+		StreamName: "orders",
+		Action:     "Up",
+		From:       2,
+		To:         4,
+		Steps:      []string{StepReshard, StepAlarms, StepConsumers},
+		StartedAt:  time.Date(2022, 10, 3, 12, 0, 0, 0, time.UTC),
+		RequestID:  "c6af9ac6-7b61-11e6-9a41-93e8deadbeef",
+	}
+
+	read, ok, err := FromTags("orders", intent.Tags())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, intent, read)
+	assert.Equal(t, "scale-Up from 2 to 4 shards", read.String())
+
+	_, ok, err = FromTags("orders", map[string]string{"team": "payments"})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	tags := intent.Tags()
+	tags[StepsTag] = "reshard rollback"
+	_, _, err = FromTags("orders", tags)
+	assert.Error(t, err)
+}
+
+func TestIntent_Steps(t *testing.T) {
+	startedAt := time.Date(2022, 10, 3, 12, 0, 0, 0, time.UTC)
+	intent := Intent{Steps: []string{StepReshard, StepAlarms}, StartedAt: startedAt}
+
+	intent.Done(StepReshard)
+	assert.False(t, intent.Pending(StepReshard))
+	assert.True(t, intent.Pending(StepAlarms))
+
+	assert.False(t, intent.Interrupted(startedAt.Add(time.Minute)))
+	assert.True(t, intent.Interrupted(startedAt.Add(Timeout)))
+}
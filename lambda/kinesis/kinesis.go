@@ -4,34 +4,71 @@ package kinesis
 import (
 	"context"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/kinesis"
 	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/vmanikes/Nemesis/accounts"
+	"github.com/vmanikes/Nemesis/clients"
 	"github.com/vmanikes/Nemesis/logging"
 	"go.uber.org/zap"
 )
 
+// API is the part of the kinesis API that Nemesis uses
+type API interface {
+	DescribeStreamSummary(ctx context.Context, params *kinesis.DescribeStreamSummaryInput, optFns ...func(*kinesis.Options)) (*kinesis.DescribeStreamSummaryOutput, error)
+	UpdateShardCount(ctx context.Context, params *kinesis.UpdateShardCountInput, optFns ...func(*kinesis.Options)) (*kinesis.UpdateShardCountOutput, error)
+	ListTagsForStream(ctx context.Context, params *kinesis.ListTagsForStreamInput, optFns ...func(*kinesis.Options)) (*kinesis.ListTagsForStreamOutput, error)
+	AddTagsToStream(ctx context.Context, params *kinesis.AddTagsToStreamInput, optFns ...func(*kinesis.Options)) (*kinesis.AddTagsToStreamOutput, error)
+	RemoveTagsFromStream(ctx context.Context, params *kinesis.RemoveTagsFromStreamInput, optFns ...func(*kinesis.Options)) (*kinesis.RemoveTagsFromStreamOutput, error)
+}
+
 type Client struct {
-	kinesisClient *kinesis.Client
+	kinesisClient API
 }
 
-// New creates a new kinesis client and returns if successfully initialized
+// New returns the kinesis client of the account and region Nemesis runs in
 func New(ctx context.Context) (*Client, error) {
-	logger := logging.WithContext(ctx)
+	return NewFor(ctx, accounts.Target{})
+}
 
-	cfg, err := config.LoadDefaultConfig(ctx)
+// NewFor returns the kinesis client of the account and region of the target. The clients are built once per process
+// and shared
+func NewFor(ctx context.Context, target accounts.Target) (*Client, error) {
+	client, err := clients.Default().Client(ctx, target, "kinesis", func(cfg aws.Config) interface{} {
+		return NewFromConfig(cfg)
+	})
 	if err != nil {
-		logger.Error("unable to load the default config for aws")
 		return nil, err
 	}
 
+	return client.(*Client), nil
+}
+
+// NewFromConfig creates the client from an existing aws config, e.g. the config of another account or region
+func NewFromConfig(cfg aws.Config) *Client {
+	return NewFromAPI(kinesis.NewFromConfig(cfg))
+}
+
+// NewFromAPI creates the client on top of an existing kinesis API implementation
+func NewFromAPI(api API) *Client {
 	return &Client{
-		kinesisClient: kinesis.NewFromConfig(cfg),
-	}, nil
+		kinesisClient: api,
+	}
 }
 
-// GetShardCount takes in a kinesis stream name and returns the shard count for the stream
-func (c *Client) GetShardCount(ctx context.Context, streamName string) (int, error) {
+// StreamSummary is the part of the stream description Nemesis scales on
+type StreamSummary struct {
+	StreamArn  string
+	Status     string
+	ShardCount int
+}
+
+// IsActive checks if the stream accepts a shard count update
+func (s StreamSummary) IsActive() bool {
+	return s.Status == string(types.StreamStatusActive)
+}
+
+// GetStreamSummary takes in a kinesis stream name and returns the arn, status and open shard count of the stream
+func (c *Client) GetStreamSummary(ctx context.Context, streamName string) (StreamSummary, error) {
 	logger := logging.WithContext(ctx)
 
 	summary, err := c.kinesisClient.DescribeStreamSummary(ctx, &kinesis.DescribeStreamSummaryInput{
@@ -40,16 +77,40 @@ func (c *Client) GetShardCount(ctx context.Context, streamName string) (int, err
 	if err != nil {
 		logger.Error("unable describe stream summary",
 			zap.String("stream-name", streamName))
+		return StreamSummary{}, err
+	}
+
+	return StreamSummary{
+		StreamArn:  aws.ToString(summary.StreamDescriptionSummary.StreamARN),
+		Status:     string(summary.StreamDescriptionSummary.StreamStatus),
+		ShardCount: int(aws.ToInt32(summary.StreamDescriptionSummary.OpenShardCount)),
+	}, nil
+}
+
+// GetShardCount takes in a kinesis stream name and returns the shard count for the stream
+func (c *Client) GetShardCount(ctx context.Context, streamName string) (int, error) {
+	summary, err := c.GetStreamSummary(ctx, streamName)
+	if err != nil {
 		return 0, err
 	}
 
-	return int(*summary.StreamDescriptionSummary.OpenShardCount), nil
+	return summary.ShardCount, nil
+}
+
+// GetStreamArn takes in a kinesis stream name and returns the arn of the stream
+func (c *Client) GetStreamArn(ctx context.Context, streamName string) (string, error) {
+	summary, err := c.GetStreamSummary(ctx, streamName)
+	if err != nil {
+		return "", err
+	}
+
+	return summary.StreamArn, nil
 }
 
 // UpdateShardCount takes in a stream name and shard count and updates the kinesis stream
 func (c *Client) UpdateShardCount(ctx context.Context, streamName string, shardCount int32) error {
 	logger := logging.WithContext(ctx)
-	
+
 	_, err := c.kinesisClient.UpdateShardCount(ctx, &kinesis.UpdateShardCountInput{
 		ScalingType:      types.ScalingTypeUniformScaling,
 		StreamName:       &streamName,
@@ -63,4 +124,69 @@ func (c *Client) UpdateShardCount(ctx context.Context, streamName string, shardC
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// GetStreamTags takes in a stream name and returns every tag of the stream
+func (c *Client) GetStreamTags(ctx context.Context, streamName string) (map[string]string, error) {
+	logger := logging.WithContext(ctx)
+
+	tags := make(map[string]string)
+	input := &kinesis.ListTagsForStreamInput{
+		StreamName: &streamName,
+	}
+
+	for {
+		output, err := c.kinesisClient.ListTagsForStream(ctx, input)
+		if err != nil {
+			logger.Error("unable to list stream tags",
+				zap.String("stream-name", streamName),
+				zap.Error(err))
+			return nil, err
+		}
+
+		for _, tag := range output.Tags {
+			tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+
+		if !aws.ToBool(output.HasMoreTags) || len(output.Tags) == 0 {
+			return tags, nil
+		}
+		input.ExclusiveStartTagKey = output.Tags[len(output.Tags)-1].Key
+	}
+}
+
+// TagStream takes in a stream name and adds the tags to the stream, replacing the values of existing keys
+func (c *Client) TagStream(ctx context.Context, streamName string, tags map[string]string) error {
+	logger := logging.WithContext(ctx)
+
+	_, err := c.kinesisClient.AddTagsToStream(ctx, &kinesis.AddTagsToStreamInput{
+		StreamName: &streamName,
+		Tags:       tags,
+	})
+	if err != nil {
+		logger.Error("unable to tag stream",
+			zap.String("stream-name", streamName),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// UntagStream takes in a stream name and removes the tags with the keys from the stream
+func (c *Client) UntagStream(ctx context.Context, streamName string, keys []string) error {
+	logger := logging.WithContext(ctx)
+
+	_, err := c.kinesisClient.RemoveTagsFromStream(ctx, &kinesis.RemoveTagsFromStreamInput{
+		StreamName: &streamName,
+		TagKeys:    keys,
+	})
+	if err != nil {
+		logger.Error("unable to untag stream",
+			zap.String("stream-name", streamName),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
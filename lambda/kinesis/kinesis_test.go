@@ -0,0 +1,83 @@
+package kinesis
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmanikes/Nemesis/nemesistest"
+	"testing"
+	"time"
+)
+
+func TestClient_UpdateShardCount(t *testing.T) {
+	ctx := context.Background()
+	fake := nemesistest.NewKinesis()
+	fake.AddStream("stream", 4)
+	fake.UpdatingDescribes = 1
+
+	client := NewFromAPI(fake)
+
+	assert.NoError(t, client.UpdateShardCount(ctx, "stream", 8))
+
+	summary, err := client.GetStreamSummary(ctx, "stream")
+	assert.NoError(t, err)
+	assert.False(t, summary.IsActive())
+	assert.Equal(t, 4, summary.ShardCount)
+
+	shardCount, err := client.GetShardCount(ctx, "stream")
+	assert.NoError(t, err)
+	assert.Equal(t, 8, shardCount)
+
+	var invalidArgument *types.InvalidArgumentException
+	assert.ErrorAs(t, client.UpdateShardCount(ctx, "stream", 17), &invalidArgument)
+
+	_, err = client.GetShardCount(ctx, "missing")
+	assert.Error(t, err)
+}
+
+func TestClient_UpdateShardCount_Quota(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	fake := nemesistest.NewKinesis()
+	fake.AddStream("stream", 1)
+	fake.Now = func() time.Time { return now }
+
+	client := NewFromAPI(fake)
+
+	shardCount := 1
+	for i := 0; i < 10; i++ {
+		target := shardCount * 2
+		if i%2 == 1 {
+			target = shardCount / 2
+		}
+		assert.NoError(t, client.UpdateShardCount(ctx, "stream", int32(target)))
+		shardCount = target
+		now = now.Add(time.Hour)
+	}
+
+	var limitExceeded *types.LimitExceededException
+	assert.ErrorAs(t, client.UpdateShardCount(ctx, "stream", 2), &limitExceeded)
+
+	now = now.Add(15 * time.Hour)
+	assert.NoError(t, client.UpdateShardCount(ctx, "stream", 2))
+}
+
+func TestClient_StreamTags(t *testing.T) {
+	ctx := context.Background()
+
+	fake := nemesistest.NewKinesis()
+	fake.AddStream("stream", 1)
+
+	client := NewFromAPI(fake)
+
+	assert.NoError(t, client.TagStream(ctx, "stream", map[string]string{"team": "payments", "NemesisFreezeUntil": "2022-10-03T12:00:00Z"}))
+	assert.NoError(t, client.UntagStream(ctx, "stream", []string{"NemesisFreezeUntil"}))
+
+	tags, err := client.GetStreamTags(ctx, "stream")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "payments"}, tags)
+
+	_, err = client.GetStreamTags(ctx, "missing")
+	assert.Error(t, err)
+}
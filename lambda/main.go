@@ -3,18 +3,43 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/vmanikes/Nemesis/accounts"
+	"github.com/vmanikes/Nemesis/audit"
+	"github.com/vmanikes/Nemesis/clock"
 	"github.com/vmanikes/Nemesis/cloudwatch"
+	"github.com/vmanikes/Nemesis/config"
 	"github.com/vmanikes/Nemesis/constants"
+	"github.com/vmanikes/Nemesis/consumers"
+	"github.com/vmanikes/Nemesis/drift"
+	"github.com/vmanikes/Nemesis/forecast"
+	"github.com/vmanikes/Nemesis/freeze"
+	"github.com/vmanikes/Nemesis/intent"
 	"github.com/vmanikes/Nemesis/kinesis"
 	"github.com/vmanikes/Nemesis/logging"
+	"github.com/vmanikes/Nemesis/notify"
+	"github.com/vmanikes/Nemesis/scaling"
+	"github.com/vmanikes/Nemesis/schedule"
 	types2 "github.com/vmanikes/Nemesis/types"
 	"go.uber.org/zap"
+	"os"
 	"time"
 )
 
+// The AWS clients are created through these, so that tests can replace them with the nemesistest fakes
+var (
+	newCloudwatchClient = cloudwatch.NewFor
+	newKinesisClient    = kinesis.NewFor
+	newConsumersClient  = consumers.NewFor
+)
+
+// systemClock is the clock of the scaling decisions, tests replace it with a fixed one
+var systemClock clock.Clock = clock.System
+
 func handleRequest(ctx context.Context, snsEvent events.SNSEvent) {
 	logger := logging.WithContext(ctx)
 
@@ -46,156 +71,1103 @@ func handleRequest(ctx context.Context, snsEvent events.SNSEvent) {
 
 	ctx = logging.NewContext(ctx, zap.String("alarm-name", alarmName))
 
-	cloudwatchClient, err := cloudwatch.New(ctx)
+	streamName := alarmInformation.GetStreamName()
+	ctx = logging.NewContext(ctx, zap.String("stream-name", streamName))
+
+	cfg, err := config.Load(ctx)
+	if err != nil {
+		return
+	}
+
+	auditStore, err := audit.Open(ctx, os.Getenv(constants.AuditStoreEnv))
+	if err != nil {
+		return
+	}
+
+	notifier, err := notify.New(ctx, cfg.Notifications)
+	if err != nil {
+		return
+	}
+
+	event := &audit.ScalingEvent{
+		StreamName:   streamName,
+		Timestamp:    systemClock.Now(),
+		AlarmName:    alarmName,
+		Alarm:        json.RawMessage(snsRecord.Message),
+		UsageFactors: alarmInformation.GetUsageFactors(),
+	}
+	if lambdaContext, ok := lambdacontext.FromContext(ctx); ok {
+		event.RequestID = lambdaContext.AwsRequestID
+	}
+	// The cooldowns and the history of the stream, once they are known, tell how long the stream is held back after
+	// the event
+	cooldowns := cfg.Cooldowns
+	var history []scaling.Action
+	defer func() {
+		recordEvent(ctx, auditStore, event)
+		notifyEvent(ctx, notifier, event, cooldownRemaining(cooldowns, history, event))
+	}()
+
+	// The alarm lives in the account and region of its stream
+	location, err := cfg.Registry.ForAlarm(alarmArn, streamName)
+	if err != nil {
+		event.Fail("unable to resolve the account of the stream", err)
+		return
+	}
+	ctx = logging.NewContext(ctx, zap.String("account-id", location.AccountID), zap.String("region", location.Region))
+	event.SetLocation(location)
+
+	cloudwatchClient, err := newCloudwatchClient(ctx, location)
 	if err != nil {
+		event.Fail("unable to create cloudwatch client", err)
 		return
 	}
 
-	scaleUpAlarmName, scaleDownAlarmName, currentAction, lastAlarmActionTimestamp, err := cloudwatchClient.GetAlarmNames(ctx, alarmName, alarmArn)
+	scaleUpAlarmName, scaleDownAlarmName, currentAction, metadata, err := cloudwatchClient.GetAlarmNames(ctx, alarmName, alarmArn, cfg.AlarmNaming)
 	if err != nil {
+		event.Fail("unable to get alarm names", err)
 		return
 	}
 
 	ctx = logging.NewContext(ctx,
 		zap.String("scale-up-alarm", scaleUpAlarmName),
 		zap.String("scale-down-alarm", scaleDownAlarmName),
-		zap.String("last-alarm-action", lastAlarmActionTimestamp))
+		zap.String("last-alarm-action", metadata.LastScaled()))
+
+	event.LastScaled = metadata.LastScaled()
 
 	if currentAction == "" {
 		logger.Error("current scale action is empty")
+		event.SetOutcome(audit.OutcomeSkipped, "alarm is neither a scale-up nor a scale-down alarm")
 		return
 	}
 
+	event.Action = currentAction
 	ctx = logging.NewContext(ctx, zap.String("scale-action", currentAction))
 
-	streamName := alarmInformation.GetStreamName()
-	ctx = logging.NewContext(ctx, zap.String("stream-name", streamName))
-
 	stateChangeTime, err := alarmInformation.GetStateChangeTime(ctx)
 	if err != nil {
+		event.Fail("unable to get state change time", err)
+		return
+	}
+
+	emergency := currentAction == "Emergency"
+	if emergency {
+		// The throttling alarm has to leave the ALARM state, so that it triggers again if the throttling goes on
+		defer func() {
+			_ = cloudwatchClient.SetAlarmState(ctx, alarmName, string(types.StateValueInsufficientData), "Emergency scale-up handled")
+		}()
+	}
+
+	kinesisClient, err := newKinesisClient(ctx, location)
+	if err != nil {
+		event.Fail("unable to create kinesis client", err)
+		return
+	}
+
+	target := reshardTarget{
+		cfg:                cfg,
+		auditStore:         auditStore,
+		cloudwatchClient:   cloudwatchClient,
+		kinesisClient:      kinesisClient,
+		location:           location,
+		streamName:         streamName,
+		scaleUpAlarmName:   scaleUpAlarmName,
+		scaleDownAlarmName: scaleDownAlarmName,
+		topicArn:           snsRecord.TopicArn,
+		settings:           cfg.Settings(location),
+		clock:              systemClock,
+	}
+	cooldowns = target.settings.Cooldowns
+
+	pending, found, err := findIntent(ctx, kinesisClient, streamName)
+	if err != nil {
+		event.Fail("unable to read the scaling intent of the stream", err)
+		return
+	}
+
+	// The alarm fired against the shard count from before the unfinished scaling, it fires again if it still applies
+	if found && target.resumeIntent(ctx, pending, event.Timestamp, event) {
+		return
+	}
+
+	// Freezes block emergencies too, unless they allow scale-ups
+	window, frozen, err := findFreeze(ctx, cfg, kinesisClient, location, currentAction, event.Timestamp)
+	if err != nil {
+		event.Fail("unable to read the freeze tags of the stream", err)
 		return
 	}
 
-	if !ShouldScaleKinesis(lastAlarmActionTimestamp, stateChangeTime) {
-		reason := "Scale-" + currentAction + " event rejected. Changing alarm state back to Insufficient Data."
+	if frozen {
+		reason := "Scale-" + currentAction + " event frozen: " + window.String() + ". Changing alarm state back to Insufficient Data."
+		event.SetOutcome(audit.OutcomeFrozen, "frozen "+window.String())
 		_ = cloudwatchClient.SetAlarmState(ctx, alarmName, string(types.StateValueInsufficientData), reason)
 		return
 	}
 
-	kinesisClient, err := kinesis.New(ctx)
+	// Sustained throttling bypasses the cooldown, producers are already losing records
+	if !emergency {
+		// A timestamp that can not be parsed fails safe, the stream is not scaled and the failure is reported
+		shouldScale, err := scaling.ShouldScaleKinesis(metadata.LastScaled(), stateChangeTime)
+		if err != nil {
+			logger.Error("unable to check the cooldown",
+				zap.String("state-change-time", stateChangeTime),
+				zap.Error(err))
+			event.Fail("unable to check the cooldown", err)
+			return
+		}
+
+		if !shouldScale {
+			reason := "Scale-" + currentAction + " event rejected. Changing alarm state back to Insufficient Data."
+			event.SetOutcome(audit.OutcomeRejected, "alarm changed state before the last scaling event at "+metadata.LastScaled())
+			_ = cloudwatchClient.SetAlarmState(ctx, alarmName, string(types.StateValueInsufficientData), reason)
+			return
+		}
+	}
+
+	if !emergency {
+		now := event.Timestamp
+
+		since := now.Add(-target.settings.Cooldowns.Window())
+		history, err = appliedActions(ctx, auditStore, location, since)
+		if err != nil {
+			event.Fail("unable to read the scaling history", err)
+			return
+		}
+
+		// Without an audit store the history is empty, the alarm metadata keeps the last few actions
+		if len(history) == 0 {
+			history = metadata.Actions(since)
+		}
+
+		decision := target.settings.Cooldowns.Check(history, currentAction, now)
+		event.Flapping = decision.Flapping
+
+		if !decision.Allowed {
+			reason := "Scale-" + currentAction + " event rejected. Changing alarm state back to Insufficient Data."
+			event.SetOutcome(audit.OutcomeRejected, decision.Reason())
+			_ = cloudwatchClient.SetAlarmState(ctx, alarmName, string(types.StateValueInsufficientData), reason)
+			return
+		}
+	}
+
+	streamSummary, err := kinesisClient.GetStreamSummary(ctx, streamName)
+	if err != nil {
+		event.Fail("unable to get shard count", err)
+		return
+	}
+
+	strategy, err := cfg.Strategy(location)
+	if err != nil {
+		event.Fail("unable to create the scaling strategy", err)
+		return
+	}
+
+	// A state reason without datapoints leaves the strategy without usage factors, they are read from the metrics of
+	// the alarm instead. The throttling alarm does not compare usage factors
+	if len(event.UsageFactors) == 0 && !emergency {
+		usageFactors, err := cloudwatchClient.GetAlarmValues(ctx, alarmName, event.Timestamp)
+		if err != nil {
+			logger.Error("unable to get the usage factors of the alarm, deciding without them",
+				zap.Error(err))
+		}
+		event.UsageFactors = usageFactors
+	}
+	threshold, _ := alarmInformation.GetThreshold()
+
+	// Strategies hold back scale-downs while the consumers lag, the scale-down alarm only compares the iterator age
+	// with its own limit
+	var iteratorAgeMinutes float64
+	if currentAction == "Down" {
+		window := time.Duration(target.settings.Alarms.ScalePeriodMinutes) * time.Minute
+		iteratorAgeMinutes, err = cloudwatchClient.GetIteratorAgeMinutes(ctx, streamName, event.Timestamp, window)
+		if err != nil {
+			logger.Error("unable to get the iterator age of the stream, deciding without it",
+				zap.Error(err))
+		}
+	}
+
+	shardCount := streamSummary.ShardCount
+	scheduledMinimum, rule := schedule.Floor(cfg.Schedule(location), event.Timestamp)
+	decision := scaling.Decide(strategy, scaling.DecisionContext{
+		StreamName:   streamName,
+		Action:       currentAction,
+		ShardCount:   shardCount,
+		UsageFactors: event.UsageFactors,
+		Threshold:    threshold,
+		Bounds:       target.settings.Bounds(scheduledMinimum),
+		History:      history,
+
+		IteratorAgeMinutes: iteratorAgeMinutes,
+		ScaleDownThreshold: target.settings.Alarms.ScaleDownThreshold,
+	})
+	newShardCount := decision.ShardCount
+
+	event.ShardCount = shardCount
+	event.TargetShardCount = newShardCount
+	event.Decision = decision.Explanation
+
+	if newShardCount == shardCount && currentAction == "Down" && shardCount <= scheduledMinimum {
+		// The alarm has to leave the ALARM state, so that it scales the stream down once the window is over
+		event.SetOutcome(audit.OutcomeSkipped, fmt.Sprintf("scheduled minimum of %d shards from rule %s", scheduledMinimum, rule))
+		_ = cloudwatchClient.SetAlarmState(ctx, alarmName, string(types.StateValueInsufficientData), "Scale-Down event blocked by a scheduled minimum shard count")
+		return
+	}
+
+	if newShardCount == shardCount {
+		event.SetOutcome(audit.OutcomeSkipped, "stream is already at the target shard count")
+		return
+	}
+
+	target.reshard(ctx, streamSummary, decision, "alarm "+alarmName+": "+decision.Explanation, event)
+}
+
+// handleSchedule raises the streams with an active scheduled scaling window to the minimum shard count of the window,
+// and the streams whose forecast load crosses the scale-up threshold. It runs on the scheduled invocations, which reach
+// a window ahead of its start by the lead time of its rule
+func handleSchedule(ctx context.Context, now time.Time) {
+	cfg, err := config.Load(ctx)
+	if err != nil {
+		return
+	}
+
+	auditStore, err := audit.Open(ctx, os.Getenv(constants.AuditStoreEnv))
+	if err != nil {
+		return
+	}
+
+	notifier, err := notify.New(ctx, cfg.Notifications)
+	if err != nil {
+		return
+	}
+
+	held := reconcileIntents(ctx, cfg, auditStore, notifier, now)
+
+	// The streams are given by name or by ARN, the rules of both apply to the stream
+	for _, location := range cfg.ScheduledStreams() {
+		scheduledMinimum, rule := schedule.Floor(cfg.Schedule(location), now)
+		if scheduledMinimum == 0 {
+			continue
+		}
+
+		if held[location] {
+			continue
+		}
+		streamCtx := logging.NewContext(ctx, zap.String("stream-name", location.StreamName), zap.String("schedule-rule", rule))
+		applySchedule(streamCtx, cfg, auditStore, notifier, location, scheduledMinimum, rule, now)
+	}
+
+	if cfg.Forecast.Enabled {
+		for _, stream := range cfg.Forecast.Streams {
+			location := cfg.Registry.ForStream(stream)
+			if held[location] {
+				continue
+			}
+			applyForecast(logging.NewContext(ctx, zap.String("stream-name", location.StreamName)), cfg, auditStore, notifier, location, now)
+		}
+	}
+}
+
+// reconcileIntents resumes the scaling intents that interrupted invocations left on the managed streams: the streams
+// with alarms in the account and region Nemesis runs in, the registered streams and the streams of the schedules and
+// the forecast. It returns the streams whose intent is still in progress, they are not scaled meanwhile
+func reconcileIntents(ctx context.Context, cfg *config.Config, auditStore audit.Store, notifier *notify.Dispatcher,
+	now time.Time) map[accounts.Target]bool {
+
+	logger := logging.WithContext(ctx)
+
+	streams := make([]string, 0)
+	for stream := range cfg.Schedules {
+		streams = append(streams, stream)
+	}
+	if cfg.Forecast.Enabled {
+		streams = append(streams, cfg.Forecast.Streams...)
+	}
+	for _, stream := range cfg.Registry.Streams {
+		streams = append(streams, stream.ARN)
+	}
+
+	cloudwatchClient, err := newCloudwatchClient(ctx, accounts.Target{})
+	if err != nil {
+		return nil
+	}
+	managed, err := drift.ManagedStreams(ctx, cloudwatchClient, cfg.AlarmNaming)
+	if err != nil {
+		return nil
+	}
+	streams = append(streams, managed...)
+
+	held := make(map[accounts.Target]bool)
+	seen := make(map[accounts.Target]bool)
+
+	for _, stream := range streams {
+		location := cfg.Registry.ForStream(stream)
+		if seen[location] {
+			continue
+		}
+		seen[location] = true
+
+		streamCtx := logging.NewContext(ctx, zap.String("stream-name", location.StreamName))
+
+		kinesisClient, err := newKinesisClient(streamCtx, location)
+		if err != nil {
+			continue
+		}
+
+		pending, found, err := findIntent(streamCtx, kinesisClient, location.StreamName)
+		if err != nil || !found {
+			continue
+		}
+
+		cloudwatchClient, err := newCloudwatchClient(streamCtx, location)
+		if err != nil {
+			continue
+		}
+
+		target, err := newScheduledReshardTarget(streamCtx, cfg, auditStore, cloudwatchClient, kinesisClient, location)
+		if err != nil {
+			continue
+		}
+
+		event := &audit.ScalingEvent{
+			StreamName: location.StreamName,
+			Timestamp:  now.UTC(),
+		}
+		event.SetLocation(location)
+		if lambdaContext, ok := lambdacontext.FromContext(ctx); ok {
+			event.RequestID = lambdaContext.AwsRequestID
+		}
+
+		if !target.resumeIntent(streamCtx, pending, now, event) {
+			continue
+		}
+
+		// The scheduled invocations run every few minutes, intents in progress are only logged
+		if event.Outcome == audit.OutcomeSkipped {
+			held[location] = true
+			logger.Info("scaling intent is in progress",
+				zap.String("stream-name", location.StreamName),
+				zap.String("reason", event.Reason))
+			continue
+		}
+		if event.Outcome == audit.OutcomeFailed {
+			held[location] = true
+		}
+
+		recordEvent(streamCtx, auditStore, event)
+		notifyEvent(streamCtx, notifier, event, cooldownRemaining(target.settings.Cooldowns, nil, event))
+	}
+
+	return held
+}
+
+// applySchedule raises the stream towards the scheduled minimum shard count. Streams already at or above it are left
+// alone without recording an event
+func applySchedule(ctx context.Context, cfg *config.Config, auditStore audit.Store, notifier *notify.Dispatcher,
+	location accounts.Target, scheduledMinimum int, rule string, now time.Time) {
+
+	logger := logging.WithContext(ctx)
+	streamName := location.StreamName
+
+	kinesisClient, err := newKinesisClient(ctx, location)
+	if err != nil {
+		return
+	}
+
+	streamSummary, err := kinesisClient.GetStreamSummary(ctx, streamName)
+	if err != nil {
+		return
+	}
+
+	if streamSummary.ShardCount >= scheduledMinimum {
+		logger.Info("stream is at the scheduled minimum shard count",
+			zap.Int("shard-count", streamSummary.ShardCount),
+			zap.Int("scheduled-minimum", scheduledMinimum))
+		return
+	}
+
+	// The scheduled invocations run every few minutes, a frozen stream is only logged so that it does not flood the
+	// audit trail
+	window, frozen, err := findFreeze(ctx, cfg, kinesisClient, location, "Scheduled", now)
+	if err != nil {
+		return
+	}
+	if frozen {
+		logger.Info("scheduled scaling is frozen",
+			zap.String("freeze", window.String()))
+		return
+	}
+
+	event := &audit.ScalingEvent{
+		StreamName: streamName,
+		Timestamp:  now.UTC(),
+		Action:     "Scheduled",
+		ShardCount: streamSummary.ShardCount,
+		TargetShardCount: scaling.CalculateShardCount("Scheduled", streamSummary.ShardCount,
+			cfg.Settings(location).Capped(scheduledMinimum)),
+	}
+	event.SetLocation(location)
+	if lambdaContext, ok := lambdacontext.FromContext(ctx); ok {
+		event.RequestID = lambdaContext.AwsRequestID
+	}
+	defer func() {
+		recordEvent(ctx, auditStore, event)
+		notifyEvent(ctx, notifier, event, cooldownRemaining(cfg.Settings(location).Cooldowns, nil, event))
+	}()
+
+	cloudwatchClient, err := newCloudwatchClient(ctx, location)
+	if err != nil {
+		event.Fail("unable to create cloudwatch client", err)
+		return
+	}
+
+	target, err := newScheduledReshardTarget(ctx, cfg, auditStore, cloudwatchClient, kinesisClient, location)
+	if err != nil {
+		event.Fail("unable to describe scale-up alarm", err)
+		return
+	}
+
+	target.reshard(ctx, streamSummary, target.targetOf(event.TargetShardCount), "scheduled rule "+rule, event)
+
+	if event.Outcome == audit.OutcomeApplied {
+		event.SetOutcome(audit.OutcomeApplied, fmt.Sprintf("raised towards the scheduled minimum of %d shards from rule %s",
+			scheduledMinimum, rule))
+	}
+}
+
+// applyForecast forecasts the load of the stream once per forecast period and raises the stream when the forecast
+// crosses the scale-up threshold within the horizon. Every forecast is recorded, with the accuracy of the one before it
+func applyForecast(ctx context.Context, cfg *config.Config, auditStore audit.Store, notifier *notify.Dispatcher,
+	location accounts.Target, now time.Time) {
+
+	streamName := location.StreamName
+	forecastConfig := cfg.Forecast.WithDefaults()
+	period := forecastConfig.Period()
+
+	events, err := auditStore.History(ctx, location, now.Add(-period-time.Duration(forecastConfig.HorizonMinutes)*time.Minute))
+	if err != nil {
+		return
+	}
+
+	var previous *audit.ScalingEvent
+	for i := range events {
+		if events[i].Action == "Predicted" && events[i].Forecast != nil {
+			previous = &events[i]
+		}
+	}
+
+	// The scheduled invocations run more often than the forecast period
+	if previous != nil && previous.Timestamp.Truncate(period).Equal(now.UTC().Truncate(period)) {
+		return
+	}
+
+	event := &audit.ScalingEvent{
+		StreamName: streamName,
+		Timestamp:  now.UTC(),
+		Action:     "Predicted",
+	}
+	event.SetLocation(location)
+	if lambdaContext, ok := lambdacontext.FromContext(ctx); ok {
+		event.RequestID = lambdaContext.AwsRequestID
+	}
+	defer func() {
+		recordEvent(ctx, auditStore, event)
+		notifyEvent(ctx, notifier, event, cooldownRemaining(cfg.Settings(location).Cooldowns, nil, event))
+	}()
+
+	kinesisClient, err := newKinesisClient(ctx, location)
 	if err != nil {
+		event.Fail("unable to create kinesis client", err)
 		return
 	}
 
-	shardCount, err := kinesisClient.GetShardCount(ctx, streamName)
+	streamSummary, err := kinesisClient.GetStreamSummary(ctx, streamName)
 	if err != nil {
+		event.Fail("unable to get shard count", err)
 		return
 	}
+	event.ShardCount = streamSummary.ShardCount
+	event.TargetShardCount = streamSummary.ShardCount
 
-	newShardCount := CalculateShardCount(currentAction, shardCount)
+	cloudwatchClient, err := newCloudwatchClient(ctx, location)
+	if err != nil {
+		event.Fail("unable to create cloudwatch client", err)
+		return
+	}
 
-	err = kinesisClient.UpdateShardCount(ctx, streamName, int32(newShardCount))
+	prediction, err := forecast.Predict(ctx, cloudwatchClient, streamName, forecastConfig, now)
 	if err != nil {
+		event.Fail("unable to forecast the stream load", err)
+		return
+	}
+
+	if previous != nil {
+		prediction.Forecast.Accuracy = forecast.Accuracy(*previous.Forecast, previous.Timestamp, prediction.History)
+	}
+
+	peak, peakAt := forecast.Peak(prediction.Forecast, streamSummary.ShardCount)
+	prediction.Forecast.PeakUsageFactor = peak
+	event.Forecast = &prediction.Forecast
+	event.UsageFactors = []float64{peak}
+
+	scaleUpThreshold := cfg.Settings(location).Alarms.ScaleUpThreshold
+	if peak < scaleUpThreshold {
+		event.SetOutcome(audit.OutcomeSkipped, fmt.Sprintf("forecast peak usage factor %.3f stays below the scale-up threshold", peak))
 		return
 	}
 
-	alarmLastScaledTimestampValue := time.Now().Format("2006-01-02T15:04:05.000+0000")
+	requiredShardCount := forecast.RequiredShardCount(prediction.Forecast, scaleUpThreshold)
+	event.TargetShardCount = scaling.CalculateShardCount("Predicted", streamSummary.ShardCount,
+		cfg.Settings(location).Capped(requiredShardCount))
+
+	if event.TargetShardCount == streamSummary.ShardCount {
+		event.SetOutcome(audit.OutcomeSkipped, "stream is already at the target shard count")
+		return
+	}
 
-	err = cloudwatchClient.UpdateAlarm(ctx, scaleUpAlarmName, streamName, alarmArn, false, newShardCount)
+	window, frozen, err := findFreeze(ctx, cfg, kinesisClient, location, "Predicted", now)
 	if err != nil {
+		event.Fail("unable to read the freeze tags of the stream", err)
+		return
+	}
+	if frozen {
+		event.SetOutcome(audit.OutcomeFrozen, "frozen "+window.String())
 		return
 	}
 
-	err = cloudwatchClient.SetAlarmState(ctx, scaleUpAlarmName, string(types.StateValueInsufficientData), "Metric math and threshold value update")
+	target, err := newScheduledReshardTarget(ctx, cfg, auditStore, cloudwatchClient, kinesisClient, location)
 	if err != nil {
+		event.Fail("unable to describe scale-up alarm", err)
 		return
 	}
 
-	err = cloudwatchClient.UpdateAlarm(ctx, scaleDownAlarmName, streamName, alarmArn, true, newShardCount)
+	target.reshard(ctx, streamSummary, target.targetOf(event.TargetShardCount),
+		fmt.Sprintf("forecast peak usage factor %.3f at %s", peak, peakAt.UTC().Format(time.RFC3339)), event)
+
+	if event.Outcome == audit.OutcomeApplied {
+		event.SetOutcome(audit.OutcomeApplied, fmt.Sprintf("forecast usage factor %.3f at %s crosses the scale-up threshold",
+			peak, peakAt.Format(time.RFC3339)))
+	}
+}
+
+// findFreeze returns the freeze window that blocks the scale action of the stream at the target at now, from the config
+// or from the tags of the stream
+func findFreeze(ctx context.Context, cfg *config.Config, kinesisClient *kinesis.Client, location accounts.Target, action string,
+	now time.Time) (freeze.Window, bool, error) {
+
+	logger := logging.WithContext(ctx)
+
+	streamName := location.StreamName
+
+	tags, err := kinesisClient.GetStreamTags(ctx, streamName)
+	if err != nil {
+		return freeze.Window{}, false, err
+	}
+
+	windows := cfg.FreezeWindows(location)
+	tagged, ok, err := freeze.FromTags(streamName, tags)
+	if err != nil {
+		logger.Error("invalid freeze tags",
+			zap.String("stream-name", streamName),
+			zap.Error(err))
+		return freeze.Window{}, false, err
+	}
+	if ok {
+		windows = append(windows, tagged)
+	}
+
+	window, frozen := freeze.Find(windows, action, now)
+	return window, frozen, nil
+}
+
+// newScheduledReshardTarget returns the reshard target of a stream for the scheduled invocations. There is no alarm
+// notification to take the pair and the topic from, so the pair is found by its tags or else by the naming, and the
+// alarms keep the topic they notify
+func newScheduledReshardTarget(ctx context.Context, cfg *config.Config, auditStore audit.Store, cloudwatchClient *cloudwatch.Client,
+	kinesisClient *kinesis.Client, location accounts.Target) (reshardTarget, error) {
+
+	streamName := location.StreamName
+	target := reshardTarget{
+		cfg:              cfg,
+		auditStore:       auditStore,
+		cloudwatchClient: cloudwatchClient,
+		kinesisClient:    kinesisClient,
+		location:         location,
+		streamName:       streamName,
+		settings:         cfg.Settings(location),
+		clock:            systemClock,
+	}
+
+	scaleUpAlarmName, scaleDownAlarmName, err := cloudwatchClient.StreamAlarmNames(ctx, streamName, cfg.AlarmNaming)
+	if err != nil {
+		return target, err
+	}
+	target.scaleUpAlarmName, target.scaleDownAlarmName = scaleUpAlarmName, scaleDownAlarmName
+
+	alarms, err := cloudwatchClient.DescribeAlarms(ctx, target.scaleUpAlarmName)
 	if err != nil {
+		return target, err
+	}
+	if len(alarms) > 0 && len(alarms[0].AlarmActions) > 0 {
+		target.topicArn = alarms[0].AlarmActions[0]
+	}
+
+	return target, nil
+}
+
+// reshardTarget is what a shard count update touches: the stream, its pair of alarms and the topic they notify
+type reshardTarget struct {
+	cfg              *config.Config
+	auditStore       audit.Store
+	cloudwatchClient *cloudwatch.Client
+	kinesisClient    *kinesis.Client
+
+	location           accounts.Target
+	streamName         string
+	scaleUpAlarmName   string
+	scaleDownAlarmName string
+	topicArn           string
+	settings           config.StreamSettings
+	clock              clock.Clock
+}
+
+// targetOf returns the target of a shard count decided without a strategy: by a schedule, a forecast or an interrupted
+// scaling
+func (t reshardTarget) targetOf(shardCount int) scaling.Target {
+	return scaling.Target{
+		ShardCount:         shardCount,
+		ScaleDownThreshold: scaling.ScaleDownThreshold(shardCount, t.settings.MinShardCount, t.settings.Alarms.ScaleDownThreshold),
+	}
+}
+
+// reshard updates the shard count of the stream to the target, moves its alarms to the new shard count and tags them
+// with the metadata of the scaling, the reason being what decided it. The outcome is recorded on the event
+func (t reshardTarget) reshard(ctx context.Context, streamSummary kinesis.StreamSummary, target scaling.Target, reason string,
+	event *audit.ScalingEvent) {
+
+	newShardCount := target.ShardCount
+
+	if !streamSummary.IsActive() {
+		event.SetOutcome(audit.OutcomeSkipped, "stream is "+streamSummary.Status+", shard count can not be updated")
 		return
 	}
 
-	err = cloudwatchClient.SetAlarmState(ctx, scaleDownAlarmName, string(types.StateValueInsufficientData), "Metric math and threshold value update")
+	now := t.clock.Now()
+	reshards, err := countRecentReshards(ctx, t.auditStore, t.location, now)
 	if err != nil {
+		event.Fail("unable to count recent reshards", err)
 		return
 	}
 
-	scaleUpAlarmArn, scaleDownAlarmArn, err := cloudwatchClient.GetAlarmArns(ctx, scaleUpAlarmName, scaleDownAlarmName)
+	// Without an audit store, or with one that missed some events, the alarm metadata keeps the last few actions
+	actions, err := t.alarmActionsSince(ctx, now.Add(-24*time.Hour))
 	if err != nil {
+		event.Fail("unable to count recent reshards", err)
+		return
+	}
+	if len(actions) > reshards {
+		reshards = len(actions)
+	}
+
+	if reshards >= constants.MaxReshardsPerDay {
+		event.SetOutcome(audit.OutcomeSkipped, fmt.Sprintf("reshard quota of %d per 24 hours is used up", constants.MaxReshardsPerDay))
 		return
 	}
 
-	err = cloudwatchClient.TagAlarm(ctx, scaleUpAlarmArn, "Up", scaleDownAlarmName, alarmLastScaledTimestampValue)
+	steps := []string{intent.StepReshard, intent.StepAlarms}
+	if t.cfg.Consumers.Enabled {
+		steps = append(steps, intent.StepConsumers)
+	}
+
+	pending := intent.Intent{
+		StreamName: t.streamName,
+		Action:     event.Action,
+		From:       streamSummary.ShardCount,
+		To:         newShardCount,
+		Steps:      steps,
+		StartedAt:  t.clock.Now(),
+		RequestID:  event.RequestID,
+	}
+
+	// The intent is written ahead of the shard count update, so that the next invocation finds the steps this one does
+	// not get to. It stays on the stream after the last step, kinesis refuses tag updates while the stream is
+	// UPDATING, and the next invocation removes it once it sees every step done
+	err = t.kinesisClient.TagStream(ctx, t.streamName, pending.Tags())
 	if err != nil {
+		event.Fail("unable to record the scaling intent", err)
 		return
 	}
 
-	err = cloudwatchClient.TagAlarm(ctx, scaleDownAlarmArn, "Down", scaleUpAlarmName, alarmLastScaledTimestampValue)
+	err = t.kinesisClient.UpdateShardCount(ctx, t.streamName, int32(newShardCount))
 	if err != nil {
+		event.Fail("unable to update shard count", err)
+		// A stream that is still ACTIVE was not resharded, the intent is dropped so that it does not hold the stream
+		// back. When the update went through after all, the stream is UPDATING and keeps it
+		_ = t.kinesisClient.UntagStream(ctx, t.streamName, intent.TagKeys)
+		return
+	}
+	event.Resharded = true
+
+	if !t.completeSteps(ctx, pending, target.ScaleDownThreshold, reason, event) {
 		return
 	}
+
+	event.SetOutcome(audit.OutcomeApplied, "stream resharded and alarms updated")
 }
 
-// CalculateShardCount returns the new shard count based on the scaling action and the updates scale down threshold
-// the down threshold will be -1.0 with the new calculation turns out to be 1
-func CalculateShardCount(scaleAction string, currentShardCount int) int {
-	var targetShardCount int
+// completeSteps runs the steps of the intent that follow the shard count update, the scale-down alarm is put with the
+// threshold. Both are idempotent, so the steps an interrupted invocation may or may not have finished can be run again
+func (t reshardTarget) completeSteps(ctx context.Context, pending intent.Intent, scaleDownThreshold float64, reason string,
+	event *audit.ScalingEvent) bool {
+
+	shardCount := pending.To
+
+	if pending.Pending(intent.StepAlarms) {
+		settings := t.settings.Alarms
+		settings.ScaleDownThreshold = scaleDownThreshold
 
-	if scaleAction == "Up" {
-		targetShardCount = currentShardCount * 2
+		pair := cloudwatch.AlarmPair{
+			StreamName:         t.streamName,
+			ScaleUpAlarmName:   t.scaleUpAlarmName,
+			ScaleDownAlarmName: t.scaleDownAlarmName,
+			TopicArn:           t.topicArn,
+			ReadSide:           t.cfg.ReadSide,
+			Settings:           settings,
+		}
+
+		err := t.cloudwatchClient.UpdateAlarmPair(ctx, pair, cloudwatch.Scaling{
+			Action:             pending.Action,
+			PreviousShardCount: pending.From,
+			ShardCount:         shardCount,
+			Timestamp:          t.clock.Now(),
+			Reason:             reason,
+			RequestID:          event.RequestID,
+			NemesisVersion:     constants.Version,
+		})
+		if err != nil {
+			event.Fail("unable to update the scaling alarms", err)
+			return false
+		}
 	}
 
-	if scaleAction == "Down" {
-		targetShardCount = currentShardCount / 2
-		// Set to minimum shard count
-		if targetShardCount <= 1 {
-			targetShardCount = 1
-			// At minimum shard count,set the scale down threshold to -1, so that scale down alarm remains in OK state
-			constants.ScaleDownThreshold = -1.0
+	if pending.Pending(intent.StepConsumers) {
+		err := scaleConsumers(ctx, t.kinesisClient, t.location, shardCount, t.cfg.Consumers)
+		if err != nil {
+			event.Fail("unable to scale stream consumers", err)
+			return false
 		}
 	}
 
-	return targetShardCount
+	return true
 }
 
-// ShouldScaleKinesis checks if the kinesis stream should be scaled or not. This is just to avoid a race condition on
-// scaling kinesis like crazy
-func ShouldScaleKinesis(lastScaledTimestamp, alarmTime string) bool {
-	var (
-		firstEverScaleAttempt = true
-	)
+// resumeIntent completes or rolls back the scaling intent an earlier invocation left on the stream. It returns true
+// when the intent decides the outcome of the event, and false when the intent was of a finished scaling and was only
+// removed, the invocation then goes on
+func (t reshardTarget) resumeIntent(ctx context.Context, pending intent.Intent, now time.Time, event *audit.ScalingEvent) bool {
+	logger := logging.WithContext(ctx)
+
+	streamSummary, err := t.kinesisClient.GetStreamSummary(ctx, t.streamName)
+	if err != nil {
+		event.Fail("unable to get shard count", err)
+		return true
+	}
 
-	if lastScaledTimestamp == "" {
-		firstEverScaleAttempt = true
-	} else {
-		firstEverScaleAttempt = false
+	decide := func() {
+		event.Action = pending.Action
+		event.ShardCount = pending.From
+		event.TargetShardCount = pending.To
 	}
 
-	if firstEverScaleAttempt {
+	if !streamSummary.IsActive() {
+		decide()
+		event.SetOutcome(audit.OutcomeSkipped, pending.String()+" is in progress, the stream is "+streamSummary.Status)
 		return true
 	}
 
-	var stateChangeTime, stateChangeParseErr = time.Parse("2006-01-02T15:04:05.000+0000", alarmTime)
-	var lastScaled, lastScaledTimestampParseErr = time.Parse("2006-01-02T15:04:05.000+0000", lastScaledTimestamp)
+	// The steps are not recorded as they finish, what is done is read from the stream and the alarms
+	if streamSummary.ShardCount != pending.To {
+		decide()
+		if !pending.Interrupted(now) {
+			event.SetOutcome(audit.OutcomeSkipped, pending.String()+" is in progress since "+pending.StartedAt.Format(time.RFC3339))
+			return true
+		}
+
+		err = t.kinesisClient.UntagStream(ctx, t.streamName, intent.TagKeys)
+		if err != nil {
+			event.Fail("unable to remove the scaling intent", err)
+			return true
+		}
 
-	if lastScaledTimestampParseErr != nil || stateChangeParseErr != nil {
+		event.SetOutcome(audit.OutcomeRolledBack, fmt.Sprintf("dropped the interrupted %s, the stream has %d shards",
+			pending.String(), streamSummary.ShardCount))
 		return true
 	}
 
-	if stateChangeTime.Before(lastScaled) || stateChangeTime.Equal(lastScaled) {
-		return false
+	pending.Done(intent.StepReshard)
+
+	alarmsDone, err := t.alarmsScaledSince(ctx, pending.StartedAt)
+	if err != nil {
+		event.Fail("unable to read the scaling alarm tags", err)
+		return true
+	}
+	if alarmsDone {
+		pending.Done(intent.StepAlarms)
+	}
+
+	if !t.completeSteps(ctx, pending, t.targetOf(pending.To).ScaleDownThreshold, "completed the interrupted "+pending.String(), event) {
+		decide()
+		return true
+	}
+
+	err = t.kinesisClient.UntagStream(ctx, t.streamName, intent.TagKeys)
+	if err != nil {
+		decide()
+		event.Fail("unable to remove the scaling intent", err)
+		return true
 	}
 
-	// Too soon since the last scaling event
-	var nextAllowedScalingEvent = lastScaled.Add(time.Minute * time.Duration(constants.ScalePeriodMinutes))
-	if stateChangeTime.Before(nextAllowedScalingEvent) {
+	if alarmsDone {
+		logger.Info("removed the intent of a finished scaling",
+			zap.String("intent", pending.String()))
 		return false
 	}
 
+	decide()
+	event.SetOutcome(audit.OutcomeResumed, "completed the interrupted "+pending.String())
 	return true
 }
 
-func main()  {
-	lambda.Start(handleRequest)
-}
\ No newline at end of file
+// alarmActionsSince returns the scaling actions the metadata of the scale-up alarm keeps at or after since, none when
+// the alarm is missing or its metadata is broken
+func (t reshardTarget) alarmActionsSince(ctx context.Context, since time.Time) ([]scaling.Action, error) {
+	scaleUpAlarmArn, _, err := t.cloudwatchClient.GetAlarmArns(ctx, t.scaleUpAlarmName, t.scaleDownAlarmName)
+	if err != nil || scaleUpAlarmArn == "" {
+		return nil, err
+	}
+
+	tags, err := t.cloudwatchClient.GetAlarmTags(ctx, scaleUpAlarmArn)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := cloudwatch.ParseMetadata(tags)
+	if err != nil {
+		return nil, nil
+	}
+
+	return metadata.Actions(since), nil
+}
+
+// alarmsScaledSince checks if both alarms were tagged with a scaling at or after the time
+func (t reshardTarget) alarmsScaledSince(ctx context.Context, since time.Time) (bool, error) {
+	scaleUpAlarmArn, scaleDownAlarmArn, err := t.cloudwatchClient.GetAlarmArns(ctx, t.scaleUpAlarmName, t.scaleDownAlarmName)
+	if err != nil {
+		return false, err
+	}
+
+	for _, alarmArn := range []string{scaleUpAlarmArn, scaleDownAlarmArn} {
+		if alarmArn == "" {
+			return false, nil
+		}
+
+		tags, err := t.cloudwatchClient.GetAlarmTags(ctx, alarmArn)
+		if err != nil {
+			return false, err
+		}
+
+		metadata, err := cloudwatch.ParseMetadata(tags)
+		if err != nil {
+			return false, nil
+		}
+
+		lastScaled, err := clock.Parse(metadata.LastScaled())
+		if err != nil || lastScaled.Before(since) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// findIntent returns the scaling intent the stream is tagged with. Intent tags that can not be read are removed, so
+// that they do not block the scaling of the stream, and the stream is treated as having no intent
+func findIntent(ctx context.Context, kinesisClient *kinesis.Client, streamName string) (intent.Intent, bool, error) {
+	logger := logging.WithContext(ctx)
+
+	tags, err := kinesisClient.GetStreamTags(ctx, streamName)
+	if err != nil {
+		return intent.Intent{}, false, err
+	}
+
+	pending, ok, err := intent.FromTags(streamName, tags)
+	if err != nil {
+		logger.Error("invalid scaling intent tags, removing them",
+			zap.String("stream-name", streamName),
+			zap.Error(err))
+		_ = kinesisClient.UntagStream(ctx, streamName, intent.TagKeys)
+		return intent.Intent{}, false, nil
+	}
+
+	return pending, ok, nil
+}
+
+// scaleConsumers makes the Lambda consumers of the stream, in the account and region of the stream, follow its new
+// shard count
+func scaleConsumers(ctx context.Context, kinesisClient *kinesis.Client, location accounts.Target, shardCount int, cfg consumers.Config) error {
+	streamArn, err := kinesisClient.GetStreamArn(ctx, location.StreamName)
+	if err != nil {
+		return err
+	}
+
+	consumersClient, err := newConsumersClient(ctx, location)
+	if err != nil {
+		return err
+	}
+
+	return consumersClient.Scale(ctx, streamArn, shardCount, cfg)
+}
+
+// appliedActions returns the scaling actions applied to the stream at the target at or after since, oldest first
+func appliedActions(ctx context.Context, store audit.Store, location accounts.Target, since time.Time) ([]scaling.Action, error) {
+	events, err := store.History(ctx, location, since)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := make([]scaling.Action, 0, len(events))
+	for _, event := range events {
+		if event.Outcome == audit.OutcomeApplied {
+			actions = append(actions, scaling.Action{Action: event.Action, Timestamp: event.Timestamp})
+		}
+	}
+
+	return actions, nil
+}
+
+// countRecentReshards returns the number of shard count updates the stream at the target went through in the 24 hours
+// before now: the applied scalings, the failed ones whose update went through before a later step failed, and the
+// resumed ones, whose update was made by an interrupted invocation. A resumed scaling whose failure was recorded as
+// well is counted twice, the quota is rather held back early than exceeded
+func countRecentReshards(ctx context.Context, store audit.Store, location accounts.Target, now time.Time) (int, error) {
+	events, err := store.History(ctx, location, now.Add(-24*time.Hour))
+	if err != nil {
+		return 0, err
+	}
+
+	reshards := 0
+	for _, event := range events {
+		if event.Resharded || event.Outcome == audit.OutcomeApplied || event.Outcome == audit.OutcomeResumed {
+			reshards++
+		}
+	}
+
+	return reshards, nil
+}
+
+// recordEvent persists the scaling event. Failing to record an event does not fail the scaling
+func recordEvent(ctx context.Context, store audit.Store, event *audit.ScalingEvent) {
+	logger := logging.WithContext(ctx)
+
+	logger.Info("scaling event",
+		zap.String("outcome", string(event.Outcome)),
+		zap.String("reason", event.Reason),
+		zap.Int("shard-count", event.ShardCount),
+		zap.Int("target-shard-count", event.TargetShardCount))
+
+	err := store.Record(ctx, *event)
+	if err != nil {
+		logger.Error("unable to record scaling event",
+			zap.Error(err))
+	}
+}
+
+// notifyEvent tells the configured channels about applied and failed scaling events, about resumed and rolled back
+// interrupted ones and about the rejected ones of flapping streams. Other events are only recorded
+func notifyEvent(ctx context.Context, notifier *notify.Dispatcher, event *audit.ScalingEvent, cooldownRemaining time.Duration) {
+	var severity notify.Severity
+
+	switch event.Outcome {
+	case audit.OutcomeApplied:
+		severity = notify.SeverityInfo
+	case audit.OutcomeFailed:
+		severity = notify.SeverityError
+	case audit.OutcomeResumed, audit.OutcomeRolledBack:
+		// Someone should look at why the invocation was interrupted
+		severity = notify.SeverityWarning
+	case audit.OutcomeRejected:
+		// Rejections are only told about when the stream oscillates, someone should look at its thresholds
+		if !event.Flapping {
+			return
+		}
+		severity = notify.SeverityWarning
+	default:
+		return
+	}
+
+	message := notify.Message{
+		Severity:          severity,
+		StreamName:        event.StreamName,
+		Action:            event.Action,
+		Outcome:           string(event.Outcome),
+		ShardCount:        event.ShardCount,
+		TargetShardCount:  event.TargetShardCount,
+		Reason:            event.Reason,
+		Error:             event.Error,
+		CooldownRemaining: cooldownRemaining,
+		RequestID:         event.RequestID,
+		Timestamp:         event.Timestamp,
+	}
+	if len(event.UsageFactors) > 0 {
+		message.UsageFactor = event.UsageFactors[0]
+	}
+
+	_ = notifier.Notify(ctx, message)
+}
+
+// cooldownRemaining returns how long the stream is held back after the event: the rest of the cooldown that rejected
+// it, or the cooldown its applied action starts
+func cooldownRemaining(cooldowns scaling.Cooldowns, history []scaling.Action, event *audit.ScalingEvent) time.Duration {
+	if event.Outcome == audit.OutcomeApplied {
+		history = append(history[:len(history):len(history)], scaling.Action{Action: event.Action, Timestamp: event.Timestamp})
+	}
+
+	return cooldowns.Remaining(history, event.Action, event.Timestamp)
+}
+
+// handleEvent routes the scheduled invocations to handleSchedule and the SNS notifications of the scaling alarms to
+// handleRequest
+func handleEvent(ctx context.Context, payload json.RawMessage) {
+	logger := logging.WithContext(ctx)
+
+	var scheduledEvent events.CloudWatchEvent
+	if err := json.Unmarshal(payload, &scheduledEvent); err == nil && scheduledEvent.DetailType == "Scheduled Event" {
+		handleSchedule(ctx, systemClock.Now())
+		return
+	}
+
+	var snsEvent events.SNSEvent
+	err := json.Unmarshal(payload, &snsEvent)
+	if err != nil {
+		logger.Error("unable to unmarshal the event",
+			zap.Error(err))
+		return
+	}
+
+	handleRequest(ctx, snsEvent)
+}
+
+func main() {
+	ctx := context.Background()
+
+	// The clients are shared by the warm invocations, their options are read once and before the scaling policy, which
+	// may be read with them
+	if err := config.InitClients(ctx); err != nil {
+		os.Exit(1)
+	}
+	if _, err := config.Load(ctx); err != nil {
+		os.Exit(1)
+	}
+
+	lambda.Start(handleEvent)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmanikes/Nemesis/accounts"
+	"github.com/vmanikes/Nemesis/audit"
+	"github.com/vmanikes/Nemesis/scaling"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCountRecentReshards(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "us-east-1")
+	store := audit.NewFileStore(filepath.Join(t.TempDir(), "audit.jsonl"))
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, store.Record(ctx, audit.ScalingEvent{StreamName: "test-stream", Timestamp: now.Add(-time.Hour), Outcome: audit.OutcomeApplied}))
+	assert.NoError(t, store.Record(ctx, audit.ScalingEvent{StreamName: "test-stream", Timestamp: now.Add(-2 * time.Hour), Outcome: audit.OutcomeRejected}))
+	assert.NoError(t, store.Record(ctx, audit.ScalingEvent{StreamName: "test-stream", Timestamp: now.Add(-25 * time.Hour), Outcome: audit.OutcomeApplied}))
+
+	// A scaling that failed after the shard count update and an interrupted one that was resumed used the quota too
+	assert.NoError(t, store.Record(ctx, audit.ScalingEvent{StreamName: "test-stream", Timestamp: now.Add(-3 * time.Hour), Outcome: audit.OutcomeFailed, Resharded: true}))
+	assert.NoError(t, store.Record(ctx, audit.ScalingEvent{StreamName: "test-stream", Timestamp: now.Add(-4 * time.Hour), Outcome: audit.OutcomeFailed}))
+	assert.NoError(t, store.Record(ctx, audit.ScalingEvent{StreamName: "test-stream", Timestamp: now.Add(-5 * time.Hour), Outcome: audit.OutcomeResumed}))
+
+	// The stream of the same name in another account has a quota of its own
+	remote := accounts.Target{StreamName: "test-stream", AccountID: "999999999999", Region: "eu-west-1"}
+	event := audit.ScalingEvent{StreamName: "test-stream", Timestamp: now.Add(-time.Hour), Outcome: audit.OutcomeApplied}
+	event.SetLocation(remote)
+	assert.NoError(t, store.Record(ctx, event))
+
+	reshards, err := countRecentReshards(ctx, store, accounts.Target{StreamName: "test-stream"}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, reshards)
+
+	reshards, err = countRecentReshards(ctx, store, remote, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, reshards)
+}
+
+func TestCooldownRemaining(t *testing.T) {
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	cooldowns := scaling.Cooldowns{ScaleUpMinutes: 10, ScaleDownAfterScaleUpMinutes: 180}
+
+	// An applied action starts its own cooldown
+	event := &audit.ScalingEvent{Action: "Up", Timestamp: now, Outcome: audit.OutcomeApplied}
+	assert.Equal(t, 10*time.Minute, cooldownRemaining(cooldowns, nil, event))
+
+	// A rejected action waits for the rest of the cooldown that rejected it
+	history := []scaling.Action{{Action: "Up", Timestamp: now.Add(-time.Hour)}}
+	event = &audit.ScalingEvent{Action: "Down", Timestamp: now, Outcome: audit.OutcomeRejected}
+	assert.Equal(t, 2*time.Hour, cooldownRemaining(cooldowns, history, event))
+	assert.Len(t, history, 1)
+}
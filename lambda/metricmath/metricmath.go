@@ -0,0 +1,578 @@
+// Package metricmath parses and evaluates the subset of CloudWatch metric math that the Nemesis alarms use:
+// arithmetic, constants, ID references, FILL and MAX. It checks alarm definitions before they are put and evaluates
+// them locally over supplied time series
+package metricmath
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrSyntax is returned for expressions that cannot be parsed
+	ErrSyntax = errors.New("metric math syntax error")
+	// ErrUndefinedID is returned when an expression references an ID that no query defines
+	ErrUndefinedID = errors.New("undefined metric math ID")
+	// ErrCycle is returned when expressions depend on each other
+	ErrCycle = errors.New("metric math dependency cycle")
+	// ErrDuplicateID is returned when two queries have the same ID
+	ErrDuplicateID = errors.New("duplicate metric math ID")
+)
+
+func syntaxError(expression string, position int, message string) error {
+	return fmt.Errorf("%w: %q at position %d: %s", ErrSyntax, expression, position, message)
+}
+
+// Series is a time series, or a scalar when Timestamps is nil and it holds a single value
+type Series struct {
+	Timestamps []time.Time
+	Values     []float64
+}
+
+// Scalar returns a scalar series
+func Scalar(value float64) Series {
+	return Series{Values: []float64{value}}
+}
+
+// IsScalar checks if the series is a scalar
+func (s Series) IsScalar() bool {
+	return s.Timestamps == nil && len(s.Values) == 1
+}
+
+// At returns the value of the series at the timestamp. Scalars have a value at every timestamp
+func (s Series) At(timestamp time.Time) (float64, bool) {
+	if s.IsScalar() {
+		return s.Values[0], true
+	}
+
+	for i, t := range s.Timestamps {
+		if t.Equal(timestamp) {
+			return s.Values[i], true
+		}
+	}
+
+	return 0, false
+}
+
+// lookup returns a function that finds the value of the series at a timestamp in constant time
+func (s Series) lookup() func(time.Time) (float64, bool) {
+	if s.IsScalar() {
+		return func(time.Time) (float64, bool) {
+			return s.Values[0], true
+		}
+	}
+
+	values := make(map[int64]float64, len(s.Timestamps))
+	for i, timestamp := range s.Timestamps {
+		values[timestamp.UnixNano()] = s.Values[i]
+	}
+
+	return func(timestamp time.Time) (float64, bool) {
+		value, ok := values[timestamp.UnixNano()]
+		return value, ok
+	}
+}
+
+// Expression is a parsed metric math expression
+type Expression struct {
+	source string
+	root   node
+}
+
+// Parse parses a single expression
+func Parse(expression string) (*Expression, error) {
+	tokens, err := lex(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{expression: expression, tokens: tokens}
+
+	root, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, p.unexpected("expected an operator")
+	}
+
+	return &Expression{source: expression, root: root}, nil
+}
+
+// String returns the source of the expression
+func (e *Expression) String() string {
+	return e.source
+}
+
+// References returns the IDs the expression references, sorted and without duplicates
+func (e *Expression) References() []string {
+	seen := make(map[string]bool)
+	e.root.references(func(id string) {
+		seen[id] = true
+	})
+
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// Query is a single query of a metric alarm. Metrics have no expression, their series is supplied at evaluation
+type Query struct {
+	ID         string
+	Expression string
+}
+
+// Program is a validated set of queries
+type Program struct {
+	ids         []string
+	expressions map[string]*Expression
+	// order holds the expression IDs so that every expression comes after the ones it references
+	order []string
+}
+
+// Compile parses the expressions of the queries and rejects invalid and duplicate IDs, references to undefined IDs and
+// dependency cycles
+func Compile(queries []Query) (*Program, error) {
+	program := &Program{
+		expressions: make(map[string]*Expression),
+	}
+
+	defined := make(map[string]bool)
+
+	for _, query := range queries {
+		if !isID(query.ID) {
+			return nil, fmt.Errorf("%w: invalid ID %q, IDs start with a lowercase letter", ErrSyntax, query.ID)
+		}
+		if defined[query.ID] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateID, query.ID)
+		}
+		defined[query.ID] = true
+		program.ids = append(program.ids, query.ID)
+
+		if query.Expression == "" {
+			continue
+		}
+
+		expression, err := Parse(query.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", query.ID, err)
+		}
+		program.expressions[query.ID] = expression
+	}
+
+	for _, id := range program.ids {
+		expression, ok := program.expressions[id]
+		if !ok {
+			continue
+		}
+		for _, reference := range expression.References() {
+			if !defined[reference] {
+				return nil, fmt.Errorf("%w: %s references %s", ErrUndefinedID, id, reference)
+			}
+		}
+	}
+
+	order, err := program.sort()
+	if err != nil {
+		return nil, err
+	}
+	program.order = order
+
+	return program, nil
+}
+
+// sort orders the expressions by their dependencies and reports the first cycle it finds
+func (p *Program) sort() ([]string, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int)
+	order := make([]string, 0, len(p.expressions))
+	path := make([]string, 0)
+
+	var visit func(id string) error
+	visit = func(id string) error {
+		expression, ok := p.expressions[id]
+		if !ok {
+			return nil
+		}
+
+		switch state[id] {
+		case visited:
+			return nil
+		case visiting:
+			start := 0
+			for i, step := range path {
+				if step == id {
+					start = i
+				}
+			}
+			return fmt.Errorf("%w: %s", ErrCycle, strings.Join(append(path[start:], id), " -> "))
+		}
+
+		state[id] = visiting
+		path = append(path, id)
+
+		for _, reference := range expression.References() {
+			if err := visit(reference); err != nil {
+				return err
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[id] = visited
+		order = append(order, id)
+
+		return nil
+	}
+
+	for _, id := range p.ids {
+		if err := visit(id); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// IDs returns the IDs of all queries in their original order
+func (p *Program) IDs() []string {
+	return append([]string(nil), p.ids...)
+}
+
+// Expression returns the expression of the query, nil for metrics
+func (p *Program) Expression(id string) *Expression {
+	return p.expressions[id]
+}
+
+// Evaluate computes every query. Metrics take their series from data, metrics without data are empty. FILL fills
+// the missing datapoints of the timestamps, which default to all the timestamps in data
+func (p *Program) Evaluate(data map[string]Series, timestamps []time.Time) (map[string]Series, error) {
+	if timestamps == nil {
+		timestamps = union(seriesOf(data)...)
+	}
+
+	env := &environment{
+		timestamps: timestamps,
+		values:     make(map[string]Series, len(p.ids)),
+	}
+
+	for _, id := range p.ids {
+		if _, ok := p.expressions[id]; !ok {
+			env.values[id] = data[id]
+		}
+	}
+
+	for _, id := range p.order {
+		value, err := p.expressions[id].root.eval(env)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", id, err)
+		}
+		env.values[id] = value
+	}
+
+	return env.values, nil
+}
+
+// environment holds the values computed so far
+type environment struct {
+	timestamps []time.Time
+	values     map[string]Series
+}
+
+// node is a node of the expression tree
+type node interface {
+	eval(env *environment) (Series, error)
+	references(add func(id string))
+}
+
+type number float64
+
+func (n number) eval(*environment) (Series, error) {
+	return Scalar(float64(n)), nil
+}
+
+func (n number) references(func(string)) {}
+
+type reference string
+
+func (r reference) eval(env *environment) (Series, error) {
+	return env.values[string(r)], nil
+}
+
+func (r reference) references(add func(string)) {
+	add(string(r))
+}
+
+type negate struct {
+	operand node
+}
+
+func (n negate) eval(env *environment) (Series, error) {
+	operand, err := n.operand.eval(env)
+	if err != nil {
+		return Series{}, err
+	}
+
+	return apply(operand, Scalar(-1), '*'), nil
+}
+
+func (n negate) references(add func(string)) {
+	n.operand.references(add)
+}
+
+type binary struct {
+	operator    byte
+	left, right node
+}
+
+func (b binary) eval(env *environment) (Series, error) {
+	left, err := b.left.eval(env)
+	if err != nil {
+		return Series{}, err
+	}
+	right, err := b.right.eval(env)
+	if err != nil {
+		return Series{}, err
+	}
+
+	if left.IsScalar() && right.IsScalar() && b.operator == '/' && right.Values[0] == 0 {
+		return Series{}, errors.New("division by zero")
+	}
+
+	return apply(left, right, b.operator), nil
+}
+
+func (b binary) references(add func(string)) {
+	b.left.references(add)
+	b.right.references(add)
+}
+
+type array []node
+
+func (a array) eval(*environment) (Series, error) {
+	return Series{}, errors.New("arrays are only supported as function arguments")
+}
+
+func (a array) references(add func(string)) {
+	for _, element := range a {
+		element.references(add)
+	}
+}
+
+type call struct {
+	name      string
+	arguments []node
+}
+
+func (c call) eval(env *environment) (Series, error) {
+	switch c.name {
+	case "FILL":
+		series, err := c.arguments[0].eval(env)
+		if err != nil {
+			return Series{}, err
+		}
+		value, _ := constant(c.arguments[1])
+
+		return fill(series, value, env.timestamps), nil
+	default:
+		elements, ok := c.arguments[0].(array)
+		if !ok {
+			series, err := c.arguments[0].eval(env)
+			if err != nil {
+				return Series{}, err
+			}
+			return maxOf(series), nil
+		}
+
+		series := make([]Series, 0, len(elements))
+		for _, element := range elements {
+			value, err := element.eval(env)
+			if err != nil {
+				return Series{}, err
+			}
+			series = append(series, value)
+		}
+
+		return maxAcross(series), nil
+	}
+}
+
+func (c call) references(add func(string)) {
+	for _, argument := range c.arguments {
+		argument.references(add)
+	}
+}
+
+// apply applies the operator to every pair of values with the same timestamp. Scalars pair with every value. Datapoints
+// that are not finite, e.g. after a division by zero, are dropped as cloudwatch does
+func apply(left, right Series, operator byte) Series {
+	operate := func(a, b float64) float64 {
+		switch operator {
+		case '+':
+			return a + b
+		case '-':
+			return a - b
+		case '*':
+			return a * b
+		default:
+			return a / b
+		}
+	}
+
+	if left.IsScalar() && right.IsScalar() {
+		return Scalar(operate(left.Values[0], right.Values[0]))
+	}
+
+	result := Series{Timestamps: make([]time.Time, 0), Values: make([]float64, 0)}
+
+	timestamps := left.Timestamps
+	if left.IsScalar() {
+		timestamps = right.Timestamps
+	}
+
+	leftAt, rightAt := left.lookup(), right.lookup()
+
+	for _, timestamp := range timestamps {
+		a, ok := leftAt(timestamp)
+		if !ok {
+			continue
+		}
+		b, ok := rightAt(timestamp)
+		if !ok {
+			continue
+		}
+
+		value := operate(a, b)
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+
+		result.Timestamps = append(result.Timestamps, timestamp)
+		result.Values = append(result.Values, value)
+	}
+
+	return result
+}
+
+// fill returns a value for every timestamp, taking the missing ones from value
+func fill(series Series, value float64, timestamps []time.Time) Series {
+	if series.IsScalar() {
+		return series
+	}
+
+	at := series.lookup()
+
+	result := Series{Timestamps: make([]time.Time, 0, len(timestamps)), Values: make([]float64, 0, len(timestamps))}
+	for _, timestamp := range union(series.Timestamps, timestamps) {
+		v, ok := at(timestamp)
+		if !ok {
+			v = value
+		}
+
+		result.Timestamps = append(result.Timestamps, timestamp)
+		result.Values = append(result.Values, v)
+	}
+
+	return result
+}
+
+// maxOf returns the maximum value of the series as a scalar. An empty series stays empty
+func maxOf(series Series) Series {
+	if series.IsScalar() || len(series.Values) == 0 {
+		return series
+	}
+
+	result := series.Values[0]
+	for _, value := range series.Values[1:] {
+		result = math.Max(result, value)
+	}
+
+	return Scalar(result)
+}
+
+// maxAcross returns the maximum of the series at every timestamp any of them has a value
+func maxAcross(series []Series) Series {
+	timestamps := make([][]time.Time, 0, len(series))
+	allScalars := true
+	for _, s := range series {
+		if !s.IsScalar() {
+			allScalars = false
+			timestamps = append(timestamps, s.Timestamps)
+		}
+	}
+
+	if allScalars {
+		result := series[0].Values[0]
+		for _, s := range series[1:] {
+			result = math.Max(result, s.Values[0])
+		}
+		return Scalar(result)
+	}
+
+	lookups := make([]func(time.Time) (float64, bool), 0, len(series))
+	for _, s := range series {
+		lookups = append(lookups, s.lookup())
+	}
+
+	result := Series{Timestamps: make([]time.Time, 0), Values: make([]float64, 0)}
+	for _, timestamp := range union(timestamps...) {
+		found := false
+		value := math.Inf(-1)
+		for _, at := range lookups {
+			if v, ok := at(timestamp); ok {
+				found = true
+				value = math.Max(value, v)
+			}
+		}
+		if !found {
+			continue
+		}
+
+		result.Timestamps = append(result.Timestamps, timestamp)
+		result.Values = append(result.Values, value)
+	}
+
+	return result
+}
+
+// seriesOf returns the timestamps of every series in data
+func seriesOf(data map[string]Series) [][]time.Time {
+	timestamps := make([][]time.Time, 0, len(data))
+	for _, series := range data {
+		timestamps = append(timestamps, series.Timestamps)
+	}
+	return timestamps
+}
+
+// union returns the sorted timestamps that are in any of the lists
+func union(lists ...[]time.Time) []time.Time {
+	seen := make(map[int64]bool)
+	result := make([]time.Time, 0)
+
+	for _, list := range lists {
+		for _, timestamp := range list {
+			if !seen[timestamp.UnixNano()] {
+				seen[timestamp.UnixNano()] = true
+				result = append(result, timestamp)
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Before(result[j])
+	})
+
+	return result
+}
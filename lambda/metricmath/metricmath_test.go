@@ -0,0 +1,132 @@
+package metricmath
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+
+func minutes(offsets ...int) []time.Time {
+	timestamps := make([]time.Time, 0, len(offsets))
+	for _, offset := range offsets {
+		timestamps = append(timestamps, start.Add(time.Duration(offset)*time.Minute))
+	}
+	return timestamps
+}
+
+func TestParse(t *testing.T) {
+	valid := []string{
+		"e1/(1024*1024*60*5*s1)",
+		"(FILL(m3,0)/1000/60)*(0.07500/s2)",
+		"MAX([e3,e4,e5])",
+		"MAX(m1)",
+		"-m1 + 2.5e3",
+		"FILL(m1, -1)",
+	}
+	for _, expression := range valid {
+		_, err := Parse(expression)
+		assert.NoError(t, err, expression)
+	}
+
+	invalid := []string{
+		"",
+		"e1 +",
+		"(e1",
+		"e1 e2",
+		"MAX([e1,e2]",
+		"FILL(m1)",
+		"FILL(m1, m2)",
+		"FILL([m1], 0)",
+		"SUM([m1])",
+		"E1 * 2",
+		"m1 % 2",
+		"[m1]",
+	}
+	for _, expression := range invalid {
+		_, err := Parse(expression)
+		assert.True(t, errors.Is(err, ErrSyntax), expression)
+	}
+}
+
+func TestExpression_References(t *testing.T) {
+	expression, err := Parse("MAX([e3, e4, e3 * s1])")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"e3", "e4", "s1"}, expression.References())
+}
+
+func TestCompile(t *testing.T) {
+	_, err := Compile([]Query{{ID: "m1"}, {ID: "e1", Expression: "FILL(m1,0)"}, {ID: "e2", Expression: "e1/s1"}})
+	assert.True(t, errors.Is(err, ErrUndefinedID))
+	assert.Contains(t, err.Error(), "e2 references s1")
+
+	_, err = Compile([]Query{{ID: "e1", Expression: "e3+1"}, {ID: "e2", Expression: "e1*2"}, {ID: "e3", Expression: "e2"}})
+	assert.True(t, errors.Is(err, ErrCycle))
+	assert.Contains(t, err.Error(), "e1 -> e3 -> e2 -> e1")
+
+	_, err = Compile([]Query{{ID: "e1", Expression: "e1"}})
+	assert.True(t, errors.Is(err, ErrCycle))
+
+	_, err = Compile([]Query{{ID: "m1"}, {ID: "m1"}})
+	assert.True(t, errors.Is(err, ErrDuplicateID))
+
+	_, err = Compile([]Query{{ID: "M1"}})
+	assert.True(t, errors.Is(err, ErrSyntax))
+
+	_, err = Compile([]Query{{ID: "e1", Expression: "m1 +"}, {ID: "m1"}})
+	assert.True(t, errors.Is(err, ErrSyntax))
+}
+
+func TestProgram_Evaluate(t *testing.T) {
+	program, err := Compile([]Query{
+		{ID: "m1"},
+		{ID: "m2"},
+		{ID: "e6", Expression: "MAX([e3,e4])"},
+		{ID: "e1", Expression: "FILL(m1,0)"},
+		{ID: "e2", Expression: "FILL(m2,0)"},
+		{ID: "e3", Expression: "e1/(100*s1)"},
+		{ID: "e4", Expression: "e2/(10*s1)"},
+		{ID: "s1", Expression: "2"},
+		{ID: "peak", Expression: "MAX(e6)"},
+	})
+	assert.NoError(t, err)
+
+	values, err := program.Evaluate(map[string]Series{
+		"m1": {Timestamps: minutes(0, 1), Values: []float64{100, 400}},
+		"m2": {Timestamps: minutes(0, 2), Values: []float64{30, 10}},
+	}, minutes(0, 1, 2))
+	assert.NoError(t, err)
+
+	assert.Equal(t, Scalar(2), values["s1"])
+	assert.Equal(t, Series{Timestamps: minutes(0, 1, 2), Values: []float64{100, 400, 0}}, values["e1"])
+	assert.Equal(t, Series{Timestamps: minutes(0, 1, 2), Values: []float64{0.5, 2, 0}}, values["e3"])
+	assert.Equal(t, Series{Timestamps: minutes(0, 1, 2), Values: []float64{1.5, 0, 0.5}}, values["e4"])
+	assert.Equal(t, Series{Timestamps: minutes(0, 1, 2), Values: []float64{1.5, 2, 0.5}}, values["e6"])
+	assert.Equal(t, Scalar(2), values["peak"])
+}
+
+func TestProgram_EvaluateMissingData(t *testing.T) {
+	program, err := Compile([]Query{
+		{ID: "m1"},
+		{ID: "m2"},
+		{ID: "ratio", Expression: "m1/m2"},
+		{ID: "scalar", Expression: "1/0"},
+	})
+	assert.NoError(t, err)
+
+	_, err = program.Evaluate(nil, nil)
+	assert.Error(t, err)
+
+	program, err = Compile([]Query{{ID: "m1"}, {ID: "m2"}, {ID: "ratio", Expression: "m1/m2"}})
+	assert.NoError(t, err)
+
+	// Only matching timestamps are combined and divisions by zero are dropped
+	values, err := program.Evaluate(map[string]Series{
+		"m1": {Timestamps: minutes(0, 1, 2), Values: []float64{1, 2, 3}},
+		"m2": {Timestamps: minutes(1, 2), Values: []float64{0, 6}},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Series{Timestamps: minutes(2), Values: []float64{0.5}}, values["ratio"])
+}
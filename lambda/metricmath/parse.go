@@ -0,0 +1,314 @@
+package metricmath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// token is a lexical token of an expression
+type token struct {
+	kind     tokenKind
+	text     string
+	position int
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenIdentifier
+	tokenOperator
+)
+
+// lex splits the expression into tokens
+func lex(expression string) ([]token, error) {
+	tokens := make([]token, 0)
+
+	for i := 0; i < len(expression); {
+		c := rune(expression[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			start := i
+			for i < len(expression) && (unicode.IsDigit(rune(expression[i])) || expression[i] == '.') {
+				i++
+			}
+			if i < len(expression) && (expression[i] == 'e' || expression[i] == 'E') {
+				j := i + 1
+				if j < len(expression) && (expression[j] == '+' || expression[j] == '-') {
+					j++
+				}
+				if j < len(expression) && unicode.IsDigit(rune(expression[j])) {
+					i = j
+					for i < len(expression) && unicode.IsDigit(rune(expression[i])) {
+						i++
+					}
+				}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: expression[start:i], position: start})
+		case unicode.IsLetter(c):
+			start := i
+			for i < len(expression) && (unicode.IsLetter(rune(expression[i])) || unicode.IsDigit(rune(expression[i])) || expression[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdentifier, text: expression[start:i], position: start})
+		case strings.ContainsRune("+-*/()[],", c):
+			tokens = append(tokens, token{kind: tokenOperator, text: string(c), position: i})
+			i++
+		default:
+			return nil, syntaxError(expression, i, fmt.Sprintf("unexpected character %q", c))
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, position: len(expression)}), nil
+}
+
+// parser is a recursive descent parser of the metric math grammar:
+//
+//	expression = term { ("+" | "-") term }
+//	term       = unary { ("*" | "/") unary }
+//	unary      = "-" unary | primary
+//	primary    = number | id | function "(" arguments ")" | "(" expression ")"
+//	arguments  = argument { "," argument }
+//	argument   = expression | "[" expression { "," expression } "]"
+type parser struct {
+	expression string
+	tokens     []token
+	next       int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+	}
+	return t
+}
+
+func (p *parser) accept(operator string) bool {
+	if t := p.peek(); t.kind == tokenOperator && t.text == operator {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(operator string) error {
+	if !p.accept(operator) {
+		return p.unexpected("expected " + strconv.Quote(operator))
+	}
+	return nil
+}
+
+func (p *parser) unexpected(message string) error {
+	t := p.peek()
+	if t.kind == tokenEOF {
+		return syntaxError(p.expression, t.position, message+", found the end of the expression")
+	}
+	return syntaxError(p.expression, t.position, fmt.Sprintf("%s, found %q", message, t.text))
+}
+
+func (p *parser) parseExpression() (node, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		if t.kind != tokenOperator || t.text != "+" && t.text != "-" {
+			return left, nil
+		}
+		p.advance()
+
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{operator: t.text[0], left: left, right: right}
+	}
+}
+
+func (p *parser) parseTerm() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		if t.kind != tokenOperator || t.text != "*" && t.text != "/" {
+			return left, nil
+		}
+		p.advance()
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{operator: t.text[0], left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.accept("-") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negate{operand: operand}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.peek()
+
+	switch t.kind {
+	case tokenNumber:
+		p.advance()
+		value, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, syntaxError(p.expression, t.position, fmt.Sprintf("invalid number %q", t.text))
+		}
+		return number(value), nil
+	case tokenIdentifier:
+		p.advance()
+		if p.peek().kind == tokenOperator && p.peek().text == "(" {
+			return p.parseCall(t)
+		}
+		if !isID(t.text) {
+			return nil, syntaxError(p.expression, t.position, fmt.Sprintf("invalid ID %q, IDs start with a lowercase letter", t.text))
+		}
+		return reference(t.text), nil
+	case tokenOperator:
+		if p.accept("(") {
+			inner, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		}
+	}
+
+	return nil, p.unexpected("expected a number, an ID, a function or \"(\"")
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	arguments := make([]node, 0)
+	for {
+		var (
+			argument node
+			err      error
+		)
+
+		if p.accept("[") {
+			argument, err = p.parseArray()
+		} else {
+			argument, err = p.parseExpression()
+		}
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, argument)
+
+		if !p.accept(",") {
+			break
+		}
+	}
+
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	return newCall(p.expression, name, arguments)
+}
+
+func (p *parser) parseArray() (node, error) {
+	elements := make(array, 0)
+	for {
+		element, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+
+		if !p.accept(",") {
+			break
+		}
+	}
+
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+
+	return elements, nil
+}
+
+// newCall checks the arguments of the supported functions
+func newCall(expression string, name token, arguments []node) (node, error) {
+	switch name.text {
+	case "FILL":
+		if len(arguments) != 2 {
+			return nil, syntaxError(expression, name.position, "FILL takes a series and a value")
+		}
+		if _, ok := arguments[0].(array); ok {
+			return nil, syntaxError(expression, name.position, "FILL takes a single series, not an array")
+		}
+		if _, ok := constant(arguments[1]); !ok {
+			return nil, syntaxError(expression, name.position, "FILL only supports a constant fill value")
+		}
+	case "MAX":
+		if len(arguments) != 1 {
+			return nil, syntaxError(expression, name.position, "MAX takes a single series or an array of series")
+		}
+	default:
+		return nil, syntaxError(expression, name.position, fmt.Sprintf("unsupported function %q", name.text))
+	}
+
+	return call{name: name.text, arguments: arguments}, nil
+}
+
+// constant returns the value of a number or a negated number
+func constant(n node) (float64, bool) {
+	switch n := n.(type) {
+	case number:
+		return float64(n), true
+	case negate:
+		value, ok := constant(n.operand)
+		return -value, ok
+	}
+	return 0, false
+}
+
+// isID checks if the name is a valid query ID, a lowercase letter followed by letters, digits and underscores
+func isID(name string) bool {
+	if name == "" || !unicode.IsLower(rune(name[0])) {
+		return false
+	}
+
+	for _, c := range name {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' {
+			return false
+		}
+	}
+
+	return true
+}
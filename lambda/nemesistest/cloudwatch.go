@@ -0,0 +1,373 @@
+package nemesistest
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"sort"
+	"time"
+)
+
+// Alarm is the state of a fake cloudwatch alarm
+type Alarm struct {
+	// Definition is the last PutMetricAlarm input of the alarm
+	Definition  cloudwatch.PutMetricAlarmInput
+	Arn         string
+	State       types.StateValue
+	StateReason string
+	Tags        map[string]string
+}
+
+// CloudWatch is a stateful in-memory fake of the cloudwatch alarm and metric data API
+type CloudWatch struct {
+	calls
+
+	alarms  map[string]*Alarm
+	metrics map[string]map[time.Time]float64
+}
+
+// NewCloudWatch returns an empty fake
+func NewCloudWatch() *CloudWatch {
+	return &CloudWatch{
+		alarms:  make(map[string]*Alarm),
+		metrics: make(map[string]map[time.Time]float64),
+	}
+}
+
+// AlarmArn returns the arn the fake gives to the alarm
+func AlarmArn(alarmName string) string {
+	return fmt.Sprintf("arn:aws:cloudwatch:%s:%s:alarm:%s", Region, AccountID, alarmName)
+}
+
+// AddAlarm adds an alarm in the given state with the given tags
+func (c *CloudWatch) AddAlarm(input cloudwatch.PutMetricAlarmInput, state types.StateValue, tags map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	alarm := &Alarm{
+		Definition: input,
+		Arn:        AlarmArn(aws.ToString(input.AlarmName)),
+		State:      state,
+		Tags:       make(map[string]string),
+	}
+	for key, value := range tags {
+		alarm.Tags[key] = value
+	}
+
+	c.alarms[aws.ToString(input.AlarmName)] = alarm
+}
+
+// Alarm returns a copy of the state of the alarm
+func (c *CloudWatch) Alarm(alarmName string) (Alarm, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	alarm, ok := c.alarms[alarmName]
+	if !ok {
+		return Alarm{}, false
+	}
+
+	cp := *alarm
+	cp.Tags = make(map[string]string, len(alarm.Tags))
+	for key, value := range alarm.Tags {
+		cp.Tags[key] = value
+	}
+
+	return cp, true
+}
+
+// DeleteAlarms deletes the alarms with the given names, names without an alarm are ignored
+func (c *CloudWatch) DeleteAlarms(_ context.Context, params *cloudwatch.DeleteAlarmsInput, _ ...func(*cloudwatch.Options)) (*cloudwatch.DeleteAlarmsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.record("DeleteAlarms"); err != nil {
+		return nil, err
+	}
+
+	for _, name := range params.AlarmNames {
+		delete(c.alarms, name)
+	}
+
+	return &cloudwatch.DeleteAlarmsOutput{}, nil
+}
+
+// DescribeAlarms returns the metric alarms with the given names, or all of them when no names are given
+func (c *CloudWatch) DescribeAlarms(_ context.Context, params *cloudwatch.DescribeAlarmsInput, _ ...func(*cloudwatch.Options)) (*cloudwatch.DescribeAlarmsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.record("DescribeAlarms"); err != nil {
+		return nil, err
+	}
+
+	names := params.AlarmNames
+	if len(names) == 0 {
+		for name := range c.alarms {
+			names = append(names, name)
+		}
+	}
+
+	output := &cloudwatch.DescribeAlarmsOutput{}
+	for _, name := range names {
+		alarm, ok := c.alarms[name]
+		if !ok {
+			continue
+		}
+
+		definition := alarm.Definition
+		output.MetricAlarms = append(output.MetricAlarms, types.MetricAlarm{
+			ActionsEnabled:                   definition.ActionsEnabled,
+			AlarmActions:                     definition.AlarmActions,
+			AlarmArn:                         aws.String(alarm.Arn),
+			AlarmDescription:                 definition.AlarmDescription,
+			AlarmName:                        definition.AlarmName,
+			ComparisonOperator:               definition.ComparisonOperator,
+			DatapointsToAlarm:                definition.DatapointsToAlarm,
+			Dimensions:                       definition.Dimensions,
+			EvaluateLowSampleCountPercentile: definition.EvaluateLowSampleCountPercentile,
+			EvaluationPeriods:                definition.EvaluationPeriods,
+			ExtendedStatistic:                definition.ExtendedStatistic,
+			InsufficientDataActions:          definition.InsufficientDataActions,
+			MetricName:                       definition.MetricName,
+			Metrics:                          definition.Metrics,
+			Namespace:                        definition.Namespace,
+			OKActions:                        definition.OKActions,
+			Period:                           definition.Period,
+			StateReason:                      aws.String(alarm.StateReason),
+			StateValue:                       alarm.State,
+			Statistic:                        definition.Statistic,
+			Threshold:                        definition.Threshold,
+			ThresholdMetricId:                definition.ThresholdMetricId,
+			TreatMissingData:                 definition.TreatMissingData,
+			Unit:                             definition.Unit,
+		})
+	}
+
+	return output, nil
+}
+
+// AddMetricData adds raw datapoints of the metric of the stream. GetMetricData aggregates them into the requested
+// periods
+func (c *CloudWatch) AddMetricData(metricName, streamName string, values map[time.Time]float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := metricName + "/" + streamName
+	if c.metrics[key] == nil {
+		c.metrics[key] = make(map[time.Time]float64)
+	}
+	for timestamp, value := range values {
+		c.metrics[key][timestamp.UTC()] = value
+	}
+}
+
+// GetMetricData returns the aggregated datapoints of the MetricStat queries between the start and the end time.
+// Expression queries return no data
+func (c *CloudWatch) GetMetricData(_ context.Context, params *cloudwatch.GetMetricDataInput, _ ...func(*cloudwatch.Options)) (*cloudwatch.GetMetricDataOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.record("GetMetricData"); err != nil {
+		return nil, err
+	}
+
+	output := &cloudwatch.GetMetricDataOutput{}
+
+	for _, query := range params.MetricDataQueries {
+		result := types.MetricDataResult{
+			Id:         query.Id,
+			StatusCode: types.StatusCodeComplete,
+		}
+
+		if query.MetricStat != nil && query.MetricStat.Metric != nil && len(query.MetricStat.Metric.Dimensions) > 0 {
+			metric := query.MetricStat.Metric
+			key := aws.ToString(metric.MetricName) + "/" + aws.ToString(metric.Dimensions[0].Value)
+			period := time.Duration(aws.ToInt32(query.MetricStat.Period)) * time.Second
+
+			buckets := make(map[time.Time][]float64)
+			for timestamp, value := range c.metrics[key] {
+				if timestamp.Before(aws.ToTime(params.StartTime)) || !timestamp.Before(aws.ToTime(params.EndTime)) {
+					continue
+				}
+				bucket := timestamp.Truncate(period)
+				buckets[bucket] = append(buckets[bucket], value)
+			}
+
+			for timestamp := range buckets {
+				result.Timestamps = append(result.Timestamps, timestamp)
+			}
+			sort.Slice(result.Timestamps, func(i, j int) bool {
+				return result.Timestamps[i].Before(result.Timestamps[j])
+			})
+			if params.ScanBy != types.ScanByTimestampAscending {
+				for i, j := 0, len(result.Timestamps)-1; i < j; i, j = i+1, j-1 {
+					result.Timestamps[i], result.Timestamps[j] = result.Timestamps[j], result.Timestamps[i]
+				}
+			}
+
+			for _, timestamp := range result.Timestamps {
+				result.Values = append(result.Values, aggregate(aws.ToString(query.MetricStat.Stat), buckets[timestamp]))
+			}
+		}
+
+		output.MetricDataResults = append(output.MetricDataResults, result)
+	}
+
+	return output, nil
+}
+
+// aggregate applies the cloudwatch statistic to the values of one period
+func aggregate(statistic string, values []float64) float64 {
+	result := values[0]
+
+	for _, value := range values[1:] {
+		switch statistic {
+		case "Maximum":
+			if value > result {
+				result = value
+			}
+		case "Minimum":
+			if value < result {
+				result = value
+			}
+		default:
+			result += value
+		}
+	}
+
+	if statistic == "Average" {
+		result /= float64(len(values))
+	}
+
+	return result
+}
+
+// ListTagsForResource returns the tags of the alarm with the given arn
+func (c *CloudWatch) ListTagsForResource(_ context.Context, params *cloudwatch.ListTagsForResourceInput, _ ...func(*cloudwatch.Options)) (*cloudwatch.ListTagsForResourceOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.record("ListTagsForResource"); err != nil {
+		return nil, err
+	}
+
+	alarm, err := c.alarmByArn(params.ResourceARN)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &cloudwatch.ListTagsForResourceOutput{}
+	for key, value := range alarm.Tags {
+		output.Tags = append(output.Tags, types.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(value),
+		})
+	}
+
+	return output, nil
+}
+
+// PutMetricAlarm creates or overwrites the alarm. New alarms start in INSUFFICIENT_DATA, updated alarms keep their state
+func (c *CloudWatch) PutMetricAlarm(_ context.Context, params *cloudwatch.PutMetricAlarmInput, _ ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricAlarmOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.record("PutMetricAlarm"); err != nil {
+		return nil, err
+	}
+
+	name := aws.ToString(params.AlarmName)
+
+	alarm, ok := c.alarms[name]
+	if !ok {
+		alarm = &Alarm{
+			Arn:   AlarmArn(name),
+			State: types.StateValueInsufficientData,
+			Tags:  make(map[string]string),
+		}
+		for _, tag := range params.Tags {
+			alarm.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+		c.alarms[name] = alarm
+	}
+
+	alarm.Definition = *params
+
+	return &cloudwatch.PutMetricAlarmOutput{}, nil
+}
+
+// SetAlarmState changes the state of the alarm
+func (c *CloudWatch) SetAlarmState(_ context.Context, params *cloudwatch.SetAlarmStateInput, _ ...func(*cloudwatch.Options)) (*cloudwatch.SetAlarmStateOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.record("SetAlarmState"); err != nil {
+		return nil, err
+	}
+
+	alarm, ok := c.alarms[aws.ToString(params.AlarmName)]
+	if !ok {
+		return nil, &types.ResourceNotFound{Message: aws.String("alarm " + aws.ToString(params.AlarmName) + " not found")}
+	}
+
+	alarm.State = params.StateValue
+	alarm.StateReason = aws.ToString(params.StateReason)
+
+	return &cloudwatch.SetAlarmStateOutput{}, nil
+}
+
+// TagResource adds or overwrites the tags of the alarm with the given arn
+func (c *CloudWatch) TagResource(_ context.Context, params *cloudwatch.TagResourceInput, _ ...func(*cloudwatch.Options)) (*cloudwatch.TagResourceOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.record("TagResource"); err != nil {
+		return nil, err
+	}
+
+	alarm, err := c.alarmByArn(params.ResourceARN)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tag := range params.Tags {
+		alarm.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	return &cloudwatch.TagResourceOutput{}, nil
+}
+
+// UntagResource removes the tags with the given keys from the alarm with the given arn
+func (c *CloudWatch) UntagResource(_ context.Context, params *cloudwatch.UntagResourceInput, _ ...func(*cloudwatch.Options)) (*cloudwatch.UntagResourceOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.record("UntagResource"); err != nil {
+		return nil, err
+	}
+
+	alarm, err := c.alarmByArn(params.ResourceARN)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range params.TagKeys {
+		delete(alarm.Tags, key)
+	}
+
+	return &cloudwatch.UntagResourceOutput{}, nil
+}
+
+// alarmByArn returns the alarm or the not found error cloudwatch returns. The caller must hold mu
+func (c *CloudWatch) alarmByArn(arn *string) (*Alarm, error) {
+	for _, alarm := range c.alarms {
+		if alarm.Arn == aws.ToString(arn) {
+			return alarm, nil
+		}
+	}
+
+	return nil, &types.ResourceNotFoundException{Message: aws.String("resource " + aws.ToString(arn) + " not found")}
+}
@@ -0,0 +1,283 @@
+package nemesistest
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"sort"
+	"time"
+)
+
+const (
+	// maxShardCount is the most shards kinesis allows a stream to be updated to
+	maxShardCount = 10000
+	// maxUpdatesPerDay is the number of shard count updates kinesis allows per stream in a rolling 24 hours
+	maxUpdatesPerDay = 10
+)
+
+// Stream is the state of a fake kinesis stream
+type Stream struct {
+	Name       string
+	Arn        string
+	Status     types.StreamStatus
+	ShardCount int
+	// Tags are the tags of the stream
+	Tags map[string]string
+	// Updates are the times of the accepted shard count updates
+	Updates []time.Time
+
+	targetShardCount     int
+	describesUntilActive int
+}
+
+// Kinesis is a stateful in-memory fake of the kinesis API. Shard count updates follow the kinesis rules: the stream
+// must be ACTIVE, the target must be within half and double the open shards and at most 10 updates are accepted per
+// stream in a rolling 24 hours
+type Kinesis struct {
+	calls
+
+	// Now returns the current time for the reshard quota. Defaults to time.Now
+	Now func() time.Time
+	// UpdatingDescribes is the number of DescribeStreamSummary calls a stream stays UPDATING after a shard count
+	// update. With 0 updates are applied immediately
+	UpdatingDescribes int
+
+	streams map[string]*Stream
+}
+
+// NewKinesis returns an empty fake
+func NewKinesis() *Kinesis {
+	return &Kinesis{
+		Now:     time.Now,
+		streams: make(map[string]*Stream),
+	}
+}
+
+// AddStream adds an ACTIVE stream with the given shard count
+func (k *Kinesis) AddStream(name string, shardCount int) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.streams[name] = &Stream{
+		Name:       name,
+		Arn:        fmt.Sprintf("arn:aws:kinesis:%s:%s:stream/%s", Region, AccountID, name),
+		Status:     types.StreamStatusActive,
+		ShardCount: shardCount,
+		Tags:       make(map[string]string),
+	}
+}
+
+// Stream returns a copy of the state of the stream
+func (k *Kinesis) Stream(name string) (Stream, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	stream, ok := k.streams[name]
+	if !ok {
+		return Stream{}, false
+	}
+
+	cp := *stream
+	cp.Tags = make(map[string]string, len(stream.Tags))
+	for key, value := range stream.Tags {
+		cp.Tags[key] = value
+	}
+	cp.Updates = append([]time.Time(nil), stream.Updates...)
+
+	return cp, true
+}
+
+// Settle completes every shard count update in progress
+func (k *Kinesis) Settle() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for _, stream := range k.streams {
+		if stream.Status == types.StreamStatusUpdating {
+			stream.activate()
+		}
+	}
+}
+
+// DescribeStreamSummary returns the summary of the stream and moves UPDATING streams towards ACTIVE
+func (k *Kinesis) DescribeStreamSummary(_ context.Context, params *kinesis.DescribeStreamSummaryInput, _ ...func(*kinesis.Options)) (*kinesis.DescribeStreamSummaryOutput, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if err := k.record("DescribeStreamSummary"); err != nil {
+		return nil, err
+	}
+
+	stream, err := k.stream(params.StreamName)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &types.StreamDescriptionSummary{
+		StreamName:     aws.String(stream.Name),
+		StreamARN:      aws.String(stream.Arn),
+		StreamStatus:   stream.Status,
+		OpenShardCount: aws.Int32(int32(stream.ShardCount)),
+	}
+
+	if stream.Status == types.StreamStatusUpdating {
+		stream.describesUntilActive--
+		if stream.describesUntilActive <= 0 {
+			stream.activate()
+		}
+	}
+
+	return &kinesis.DescribeStreamSummaryOutput{
+		StreamDescriptionSummary: summary,
+	}, nil
+}
+
+// UpdateShardCount validates the update against the kinesis rules and starts it
+func (k *Kinesis) UpdateShardCount(_ context.Context, params *kinesis.UpdateShardCountInput, _ ...func(*kinesis.Options)) (*kinesis.UpdateShardCountOutput, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if err := k.record("UpdateShardCount"); err != nil {
+		return nil, err
+	}
+
+	stream, err := k.stream(params.StreamName)
+	if err != nil {
+		return nil, err
+	}
+
+	if stream.Status != types.StreamStatusActive {
+		return nil, &types.ResourceInUseException{Message: aws.String("stream " + stream.Name + " is " + string(stream.Status))}
+	}
+
+	target := int(aws.ToInt32(params.TargetShardCount))
+	if target < 1 || target > 2*stream.ShardCount || target < (stream.ShardCount+1)/2 || target > maxShardCount {
+		return nil, &types.InvalidArgumentException{Message: aws.String(fmt.Sprintf("invalid target shard count %d for %d open shards", target, stream.ShardCount))}
+	}
+
+	now := k.Now()
+	recent := 0
+	for _, update := range stream.Updates {
+		if update.After(now.Add(-24 * time.Hour)) {
+			recent++
+		}
+	}
+	if recent >= maxUpdatesPerDay {
+		return nil, &types.LimitExceededException{Message: aws.String("shard count update limit exceeded for " + stream.Name)}
+	}
+
+	stream.Updates = append(stream.Updates, now)
+	stream.targetShardCount = target
+
+	if k.UpdatingDescribes == 0 {
+		stream.activate()
+	} else {
+		stream.Status = types.StreamStatusUpdating
+		stream.describesUntilActive = k.UpdatingDescribes
+	}
+
+	return &kinesis.UpdateShardCountOutput{
+		StreamName:        aws.String(stream.Name),
+		CurrentShardCount: aws.Int32(int32(stream.ShardCount)),
+		TargetShardCount:  aws.Int32(int32(target)),
+	}, nil
+}
+
+// ListTagsForStream returns the tags of the stream sorted by key, all in a single page
+func (k *Kinesis) ListTagsForStream(_ context.Context, params *kinesis.ListTagsForStreamInput, _ ...func(*kinesis.Options)) (*kinesis.ListTagsForStreamOutput, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if err := k.record("ListTagsForStream"); err != nil {
+		return nil, err
+	}
+
+	stream, err := k.stream(params.StreamName)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(stream.Tags))
+	for key := range stream.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tags := make([]types.Tag, 0, len(keys))
+	for _, key := range keys {
+		tags = append(tags, types.Tag{Key: aws.String(key), Value: aws.String(stream.Tags[key])})
+	}
+
+	return &kinesis.ListTagsForStreamOutput{
+		HasMoreTags: aws.Bool(false),
+		Tags:        tags,
+	}, nil
+}
+
+// AddTagsToStream adds the tags to the stream. Like kinesis, it requires the stream to be ACTIVE
+func (k *Kinesis) AddTagsToStream(_ context.Context, params *kinesis.AddTagsToStreamInput, _ ...func(*kinesis.Options)) (*kinesis.AddTagsToStreamOutput, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if err := k.record("AddTagsToStream"); err != nil {
+		return nil, err
+	}
+
+	stream, err := k.stream(params.StreamName)
+	if err != nil {
+		return nil, err
+	}
+
+	if stream.Status != types.StreamStatusActive {
+		return nil, &types.ResourceInUseException{Message: aws.String("stream " + stream.Name + " is " + string(stream.Status))}
+	}
+
+	for key, value := range params.Tags {
+		stream.Tags[key] = value
+	}
+
+	return &kinesis.AddTagsToStreamOutput{}, nil
+}
+
+// RemoveTagsFromStream removes the tags from the stream. Like kinesis, it requires the stream to be ACTIVE
+func (k *Kinesis) RemoveTagsFromStream(_ context.Context, params *kinesis.RemoveTagsFromStreamInput, _ ...func(*kinesis.Options)) (*kinesis.RemoveTagsFromStreamOutput, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if err := k.record("RemoveTagsFromStream"); err != nil {
+		return nil, err
+	}
+
+	stream, err := k.stream(params.StreamName)
+	if err != nil {
+		return nil, err
+	}
+
+	if stream.Status != types.StreamStatusActive {
+		return nil, &types.ResourceInUseException{Message: aws.String("stream " + stream.Name + " is " + string(stream.Status))}
+	}
+
+	for _, key := range params.TagKeys {
+		delete(stream.Tags, key)
+	}
+
+	return &kinesis.RemoveTagsFromStreamOutput{}, nil
+}
+
+// stream returns the stream or the not found error kinesis returns. The caller must hold mu
+func (k *Kinesis) stream(name *string) (*Stream, error) {
+	stream, ok := k.streams[aws.ToString(name)]
+	if !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("stream " + aws.ToString(name) + " not found")}
+	}
+
+	return stream, nil
+}
+
+// activate completes the update in progress
+func (s *Stream) activate() {
+	s.ShardCount = s.targetShardCount
+	s.Status = types.StreamStatusActive
+}
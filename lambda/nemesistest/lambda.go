@@ -0,0 +1,142 @@
+package nemesistest
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// EventSourceMapping is the state of a fake event source mapping
+type EventSourceMapping struct {
+	UUID                  string
+	FunctionArn           string
+	EventSourceArn        string
+	ParallelizationFactor int32
+}
+
+// Lambda is a stateful in-memory fake of the event source mappings and the reserved concurrency of the lambda API
+type Lambda struct {
+	calls
+
+	mappings    []*EventSourceMapping
+	concurrency map[string]int32
+}
+
+// NewLambda returns an empty fake
+func NewLambda() *Lambda {
+	return &Lambda{
+		concurrency: make(map[string]int32),
+	}
+}
+
+// AddEventSourceMapping adds a mapping of the function to the event source with the parallelization factor
+func (l *Lambda) AddEventSourceMapping(functionArn, eventSourceArn string, parallelizationFactor int32) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.mappings = append(l.mappings, &EventSourceMapping{
+		UUID:                  fmt.Sprintf("mapping-%d", len(l.mappings)+1),
+		FunctionArn:           functionArn,
+		EventSourceArn:        eventSourceArn,
+		ParallelizationFactor: parallelizationFactor,
+	})
+}
+
+// EventSourceMappings returns a copy of the mappings of the function
+func (l *Lambda) EventSourceMappings(functionArn string) []EventSourceMapping {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	mappings := make([]EventSourceMapping, 0)
+	for _, mapping := range l.mappings {
+		if mapping.FunctionArn == functionArn {
+			mappings = append(mappings, *mapping)
+		}
+	}
+
+	return mappings
+}
+
+// SetReservedConcurrency sets the reserved concurrency of the function, as an operator would
+func (l *Lambda) SetReservedConcurrency(functionArn string, concurrency int32) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.concurrency[functionArn] = concurrency
+}
+
+// ReservedConcurrency returns the reserved concurrency of the function, false when it has none
+func (l *Lambda) ReservedConcurrency(functionArn string) (int32, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	concurrency, ok := l.concurrency[functionArn]
+	return concurrency, ok
+}
+
+// ListEventSourceMappings returns the mappings of the event source and of the function, in a single page
+func (l *Lambda) ListEventSourceMappings(_ context.Context, params *lambda.ListEventSourceMappingsInput, _ ...func(*lambda.Options)) (*lambda.ListEventSourceMappingsOutput, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.record("ListEventSourceMappings"); err != nil {
+		return nil, err
+	}
+
+	output := &lambda.ListEventSourceMappingsOutput{}
+	for _, mapping := range l.mappings {
+		if params.EventSourceArn != nil && aws.ToString(params.EventSourceArn) != mapping.EventSourceArn {
+			continue
+		}
+		if params.FunctionName != nil && aws.ToString(params.FunctionName) != mapping.FunctionArn {
+			continue
+		}
+
+		output.EventSourceMappings = append(output.EventSourceMappings, types.EventSourceMappingConfiguration{
+			UUID:                  aws.String(mapping.UUID),
+			FunctionArn:           aws.String(mapping.FunctionArn),
+			EventSourceArn:        aws.String(mapping.EventSourceArn),
+			ParallelizationFactor: aws.Int32(mapping.ParallelizationFactor),
+		})
+	}
+
+	return output, nil
+}
+
+// UpdateEventSourceMapping sets the parallelization factor of the mapping
+func (l *Lambda) UpdateEventSourceMapping(_ context.Context, params *lambda.UpdateEventSourceMappingInput, _ ...func(*lambda.Options)) (*lambda.UpdateEventSourceMappingOutput, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.record("UpdateEventSourceMapping"); err != nil {
+		return nil, err
+	}
+
+	for _, mapping := range l.mappings {
+		if mapping.UUID != aws.ToString(params.UUID) {
+			continue
+		}
+		if params.ParallelizationFactor != nil {
+			mapping.ParallelizationFactor = aws.ToInt32(params.ParallelizationFactor)
+		}
+		return &lambda.UpdateEventSourceMappingOutput{UUID: params.UUID}, nil
+	}
+
+	return nil, &types.ResourceNotFoundException{Message: aws.String("event source mapping not found")}
+}
+
+// PutFunctionConcurrency sets the reserved concurrency of the function
+func (l *Lambda) PutFunctionConcurrency(_ context.Context, params *lambda.PutFunctionConcurrencyInput, _ ...func(*lambda.Options)) (*lambda.PutFunctionConcurrencyOutput, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.record("PutFunctionConcurrency"); err != nil {
+		return nil, err
+	}
+
+	l.concurrency[aws.ToString(params.FunctionName)] = aws.ToInt32(params.ReservedConcurrentExecutions)
+
+	return &lambda.PutFunctionConcurrencyOutput{ReservedConcurrentExecutions: params.ReservedConcurrentExecutions}, nil
+}
@@ -0,0 +1,69 @@
+// Package nemesistest contains stateful in-memory fakes of the AWS APIs that Nemesis uses, so that scaling scenarios
+// can be tested without AWS
+package nemesistest
+
+import (
+	"sync"
+)
+
+const (
+	// Region is the region of the fake resources
+	Region = "us-east-1"
+	// AccountID is the account of the fake resources
+	AccountID = "123456789012"
+)
+
+// calls records the API calls made against a fake and the errors they should fail with
+type calls struct {
+	mu sync.Mutex
+	// Errors makes the named operation, e.g. PutMetricAlarm, fail with the error until it is removed
+	Errors map[string]error
+	names  []string
+}
+
+// record records a call to the operation and returns the error it should fail with. The caller must hold mu
+func (c *calls) record(operation string) error {
+	c.names = append(c.names, operation)
+
+	return c.Errors[operation]
+}
+
+// FailOn makes every following call to the operation fail with err. A nil err removes the failure
+func (c *calls) FailOn(operation string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Errors == nil {
+		c.Errors = make(map[string]error)
+	}
+
+	if err == nil {
+		delete(c.Errors, operation)
+		return
+	}
+
+	c.Errors[operation] = err
+}
+
+// Calls returns the names of the operations called so far, in order
+func (c *calls) Calls() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string(nil), c.names...)
+}
+
+// CallCount returns how many times the operation was called
+func (c *calls) CallCount(operation string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	count := 0
+	for _, name := range c.names {
+		if name == operation {
+			count++
+		}
+	}
+
+	return count
+}
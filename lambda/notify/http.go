@@ -0,0 +1,118 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// httpClient is shared by the slack and webhook notifiers
+var httpClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+// SlackNotifier posts messages to a Slack incoming webhook
+type SlackNotifier struct {
+	url string
+}
+
+// NewSlackNotifier creates a notifier for the Slack incoming webhook URL
+func NewSlackNotifier(url string) *SlackNotifier {
+	return &SlackNotifier{
+		url: url,
+	}
+}
+
+// Notify posts the message text to the incoming webhook
+func (n *SlackNotifier) Notify(ctx context.Context, message Message) error {
+	body, err := json.Marshal(map[string]string{
+		"text": message.Text(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return post(ctx, n.url, bytes.NewReader(body), nil)
+}
+
+// WebhookNotifier posts messages as JSON to a generic webhook
+type WebhookNotifier struct {
+	url      string
+	template *template.Template
+	headers  map[string]string
+}
+
+// NewWebhookNotifier creates a notifier for the webhook URL. When body is empty the message is posted as JSON,
+// otherwise body is parsed as a text/template that is executed with the message
+func NewWebhookNotifier(url, body string, headers map[string]string) (*WebhookNotifier, error) {
+	notifier := &WebhookNotifier{
+		url:     url,
+		headers: headers,
+	}
+
+	if body != "" {
+		tmpl, err := template.New("webhook").Funcs(template.FuncMap{
+			"json": func(v interface{}) (string, error) {
+				b, err := json.Marshal(v)
+				return string(b), err
+			},
+		}).Parse(body)
+		if err != nil {
+			return nil, err
+		}
+		notifier.template = tmpl
+	}
+
+	return notifier, nil
+}
+
+// Notify posts the rendered message to the webhook
+func (n *WebhookNotifier) Notify(ctx context.Context, message Message) error {
+	var body bytes.Buffer
+
+	if n.template == nil {
+		err := json.NewEncoder(&body).Encode(message)
+		if err != nil {
+			return err
+		}
+	} else {
+		err := n.template.Execute(&body, message)
+		if err != nil {
+			return err
+		}
+	}
+
+	return post(ctx, n.url, &body, n.headers)
+}
+
+// post sends a JSON body to the URL and fails on any non 2xx response
+func post(ctx context.Context, url string, body io.Reader, headers map[string]string) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		responseBody, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("notification endpoint returned %s: %s", response.Status, responseBody)
+	}
+
+	return nil
+}
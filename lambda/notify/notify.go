@@ -0,0 +1,197 @@
+// Package notify contains the notifiers that tell people about scaling actions taken by Nemesis
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vmanikes/Nemesis/logging"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Severity is the severity of a notification
+type Severity string
+
+const (
+	// SeverityInfo is used for scaling actions that were applied
+	SeverityInfo Severity = "info"
+	// SeverityError is used for scaling actions that failed
+	SeverityError Severity = "error"
+	// SeverityWarning is used for scaling actions that were held back because the stream is flapping
+	SeverityWarning Severity = "warning"
+)
+
+// Message is a single notification about a scaling action
+type Message struct {
+	Severity          Severity      `json:"severity"`
+	StreamName        string        `json:"streamName"`
+	Action            string        `json:"action"`
+	Outcome           string        `json:"outcome"`
+	ShardCount        int           `json:"shardCount"`
+	TargetShardCount  int           `json:"targetShardCount"`
+	Reason            string        `json:"reason"`
+	Error             string        `json:"error,omitempty"`
+	UsageFactor       float64       `json:"usageFactor"`
+	CooldownRemaining time.Duration `json:"cooldownRemaining"`
+	RequestID         string        `json:"requestId,omitempty"`
+	Timestamp         time.Time     `json:"timestamp"`
+}
+
+// Subject returns a one line summary of the message
+func (m Message) Subject() string {
+	return fmt.Sprintf("Nemesis scale-%s %s for %s", m.Action, m.Outcome, m.StreamName)
+}
+
+// Text returns the concise human readable body of the message
+func (m Message) Text() string {
+	text := fmt.Sprintf("[%s] %s: %d -> %d shards (scale-%s %s). Reason: %s. Usage factor: %.3f. Cooldown remaining: %s.",
+		m.Severity, m.StreamName, m.ShardCount, m.TargetShardCount, m.Action, m.Outcome, m.Reason, m.UsageFactor,
+		m.CooldownRemaining.Round(time.Second))
+	if m.Error != "" {
+		text += " Error: " + m.Error
+	}
+
+	return text
+}
+
+// Notifier sends a message to a single channel
+type Notifier interface {
+	Notify(ctx context.Context, message Message) error
+}
+
+// Channel configures a single notification channel and the messages that are sent to it
+type Channel struct {
+	// Type is one of sns, slack or webhook
+	Type string `json:"type"`
+	// Target is the topic ARN for sns and the URL for slack and webhook
+	Target string `json:"target"`
+	// Template is an optional text/template for the webhook body. The message is the template data
+	Template string `json:"template,omitempty"`
+	// Headers are extra HTTP headers for the webhook request
+	Headers map[string]string `json:"headers,omitempty"`
+	// Streams limits the channel to the given streams. All streams are sent when empty
+	Streams []string `json:"streams,omitempty"`
+	// Severities limits the channel to the given severities. All severities are sent when empty
+	Severities []Severity `json:"severities,omitempty"`
+}
+
+// Matches checks if the message should be sent to the channel
+func (c Channel) Matches(message Message) bool {
+	severities := make([]string, 0, len(c.Severities))
+	for _, severity := range c.Severities {
+		severities = append(severities, string(severity))
+	}
+
+	return matchesAny(c.Streams, message.StreamName) && matchesAny(severities, string(message.Severity))
+}
+
+// Validate checks the channel without creating its notifier
+func (c Channel) Validate() error {
+	switch c.Type {
+	case "sns", "slack":
+	case "webhook":
+		if _, err := NewWebhookNotifier(c.Target, c.Template, c.Headers); err != nil {
+			return fmt.Errorf("invalid webhook template: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported notification channel type %q, expected sns, slack or webhook", c.Type)
+	}
+
+	if c.Target == "" {
+		return errors.New("a notification channel needs a target")
+	}
+
+	for _, severity := range c.Severities {
+		switch severity {
+		case SeverityInfo, SeverityWarning, SeverityError:
+		default:
+			return fmt.Errorf("unknown severity %q, expected info, warning or error", severity)
+		}
+	}
+
+	return nil
+}
+
+// Dispatcher sends messages to every configured channel that matches them
+type Dispatcher struct {
+	channels  []Channel
+	notifiers []Notifier
+}
+
+// New creates the notifiers for the channels and returns a dispatcher for them
+func New(ctx context.Context, channels []Channel) (*Dispatcher, error) {
+	logger := logging.WithContext(ctx)
+
+	dispatcher := &Dispatcher{}
+
+	for _, channel := range channels {
+		var (
+			notifier Notifier
+			err      error
+		)
+
+		switch channel.Type {
+		case "sns":
+			notifier, err = NewSNSNotifier(ctx, channel.Target)
+		case "slack":
+			notifier = NewSlackNotifier(channel.Target)
+		case "webhook":
+			notifier, err = NewWebhookNotifier(channel.Target, channel.Template, channel.Headers)
+		default:
+			err = errors.New("unsupported notification channel type")
+			logger.Error(err.Error(),
+				zap.String("type", channel.Type))
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		dispatcher.channels = append(dispatcher.channels, channel)
+		dispatcher.notifiers = append(dispatcher.notifiers, notifier)
+	}
+
+	return dispatcher, nil
+}
+
+// Notify sends the message to every matching channel. A failing channel does not stop the others, the first error is
+// returned
+func (d *Dispatcher) Notify(ctx context.Context, message Message) error {
+	logger := logging.WithContext(ctx)
+
+	var firstErr error
+
+	for i, channel := range d.channels {
+		if !channel.Matches(message) {
+			continue
+		}
+
+		err := d.notifiers[i].Notify(ctx, message)
+		if err != nil {
+			logger.Error("unable to send notification",
+				zap.String("type", channel.Type),
+				zap.String("target", channel.Target),
+				zap.Error(err))
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// matchesAny returns true when the filter is empty or contains the value
+func matchesAny(filter []string, value string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+
+	for _, f := range filter {
+		if f == value {
+			return true
+		}
+	}
+
+	return false
+}
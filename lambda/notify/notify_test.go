@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+var testMessage = Message{
+	Severity:          SeverityInfo,
+	StreamName:        "test-stream",
+	Action:            "Up",
+	Outcome:           "Applied",
+	ShardCount:        2,
+	TargetShardCount:  4,
+	Reason:            "stream resharded and alarms updated",
+	UsageFactor:       0.8,
+	CooldownRemaining: 5 * time.Minute,
+}
+
+// recorder is a local stand-in for the notification endpoints that keeps the last request body
+type recorder struct {
+	server  *httptest.Server
+	body    []byte
+	headers http.Header
+}
+
+func newRecorder(t *testing.T, response string) *recorder {
+	r := &recorder{}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.body, _ = ioutil.ReadAll(req.Body)
+		r.headers = req.Header
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(r.server.Close)
+
+	return r
+}
+
+func TestMessage_Text(t *testing.T) {
+	assert.Equal(t, "[info] test-stream: 2 -> 4 shards (scale-Up Applied). Reason: stream resharded and alarms updated. "+
+		"Usage factor: 0.800. Cooldown remaining: 5m0s.", testMessage.Text())
+}
+
+func TestSlackNotifier_Notify(t *testing.T) {
+	r := newRecorder(t, "ok")
+
+	err := NewSlackNotifier(r.server.URL).Notify(context.Background(), testMessage)
+	assert.NoError(t, err)
+
+	var body map[string]string
+	assert.NoError(t, json.Unmarshal(r.body, &body))
+	assert.Equal(t, testMessage.Text(), body["text"])
+}
+
+func TestWebhookNotifier_Notify(t *testing.T) {
+	r := newRecorder(t, "")
+
+	notifier, err := NewWebhookNotifier(r.server.URL, "", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, notifier.Notify(context.Background(), testMessage))
+
+	var body Message
+	assert.NoError(t, json.Unmarshal(r.body, &body))
+	assert.Equal(t, testMessage, body)
+}
+
+func TestWebhookNotifier_Notify_Template(t *testing.T) {
+	r := newRecorder(t, "")
+
+	notifier, err := NewWebhookNotifier(r.server.URL,
+		`{"summary": {{ json .Subject }}, "shards": {{ .TargetShardCount }}}`,
+		map[string]string{"Authorization": "Bearer token"})
+	assert.NoError(t, err)
+	assert.NoError(t, notifier.Notify(context.Background(), testMessage))
+
+	assert.JSONEq(t, `{"summary": "Nemesis scale-Up Applied for test-stream", "shards": 4}`, string(r.body))
+	assert.Equal(t, "Bearer token", r.headers.Get("Authorization"))
+}
+
+func TestWebhookNotifier_Notify_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	notifier, err := NewWebhookNotifier(server.URL, "", nil)
+	assert.NoError(t, err)
+	assert.Error(t, notifier.Notify(context.Background(), testMessage))
+}
+
+func TestSNSNotifier_Notify(t *testing.T) {
+	r := newRecorder(t, `<PublishResponse xmlns="http://sns.amazonaws.com/doc/2010-03-31/">
+  <PublishResult><MessageId>message-id</MessageId></PublishResult>
+  <ResponseMetadata><RequestId>request-id</RequestId></ResponseMetadata>
+</PublishResponse>`)
+
+	client := sns.New(sns.Options{
+		Region:           "us-east-1",
+		Credentials:      aws.AnonymousCredentials{},
+		EndpointResolver: sns.EndpointResolverFromURL(r.server.URL),
+	})
+
+	err := NewSNSNotifierFromClient(client, "arn:aws:sns:us-east-1:321434131231:nemesis").Notify(context.Background(), testMessage)
+	assert.NoError(t, err)
+
+	form, err := url.ParseQuery(string(r.body))
+	assert.NoError(t, err)
+	assert.Equal(t, "Publish", form.Get("Action"))
+	assert.Equal(t, "arn:aws:sns:us-east-1:321434131231:nemesis", form.Get("TopicArn"))
+	assert.Equal(t, testMessage.Text(), form.Get("Message"))
+}
+
+func TestDispatcher_Notify(t *testing.T) {
+	all := newRecorder(t, "")
+	errorsOnly := newRecorder(t, "")
+	otherStream := newRecorder(t, "")
+
+	dispatcher, err := New(context.Background(), []Channel{
+		{Type: "slack", Target: all.server.URL},
+		{Type: "slack", Target: errorsOnly.server.URL, Severities: []Severity{SeverityError}},
+		{Type: "webhook", Target: otherStream.server.URL, Streams: []string{"other-stream"}},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, dispatcher.Notify(context.Background(), testMessage))
+
+	assert.NotEmpty(t, all.body)
+	assert.Empty(t, errorsOnly.body)
+	assert.Empty(t, otherStream.body)
+}
+
+func TestNew_UnsupportedType(t *testing.T) {
+	_, err := New(context.Background(), []Channel{{Type: "pager", Target: "x"}})
+	assert.Error(t, err)
+}
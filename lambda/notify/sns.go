@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/vmanikes/Nemesis/accounts"
+	"github.com/vmanikes/Nemesis/clients"
+	"github.com/vmanikes/Nemesis/logging"
+	"go.uber.org/zap"
+)
+
+// SNSAPI is the part of the sns API that Nemesis uses
+type SNSAPI interface {
+	Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// SNSNotifier publishes messages to an SNS topic
+type SNSNotifier struct {
+	topicArn  string
+	snsClient SNSAPI
+}
+
+// NewSNSNotifier creates a notifier that publishes to the given topic
+func NewSNSNotifier(ctx context.Context, topicArn string) (*SNSNotifier, error) {
+	logger := logging.WithContext(ctx)
+
+	cfg, err := clients.Default().Config(ctx, accounts.Target{})
+	if err != nil {
+		logger.Error("unable to load the default config for aws")
+		return nil, err
+	}
+
+	return NewSNSNotifierFromClient(sns.NewFromConfig(cfg), topicArn), nil
+}
+
+// NewSNSNotifierFromClient creates a notifier that publishes to the given topic with an existing client
+func NewSNSNotifierFromClient(snsClient SNSAPI, topicArn string) *SNSNotifier {
+	return &SNSNotifier{
+		topicArn:  topicArn,
+		snsClient: snsClient,
+	}
+}
+
+// Notify publishes the message to the topic
+func (n *SNSNotifier) Notify(ctx context.Context, message Message) error {
+	logger := logging.WithContext(ctx)
+
+	subject := message.Subject()
+	// SNS subjects are limited to 100 characters
+	if len(subject) > 100 {
+		subject = subject[:100]
+	}
+
+	_, err := n.snsClient.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(n.topicArn),
+		Subject:  aws.String(subject),
+		Message:  aws.String(message.Text()),
+	})
+	if err != nil {
+		logger.Error("unable to publish notification",
+			zap.String("topic-arn", n.topicArn),
+			zap.Error(err))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+// Package policy contains the declarative scaling policy documents. A document holds one policy per stream or group
+// of streams, along with a default policy for every stream, in YAML or JSON. It is loaded from a local file, an S3
+// object or an SSM parameter and validated against the schema of its fields, with the line of every error
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/vmanikes/Nemesis/freeze"
+	"github.com/vmanikes/Nemesis/notify"
+	"github.com/vmanikes/Nemesis/scaling"
+	"github.com/vmanikes/Nemesis/schedule"
+	"gopkg.in/yaml.v3"
+	"sync"
+	"time"
+)
+
+// Version is the version of the document format
+const Version = 1
+
+// Document is a scaling policy document
+type Document struct {
+	Version  int      `json:"version"`
+	Policies []Policy `json:"policies"`
+}
+
+// Policy is the scaling policy of a group of streams, or of every stream when it lists none. The policy of a group of
+// streams overrides the thresholds, periods, datapoints, iterator age block, bounds and cooldowns of the default policy
+// that it sets
+type Policy struct {
+	Name string `json:"name"`
+	// Streams are the names of the streams the policy applies to. The policy without streams is the default policy
+	Streams    []string    `json:"streams,omitempty"`
+	Thresholds *Thresholds `json:"thresholds,omitempty"`
+	Periods    *Periods    `json:"periods,omitempty"`
+	Datapoints *Datapoints `json:"datapoints,omitempty"`
+	// IteratorAgeBlockMinutes is the iterator age above which the scale-down alarm does not fire
+	IteratorAgeBlockMinutes int64                   `json:"iteratorAgeBlockMinutes,omitempty"`
+	Bounds                  *Bounds                 `json:"bounds,omitempty"`
+	Cooldowns               *scaling.Cooldowns      `json:"cooldowns,omitempty"`
+	Strategy                *scaling.StrategyConfig `json:"strategy,omitempty"`
+	Schedules               []schedule.Rule         `json:"schedules,omitempty"`
+	Notifications           []notify.Channel        `json:"notifications,omitempty"`
+	Freezes                 []freeze.Window         `json:"freezes,omitempty"`
+}
+
+// Thresholds are the usage factors that make the alarms fire
+type Thresholds struct {
+	ScaleUp   float64 `json:"scaleUp"`
+	ScaleDown float64 `json:"scaleDown"`
+}
+
+// Periods are the period of the alarm metrics and the windows the alarms evaluate
+type Periods struct {
+	ScalePeriodMinutes         int64 `json:"scalePeriodMinutes"`
+	ScaleUpEvaluationMinutes   int64 `json:"scaleUpEvaluationMinutes"`
+	ScaleDownEvaluationMinutes int64 `json:"scaleDownEvaluationMinutes"`
+}
+
+// Datapoints are the number of breaching datapoints that make the alarms fire
+type Datapoints struct {
+	ScaleUp   int64 `json:"scaleUp"`
+	ScaleDown int64 `json:"scaleDown"`
+}
+
+// Bounds are the shard counts the streams are scaled within
+type Bounds struct {
+	MinShardCount int `json:"minShardCount"`
+	MaxShardCount int `json:"maxShardCount"`
+}
+
+// Default returns the default policy of the document
+func (d *Document) Default() (Policy, bool) {
+	for _, policy := range d.Policies {
+		if len(policy.Streams) == 0 {
+			return policy, true
+		}
+	}
+	return Policy{}, false
+}
+
+// cacheTTL is how long a loaded document is reused, so that warm Lambda invocations do not read it every time
+const cacheTTL = time.Minute
+
+type cached struct {
+	document *Document
+	loadedAt time.Time
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = make(map[string]cached)
+)
+
+// Load reads, parses and validates the document at the source: a local path, file://<path>, s3://<bucket>/<key> or
+// ssm:<parameter name>. The document is reused for a minute
+func Load(ctx context.Context, source string) (*Document, error) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	if entry, ok := cache[source]; ok && time.Since(entry.loadedAt) < cacheTTL {
+		return entry.document, nil
+	}
+
+	body, err := Read(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := Parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	cache[source] = cached{document: document, loadedAt: time.Now()}
+
+	return document, nil
+}
+
+// Parse parses the document from YAML or JSON and validates it. The errors are of type Errors, with the line and
+// column of every error
+func Parse(body []byte) (*Document, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(body, &root); err != nil {
+		return nil, syntaxError(err)
+	}
+	if len(root.Content) == 0 {
+		return nil, Errors{{Line: 1, Column: 1, Message: "the document is empty"}}
+	}
+
+	paths := make(map[string]*yaml.Node)
+	if errs := checkSchema(root.Content[0], documentType, "", paths); len(errs) > 0 {
+		return nil, errs
+	}
+
+	// The schema check guarantees the document decodes into the types
+	var value interface{}
+	if err := root.Content[0].Decode(&value); err != nil {
+		return nil, syntaxError(err)
+	}
+	body, err := json.Marshal(value)
+	if err != nil {
+		return nil, Errors{{Line: 1, Column: 1, Message: err.Error()}}
+	}
+
+	document := &Document{}
+	if err = json.Unmarshal(body, document); err != nil {
+		return nil, Errors{{Line: 1, Column: 1, Message: err.Error()}}
+	}
+
+	if errs := document.validate(paths); len(errs) > 0 {
+		return nil, errs
+	}
+
+	return document, nil
+}
@@ -0,0 +1,295 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmanikes/Nemesis/notify"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const validPolicy = `version: 1
+policies:
+  - name: default
+    thresholds:
+      scaleUp: 0.25
+      scaleDown: 0.075
+    periods:
+      scalePeriodMinutes: 5
+      scaleUpEvaluationMinutes: 25
+      scaleDownEvaluationMinutes: 300
+    datapoints:
+      scaleUp: 5
+      scaleDown: 57
+    bounds:
+      minShardCount: 1
+      maxShardCount: 64
+    cooldowns:
+      scaleUpMinutes: 5
+  - name: checkout
+    streams: [orders, payments]
+    strategy:
+      name: targetTracking
+      parameters:
+        targetUsageFactor: 0.2
+    schedules:
+      - name: black-friday
+        from: 2026-11-27T00:00:00Z
+        to: 2026-11-28T00:00:00Z
+        minShardCount: 32
+    notifications:
+      - type: slack
+        target: https://hooks.slack.com/services/x
+        severities: [error]
+    freezes:
+      - until: 2026-12-01T00:00:00Z
+        reason: migration
+`
+
+func TestParse(t *testing.T) {
+	document, err := Parse([]byte(validPolicy))
+	assert.NoError(t, err)
+	assert.Len(t, document.Policies, 2)
+
+	defaultPolicy, ok := document.Default()
+	assert.True(t, ok)
+	assert.Equal(t, "default", defaultPolicy.Name)
+	assert.Equal(t, &Bounds{MinShardCount: 1, MaxShardCount: 64}, defaultPolicy.Bounds)
+	assert.Equal(t, 5, defaultPolicy.Cooldowns.ScaleUpMinutes)
+
+	checkout := document.Policies[1]
+	assert.Equal(t, []string{"orders", "payments"}, checkout.Streams)
+	assert.Equal(t, "targetTracking", checkout.Strategy.Name)
+	assert.JSONEq(t, `{"targetUsageFactor": 0.2}`, string(checkout.Strategy.Parameters))
+	assert.Equal(t, 32, checkout.Schedules[0].MinShardCount)
+	assert.Equal(t, []notify.Severity{notify.SeverityError}, checkout.Notifications[0].Severities)
+	assert.Equal(t, "migration", checkout.Freezes[0].Reason)
+}
+
+func TestParse_JSON(t *testing.T) {
+	document, err := Parse([]byte(`{
+  "version": 1,
+  "policies": [
+    {"name": "default", "bounds": {"minShardCount": 2, "maxShardCount": 8}},
+    {"name": "batch", "streams": ["batch"], "strategy": {"name": "step"}}
+  ]
+}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, document.Policies[0].Bounds.MinShardCount)
+	assert.Equal(t, "step", document.Policies[1].Strategy.Name)
+}
+
+func TestParse_SchemaErrors(t *testing.T) {
+	_, err := Parse([]byte(`version: 1
+policies:
+  - name: default
+    thresholds:
+      scaleUp: high
+      scaleDown: 0.075
+    colldowns: {}
+    streams: orders
+`))
+
+	var errs Errors
+	assert.True(t, errors.As(err, &errs))
+	assert.Len(t, errs, 3)
+
+	assert.Equal(t, 5, errs[0].Line)
+	assert.Equal(t, 16, errs[0].Column)
+	assert.Equal(t, "policies[0].thresholds.scaleUp", errs[0].Path)
+	assert.Equal(t, "expected a number", errs[0].Message)
+
+	assert.Equal(t, 7, errs[1].Line)
+	assert.Contains(t, errs[1].Message, `unknown field "colldowns"`)
+
+	assert.Equal(t, 8, errs[2].Line)
+	assert.Equal(t, "expected a list", errs[2].Message)
+}
+
+func TestParse_SyntaxError(t *testing.T) {
+	_, err := Parse([]byte("version: 1\npolicies:\n  - name: [default\n"))
+
+	var errs Errors
+	assert.True(t, errors.As(err, &errs))
+	assert.Len(t, errs, 1)
+	assert.NotZero(t, errs[0].Line)
+
+	_, err = Parse([]byte(""))
+	assert.EqualError(t, err, "line 1, column 1: the document is empty")
+}
+
+func TestParse_ValidationErrors(t *testing.T) {
+	_, err := Parse([]byte(`version: 2
+policies:
+  - name: default
+    bounds:
+      minShardCount: 4
+      maxShardCount: 2
+  - name: checkout
+    streams: [orders]
+    datapoints:
+      scaleUp: 7
+      scaleDown: 57
+    strategy:
+      name: fastest
+  - name: checkout
+    streams: [orders]
+    notifications:
+      - type: pager
+        target: x
+`))
+
+	var errs Errors
+	assert.True(t, errors.As(err, &errs))
+
+	lines := make([]int, 0, len(errs))
+	paths := make([]string, 0, len(errs))
+	for _, e := range errs {
+		lines = append(lines, e.Line)
+		paths = append(paths, e.Path)
+	}
+	assert.Equal(t, []int{1, 6, 10, 13, 14, 15, 17}, lines)
+	assert.Equal(t, []string{
+		"version",
+		"policies[0].bounds.maxShardCount",
+		"policies[1].datapoints.scaleUp",
+		"policies[1].strategy",
+		"policies[2].name",
+		"policies[2].streams[0]",
+		"policies[2].notifications[0]",
+	}, paths)
+	assert.Equal(t, "7 datapoints are not between 1 and the 5 evaluation periods", errs[2].Message)
+	assert.Contains(t, errs[5].Message, `stream orders is already in policy "checkout"`)
+}
+
+func TestRead(t *testing.T) {
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(validPolicy), 0644))
+
+	body, err := Read(ctx, path)
+	assert.NoError(t, err)
+	assert.Equal(t, validPolicy, string(body))
+
+	body, err = Read(ctx, "file://"+path)
+	assert.NoError(t, err)
+	assert.Equal(t, validPolicy, string(body))
+
+	_, err = Read(ctx, filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+type fakeS3 struct {
+	objects map[string]string
+}
+
+func (f *fakeS3) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	body, ok := f.objects[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)]
+	if !ok {
+		return nil, errors.New("NoSuchKey")
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+func TestReadS3(t *testing.T) {
+	ctx := context.Background()
+	api := &fakeS3{objects: map[string]string{"config-bucket/nemesis/policy.yaml": validPolicy}}
+
+	body, err := ReadS3(ctx, api, "s3://config-bucket/nemesis/policy.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, validPolicy, string(body))
+
+	_, err = ReadS3(ctx, api, "s3://config-bucket/missing.yaml")
+	assert.Error(t, err)
+
+	_, err = ReadS3(ctx, api, "s3://config-bucket")
+	assert.EqualError(t, err, "invalid scaling policy source s3://config-bucket, expected s3://<bucket>/<key>")
+}
+
+type fakeSSM struct {
+	parameters map[string]string
+	decrypted  bool
+}
+
+func (f *fakeSSM) GetParameter(_ context.Context, params *ssm.GetParameterInput, _ ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	f.decrypted = params.WithDecryption
+	value, ok := f.parameters[aws.ToString(params.Name)]
+	if !ok {
+		return nil, errors.New("ParameterNotFound")
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssmtypes.Parameter{Value: aws.String(value)}}, nil
+}
+
+func TestReadSSM(t *testing.T) {
+	ctx := context.Background()
+	api := &fakeSSM{parameters: map[string]string{"/nemesis/policy": validPolicy}}
+
+	body, err := ReadSSM(ctx, api, "ssm:/nemesis/policy")
+	assert.NoError(t, err)
+	assert.Equal(t, validPolicy, string(body))
+	assert.True(t, api.decrypted)
+
+	body, err = ReadSSM(ctx, api, "ssm:///nemesis/policy")
+	assert.NoError(t, err)
+	assert.Equal(t, validPolicy, string(body))
+
+	_, err = ReadSSM(ctx, api, "ssm:/nemesis/missing")
+	assert.Error(t, err)
+
+	_, err = ReadSSM(ctx, api, "ssm:")
+	assert.Error(t, err)
+}
+
+func TestParse_PeriodsWithoutDatapoints(t *testing.T) {
+	// 2 evaluation periods do not fit the 5 scale-up datapoints of the constants
+	_, err := Parse([]byte(`version: 1
+policies:
+  - name: default
+    periods:
+      scalePeriodMinutes: 10
+      scaleUpEvaluationMinutes: 20
+      scaleDownEvaluationMinutes: 600
+`))
+
+	var errs Errors
+	assert.True(t, errors.As(err, &errs))
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "policies[0].periods.scaleUpEvaluationMinutes", errs[0].Path)
+	assert.Equal(t, "5 datapoints are not between 1 and the 2 evaluation periods", errs[0].Message)
+	assert.Equal(t, 6, errs[0].Line)
+}
+
+func TestParse_StreamPolicyInheritsPeriods(t *testing.T) {
+	// The stream policy keeps the 5 scale-up evaluation periods of the default policy
+	_, err := Parse([]byte(`version: 1
+policies:
+  - name: default
+    periods:
+      scalePeriodMinutes: 10
+      scaleUpEvaluationMinutes: 50
+      scaleDownEvaluationMinutes: 600
+  - name: checkout
+    streams: [orders]
+    thresholds:
+      scaleUp: 0.5
+      scaleDown: 0.1
+    datapoints:
+      scaleUp: 6
+      scaleDown: 57
+`))
+
+	var errs Errors
+	assert.True(t, errors.As(err, &errs))
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "policies[1].datapoints.scaleUp", errs[0].Path)
+	assert.Equal(t, "6 datapoints are not between 1 and the 5 evaluation periods", errs[0].Message)
+}
@@ -0,0 +1,203 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error is an error at a line and column of the document
+type Error struct {
+	Line   int
+	Column int
+	// Path is the field the error is about, e.g. policies[0].thresholds.scaleUp, empty for syntax errors
+	Path    string
+	Message string
+}
+
+func (e Error) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+	}
+	return fmt.Sprintf("line %d, column %d: %s: %s", e.Line, e.Column, e.Path, e.Message)
+}
+
+// Errors are the errors of a document, in the order of their lines
+type Errors []Error
+
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+var (
+	documentType   = reflect.TypeOf(Document{})
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+	// yamlLinePattern finds the line in the syntax errors of the yaml parser
+	yamlLinePattern = regexp.MustCompile(`line (\d+): (.*)`)
+)
+
+// syntaxError turns an error of the yaml parser into Errors
+func syntaxError(err error) Errors {
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		errs := make(Errors, 0, len(typeErr.Errors))
+		for _, message := range typeErr.Errors {
+			errs = append(errs, lineError(message))
+		}
+		return errs
+	}
+
+	return Errors{lineError(err.Error())}
+}
+
+// lineError reads the line from an error message of the yaml parser
+func lineError(message string) Error {
+	message = strings.TrimPrefix(message, "yaml: ")
+	if match := yamlLinePattern.FindStringSubmatch(message); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		return Error{Line: line, Column: 1, Message: match[2]}
+	}
+	return Error{Line: 1, Column: 1, Message: message}
+}
+
+// checkSchema checks the node against the type its value decodes into: mappings hold the JSON fields of structs,
+// scalars have the kind of their field. The nodes are recorded by their path, for the errors of the validation that
+// follows
+func checkSchema(node *yaml.Node, t reflect.Type, path string, paths map[string]*yaml.Node) Errors {
+	paths[path] = node
+
+	fail := func(format string, args ...interface{}) Errors {
+		return Errors{{Line: node.Line, Column: node.Column, Path: path, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	if node.Kind == yaml.AliasNode {
+		return fail("aliases are not supported")
+	}
+
+	switch {
+	case t == rawMessageType:
+		return nil
+	case t == timeType:
+		if node.Kind != yaml.ScalarNode || (node.Tag != "!!str" && node.Tag != "!!timestamp") {
+			return fail("expected an RFC 3339 time")
+		}
+		if _, err := time.Parse(time.RFC3339, node.Value); err != nil {
+			return fail("expected an RFC 3339 time, e.g. 2022-11-25T00:00:00Z")
+		}
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return checkSchema(node, t.Elem(), path, paths)
+	case reflect.Struct:
+		return checkStruct(node, t, path, paths, fail)
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return fail("expected a list")
+		}
+		var errs Errors
+		for i, item := range node.Content {
+			errs = append(errs, checkSchema(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), paths)...)
+		}
+		return errs
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return fail("expected a mapping")
+		}
+		var errs Errors
+		for i := 0; i < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Tag != "!!str" {
+				errs = append(errs, Error{Line: key.Line, Column: key.Column, Path: path, Message: "expected a string key"})
+				continue
+			}
+			errs = append(errs, checkSchema(value, t.Elem(), join(path, key.Value), paths)...)
+		}
+		return errs
+	case reflect.String:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!str" {
+			return fail("expected a string")
+		}
+	case reflect.Bool:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+			return fail("expected true or false")
+		}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" {
+			return fail("expected an integer")
+		}
+	case reflect.Float32, reflect.Float64:
+		if node.Kind != yaml.ScalarNode || (node.Tag != "!!int" && node.Tag != "!!float") {
+			return fail("expected a number")
+		}
+	case reflect.Interface:
+		return nil
+	default:
+		return fail("unsupported field type %s", t)
+	}
+
+	return nil
+}
+
+// checkStruct checks that the mapping only holds the JSON fields of the struct, once each
+func checkStruct(node *yaml.Node, t reflect.Type, path string, paths map[string]*yaml.Node,
+	fail func(format string, args ...interface{}) Errors) Errors {
+
+	if node.Kind != yaml.MappingNode {
+		return fail("expected a mapping")
+	}
+
+	fields := make(map[string]reflect.Type)
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || field.PkgPath != "" {
+			continue
+		}
+		fields[name] = field.Type
+		names = append(names, name)
+	}
+
+	var errs Errors
+	seen := make(map[string]bool)
+	for i := 0; i < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+
+		fieldType, ok := fields[key.Value]
+		switch {
+		case !ok:
+			errs = append(errs, Error{Line: key.Line, Column: key.Column, Path: path,
+				Message: fmt.Sprintf("unknown field %q, expected one of %s", key.Value, strings.Join(names, ", "))})
+		case seen[key.Value]:
+			errs = append(errs, Error{Line: key.Line, Column: key.Column, Path: path,
+				Message: fmt.Sprintf("field %q is set twice", key.Value)})
+		default:
+			seen[key.Value] = true
+			errs = append(errs, checkSchema(value, fieldType, join(path, key.Value), paths)...)
+		}
+	}
+
+	return errs
+}
+
+// join appends the field to the path
+func join(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
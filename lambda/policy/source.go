@@ -0,0 +1,127 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/vmanikes/Nemesis/accounts"
+	"github.com/vmanikes/Nemesis/clients"
+	"github.com/vmanikes/Nemesis/logging"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"strings"
+)
+
+// S3API is the part of the s3 API that the policy sources use
+type S3API interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// SSMAPI is the part of the ssm API that the policy sources use
+type SSMAPI interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// Read reads the document at the source: a local path, file://<path>, s3://<bucket>/<key> or ssm:<parameter name>.
+// The AWS clients are only created for the S3 and SSM sources
+func Read(ctx context.Context, source string) ([]byte, error) {
+	logger := logging.WithContext(ctx)
+
+	switch {
+	case strings.HasPrefix(source, "s3://"), strings.HasPrefix(source, "ssm:"):
+		cfg, err := clients.Default().Config(ctx, accounts.Target{})
+		if err != nil {
+			logger.Error("unable to load the default config for aws")
+			return nil, err
+		}
+
+		if strings.HasPrefix(source, "s3://") {
+			return ReadS3(ctx, s3.NewFromConfig(cfg), source)
+		}
+		return ReadSSM(ctx, ssm.NewFromConfig(cfg), source)
+	default:
+		path := strings.TrimPrefix(source, "file://")
+
+		body, err := os.ReadFile(path)
+		if err != nil {
+			logger.Error("unable to read the scaling policy file",
+				zap.String("path", path),
+				zap.Error(err))
+			return nil, err
+		}
+
+		return body, nil
+	}
+}
+
+// ReadS3 reads the document from the s3://<bucket>/<key> source
+func ReadS3(ctx context.Context, api S3API, source string) ([]byte, error) {
+	logger := logging.WithContext(ctx)
+
+	parts := strings.SplitN(strings.TrimPrefix(source, "s3://"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		err := fmt.Errorf("invalid scaling policy source %s, expected s3://<bucket>/<key>", source)
+		logger.Error(err.Error())
+		return nil, err
+	}
+	bucket, key := parts[0], parts[1]
+
+	response, err := api.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		logger.Error("unable to get the scaling policy object",
+			zap.String("bucket", bucket),
+			zap.String("key", key),
+			zap.Error(err))
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		logger.Error("unable to read the scaling policy object",
+			zap.String("bucket", bucket),
+			zap.String("key", key),
+			zap.Error(err))
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// ReadSSM reads the document from the ssm:<parameter name> source. SecureString parameters are decrypted
+func ReadSSM(ctx context.Context, api SSMAPI, source string) ([]byte, error) {
+	logger := logging.WithContext(ctx)
+
+	name := strings.TrimPrefix(strings.TrimPrefix(source, "ssm:"), "//")
+	if name == "" {
+		err := fmt.Errorf("invalid scaling policy source %s, expected ssm:<parameter name>", source)
+		logger.Error(err.Error())
+		return nil, err
+	}
+
+	response, err := api.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: true,
+	})
+	if err != nil {
+		logger.Error("unable to get the scaling policy parameter",
+			zap.String("name", name),
+			zap.Error(err))
+		return nil, err
+	}
+	if response.Parameter == nil || response.Parameter.Value == nil {
+		err = errors.New("the scaling policy parameter has no value")
+		logger.Error(err.Error(),
+			zap.String("name", name))
+		return nil, err
+	}
+
+	return []byte(*response.Parameter.Value), nil
+}
@@ -0,0 +1,225 @@
+package policy
+
+import (
+	"fmt"
+	"github.com/vmanikes/Nemesis/constants"
+	"github.com/vmanikes/Nemesis/freeze"
+	"github.com/vmanikes/Nemesis/scaling"
+	"github.com/vmanikes/Nemesis/schedule"
+	"gopkg.in/yaml.v3"
+	"sort"
+)
+
+// maxShardCount is the highest maximum shard count a policy can set
+const maxShardCount = 10000
+
+// validate checks the values of the document, the paths hold the node of every field for the line of its errors
+func (d *Document) validate(paths map[string]*yaml.Node) Errors {
+	var errs Errors
+
+	add := func(path, format string, args ...interface{}) {
+		// Errors about a field that is not set are reported at the closest field that is
+		node, ok := paths[path]
+		for parent := path; !ok && parent != ""; {
+			parent = parentPath(parent)
+			node, ok = paths[parent]
+		}
+
+		errs = append(errs, Error{Line: node.Line, Column: node.Column, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if d.Version != Version {
+		add("version", "unsupported version %d, expected %d", d.Version, Version)
+	}
+
+	// The policies of streams inherit the periods and datapoints they do not set from the default policy
+	defaultPolicy, _ := d.Default()
+
+	names := make(map[string]bool)
+	streams := make(map[string]string)
+	defaults := 0
+
+	for i, policy := range d.Policies {
+		path := fmt.Sprintf("policies[%d]", i)
+
+		switch {
+		case policy.Name == "":
+			add(join(path, "name"), "a policy needs a name")
+		case names[policy.Name]:
+			add(join(path, "name"), "policy %q is defined twice", policy.Name)
+		}
+		names[policy.Name] = true
+
+		if len(policy.Streams) == 0 {
+			defaults++
+			if defaults > 1 {
+				add(path, "only one policy can be without streams, the default policy")
+			}
+		}
+
+		for j, streamName := range policy.Streams {
+			streamPath := fmt.Sprintf("%s.streams[%d]", path, j)
+			switch other, ok := streams[streamName]; {
+			case streamName == "":
+				add(streamPath, "empty stream name")
+			case ok:
+				add(streamPath, "stream %s is already in policy %q", streamName, other)
+			default:
+				streams[streamName] = policy.Name
+			}
+		}
+
+		policy.validate(path, defaultPolicy, add)
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].Line != errs[j].Line {
+			return errs[i].Line < errs[j].Line
+		}
+		if errs[i].Column != errs[j].Column {
+			return errs[i].Column < errs[j].Column
+		}
+		return errs[i].Path < errs[j].Path
+	})
+
+	return errs
+}
+
+// validate checks the values of the policy, the default policy being the one it inherits from
+func (p Policy) validate(path string, defaultPolicy Policy, add func(path, format string, args ...interface{})) {
+	if t := p.Thresholds; t != nil {
+		if t.ScaleUp <= 0 || t.ScaleUp > 1 {
+			add(join(path, "thresholds.scaleUp"), "%g is not between 0 and 1", t.ScaleUp)
+		}
+		if t.ScaleDown <= 0 || t.ScaleDown >= t.ScaleUp {
+			add(join(path, "thresholds.scaleDown"), "%g is not between 0 and the scale-up threshold", t.ScaleDown)
+		}
+	}
+
+	periods := p.Periods
+	if periods != nil {
+		if periods.ScalePeriodMinutes <= 0 {
+			add(join(path, "periods.scalePeriodMinutes"), "must be positive")
+		} else {
+			for field, minutes := range map[string]int64{
+				"scaleUpEvaluationMinutes":   periods.ScaleUpEvaluationMinutes,
+				"scaleDownEvaluationMinutes": periods.ScaleDownEvaluationMinutes,
+			} {
+				if minutes <= 0 || minutes%periods.ScalePeriodMinutes != 0 {
+					add(join(path, "periods."+field), "%d is not a positive multiple of the scale period", minutes)
+				}
+			}
+		}
+	}
+
+	// Periods without datapoints keep the datapoints of the constants, which must still fit the evaluation periods
+	if p.Datapoints != nil || p.Periods != nil {
+		inherited := p
+		if len(p.Streams) > 0 {
+			inherited = p.inherit(defaultPolicy)
+		}
+		datapoints, evaluationPeriods := inherited.datapoints(), inherited.evaluationPeriods()
+		fields := [2]string{"datapoints.scaleUp", "datapoints.scaleDown"}
+		if p.Datapoints == nil {
+			fields = [2]string{"periods.scaleUpEvaluationMinutes", "periods.scaleDownEvaluationMinutes"}
+		}
+		for i, field := range fields {
+			if datapoints[i] <= 0 || datapoints[i] > evaluationPeriods[i] {
+				add(join(path, field), "%d datapoints are not between 1 and the %d evaluation periods", datapoints[i],
+					evaluationPeriods[i])
+			}
+		}
+	}
+
+	if p.IteratorAgeBlockMinutes < 0 {
+		add(join(path, "iteratorAgeBlockMinutes"), "must not be negative")
+	}
+
+	if b := p.Bounds; b != nil {
+		if b.MinShardCount < 1 {
+			add(join(path, "bounds.minShardCount"), "must be at least 1")
+		}
+		if b.MaxShardCount < b.MinShardCount || b.MaxShardCount > maxShardCount {
+			add(join(path, "bounds.maxShardCount"), "%d is not between the minimum shard count and %d", b.MaxShardCount,
+				maxShardCount)
+		}
+	}
+
+	if p.Strategy != nil {
+		if err := (scaling.Strategies{Default: *p.Strategy}).Validate(); err != nil {
+			add(join(path, "strategy"), "%s", err)
+		}
+	}
+
+	if len(p.Schedules) > 0 {
+		if len(p.Streams) == 0 {
+			add(join(path, "schedules"), "schedules raise the shard count of named streams and can not be set in the default policy")
+		} else if err := schedule.Validate(map[string][]schedule.Rule{p.Name: p.Schedules}); err != nil {
+			add(join(path, "schedules"), "%s", err)
+		}
+	}
+
+	for i, channel := range p.Notifications {
+		channelPath := fmt.Sprintf("%s.notifications[%d]", path, i)
+		if len(channel.Streams) > 0 {
+			add(join(channelPath, "streams"), "notifications apply to the streams of their policy and can not name streams")
+			continue
+		}
+		if err := channel.Validate(); err != nil {
+			add(channelPath, "%s", err)
+		}
+	}
+
+	for i, window := range p.Freezes {
+		windowPath := fmt.Sprintf("%s.freezes[%d]", path, i)
+		if window.StreamName != "" {
+			add(join(windowPath, "stream"), "freezes apply to the streams of their policy and can not name a stream")
+			continue
+		}
+		if err := freeze.Validate([]freeze.Window{window}); err != nil {
+			add(windowPath, "%s", err)
+		}
+	}
+}
+
+// evaluationPeriods returns the number of scale-up and scale-down evaluation periods of the policy, with the constants
+// for the unset periods
+func (p Policy) evaluationPeriods() [2]int64 {
+	if p.Periods == nil || p.Periods.ScalePeriodMinutes <= 0 {
+		return [2]int64{constants.ScaleUpEvaluationPeriodMinutes, constants.ScaleDownEvaluationPeriodMinutes}
+	}
+	return [2]int64{
+		p.Periods.ScaleUpEvaluationMinutes / p.Periods.ScalePeriodMinutes,
+		p.Periods.ScaleDownEvaluationMinutes / p.Periods.ScalePeriodMinutes,
+	}
+}
+
+// inherit returns the policy with the periods and datapoints it does not set from the default policy
+func (p Policy) inherit(defaultPolicy Policy) Policy {
+	if p.Periods == nil {
+		p.Periods = defaultPolicy.Periods
+	}
+	if p.Datapoints == nil {
+		p.Datapoints = defaultPolicy.Datapoints
+	}
+	return p
+}
+
+// datapoints returns the number of scale-up and scale-down datapoints of the policy, with the constants when they are
+// unset
+func (p Policy) datapoints() [2]int64 {
+	if p.Datapoints == nil {
+		return [2]int64{constants.DataPointsToScaleUp, constants.DataPointsToScaleDown}
+	}
+	return [2]int64{p.Datapoints.ScaleUp, p.Datapoints.ScaleDown}
+}
+
+// parentPath returns the path of the field that holds the field of the path
+func parentPath(path string) string {
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i] == '.' || path[i] == '[' {
+			return path[:i]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,191 @@
+package scaling
+
+import (
+	"fmt"
+	"github.com/vmanikes/Nemesis/constants"
+	"time"
+)
+
+// Cooldowns are the least times between a scaling action and the next one, by the direction of both. Every unset
+// cooldown is ScalePeriodMinutes
+type Cooldowns struct {
+	// ScaleUpMinutes is the least time between any scaling action and a scale-up
+	ScaleUpMinutes int `json:"scaleUpMinutes,omitempty"`
+	// ScaleDownMinutes is the least time between any scaling action and a scale-down
+	ScaleDownMinutes int `json:"scaleDownMinutes,omitempty"`
+	// ScaleDownAfterScaleUpMinutes is the least time between a scale-up and a scale-down, e.g. 180 for no scale-down
+	// within 3 hours of a scale-up
+	ScaleDownAfterScaleUpMinutes int `json:"scaleDownAfterScaleUpMinutes,omitempty"`
+	// Flapping raises the cooldowns of the streams that oscillate
+	Flapping FlapDetection `json:"flapping"`
+}
+
+// FlapDetection counts the direction changes between the recent scaling actions of a stream. A stream with Reversals
+// changes within WindowMinutes is flapping, and its cooldowns are multiplied by CooldownMultiplier
+type FlapDetection struct {
+	Enabled bool `json:"enabled"`
+	// WindowMinutes is the history that is looked at, 360 when 0
+	WindowMinutes int `json:"windowMinutes,omitempty"`
+	// Reversals is the number of direction changes that make a stream flapping, 3 when 0
+	Reversals int `json:"reversals,omitempty"`
+	// CooldownMultiplier raises the cooldowns of a flapping stream, 4 when 0
+	CooldownMultiplier int `json:"cooldownMultiplier,omitempty"`
+}
+
+// WithDefaults returns the flap detection with the defaults for the unset fields
+func (f FlapDetection) WithDefaults() FlapDetection {
+	if f.WindowMinutes <= 0 {
+		f.WindowMinutes = 360
+	}
+	if f.Reversals <= 0 {
+		f.Reversals = 3
+	}
+	if f.CooldownMultiplier <= 0 {
+		f.CooldownMultiplier = 4
+	}
+	return f
+}
+
+// Action is a scaling action that was applied to a stream. The Action of a scaling that is only known by its time, from
+// the tags of older Nemesis versions, is empty
+type Action struct {
+	Action    string
+	Timestamp time.Time
+}
+
+// CooldownDecision is whether a scaling action may be applied after the recent actions of the stream
+type CooldownDecision struct {
+	Allowed bool
+	// Cooldown is the effective cooldown after the last action, raised when the stream is flapping
+	Cooldown time.Duration
+	// Until is when the cooldown ends
+	Until time.Time
+	// Last is the action the cooldown runs from
+	Last Action
+	// Flapping is set when the direction changes within the flap detection window reached the limit
+	Flapping  bool
+	Reversals int
+}
+
+// Reason describes why the action was rejected
+func (d CooldownDecision) Reason() string {
+	last := "the scale-" + d.Last.Action
+	if d.Last.Action == "" {
+		last = "the last scaling"
+	}
+
+	reason := fmt.Sprintf("cooldown of %s since %s at %s", d.Cooldown, last, d.Last.Timestamp.UTC().Format(time.RFC3339))
+	if d.Flapping {
+		reason += fmt.Sprintf(", raised after %d direction changes", d.Reversals)
+	}
+
+	return reason
+}
+
+// IsScaleUp checks if the scale action adds shards
+func IsScaleUp(action string) bool {
+	switch action {
+	case "Up", "Emergency", "Scheduled", "Predicted":
+		return true
+	}
+	return false
+}
+
+// Window returns how much history Check needs
+func (c Cooldowns) Window() time.Duration {
+	window := c.cooldown("Up", "Down")
+	for _, cooldown := range []time.Duration{c.cooldown("Up", "Up"), c.cooldown("Down", "Down")} {
+		if cooldown > window {
+			window = cooldown
+		}
+	}
+	if !c.Flapping.Enabled {
+		return window
+	}
+
+	flapping := c.Flapping.WithDefaults()
+	window *= time.Duration(flapping.CooldownMultiplier)
+	if flapWindow := time.Duration(flapping.WindowMinutes) * time.Minute; flapWindow > window {
+		window = flapWindow
+	}
+
+	return window
+}
+
+// cooldown returns the least time between the last and the next action
+func (c Cooldowns) cooldown(last, next string) time.Duration {
+	minutes := int(constants.ScalePeriodMinutes)
+
+	if IsScaleUp(next) {
+		if c.ScaleUpMinutes > 0 {
+			minutes = c.ScaleUpMinutes
+		}
+	} else {
+		if c.ScaleDownMinutes > 0 {
+			minutes = c.ScaleDownMinutes
+		}
+		if IsScaleUp(last) && c.ScaleDownAfterScaleUpMinutes > minutes {
+			minutes = c.ScaleDownAfterScaleUpMinutes
+		}
+	}
+
+	return time.Duration(minutes) * time.Minute
+}
+
+// Reversals counts the direction changes between the consecutive actions, which are sorted oldest first
+func Reversals(history []Action) int {
+	reversals := 0
+	for i := 1; i < len(history); i++ {
+		if IsScaleUp(history[i].Action) != IsScaleUp(history[i-1].Action) {
+			reversals++
+		}
+	}
+
+	return reversals
+}
+
+// Check decides if the action may be applied at the given time after the history of the stream, sorted oldest first
+func (c Cooldowns) Check(history []Action, action string, at time.Time) CooldownDecision {
+	decision := CooldownDecision{Allowed: true}
+	if len(history) == 0 {
+		return decision
+	}
+
+	decision.Last = history[len(history)-1]
+	decision.Cooldown = c.cooldown(decision.Last.Action, action)
+
+	if c.Flapping.Enabled {
+		flapping := c.Flapping.WithDefaults()
+		since := at.Add(-time.Duration(flapping.WindowMinutes) * time.Minute)
+
+		recent := make([]Action, 0, len(history)+1)
+		for _, past := range history {
+			if !past.Timestamp.Before(since) {
+				recent = append(recent, past)
+			}
+		}
+
+		// The action itself counts, a stream that would flap again is held back
+		decision.Reversals = Reversals(append(recent, Action{Action: action, Timestamp: at}))
+		if decision.Reversals >= flapping.Reversals {
+			decision.Flapping = true
+			decision.Cooldown *= time.Duration(flapping.CooldownMultiplier)
+		}
+	}
+
+	decision.Until = decision.Last.Timestamp.Add(decision.Cooldown)
+	decision.Allowed = !at.Before(decision.Until)
+
+	return decision
+}
+
+// Remaining returns how long until the action may be applied after the history of the stream, 0 when it may be
+// applied at the given time
+func (c Cooldowns) Remaining(history []Action, action string, at time.Time) time.Duration {
+	decision := c.Check(history, action, at)
+	if decision.Allowed {
+		return 0
+	}
+
+	return decision.Until.Sub(at)
+}
@@ -0,0 +1,60 @@
+// Package scaling contains the scaling decisions of Nemesis: whether a stream may be scaled and to which shard count
+package scaling
+
+import (
+	"fmt"
+	"github.com/vmanikes/Nemesis/clock"
+	"github.com/vmanikes/Nemesis/constants"
+)
+
+// CalculateShardCount returns the new shard count based on the scaling action and the updates scale down threshold
+// the down threshold will be -1.0 with the new calculation turns out to be 1. The Up, Down and Emergency actions double
+// or halve the shard count through Decide with the Doubling strategy, so the result is kept within the shard count
+// bounds. minimumShardCount is the floor of an active scheduled scaling window, 0 outside of one, and scale-downs never
+// go below it. The Scheduled and Predicted actions raise the stream towards it, at most doubling it
+func CalculateShardCount(scaleAction string, currentShardCount, minimumShardCount int) int {
+	if scaleAction != "Scheduled" && scaleAction != "Predicted" {
+		return Decide(Doubling{}, DecisionContext{
+			Action:     scaleAction,
+			ShardCount: currentShardCount,
+			Bounds:     DefaultBounds(minimumShardCount),
+		}).ShardCount
+	}
+
+	targetShardCount := currentShardCount * 2
+	if targetShardCount > minimumShardCount {
+		targetShardCount = minimumShardCount
+	}
+	if targetShardCount > constants.MaxShardCount {
+		targetShardCount = constants.MaxShardCount
+	}
+	// Never scale down on a scale-up, even when the stream is already above the bounds
+	if targetShardCount < currentShardCount {
+		targetShardCount = currentShardCount
+	}
+
+	return targetShardCount
+}
+
+// ShouldScaleKinesis checks if the alarm changed state after the last scaling event, so that an alarm that fired
+// before the stream was scaled does not scale it again. How long after the last scaling event the stream may be scaled
+// again is decided by Cooldowns. A timestamp that can not be parsed fails safe, the stream is not scaled and the error
+// is returned
+func ShouldScaleKinesis(lastScaledTimestamp, alarmTime string) (bool, error) {
+	// First ever scale attempt
+	if lastScaledTimestamp == "" {
+		return true, nil
+	}
+
+	stateChangeTime, err := clock.Parse(alarmTime)
+	if err != nil {
+		return false, fmt.Errorf("invalid state change time: %w", err)
+	}
+
+	lastScaled, err := clock.Parse(lastScaledTimestamp)
+	if err != nil {
+		return false, fmt.Errorf("invalid last scaled timestamp: %w", err)
+	}
+
+	return stateChangeTime.After(lastScaled), nil
+}
@@ -0,0 +1,116 @@
+package scaling
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/vmanikes/Nemesis/constants"
+	"testing"
+	"time"
+)
+
+func TestCalculateShardCount(t *testing.T) {
+	assert.Equal(t, 8, CalculateShardCount("Up", 4, 0))
+	assert.Equal(t, 8, CalculateShardCount("Emergency", 4, 0))
+	assert.Equal(t, 2, CalculateShardCount("Down", 4, 0))
+	assert.Equal(t, constants.MaxShardCount, CalculateShardCount("Emergency", constants.MaxShardCount-1, 0))
+	assert.Equal(t, constants.MaxShardCount+2, CalculateShardCount("Up", constants.MaxShardCount+2, 0))
+}
+
+func TestCalculateShardCountScheduledMinimum(t *testing.T) {
+	assert.Equal(t, 6, CalculateShardCount("Down", 8, 6))
+	assert.Equal(t, 8, CalculateShardCount("Down", 8, 8))
+	assert.Equal(t, 4, CalculateShardCount("Down", 4, 16))
+	assert.Equal(t, 16, CalculateShardCount("Up", 8, 10))
+	assert.Equal(t, 10, CalculateShardCount("Scheduled", 8, 10))
+	assert.Equal(t, 16, CalculateShardCount("Scheduled", 8, 64))
+	assert.Equal(t, 8, CalculateShardCount("Scheduled", 8, 4))
+	assert.Equal(t, 8, CalculateShardCount("Scheduled", 8, 0))
+	assert.Equal(t, 12, CalculateShardCount("Predicted", 8, 12))
+}
+
+func TestShouldScaleKinesis(t *testing.T) {
+	for _, test := range []struct {
+		lastScaled, alarmTime string
+		expected              bool
+	}{
+		{"", "2020-04-23T21:17:44.775+0000", true},
+		{"2020-04-23T21:17:44.775+0000", "2020-04-23T21:17:44.775+0000", false},
+		{"2020-04-23T21:18:00.000+0000", "2020-04-23T21:17:44.775+0000", false},
+		// The cooldown since the last scaling event is left to Cooldowns
+		{"2020-04-23T21:17:00.000+0000", "2020-04-23T21:17:44.775+0000", true},
+		// RFC 3339 and offsets other than +0000
+		{"2020-04-23T21:18:00Z", "2020-04-23T21:17:44.775+0000", false},
+		{"2020-04-23T21:15:00Z", "2020-04-23T21:17:44.775+0000", true},
+		{"2020-04-23T21:18:00.000+0000", "2020-04-23T23:17:44.775+0200", false},
+	} {
+		shouldScale, err := ShouldScaleKinesis(test.lastScaled, test.alarmTime)
+		assert.NoError(t, err, test)
+		assert.Equal(t, test.expected, shouldScale, test)
+	}
+
+	// Timestamps that can not be parsed never scale
+	shouldScale, err := ShouldScaleKinesis("2020-04-23T21:10:00.000+0000", "Thursday")
+	assert.Error(t, err)
+	assert.False(t, shouldScale)
+
+	shouldScale, err = ShouldScaleKinesis("last week", "2020-04-23T21:17:44.775+0000")
+	assert.Error(t, err)
+	assert.False(t, shouldScale)
+}
+
+func TestCooldowns_Remaining(t *testing.T) {
+	at := time.Date(2020, 4, 23, 21, 17, 0, 0, time.UTC)
+	cooldowns := Cooldowns{ScaleDownAfterScaleUpMinutes: 60}
+	history := []Action{{Action: "Up", Timestamp: at.Add(-2 * time.Minute)}}
+
+	assert.Equal(t, time.Duration(0), cooldowns.Remaining(nil, "Up", at))
+	assert.Equal(t, 3*time.Minute, cooldowns.Remaining(history, "Up", at))
+	assert.Equal(t, 58*time.Minute, cooldowns.Remaining(history, "Down", at))
+	assert.Equal(t, time.Duration(0), cooldowns.Remaining(history, "Up", at.Add(3*time.Minute)))
+
+	// A scaling only known by its time holds back both directions for ScalePeriodMinutes
+	decision := cooldowns.Check([]Action{{Timestamp: at.Add(-2 * time.Minute)}}, "Down", at)
+	assert.Equal(t, 3*time.Minute, decision.Until.Sub(at))
+	assert.Equal(t, "cooldown of 5m0s since the last scaling at 2020-04-23T21:15:00Z", decision.Reason())
+}
+
+func TestCooldowns_Check(t *testing.T) {
+	at := time.Date(2022, 10, 3, 12, 0, 0, 0, time.UTC)
+	cooldowns := Cooldowns{ScaleUpMinutes: 10, ScaleDownAfterScaleUpMinutes: 180}
+
+	// No scale-down within 3 hours of a scale-up, scale-downs after scale-downs keep ScalePeriodMinutes
+	decision := cooldowns.Check([]Action{{Action: "Up", Timestamp: at.Add(-2 * time.Hour)}}, "Down", at)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, at.Add(time.Hour), decision.Until)
+	assert.Equal(t, "cooldown of 3h0m0s since the scale-Up at 2022-10-03T10:00:00Z", decision.Reason())
+
+	assert.True(t, cooldowns.Check([]Action{{Action: "Down", Timestamp: at.Add(-6 * time.Minute)}}, "Down", at).Allowed)
+	assert.False(t, cooldowns.Check([]Action{{Action: "Down", Timestamp: at.Add(-6 * time.Minute)}}, "Up", at).Allowed)
+	assert.True(t, cooldowns.Check(nil, "Down", at).Allowed)
+}
+
+func TestCooldowns_Flapping(t *testing.T) {
+	at := time.Date(2022, 10, 3, 12, 0, 0, 0, time.UTC)
+	cooldowns := Cooldowns{Flapping: FlapDetection{Enabled: true}}
+
+	history := []Action{
+		{Action: "Up", Timestamp: at.Add(-90 * time.Minute)},
+		{Action: "Down", Timestamp: at.Add(-60 * time.Minute)},
+		{Action: "Up", Timestamp: at.Add(-10 * time.Minute)},
+	}
+
+	// The scale-down would be the third direction change in 6 hours, the cooldown is raised to 20 minutes
+	decision := cooldowns.Check(history, "Down", at)
+	assert.True(t, decision.Flapping)
+	assert.Equal(t, 3, decision.Reversals)
+	assert.Equal(t, 20*time.Minute, decision.Cooldown)
+	assert.False(t, decision.Allowed)
+
+	decision = cooldowns.Check(history, "Up", at)
+	assert.False(t, decision.Flapping)
+	assert.True(t, decision.Allowed)
+
+	// Actions before the window are not counted
+	decision = cooldowns.Check(history, "Down", at.Add(5*time.Hour))
+	assert.False(t, decision.Flapping)
+	assert.Equal(t, 6*time.Hour, cooldowns.Window())
+}
@@ -0,0 +1,478 @@
+package scaling
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vmanikes/Nemesis/constants"
+	"math"
+	"sort"
+	"sync"
+)
+
+// DefaultStrategy is the strategy of the streams without one, the doubling and halving Nemesis always did
+const DefaultStrategy = "doubling"
+
+// DecisionContext is what a scaling strategy decides the target shard count of a stream from
+type DecisionContext struct {
+	StreamName string
+	// Action is the scale action of the alarm: Up, Down or Emergency
+	Action     string
+	ShardCount int
+	// UsageFactors are the datapoints of MaxIncomingUsageFactor that triggered the alarm, the most recent first. They
+	// are empty when the notification did not hold them
+	UsageFactors []float64
+	// Threshold is the threshold of the alarm, 0 when the notification did not hold it
+	Threshold float64
+	// IteratorAgeMinutes is the age of the oldest unread record, 0 when it is not known
+	IteratorAgeMinutes float64
+	Bounds             Bounds
+	// ScaleDownThreshold is the threshold of the scale-down alarm of the stream above its minimum shard count
+	ScaleDownThreshold float64
+	// History are the recent scaling actions of the stream, oldest first
+	History []Action
+}
+
+// Bounds are the shard counts the target is kept within
+type Bounds struct {
+	MinShardCount int
+	MaxShardCount int
+	// ScheduledMinimum is the floor of an active scheduled scaling window, 0 outside of one
+	ScheduledMinimum int
+}
+
+// DefaultBounds are the bounds of constants.MinShardCount and constants.MaxShardCount with the scheduled minimum
+func DefaultBounds(scheduledMinimum int) Bounds {
+	return Bounds{
+		MinShardCount:    constants.MinShardCount,
+		MaxShardCount:    constants.MaxShardCount,
+		ScheduledMinimum: scheduledMinimum,
+	}
+}
+
+// Target is the shard count a strategy decided on, with the explanation for the audit trail and the alarm metadata
+type Target struct {
+	ShardCount  int
+	Explanation string
+	// ScaleDownThreshold is the threshold the scale-down alarm is put with at the target shard count
+	ScaleDownThreshold float64
+}
+
+// ScaleDownThreshold returns the threshold of the scale-down alarm of a stream with the shard count: the threshold, or
+// -1 at or below the minimum shard count so that the scale-down alarm remains in OK state
+func ScaleDownThreshold(shardCount, minShardCount int, threshold float64) float64 {
+	if shardCount <= minShardCount {
+		return -1.0
+	}
+	return threshold
+}
+
+// ScalingStrategy decides the target shard count of a stream when one of its alarms fires. Decide keeps the target
+// within the bounds and the limits of kinesis, so a strategy only has to express its policy
+type ScalingStrategy interface {
+	Target(decision DecisionContext) Target
+}
+
+// StrategyFactory creates a strategy from its parameters in the configuration, which are empty when none are given
+type StrategyFactory func(parameters json.RawMessage) (ScalingStrategy, error)
+
+var (
+	strategiesMu sync.RWMutex
+	strategies   = map[string]StrategyFactory{}
+)
+
+// RegisterStrategy makes a strategy selectable by name in the configuration, typically from the init function of the
+// package that holds it. Registering a name twice, the name of a built-in strategy included, panics
+func RegisterStrategy(name string, factory StrategyFactory) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+
+	if _, ok := strategies[name]; ok {
+		panic(fmt.Sprintf("scaling strategy %q is already registered", name))
+	}
+	strategies[name] = factory
+}
+
+// StrategyNames returns the names of the registered strategies, sorted
+func StrategyNames() []string {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// NewStrategy creates the registered strategy with the parameters
+func NewStrategy(name string, parameters json.RawMessage) (ScalingStrategy, error) {
+	strategiesMu.RLock()
+	factory, ok := strategies[name]
+	strategiesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown scaling strategy %q", name)
+	}
+
+	strategy, err := factory(parameters)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameters of scaling strategy %q: %w", name, err)
+	}
+
+	return strategy, nil
+}
+
+// StrategyConfig selects a strategy by name, with the parameters of the strategy
+type StrategyConfig struct {
+	Name       string          `json:"name"`
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+// Strategies select the scaling strategy of every stream. Streams that are not listed use the default, which is
+// DefaultStrategy when its name is empty
+type Strategies struct {
+	Default StrategyConfig            `json:"default"`
+	Streams map[string]StrategyConfig `json:"streams,omitempty"`
+}
+
+// Validate checks that every selected strategy is registered and accepts its parameters
+func (s Strategies) Validate() error {
+	if _, err := s.build(s.Default); err != nil {
+		return err
+	}
+
+	for streamName, strategy := range s.Streams {
+		if _, err := s.build(strategy); err != nil {
+			return fmt.Errorf("stream %s: %w", streamName, err)
+		}
+	}
+
+	return nil
+}
+
+// For returns the strategy of the stream
+func (s Strategies) For(streamName string) (ScalingStrategy, error) {
+	if strategy, ok := s.Streams[streamName]; ok {
+		return s.build(strategy)
+	}
+	return s.build(s.Default)
+}
+
+// Fallback returns the default strategy, the strategy of the streams without one of their own
+func (s Strategies) Fallback() (ScalingStrategy, error) {
+	return s.build(s.Default)
+}
+
+// build creates the selected strategy
+func (s Strategies) build(strategy StrategyConfig) (ScalingStrategy, error) {
+	name := strategy.Name
+	if name == "" {
+		name = DefaultStrategy
+	}
+	return NewStrategy(name, strategy.Parameters)
+}
+
+// Decide asks the strategy for the target shard count and keeps it within the bounds: a scale-up never lowers the
+// shard count and a scale-down never raises it, kinesis allows at most doubling and at least halving the shard count in
+// one update, and scale-downs stay above the scheduled minimum
+func Decide(strategy ScalingStrategy, decision DecisionContext) Target {
+	target := strategy.Target(decision)
+	current := decision.ShardCount
+	bounds := decision.Bounds
+
+	limit := func(shardCount int, why string) {
+		if shardCount != target.ShardCount {
+			target.ShardCount = shardCount
+			target.Explanation += fmt.Sprintf(", %s %d shards", why, shardCount)
+		}
+	}
+
+	switch decision.Action {
+	case "Up", "Emergency":
+		if target.ShardCount > current*2 {
+			limit(current*2, "kinesis allows at most doubling to")
+		}
+		if target.ShardCount > bounds.MaxShardCount {
+			limit(bounds.MaxShardCount, "capped at the maximum of")
+		}
+		// Never scale down on a scale-up, even when the stream is already above the bounds
+		if target.ShardCount < current {
+			limit(current, "kept at")
+		}
+	case "Down":
+		if target.ShardCount < (current+1)/2 {
+			limit((current+1)/2, "kinesis allows at least halving to")
+		}
+		// Within a scheduled window, never below its minimum. A stream that is not there yet is left as it is
+		if target.ShardCount < bounds.ScheduledMinimum {
+			limit(minInt(bounds.ScheduledMinimum, current), "held by the scheduled minimum at")
+		}
+		if target.ShardCount < bounds.MinShardCount {
+			limit(bounds.MinShardCount, "raised to the minimum of")
+		}
+		if target.ShardCount > current {
+			limit(current, "kept at")
+		}
+	default:
+		target = Target{ShardCount: current, Explanation: "no strategy for the " + decision.Action + " action"}
+	}
+
+	target.ScaleDownThreshold = ScaleDownThreshold(target.ShardCount, bounds.MinShardCount, decision.ScaleDownThreshold)
+
+	return target
+}
+
+func init() {
+	for name, factory := range map[string]StrategyFactory{
+		"doubling": func(json.RawMessage) (ScalingStrategy, error) {
+			return Doubling{}, nil
+		},
+		"step": func(parameters json.RawMessage) (ScalingStrategy, error) {
+			var step Step
+			if err := unmarshalParameters(parameters, &step); err != nil {
+				return nil, err
+			}
+			return step.WithDefaults(), step.Validate()
+		},
+		"targetTracking": func(parameters json.RawMessage) (ScalingStrategy, error) {
+			var tracking TargetTracking
+			if err := unmarshalParameters(parameters, &tracking); err != nil {
+				return nil, err
+			}
+			return tracking.WithDefaults(), tracking.Validate()
+		},
+	} {
+		RegisterStrategy(name, factory)
+	}
+}
+
+// unmarshalParameters reads the parameters of a strategy, which may be empty, and rejects unknown fields
+func unmarshalParameters(parameters json.RawMessage, strategy interface{}) error {
+	if len(parameters) == 0 {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(parameters))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(strategy)
+}
+
+// Doubling doubles the shard count on every scale-up and halves it on every scale-down
+type Doubling struct{}
+
+// Target doubles or halves the shard count
+func (Doubling) Target(decision DecisionContext) Target {
+	if decision.Action == "Down" {
+		return Target{
+			ShardCount:  decision.ShardCount / 2,
+			Explanation: fmt.Sprintf("halving %d to %d shards", decision.ShardCount, decision.ShardCount/2),
+		}
+	}
+
+	return Target{
+		ShardCount:  decision.ShardCount * 2,
+		Explanation: fmt.Sprintf("doubling %d to %d shards", decision.ShardCount, decision.ShardCount*2),
+	}
+}
+
+// Step adds or removes a share of the shards, at least one. With step adjustments the share a scale-up adds depends on
+// how far the usage factor is above the threshold, like the step scaling policies of Application Auto Scaling.
+// Emergency scale-ups double the shard count
+type Step struct {
+	// ScaleUpPercent is the share of shards a scale-up adds, 50 when 0. With step adjustments it is only used when the
+	// usage factor is not known
+	ScaleUpPercent int `json:"scaleUpPercent,omitempty"`
+	// ScaleDownPercent is the share of shards a scale-down removes, 25 when 0
+	ScaleDownPercent int `json:"scaleDownPercent,omitempty"`
+	// StepAdjustments are the shares of shards a scale-up adds by how far the usage factor is above the threshold.
+	// They are contiguous, the first starts at 0 and the last has no upper bound
+	StepAdjustments []StepAdjustment `json:"stepAdjustments,omitempty"`
+}
+
+// StepAdjustment is the share of shards a scale-up adds when the usage factor is between the bounds above the
+// threshold. Kinesis allows at most doubling in one update, so Decide applies at most 100% of a larger share. The rest
+// is only added when the alarm fires again on the new shard count, after its evaluation periods and the cooldown, and
+// then by the step of the usage factor at that time
+type StepAdjustment struct {
+	// LowerBound is the least the usage factor is above the threshold, inclusive
+	LowerBound float64 `json:"lowerBound"`
+	// UpperBound is the most the usage factor is above the threshold, exclusive. No upper bound when nil
+	UpperBound *float64 `json:"upperBound,omitempty"`
+	// AdjustmentPercent is the share of shards the scale-up adds
+	AdjustmentPercent int `json:"adjustmentPercent"`
+}
+
+// WithDefaults returns the step with the defaults for the unset percentages
+func (s Step) WithDefaults() Step {
+	if s.ScaleUpPercent == 0 {
+		s.ScaleUpPercent = 50
+	}
+	if s.ScaleDownPercent == 0 {
+		s.ScaleDownPercent = 25
+	}
+	return s
+}
+
+// Validate checks that the steps are within what kinesis allows in one update
+func (s Step) Validate() error {
+	s = s.WithDefaults()
+	if s.ScaleUpPercent < 0 || s.ScaleUpPercent > 100 {
+		return fmt.Errorf("scaleUpPercent %d is not between 1 and 100", s.ScaleUpPercent)
+	}
+	if s.ScaleDownPercent < 0 || s.ScaleDownPercent > 50 {
+		return fmt.Errorf("scaleDownPercent %d is not between 1 and 50", s.ScaleDownPercent)
+	}
+
+	for i, adjustment := range s.StepAdjustments {
+		if adjustment.AdjustmentPercent < 1 {
+			return fmt.Errorf("adjustmentPercent %d of step adjustment %d is not positive", adjustment.AdjustmentPercent, i)
+		}
+		if i == 0 && adjustment.LowerBound != 0 {
+			return fmt.Errorf("lowerBound %g of the first step adjustment is not 0", adjustment.LowerBound)
+		}
+		if i > 0 {
+			previous := s.StepAdjustments[i-1]
+			if previous.UpperBound == nil || adjustment.LowerBound != *previous.UpperBound {
+				return fmt.Errorf("lowerBound %g of step adjustment %d is not the upperBound of the one before it", adjustment.LowerBound, i)
+			}
+		}
+		if adjustment.UpperBound != nil && *adjustment.UpperBound <= adjustment.LowerBound {
+			return fmt.Errorf("upperBound %g of step adjustment %d is not above its lowerBound", *adjustment.UpperBound, i)
+		}
+	}
+	if n := len(s.StepAdjustments); n > 0 && s.StepAdjustments[n-1].UpperBound != nil {
+		return errors.New("the last step adjustment has an upperBound")
+	}
+
+	return nil
+}
+
+// Target adds or removes the step
+func (s Step) Target(decision DecisionContext) Target {
+	current := decision.ShardCount
+
+	switch decision.Action {
+	case "Emergency":
+		return Doubling{}.Target(decision)
+	case "Down":
+		step := maxInt(1, current*s.ScaleDownPercent/100)
+		return Target{
+			ShardCount:  current - step,
+			Explanation: fmt.Sprintf("step of %d%% from %d to %d shards", s.ScaleDownPercent, current, current-step),
+		}
+	default:
+		percent, explanation := s.ScaleUpPercent, ""
+		if len(s.StepAdjustments) > 0 {
+			if len(decision.UsageFactors) == 0 {
+				explanation = "no usage factors, "
+			} else {
+				threshold := decision.Threshold
+				if threshold <= 0 {
+					threshold = constants.ScaleUpThreshold
+				}
+				usageFactor := decision.UsageFactors[0]
+				percent = s.adjustment(usageFactor - threshold).AdjustmentPercent
+				explanation = fmt.Sprintf("usage factor %.3f is %.3f above the threshold of %.3f, ", usageFactor,
+					usageFactor-threshold, threshold)
+			}
+		}
+
+		step := maxInt(1, int(math.Ceil(float64(current*percent)/100)))
+		return Target{
+			ShardCount:  current + step,
+			Explanation: explanation + fmt.Sprintf("step of %d%% from %d to %d shards", percent, current, current+step),
+		}
+	}
+}
+
+// adjustment returns the step adjustment of the breach, the first one for a usage factor that is below the threshold
+// again
+func (s Step) adjustment(breach float64) StepAdjustment {
+	for _, adjustment := range s.StepAdjustments {
+		if adjustment.UpperBound == nil || breach < *adjustment.UpperBound {
+			return adjustment
+		}
+	}
+	return s.StepAdjustments[len(s.StepAdjustments)-1]
+}
+
+// TargetTracking sizes the stream so that its usage factor lands on the target usage factor. It falls back to doubling
+// and halving when the notification holds no usage factors, and does not scale down a stream whose consumers are
+// behind
+type TargetTracking struct {
+	// TargetUsageFactor is the usage factor the stream is sized for, 0.15 when 0, between the scale-down and the
+	// scale-up threshold
+	TargetUsageFactor float64 `json:"targetUsageFactor,omitempty"`
+	// MaxIteratorAgeMinutes is the iterator age above which the stream is not scaled down, ScaleDownMinIterAgeMinutes
+	// when 0
+	MaxIteratorAgeMinutes float64 `json:"maxIteratorAgeMinutes,omitempty"`
+}
+
+// WithDefaults returns the target tracking with the defaults for the unset fields
+func (t TargetTracking) WithDefaults() TargetTracking {
+	if t.TargetUsageFactor == 0 {
+		t.TargetUsageFactor = 0.15
+	}
+	if t.MaxIteratorAgeMinutes == 0 {
+		t.MaxIteratorAgeMinutes = float64(constants.ScaleDownMinIterAgeMinutes)
+	}
+	return t
+}
+
+// Validate checks the target usage factor
+func (t TargetTracking) Validate() error {
+	t = t.WithDefaults()
+	if t.TargetUsageFactor <= 0 || t.TargetUsageFactor > 1 {
+		return fmt.Errorf("targetUsageFactor %g is not between 0 and 1", t.TargetUsageFactor)
+	}
+	if t.MaxIteratorAgeMinutes < 0 {
+		return fmt.Errorf("maxIteratorAgeMinutes %g is negative", t.MaxIteratorAgeMinutes)
+	}
+	return nil
+}
+
+// Target sizes the stream for the target usage factor from the most recent usage factor
+func (t TargetTracking) Target(decision DecisionContext) Target {
+	current := decision.ShardCount
+
+	if decision.Action == "Down" && decision.IteratorAgeMinutes > t.MaxIteratorAgeMinutes {
+		return Target{
+			ShardCount: current,
+			Explanation: fmt.Sprintf("iterator age of %.0f minutes is above %.0f minutes, not scaling down",
+				decision.IteratorAgeMinutes, t.MaxIteratorAgeMinutes),
+		}
+	}
+
+	if len(decision.UsageFactors) == 0 {
+		target := Doubling{}.Target(decision)
+		target.Explanation = "no usage factors, " + target.Explanation
+		return target
+	}
+
+	usageFactor := decision.UsageFactors[0]
+	shardCount := int(math.Ceil(float64(current) * usageFactor / t.TargetUsageFactor))
+
+	return Target{
+		ShardCount: shardCount,
+		Explanation: fmt.Sprintf("usage factor %.3f on %d shards tracks %.3f with %d shards", usageFactor, current,
+			t.TargetUsageFactor, shardCount),
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,195 @@
+package scaling
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// fixedStrategy always decides on the same shard count
+type fixedStrategy int
+
+func (f fixedStrategy) Target(DecisionContext) Target {
+	return Target{ShardCount: int(f), Explanation: "fixed"}
+}
+
+func TestDecide(t *testing.T) {
+	bounds := Bounds{MinShardCount: 1, MaxShardCount: 100}
+
+	decide := func(strategy ScalingStrategy, action string, shardCount int, bounds Bounds) Target {
+		return Decide(strategy, DecisionContext{Action: action, ShardCount: shardCount, Bounds: bounds})
+	}
+
+	assert.Equal(t, Target{ShardCount: 8, Explanation: "fixed, kinesis allows at most doubling to 8 shards"}, decide(fixedStrategy(20), "Up", 4, bounds))
+	assert.Equal(t, 100, decide(fixedStrategy(200), "Emergency", 80, bounds).ShardCount)
+	assert.Equal(t, 4, decide(fixedStrategy(2), "Up", 4, bounds).ShardCount)
+	assert.Equal(t, 2, decide(fixedStrategy(1), "Down", 3, bounds).ShardCount)
+	assert.Equal(t, 4, decide(fixedStrategy(6), "Down", 4, bounds).ShardCount)
+	assert.Equal(t, 6, decide(fixedStrategy(4), "Down", 8, Bounds{MinShardCount: 1, MaxShardCount: 100, ScheduledMinimum: 6}).ShardCount)
+	assert.Equal(t, Target{ShardCount: 4, Explanation: "no strategy for the Scheduled action"}, decide(fixedStrategy(8), "Scheduled", 4, bounds))
+}
+
+func TestDecide_ScaleDownThreshold(t *testing.T) {
+	decide := func(shardCount int) Target {
+		return Decide(fixedStrategy(1), DecisionContext{
+			Action:             "Down",
+			ShardCount:         shardCount,
+			Bounds:             Bounds{MinShardCount: 2, MaxShardCount: 100},
+			ScaleDownThreshold: 0.075,
+		})
+	}
+
+	assert.Equal(t, 0.075, decide(8).ScaleDownThreshold)
+	assert.Equal(t, -1.0, decide(3).ScaleDownThreshold)
+	// The stream at its minimum does not change the threshold the next decision starts from
+	assert.Equal(t, 0.075, decide(8).ScaleDownThreshold)
+}
+
+func TestStep(t *testing.T) {
+	step := Step{}.WithDefaults()
+	bounds := Bounds{MinShardCount: 1, MaxShardCount: 100}
+
+	decide := func(action string, shardCount int) Target {
+		return Decide(step, DecisionContext{Action: action, ShardCount: shardCount, Bounds: bounds})
+	}
+
+	assert.Equal(t, Target{ShardCount: 6, Explanation: "step of 50% from 4 to 6 shards"}, decide("Up", 4))
+	assert.Equal(t, 2, decide("Up", 1).ShardCount)
+	assert.Equal(t, 6, decide("Down", 8).ShardCount)
+	assert.Equal(t, 2, decide("Down", 3).ShardCount)
+	assert.Equal(t, 8, decide("Emergency", 4).ShardCount)
+
+	assert.Error(t, Step{ScaleUpPercent: 150}.Validate())
+	assert.Error(t, Step{ScaleDownPercent: 60}.Validate())
+}
+
+func TestStep_Adjustments(t *testing.T) {
+	var step Step
+	assert.NoError(t, json.Unmarshal([]byte(`{"stepAdjustments": [
+		{"lowerBound": 0, "upperBound": 0.5, "adjustmentPercent": 25},
+		{"lowerBound": 0.5, "upperBound": 1.5, "adjustmentPercent": 50},
+		{"lowerBound": 1.5, "adjustmentPercent": 100}
+	]}`), &step))
+	step = step.WithDefaults()
+	assert.NoError(t, step.Validate())
+
+	bounds := Bounds{MinShardCount: 1, MaxShardCount: 100}
+	decide := func(usageFactors ...float64) Target {
+		return Decide(step, DecisionContext{Action: "Up", ShardCount: 8, UsageFactors: usageFactors, Threshold: 0.75, Bounds: bounds})
+	}
+
+	assert.Equal(t, Target{ShardCount: 10, Explanation: "usage factor 0.800 is 0.050 above the threshold of 0.750, step of 25% from 8 to 10 shards"},
+		decide(0.8, 1.0))
+	assert.Equal(t, 12, decide(1.25).ShardCount)
+	assert.Equal(t, 16, decide(2.25).ShardCount)
+	assert.Equal(t, Target{ShardCount: 16, Explanation: "usage factor 3.000 is 2.250 above the threshold of 0.750, step of 100% from 8 to 16 shards"},
+		decide(3.0))
+	assert.Equal(t, Target{ShardCount: 12, Explanation: "no usage factors, step of 50% from 8 to 12 shards"}, decide())
+
+	// The stream at 3.0 is still 0.75 above the threshold on 16 shards, the alarm fires again and raises it by half
+	target := Decide(step, DecisionContext{Action: "Up", ShardCount: 16, UsageFactors: []float64{1.5}, Threshold: 0.75, Bounds: bounds})
+	assert.Equal(t, 24, target.ShardCount)
+
+	// Without the threshold in the notification the scale-up threshold is used
+	target = Decide(step, DecisionContext{Action: "Up", ShardCount: 8, UsageFactors: []float64{0.9}, Bounds: bounds})
+	assert.Equal(t, "usage factor 0.900 is 0.650 above the threshold of 0.250, step of 50% from 8 to 12 shards", target.Explanation)
+
+	upper := func(bound float64) *float64 { return &bound }
+	for _, adjustments := range [][]StepAdjustment{
+		{{LowerBound: 0.1, AdjustmentPercent: 50}},
+		{{LowerBound: 0, UpperBound: upper(0.5), AdjustmentPercent: 50}},
+		{{LowerBound: 0, UpperBound: upper(0.5), AdjustmentPercent: 50}, {LowerBound: 0.6, AdjustmentPercent: 100}},
+		{{LowerBound: 0, UpperBound: upper(0), AdjustmentPercent: 50}, {LowerBound: 0, AdjustmentPercent: 100}},
+		{{LowerBound: 0, AdjustmentPercent: 0}},
+	} {
+		assert.Error(t, Step{StepAdjustments: adjustments}.Validate())
+	}
+}
+
+func TestStep_AdjustmentsAboveDoubling(t *testing.T) {
+	var step Step
+	assert.NoError(t, json.Unmarshal([]byte(`{"stepAdjustments": [
+		{"lowerBound": 0, "upperBound": 0.5, "adjustmentPercent": 25},
+		{"lowerBound": 0.5, "upperBound": 1.5, "adjustmentPercent": 100},
+		{"lowerBound": 1.5, "adjustmentPercent": 300}
+	]}`), &step))
+	step = step.WithDefaults()
+	assert.NoError(t, step.Validate())
+
+	bounds := Bounds{MinShardCount: 1, MaxShardCount: 100}
+
+	// A jump of 300% is cut to the doubling kinesis allows in one update
+	target := Decide(step, DecisionContext{Action: "Up", ShardCount: 8, UsageFactors: []float64{3.0}, Threshold: 0.75, Bounds: bounds})
+	assert.Equal(t, Target{ShardCount: 16, Explanation: "usage factor 3.000 is 2.250 above the threshold of 0.750, step of 300% from 8 to 32 shards, kinesis allows at most doubling to 16 shards"},
+		target)
+
+	// The rest is not carried over, the alarm that fires again on 16 shards adds the step of the usage factor it sees
+	target = Decide(step, DecisionContext{Action: "Up", ShardCount: 16, UsageFactors: []float64{1.5}, Threshold: 0.75, Bounds: bounds})
+	assert.Equal(t, 32, target.ShardCount)
+	target = Decide(step, DecisionContext{Action: "Up", ShardCount: 16, UsageFactors: []float64{0.9}, Threshold: 0.75, Bounds: bounds})
+	assert.Equal(t, 20, target.ShardCount)
+}
+
+func TestTargetTracking(t *testing.T) {
+	tracking := TargetTracking{TargetUsageFactor: 0.2}.WithDefaults()
+	bounds := Bounds{MinShardCount: 1, MaxShardCount: 100}
+
+	target := Decide(tracking, DecisionContext{Action: "Up", ShardCount: 4, UsageFactors: []float64{0.3, 0.5}, Bounds: bounds})
+	assert.Equal(t, Target{ShardCount: 6, Explanation: "usage factor 0.300 on 4 shards tracks 0.200 with 6 shards"}, target)
+
+	target = Decide(tracking, DecisionContext{Action: "Down", ShardCount: 10, UsageFactors: []float64{0.05}, Bounds: bounds})
+	assert.Equal(t, 5, target.ShardCount)
+
+	target = Decide(tracking, DecisionContext{Action: "Down", ShardCount: 10, UsageFactors: []float64{0.05}, IteratorAgeMinutes: 45, Bounds: bounds})
+	assert.Equal(t, 10, target.ShardCount)
+	assert.Equal(t, "iterator age of 45 minutes is above 30 minutes, not scaling down", target.Explanation)
+
+	target = Decide(tracking, DecisionContext{Action: "Up", ShardCount: 4, Bounds: bounds})
+	assert.Equal(t, Target{ShardCount: 8, Explanation: "no usage factors, doubling 4 to 8 shards"}, target)
+
+	assert.Error(t, TargetTracking{TargetUsageFactor: 1.5}.Validate())
+}
+
+func TestStrategies(t *testing.T) {
+	var strategies Strategies
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"default": {"name": "step", "parameters": {"scaleUpPercent": 25}},
+		"streams": {"orders": {"name": "targetTracking"}, "payments": {}}
+	}`), &strategies))
+	assert.NoError(t, strategies.Validate())
+
+	strategy, err := strategies.For("clicks")
+	assert.NoError(t, err)
+	assert.Equal(t, Step{ScaleUpPercent: 25, ScaleDownPercent: 25}, strategy)
+
+	strategy, err = strategies.For("orders")
+	assert.NoError(t, err)
+	assert.Equal(t, TargetTracking{TargetUsageFactor: 0.15, MaxIteratorAgeMinutes: 30}, strategy)
+
+	strategy, err = strategies.For("payments")
+	assert.NoError(t, err)
+	assert.Equal(t, Doubling{}, strategy)
+
+	assert.Error(t, Strategies{Default: StrategyConfig{Name: "random"}}.Validate())
+	assert.Error(t, Strategies{Streams: map[string]StrategyConfig{
+		"orders": {Name: "step", Parameters: json.RawMessage(`{"scaleUpPercents": 25}`)},
+	}}.Validate())
+}
+
+func TestRegisterStrategy(t *testing.T) {
+	RegisterStrategy("test-fixed", func(parameters json.RawMessage) (ScalingStrategy, error) {
+		var shardCount int
+		err := json.Unmarshal(parameters, &shardCount)
+		return fixedStrategy(shardCount), err
+	})
+
+	assert.Contains(t, StrategyNames(), "test-fixed")
+
+	strategy, err := Strategies{Default: StrategyConfig{Name: "test-fixed", Parameters: json.RawMessage(`12`)}}.For("orders")
+	assert.NoError(t, err)
+	assert.Equal(t, fixedStrategy(12), strategy)
+
+	assert.Panics(t, func() {
+		RegisterStrategy("doubling", nil)
+	})
+}
@@ -0,0 +1,128 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cron is a parsed five field cron expression: minute, hour, day of month, month and day of week, in UTC
+type cron struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	// anyDayOfMonth and anyDayOfWeek record a * field. As in cron, a time matches when either day field matches,
+	// unless one of them is *
+	anyDayOfMonth, anyDayOfWeek bool
+}
+
+// parseCron parses a cron expression. Fields are *, a value, a range a-b, a step */n or a-b/n, or a comma separated
+// list of those. Day of week 0 and 7 are both Sunday
+func parseCron(expression string) (cron, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return cron{}, fmt.Errorf("cron expression %q must have 5 fields, it has %d", expression, len(fields))
+	}
+
+	var (
+		c   cron
+		err error
+	)
+
+	bounds := []struct {
+		name     string
+		min, max int
+		set      *uint64
+	}{
+		{"minute", 0, 59, &c.minute},
+		{"hour", 0, 23, &c.hour},
+		{"day of month", 1, 31, &c.dayOfMonth},
+		{"month", 1, 12, &c.month},
+		{"day of week", 0, 7, &c.dayOfWeek},
+	}
+
+	for i, bound := range bounds {
+		*bound.set, err = parseField(fields[i], bound.min, bound.max)
+		if err != nil {
+			return cron{}, fmt.Errorf("invalid %s in cron expression %q: %w", bound.name, expression, err)
+		}
+	}
+
+	if c.dayOfWeek&(1<<7) != 0 {
+		c.dayOfWeek |= 1
+	}
+	c.anyDayOfMonth = fields[2] == "*"
+	c.anyDayOfWeek = fields[4] == "*"
+
+	return c, nil
+}
+
+// parseField returns the values of the field as a bit set
+func parseField(field string, min, max int) (uint64, error) {
+	var set uint64
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part[i+1:])
+			}
+			part = part[:i]
+		}
+
+		low, high := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", bounds[0])
+			}
+			if high, err = strconv.Atoi(bounds[1]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", bounds[1])
+			}
+		default:
+			value, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			low, high = value, value
+			if step > 1 {
+				high = max
+			}
+		}
+
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%q is outside of %d-%d", part, min, max)
+		}
+
+		for value := low; value <= high; value += step {
+			set |= 1 << uint(value)
+		}
+	}
+
+	return set, nil
+}
+
+// matches checks if the minute of t matches the expression
+func (c cron) matches(t time.Time) bool {
+	t = t.UTC()
+
+	if c.minute&(1<<uint(t.Minute())) == 0 || c.hour&(1<<uint(t.Hour())) == 0 || c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	dayOfMonth := c.dayOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := c.dayOfWeek&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case c.anyDayOfMonth:
+		return dayOfWeek
+	case c.anyDayOfWeek:
+		return dayOfMonth
+	default:
+		return dayOfMonth || dayOfWeek
+	}
+}
@@ -0,0 +1,126 @@
+// Package schedule contains the scheduled scaling rules, which keep a stream at a minimum shard count during known
+// traffic peaks
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vmanikes/Nemesis/constants"
+	"time"
+)
+
+const (
+	// maxDurationMinutes bounds the windows of cron rules, longer peaks are better written as date ranges
+	maxDurationMinutes = 7 * 24 * 60
+	// maxLeadMinutes bounds how early the capacity of a window is raised
+	maxLeadMinutes = 24 * 60
+)
+
+// Rule keeps a stream at MinShardCount during its windows. A rule is either a cron expression in UTC, with windows of
+// DurationMinutes starting at every match, or a single window from From to To
+type Rule struct {
+	Name            string    `json:"name"`
+	Cron            string    `json:"cron,omitempty"`
+	DurationMinutes int       `json:"durationMinutes,omitempty"`
+	From            time.Time `json:"from,omitempty"`
+	To              time.Time `json:"to,omitempty"`
+	MinShardCount   int       `json:"minShardCount"`
+	// LeadMinutes is how long before a window starts its capacity is raised, constants.ScheduleLeadMinutes when 0
+	LeadMinutes int `json:"leadMinutes,omitempty"`
+}
+
+// Validate checks that the rule is either a cron rule or a date range and that its bounds make sense
+func (r Rule) Validate() error {
+	if r.MinShardCount <= 0 {
+		return fmt.Errorf("rule %q: minShardCount must be positive", r.Name)
+	}
+	if r.LeadMinutes < 0 || r.LeadMinutes > maxLeadMinutes {
+		return fmt.Errorf("rule %q: leadMinutes must be between 0 and %d", r.Name, maxLeadMinutes)
+	}
+
+	dateRange := !r.From.IsZero() || !r.To.IsZero()
+
+	switch {
+	case r.Cron != "" && dateRange:
+		return fmt.Errorf("rule %q: either cron or from and to can be set, not both", r.Name)
+	case r.Cron != "":
+		if _, err := parseCron(r.Cron); err != nil {
+			return fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		if r.DurationMinutes <= 0 || r.DurationMinutes > maxDurationMinutes {
+			return fmt.Errorf("rule %q: durationMinutes must be between 1 and %d", r.Name, maxDurationMinutes)
+		}
+	case dateRange:
+		if r.From.IsZero() || r.To.IsZero() || !r.From.Before(r.To) {
+			return fmt.Errorf("rule %q: from must be before to", r.Name)
+		}
+	default:
+		return fmt.Errorf("rule %q: either cron or from and to must be set", r.Name)
+	}
+
+	return nil
+}
+
+// lead returns how long before a window starts its capacity is raised
+func (r Rule) lead() time.Duration {
+	if r.LeadMinutes > 0 {
+		return time.Duration(r.LeadMinutes) * time.Minute
+	}
+	return time.Duration(constants.ScheduleLeadMinutes) * time.Minute
+}
+
+// Active checks if now is within a window of the rule, or within the lead time before one. Invalid rules are never
+// active
+func (r Rule) Active(now time.Time) bool {
+	if r.Validate() != nil {
+		return false
+	}
+
+	if r.Cron == "" {
+		return !now.Before(r.From.Add(-r.lead())) && now.Before(r.To)
+	}
+
+	c, _ := parseCron(r.Cron)
+
+	// A window that started at a matching minute in (now - duration, now + lead] is active now
+	latest := now.Add(r.lead()).Truncate(time.Minute)
+	earliest := now.Add(-time.Duration(r.DurationMinutes) * time.Minute)
+
+	for start := latest; start.After(earliest); start = start.Add(-time.Minute) {
+		if c.matches(start) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Floor returns the highest minimum shard count of the rules active at now and the name of the rule it comes from. It
+// returns 0 when no rule is active
+func Floor(rules []Rule, now time.Time) (int, string) {
+	floor, name := 0, ""
+
+	for _, rule := range rules {
+		if rule.MinShardCount > floor && rule.Active(now) {
+			floor, name = rule.MinShardCount, rule.Name
+		}
+	}
+
+	return floor, name
+}
+
+// Validate checks every rule of every stream
+func Validate(schedules map[string][]Rule) error {
+	for streamName, rules := range schedules {
+		if streamName == "" {
+			return errors.New("scheduled scaling rules need a stream name")
+		}
+		for _, rule := range rules {
+			if err := rule.Validate(); err != nil {
+				return fmt.Errorf("stream %q: %w", streamName, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package schedule
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	c, err := parseCron("*/15 2-4 * * 1-5")
+	assert.NoError(t, err)
+
+	// Thursday
+	assert.True(t, c.matches(time.Date(2022, 9, 1, 2, 30, 0, 0, time.UTC)))
+	assert.False(t, c.matches(time.Date(2022, 9, 1, 2, 31, 0, 0, time.UTC)))
+	assert.False(t, c.matches(time.Date(2022, 9, 1, 5, 0, 0, 0, time.UTC)))
+	// Sunday
+	assert.False(t, c.matches(time.Date(2022, 9, 4, 2, 30, 0, 0, time.UTC)))
+
+	// Either day field matches when both are restricted, 7 is Sunday
+	c, err = parseCron("0 0 1 * 7")
+	assert.NoError(t, err)
+	assert.True(t, c.matches(time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, c.matches(time.Date(2022, 9, 4, 0, 0, 0, 0, time.UTC)))
+	assert.False(t, c.matches(time.Date(2022, 9, 5, 0, 0, 0, 0, time.UTC)))
+
+	for _, expression := range []string{"0 2 * *", "60 * * * *", "0 5-2 * * *", "*/0 * * * *", "a * * * *"} {
+		_, err = parseCron(expression)
+		assert.Error(t, err, expression)
+	}
+}
+
+func TestRule_Active(t *testing.T) {
+	nightly := Rule{Name: "nightly-batch", Cron: "0 2 * * *", DurationMinutes: 120, MinShardCount: 8, LeadMinutes: 20}
+
+	assert.False(t, nightly.Active(time.Date(2022, 9, 1, 1, 39, 0, 0, time.UTC)))
+	assert.True(t, nightly.Active(time.Date(2022, 9, 1, 1, 40, 0, 0, time.UTC)))
+	assert.True(t, nightly.Active(time.Date(2022, 9, 1, 3, 59, 0, 0, time.UTC)))
+	assert.False(t, nightly.Active(time.Date(2022, 9, 1, 4, 0, 0, 0, time.UTC)))
+
+	blackFriday := Rule{
+		Name:          "black-friday",
+		From:          time.Date(2022, 11, 25, 0, 0, 0, 0, time.UTC),
+		To:            time.Date(2022, 11, 28, 0, 0, 0, 0, time.UTC),
+		MinShardCount: 64,
+	}
+
+	// The default lead time applies
+	assert.True(t, blackFriday.Active(time.Date(2022, 11, 24, 23, 30, 0, 0, time.UTC)))
+	assert.False(t, blackFriday.Active(time.Date(2022, 11, 24, 23, 29, 0, 0, time.UTC)))
+	assert.False(t, blackFriday.Active(time.Date(2022, 11, 28, 0, 0, 0, 0, time.UTC)))
+
+	floor, name := Floor([]Rule{nightly, blackFriday}, time.Date(2022, 11, 26, 2, 0, 0, 0, time.UTC))
+	assert.Equal(t, 64, floor)
+	assert.Equal(t, "black-friday", name)
+
+	floor, name = Floor([]Rule{nightly, blackFriday}, time.Date(2022, 11, 1, 12, 0, 0, 0, time.UTC))
+	assert.Equal(t, 0, floor)
+	assert.Equal(t, "", name)
+}
+
+func TestRule_Validate(t *testing.T) {
+	from := time.Date(2022, 11, 25, 0, 0, 0, 0, time.UTC)
+
+	assert.Error(t, Rule{Name: "no-window", MinShardCount: 2}.Validate())
+	assert.Error(t, Rule{Name: "no-duration", Cron: "0 2 * * *", MinShardCount: 2}.Validate())
+	assert.Error(t, Rule{Name: "both", Cron: "0 2 * * *", DurationMinutes: 60, From: from, To: from.Add(time.Hour), MinShardCount: 2}.Validate())
+	assert.Error(t, Rule{Name: "reversed", From: from, To: from.Add(-time.Hour), MinShardCount: 2}.Validate())
+	assert.Error(t, Rule{Name: "no-shards", From: from, To: from.Add(time.Hour)}.Validate())
+	assert.NoError(t, Rule{Name: "range", From: from, To: from.Add(time.Hour), MinShardCount: 2}.Validate())
+}
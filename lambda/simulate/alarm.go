@@ -0,0 +1,160 @@
+package simulate
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awscloudwatch "github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/vmanikes/Nemesis/cloudwatch"
+	"github.com/vmanikes/Nemesis/metricmath"
+	"strings"
+	"time"
+)
+
+const (
+	stateOK               = "OK"
+	stateAlarm            = "ALARM"
+	stateInsufficientData = "INSUFFICIENT_DATA"
+	// streamName is the stream the simulated alarms are built for
+	streamName = "simulated-stream"
+)
+
+// alarm is a local model of one of the scaling alarms
+type alarm struct {
+	action          string
+	scaleDown       bool
+	state           string
+	stateChangeTime time.Time
+
+	// definition and program are the alarm UpdateAlarm builds and its metric math. The throttling alarm has neither
+	definition *awscloudwatch.PutMetricAlarmInput
+	program    *metricmath.Program
+}
+
+func newAlarm(action string, scaleDown bool) *alarm {
+	return &alarm{
+		action:    action,
+		scaleDown: scaleDown,
+		state:     stateInsufficientData,
+	}
+}
+
+// update mirrors UpdateAlarm followed by SetAlarmState to INSUFFICIENT_DATA. The definition is the one UpdateAlarm
+// builds, from the settings
+func (a *alarm) update(shardCount int, settings cloudwatch.AlarmSettings) error {
+	definition, err := cloudwatch.BuildAlarmInput(streamName+"-scale-"+strings.ToLower(a.action), streamName, "",
+		a.scaleDown, shardCount, cloudwatch.ReadSide{}, settings)
+	if err != nil {
+		return err
+	}
+
+	program, err := cloudwatch.CompileMetrics(definition.Metrics)
+	if err != nil {
+		return err
+	}
+
+	a.definition = definition
+	a.program = program
+	a.setInsufficientData()
+
+	return nil
+}
+
+func (a *alarm) setInsufficientData() {
+	a.state = stateInsufficientData
+}
+
+// transition moves the alarm to ALARM or OK and returns true when it went into ALARM, which is when its SNS action runs
+func (a *alarm) transition(breaching bool, now time.Time) bool {
+	next := stateOK
+	if breaching {
+		next = stateAlarm
+	}
+
+	if next == a.state {
+		return false
+	}
+
+	a.state = next
+	a.stateChangeTime = now
+
+	return next == stateAlarm
+}
+
+// evaluate runs the metric math of the alarm over its evaluation periods and checks if enough datapoints breach. It
+// returns the latest datapoint. The shard count of the alarm applies to every datapoint, as it does in cloudwatch
+func (a *alarm) evaluate(periods []period, start time.Time) (float64, bool, error) {
+	evaluationPeriods := int(aws.ToInt32(a.definition.EvaluationPeriods))
+
+	first := 0
+	if len(periods) > evaluationPeriods {
+		first = len(periods) - evaluationPeriods
+	}
+
+	periodLength := time.Duration(aws.ToInt32(a.definition.Metrics[0].MetricStat.Period)) * time.Second
+
+	timestamps := make([]time.Time, 0, len(periods)-first)
+	data := map[string]metricmath.Series{}
+	add := func(id string, timestamp time.Time, value float64) {
+		series := data[id]
+		series.Timestamps = append(series.Timestamps, timestamp)
+		series.Values = append(series.Values, value)
+		data[id] = series
+	}
+
+	for i := first; i < len(periods); i++ {
+		timestamp := start.Add(time.Duration(i) * periodLength)
+		timestamps = append(timestamps, timestamp)
+
+		add("m1", timestamp, periods[i].incomingBytes)
+		add("m2", timestamp, periods[i].incomingRecords)
+		add("m3", timestamp, periods[i].iteratorAgeMax)
+	}
+
+	values, err := a.program.Evaluate(data, timestamps)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var returned metricmath.Series
+	for _, query := range a.definition.Metrics {
+		if aws.ToBool(query.ReturnData) {
+			returned = values[aws.ToString(query.Id)]
+		}
+	}
+
+	threshold := aws.ToFloat64(a.definition.Threshold)
+
+	var (
+		latest    float64
+		breaching int
+	)
+
+	for _, timestamp := range timestamps {
+		value, ok := returned.At(timestamp)
+		if !ok {
+			continue
+		}
+		latest = value
+
+		if cloudwatch.Breaches(a.definition.ComparisonOperator, value, threshold) {
+			breaching++
+		}
+	}
+
+	return latest, breaching >= int(aws.ToInt32(a.definition.DatapointsToAlarm)), nil
+}
+
+// evaluateThrottling checks the throttling alarm, a 1 minute alarm on the throttled records
+func (a *alarm) evaluateThrottling(throttled []float64, cfg Config) (float64, bool) {
+	if len(throttled) < cfg.ThrottleDataPoints {
+		return 0, false
+	}
+
+	window := throttled[len(throttled)-cfg.ThrottleDataPoints:]
+	for _, value := range window {
+		if value < cfg.ThrottledRecordsThreshold {
+			return window[len(window)-1], false
+		}
+	}
+
+	return window[len(window)-1], true
+}
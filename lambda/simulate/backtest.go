@@ -0,0 +1,169 @@
+package simulate
+
+import (
+	"context"
+	"github.com/vmanikes/Nemesis/audit"
+	"github.com/vmanikes/Nemesis/cloudwatch"
+	"os"
+	"time"
+)
+
+// Source provides the historical per minute traffic of a stream
+type Source interface {
+	Profile(ctx context.Context, streamName string, from, to time.Time) (Profile, error)
+}
+
+// FileSource reads the traffic from a CSV file in the format of ReadCSV. The file is expected to hold exactly the
+// backtested range, so the stream name and the range are ignored
+type FileSource struct {
+	Path string
+}
+
+// Profile reads the CSV file
+func (f FileSource) Profile(_ context.Context, _ string, _, _ time.Time) (Profile, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadCSV(file)
+}
+
+// CloudWatchSource reads the traffic from the kinesis metrics of the stream
+type CloudWatchSource struct {
+	Client *cloudwatch.Client
+	// Now picks the finest resolution cloudwatch still retains for the range, time.Now when nil
+	Now func() time.Time
+}
+
+// Profile gets the stream metrics between from and to. Metrics older than the 1 minute retention are fetched at a
+// coarser period and spread evenly over its minutes
+func (c CloudWatchSource) Profile(ctx context.Context, streamName string, from, to time.Time) (Profile, error) {
+	now := time.Now
+	if c.Now != nil {
+		now = c.Now
+	}
+
+	period := metricPeriod(now().Sub(from))
+
+	datapoints, err := c.Client.GetStreamMetrics(ctx, streamName, from, to, period)
+	if err != nil {
+		return nil, err
+	}
+
+	minutes := int(period / time.Minute)
+	profile := make(Profile, 0, len(datapoints)*minutes)
+
+	for _, datapoint := range datapoints {
+		for i := 0; i < minutes; i++ {
+			profile = append(profile, Sample{
+				Bytes:                   datapoint.IncomingBytes / float64(minutes),
+				Records:                 datapoint.IncomingRecords / float64(minutes),
+				IteratorAgeMilliseconds: datapoint.IteratorAgeMilliseconds,
+			})
+		}
+	}
+
+	return profile, nil
+}
+
+// metricPeriod returns the finest period cloudwatch retains for datapoints of the given age
+func metricPeriod(age time.Duration) time.Duration {
+	switch {
+	case age <= 15*24*time.Hour:
+		return time.Minute
+	case age <= 63*24*time.Hour:
+		return 5 * time.Minute
+	default:
+		return time.Hour
+	}
+}
+
+// WithShardCounts returns a copy of the profile, starting at from, with the shard counts the applied scaling events
+// left the stream at. Before the first applied event the stream had the shard count that event started from, without
+// events it had current
+func (p Profile) WithShardCounts(from time.Time, events []audit.ScalingEvent, current int) Profile {
+	applied := make([]audit.ScalingEvent, 0, len(events))
+	for _, event := range events {
+		if event.Outcome == audit.OutcomeApplied {
+			applied = append(applied, event)
+		}
+	}
+
+	shardCount := current
+	if len(applied) > 0 {
+		shardCount = applied[0].ShardCount
+	}
+
+	profile := make(Profile, len(p))
+	next := 0
+
+	for minute, sample := range p {
+		end := from.Add(time.Duration(minute+1) * time.Minute)
+		for next < len(applied) && applied[next].Timestamp.Before(end) {
+			shardCount = applied[next].TargetShardCount
+			next++
+		}
+
+		sample.ShardCount = shardCount
+		profile[minute] = sample
+	}
+
+	return profile
+}
+
+// Backtest compares a policy with what actually ran over historical traffic
+type Backtest struct {
+	// Result is the simulation of the policy. Its ThrottledMinutes are the minutes the stream would have been over
+	// capacity. As the metrics only hold the traffic kinesis accepted, traffic that was throttled in reality is missing
+	Result Result
+	// ActualKnown is set when the profile has the shard count of every minute
+	ActualKnown bool
+	// ActualReshards, ActualShardHours and ActualCost describe what actually ran
+	ActualReshards   int
+	ActualShardHours float64
+	ActualCost       float64
+	// CostDifference is the cost of the policy minus the actual cost
+	CostDifference float64
+}
+
+// RunBacktest replays the profile through the policy of the config and compares the result with the shard counts of
+// the profile. The simulation starts at the actual shard count when it is known
+func RunBacktest(profile Profile, cfg Config) (Backtest, error) {
+	backtest := Backtest{
+		ActualKnown: len(profile) > 0,
+	}
+
+	shardMinutes := 0
+	for minute, sample := range profile {
+		if sample.ShardCount <= 0 {
+			backtest.ActualKnown = false
+			break
+		}
+
+		shardMinutes += sample.ShardCount
+		if minute > 0 && sample.ShardCount != profile[minute-1].ShardCount {
+			backtest.ActualReshards++
+		}
+	}
+
+	if backtest.ActualKnown {
+		cfg.InitialShardCount = profile[0].ShardCount
+
+		backtest.ActualShardHours = float64(shardMinutes) / 60
+		backtest.ActualCost = backtest.ActualShardHours * cfg.ShardHourPrice
+	}
+
+	result, err := Run(profile, cfg)
+	if err != nil {
+		return Backtest{}, err
+	}
+	backtest.Result = result
+
+	if backtest.ActualKnown {
+		backtest.CostDifference = backtest.Result.Cost - backtest.ActualCost
+	}
+
+	return backtest, nil
+}
@@ -0,0 +1,90 @@
+package simulate
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmanikes/Nemesis/audit"
+	"github.com/vmanikes/Nemesis/cloudwatch"
+	"github.com/vmanikes/Nemesis/nemesistest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSource_Profile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traffic.csv")
+	assert.NoError(t, os.WriteFile(path, []byte("bytes,records,shards\n100,10,2\n200,20,2\n"), 0o600))
+
+	profile, err := FileSource{Path: path}.Profile(context.Background(), "test-stream", time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, Profile{
+		{Bytes: 100, Records: 10, ShardCount: 2},
+		{Bytes: 200, Records: 20, ShardCount: 2},
+	}, profile)
+}
+
+func TestCloudWatchSource_Profile(t *testing.T) {
+	now := time.Date(2022, 9, 30, 0, 0, 0, 0, time.UTC)
+	from := now.Add(-20 * 24 * time.Hour)
+
+	fake := nemesistest.NewCloudWatch()
+	fake.AddMetricData("IncomingBytes", "test-stream", map[time.Time]float64{from: 500})
+	fake.AddMetricData("IncomingRecords", "test-stream", map[time.Time]float64{from: 50})
+
+	source := CloudWatchSource{
+		Client: cloudwatch.NewFromAPI(fake),
+		Now:    func() time.Time { return now },
+	}
+
+	// 20 days back only 5 minute datapoints are retained, they are spread over their minutes
+	profile, err := source.Profile(context.Background(), "test-stream", from, from.Add(10*time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, profile, 10)
+	assert.Equal(t, Sample{Bytes: 100, Records: 10}, profile[0])
+	assert.Equal(t, Sample{}, profile[5])
+}
+
+func TestProfile_WithShardCounts(t *testing.T) {
+	from := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	profile := make(Profile, 4)
+
+	events := []audit.ScalingEvent{
+		{Timestamp: from.Add(90 * time.Second), Outcome: audit.OutcomeRejected, ShardCount: 2, TargetShardCount: 8},
+		{Timestamp: from.Add(90 * time.Second), Outcome: audit.OutcomeApplied, ShardCount: 2, TargetShardCount: 4},
+	}
+
+	assert.Equal(t, []int{2, 4, 4, 4}, shardCounts(profile.WithShardCounts(from, events, 4)))
+	assert.Equal(t, []int{3, 3, 3, 3}, shardCounts(profile.WithShardCounts(from, nil, 3)))
+}
+
+func TestRunBacktest(t *testing.T) {
+	// Low traffic on 8 shards for 12 hours, the default policy scales down
+	profile, err := Synthetic{Shape: "constant", Minutes: 12 * 60, BytesPerSecond: 10 * 1024, RecordsPerSecond: 10}.Profile()
+	assert.NoError(t, err)
+	for minute := range profile {
+		profile[minute].ShardCount = 8
+	}
+
+	backtest, err := RunBacktest(profile, DefaultConfig())
+	assert.NoError(t, err)
+
+	assert.True(t, backtest.ActualKnown)
+	assert.Equal(t, 0, backtest.ActualReshards)
+	assert.Equal(t, 96.0, backtest.ActualShardHours)
+	assert.Equal(t, 8, backtest.Result.ShardCounts[0])
+	assert.Greater(t, backtest.Result.Reshards, 0)
+	assert.Less(t, backtest.CostDifference, 0.0)
+
+	backtest, err = RunBacktest(profile[:0], DefaultConfig())
+	assert.NoError(t, err)
+	assert.False(t, backtest.ActualKnown)
+}
+
+func shardCounts(profile Profile) []int {
+	counts := make([]int, 0, len(profile))
+	for _, sample := range profile {
+		counts = append(counts, sample.ShardCount)
+	}
+	return counts
+}
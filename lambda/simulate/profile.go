@@ -0,0 +1,147 @@
+package simulate
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Sample is the traffic a stream receives during one minute
+type Sample struct {
+	Bytes                   float64
+	Records                 float64
+	IteratorAgeMilliseconds float64
+	// ShardCount is the open shard count the stream actually had, 0 when unknown. Only backtests use it
+	ShardCount int
+}
+
+// Profile is the per minute traffic of a stream
+type Profile []Sample
+
+// Synthetic describes a generated traffic profile
+type Synthetic struct {
+	// Shape is one of constant, ramp, sine or spike
+	Shape string
+	// Minutes is the length of the profile
+	Minutes int
+	// BytesPerSecond and RecordsPerSecond are the base traffic
+	BytesPerSecond   float64
+	RecordsPerSecond float64
+	// PeakFactor multiplies the base traffic at the peak of the shape
+	PeakFactor float64
+}
+
+// Profile generates the per minute traffic of the shape. ramp grows linearly from the base to the peak, sine follows
+// a daily cycle between the base and the peak and spike holds the peak for the middle tenth of the profile
+func (s Synthetic) Profile() (Profile, error) {
+	if s.Minutes <= 0 {
+		return nil, errors.New("synthetic profile needs a positive number of minutes")
+	}
+
+	peak := s.PeakFactor
+	if peak <= 0 {
+		peak = 1
+	}
+
+	profile := make(Profile, s.Minutes)
+
+	for minute := range profile {
+		var factor float64
+
+		switch s.Shape {
+		case "constant", "":
+			factor = 1
+		case "ramp":
+			factor = 1 + (peak-1)*float64(minute)/float64(s.Minutes)
+		case "sine":
+			factor = 1 + (peak-1)*(0.5-0.5*math.Cos(2*math.Pi*float64(minute)/(24*60)))
+		case "spike":
+			factor = 1
+			if minute >= s.Minutes*9/20 && minute < s.Minutes*11/20 {
+				factor = peak
+			}
+		default:
+			return nil, fmt.Errorf("unsupported synthetic shape %q", s.Shape)
+		}
+
+		profile[minute] = Sample{
+			Bytes:   s.BytesPerSecond * 60 * factor,
+			Records: s.RecordsPerSecond * 60 * factor,
+		}
+	}
+
+	return profile, nil
+}
+
+// ReadCSV reads a profile with one row per minute. The columns are bytes, records and optionally iterator_age_ms and
+// shards, in that order or in the order of a header row naming them. Other header columns, e.g. a timestamp, are ignored
+func ReadCSV(r io.Reader) (Profile, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{"bytes": 0, "records": 1, "iterator_age_ms": 2, "shards": 3}
+
+	if len(rows) > 0 {
+		if _, err = strconv.ParseFloat(strings.TrimSpace(rows[0][0]), 64); err != nil {
+			columns = make(map[string]int)
+			for i, name := range rows[0] {
+				columns[strings.ToLower(strings.TrimSpace(name))] = i
+			}
+			rows = rows[1:]
+
+			if _, ok := columns["bytes"]; !ok {
+				return nil, errors.New("profile header has no bytes column")
+			}
+			if _, ok := columns["records"]; !ok {
+				return nil, errors.New("profile header has no records column")
+			}
+		}
+	}
+
+	profile := make(Profile, 0, len(rows))
+
+	for line, row := range rows {
+		value := func(column string) (float64, error) {
+			i, ok := columns[column]
+			if !ok || i >= len(row) || strings.TrimSpace(row[i]) == "" {
+				return 0, nil
+			}
+			v, err := strconv.ParseFloat(strings.TrimSpace(row[i]), 64)
+			if err != nil {
+				return 0, fmt.Errorf("row %d, column %s: %w", line+1, column, err)
+			}
+			return v, nil
+		}
+
+		var sample Sample
+		if sample.Bytes, err = value("bytes"); err != nil {
+			return nil, err
+		}
+		if sample.Records, err = value("records"); err != nil {
+			return nil, err
+		}
+		if sample.IteratorAgeMilliseconds, err = value("iterator_age_ms"); err != nil {
+			return nil, err
+		}
+
+		shards, err := value("shards")
+		if err != nil {
+			return nil, err
+		}
+		sample.ShardCount = int(shards)
+
+		profile = append(profile, sample)
+	}
+
+	return profile, nil
+}
@@ -0,0 +1,416 @@
+// Package simulate replays traffic profiles through the Nemesis alarms and scaling decisions, so that the scaling
+// constants can be tuned locally instead of in production
+package simulate
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/vmanikes/Nemesis/clock"
+	"github.com/vmanikes/Nemesis/cloudwatch"
+	"github.com/vmanikes/Nemesis/constants"
+	"github.com/vmanikes/Nemesis/scaling"
+	"time"
+)
+
+const (
+	// bytesPerShardPerMinute and recordsPerShardPerMinute are the write limits of a single shard
+	bytesPerShardPerMinute   = 1024 * 1024 * 60
+	recordsPerShardPerMinute = 1000 * 60
+)
+
+// Policy holds the scaling constants under test
+type Policy struct {
+	ScalePeriodMinutes               int64
+	ScaleUpEvaluationPeriodMinutes   int64
+	ScaleDownEvaluationPeriodMinutes int64
+	DataPointsToScaleUp              int64
+	DataPointsToScaleDown            int64
+	ScaleDownMinIterAgeMinutes       int64
+	ScaleUpThreshold                 float64
+	ScaleDownThreshold               float64
+	MinShardCount                    int
+	MaxShardCount                    int
+	MaxReshardsPerDay                int
+}
+
+// DefaultPolicy returns the policy the Lambda runs with
+func DefaultPolicy() Policy {
+	return Policy{
+		ScalePeriodMinutes:               constants.ScalePeriodMinutes,
+		ScaleUpEvaluationPeriodMinutes:   constants.ScaleUpEvaluationPeriodMinutes,
+		ScaleDownEvaluationPeriodMinutes: constants.ScaleDownEvaluationPeriodMinutes,
+		DataPointsToScaleUp:              constants.DataPointsToScaleUp,
+		DataPointsToScaleDown:            constants.DataPointsToScaleDown,
+		ScaleDownMinIterAgeMinutes:       constants.ScaleDownMinIterAgeMinutes,
+		ScaleUpThreshold:                 constants.ScaleUpThreshold,
+		ScaleDownThreshold:               constants.ScaleDownThreshold,
+		MinShardCount:                    constants.MinShardCount,
+		MaxShardCount:                    constants.MaxShardCount,
+		MaxReshardsPerDay:                constants.MaxReshardsPerDay,
+	}
+}
+
+// apply sets the constants to the policy, so that the defaults the scaling package falls back to, like the cooldown of
+// ScalePeriodMinutes, are those of the policy. It returns a function that restores the previous constants. Simulations
+// must therefore not run concurrently
+func (p Policy) apply() func() {
+	previous := DefaultPolicy()
+
+	set := func(p Policy) {
+		constants.ScalePeriodMinutes = p.ScalePeriodMinutes
+		constants.ScaleUpEvaluationPeriodMinutes = p.ScaleUpEvaluationPeriodMinutes
+		constants.ScaleDownEvaluationPeriodMinutes = p.ScaleDownEvaluationPeriodMinutes
+		constants.DataPointsToScaleUp = p.DataPointsToScaleUp
+		constants.DataPointsToScaleDown = p.DataPointsToScaleDown
+		constants.ScaleDownMinIterAgeMinutes = p.ScaleDownMinIterAgeMinutes
+		constants.ScaleUpThreshold = p.ScaleUpThreshold
+		constants.ScaleDownThreshold = p.ScaleDownThreshold
+		constants.MinShardCount = p.MinShardCount
+		constants.MaxShardCount = p.MaxShardCount
+		constants.MaxReshardsPerDay = p.MaxReshardsPerDay
+	}
+
+	set(p)
+
+	return func() {
+		set(previous)
+	}
+}
+
+// alarmSettings returns the settings of the alarms of a stream with the shard count
+func (p Policy) alarmSettings(shardCount int) cloudwatch.AlarmSettings {
+	return cloudwatch.AlarmSettings{
+		ScalePeriodMinutes:         p.ScalePeriodMinutes,
+		ScaleUpEvaluationPeriods:   p.ScaleUpEvaluationPeriodMinutes,
+		ScaleDownEvaluationPeriods: p.ScaleDownEvaluationPeriodMinutes,
+		DataPointsToScaleUp:        p.DataPointsToScaleUp,
+		DataPointsToScaleDown:      p.DataPointsToScaleDown,
+		ScaleUpThreshold:           p.ScaleUpThreshold,
+		ScaleDownThreshold:         scaling.ScaleDownThreshold(shardCount, p.MinShardCount, p.ScaleDownThreshold),
+		ScaleDownMinIterAgeMinutes: p.ScaleDownMinIterAgeMinutes,
+	}
+}
+
+// Config configures a simulation
+type Config struct {
+	Policy Policy
+	// Strategy decides the target shard counts, the strategy of DefaultStrategy when nil
+	Strategy scaling.ScalingStrategy
+	// Cooldowns are checked before every scaling action but the emergency scale-ups
+	Cooldowns scaling.Cooldowns
+	// InitialShardCount is the shard count of the stream and of the alarms at the start
+	InitialShardCount int
+	// ReshardMinutes is how long the stream stays UPDATING after a shard count update
+	ReshardMinutes int
+	// ThrottlingAlarm simulates the throttling alarm that triggers emergency scale-ups
+	ThrottlingAlarm bool
+	// ThrottledRecordsThreshold and ThrottleDataPoints configure the throttling alarm, with a 1 minute period
+	ThrottledRecordsThreshold float64
+	ThrottleDataPoints        int
+	// ShardHourPrice is the price of one shard hour
+	ShardHourPrice float64
+	// Start is the wall clock time of the first minute
+	Start time.Time
+}
+
+// DefaultConfig returns the configuration matching the Lambda and the Terraform defaults
+func DefaultConfig() Config {
+	return Config{
+		Policy:                    DefaultPolicy(),
+		InitialShardCount:         1,
+		ReshardMinutes:            2,
+		ThrottlingAlarm:           true,
+		ThrottledRecordsThreshold: 100,
+		ThrottleDataPoints:        3,
+		ShardHourPrice:            0.015,
+		Start:                     time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// Action is a single invocation of the scaling Lambda during the simulation
+type Action struct {
+	Minute      int
+	Time        time.Time
+	Action      string
+	Outcome     string
+	Reason      string
+	ShardCount  int
+	TargetCount int
+	UsageFactor float64
+}
+
+// Result is the outcome of a simulation
+type Result struct {
+	// Minutes is the length of the simulation
+	Minutes int
+	// ShardCounts is the open shard count of every minute
+	ShardCounts []int
+	// Timeline holds every Lambda invocation
+	Timeline []Action
+	// Reshards is the number of shard count updates
+	Reshards int
+	// ThrottledMinutes is the number of minutes in which producers were throttled
+	ThrottledMinutes int
+	// ThrottledRecords is the number of records rejected by kinesis
+	ThrottledRecords float64
+	// ShardHours and Cost are the shard hours used and their price
+	ShardHours float64
+	Cost       float64
+}
+
+// period is the aggregated traffic of one alarm period, as the alarm metrics see it
+type period struct {
+	incomingBytes   float64
+	incomingRecords float64
+	iteratorAgeMax  float64
+}
+
+// simulation is the state of a running simulation
+type simulation struct {
+	cfg    Config
+	result Result
+
+	shardCount     int
+	targetCount    int
+	updatingUntil  int
+	shardMinutes   int
+	reshardMinutes []int
+	lastScaled     string
+	history        []scaling.Action
+
+	scaleUp    *alarm
+	scaleDown  *alarm
+	throttling *alarm
+
+	periods          []period
+	current          period
+	throttledHistory []float64
+}
+
+// Run replays the profile minute by minute through the alarms UpdateAlarm builds, and the alarms that fire through
+// ShouldScaleKinesis, the cooldowns and Decide with the strategy, as the Lambda handles them. Nothing else of the Lambda
+// is simulated: there are no scheduled minimums, forecasts, freezes or read side alarms
+func Run(profile Profile, cfg Config) (Result, error) {
+	restore := cfg.Policy.apply()
+	defer restore()
+
+	if cfg.Strategy == nil {
+		strategy, err := scaling.Strategies{}.Fallback()
+		if err != nil {
+			return Result{}, err
+		}
+		cfg.Strategy = strategy
+	}
+
+	s := &simulation{
+		cfg:         cfg,
+		shardCount:  cfg.InitialShardCount,
+		targetCount: cfg.InitialShardCount,
+		result: Result{
+			Minutes:     len(profile),
+			ShardCounts: make([]int, 0, len(profile)),
+		},
+		scaleUp:    newAlarm("Up", false),
+		scaleDown:  newAlarm("Down", true),
+		throttling: newAlarm("Emergency", false),
+	}
+
+	for _, a := range []*alarm{s.scaleUp, s.scaleDown} {
+		if err := a.update(cfg.InitialShardCount, cfg.Policy.alarmSettings(cfg.InitialShardCount)); err != nil {
+			return Result{}, err
+		}
+	}
+
+	for minute, sample := range profile {
+		if err := s.step(minute, sample); err != nil {
+			return Result{}, err
+		}
+	}
+
+	s.result.ShardHours = float64(s.shardMinutes) / 60
+	s.result.Cost = s.result.ShardHours * cfg.ShardHourPrice
+
+	return s.result, nil
+}
+
+// step simulates a single minute
+func (s *simulation) step(minute int, sample Sample) error {
+	if s.updatingUntil > 0 && minute >= s.updatingUntil {
+		s.shardCount = s.targetCount
+		s.updatingUntil = 0
+	}
+
+	s.result.ShardCounts = append(s.result.ShardCounts, s.shardCount)
+	s.shardMinutes += s.shardCount
+
+	// Kinesis rejects everything above the write limits of the open shards
+	accepted := 1.0
+	if sample.Bytes > 0 {
+		accepted = minFloat(accepted, float64(s.shardCount*bytesPerShardPerMinute)/sample.Bytes)
+	}
+	if sample.Records > 0 {
+		accepted = minFloat(accepted, float64(s.shardCount*recordsPerShardPerMinute)/sample.Records)
+	}
+
+	throttled := sample.Records * (1 - accepted)
+	if throttled > 0 {
+		s.result.ThrottledMinutes++
+		s.result.ThrottledRecords += throttled
+	}
+	s.throttledHistory = append(s.throttledHistory, throttled)
+
+	s.current.incomingBytes += sample.Bytes * accepted
+	s.current.incomingRecords += sample.Records * accepted
+	s.current.iteratorAgeMax = maxFloat(s.current.iteratorAgeMax, sample.IteratorAgeMilliseconds)
+
+	now := s.cfg.Start.Add(time.Duration(minute) * time.Minute)
+
+	if s.cfg.ThrottlingAlarm {
+		value, breaching := s.throttling.evaluateThrottling(s.throttledHistory, s.cfg)
+		if s.throttling.transition(breaching, now) {
+			if err := s.invoke(minute, now, s.throttling, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	periodMinutes := int(s.cfg.Policy.ScalePeriodMinutes)
+	if (minute+1)%periodMinutes != 0 {
+		return nil
+	}
+
+	s.periods = append(s.periods, s.current)
+	s.current = period{}
+
+	for _, a := range []*alarm{s.scaleUp, s.scaleDown} {
+		value, breaching, err := a.evaluate(s.periods, s.cfg.Start)
+		if err != nil {
+			return err
+		}
+
+		if a.transition(breaching, now) {
+			if err = s.invoke(minute, now, a, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// invoke runs the decisions handleRequest makes for the alarm that went into ALARM
+func (s *simulation) invoke(minute int, now time.Time, triggered *alarm, usageFactor float64) error {
+	action := Action{
+		Minute:      minute,
+		Time:        now,
+		Action:      triggered.action,
+		ShardCount:  s.shardCount,
+		UsageFactor: usageFactor,
+	}
+	defer func() {
+		s.result.Timeline = append(s.result.Timeline, action)
+	}()
+
+	emergency := triggered.action == "Emergency"
+	if emergency {
+		triggered.setInsufficientData()
+	}
+
+	if !emergency {
+		shouldScale, err := scaling.ShouldScaleKinesis(s.lastScaled, clock.FormatLegacy(triggered.stateChangeTime))
+		if err != nil {
+			action.Outcome, action.Reason = "Failed", err.Error()
+			return err
+		}
+		if !shouldScale {
+			action.Outcome, action.Reason = "Rejected", "alarm changed state before the last scaling event"
+			triggered.setInsufficientData()
+			return nil
+		}
+
+		decision := s.cfg.Cooldowns.Check(s.history, triggered.action, now)
+		if !decision.Allowed {
+			action.Outcome, action.Reason = "Rejected", decision.Reason()
+			triggered.setInsufficientData()
+			return nil
+		}
+	}
+
+	// The throttling alarm does not compare usage factors
+	decision := scaling.DecisionContext{
+		StreamName: streamName,
+		Action:     triggered.action,
+		ShardCount: s.shardCount,
+		Bounds: scaling.Bounds{
+			MinShardCount: s.cfg.Policy.MinShardCount,
+			MaxShardCount: s.cfg.Policy.MaxShardCount,
+		},
+		ScaleDownThreshold: s.cfg.Policy.ScaleDownThreshold,
+		History:            s.history,
+	}
+	if !emergency {
+		decision.UsageFactors = []float64{usageFactor}
+		decision.Threshold = aws.ToFloat64(triggered.definition.Threshold)
+	}
+	if triggered.action == "Down" && len(s.periods) > 0 {
+		decision.IteratorAgeMinutes = s.periods[len(s.periods)-1].iteratorAgeMax / 1000 / 60
+	}
+
+	target := scaling.Decide(s.cfg.Strategy, decision).ShardCount
+	action.TargetCount = target
+
+	switch {
+	case target == s.shardCount:
+		action.Outcome, action.Reason = "Skipped", "already at the target shard count"
+		return nil
+	case s.updatingUntil > 0:
+		action.Outcome, action.Reason = "Skipped", "stream is UPDATING"
+		return nil
+	case s.reshardsSince(minute-24*60) >= s.cfg.Policy.MaxReshardsPerDay:
+		action.Outcome, action.Reason = "Skipped", "reshard quota used up"
+		return nil
+	}
+
+	s.targetCount = target
+	s.updatingUntil = minute + 1 + s.cfg.ReshardMinutes
+	s.reshardMinutes = append(s.reshardMinutes, minute)
+	s.result.Reshards++
+	s.lastScaled = clock.FormatLegacy(now)
+	s.history = append(s.history, scaling.Action{Action: triggered.action, Timestamp: now})
+
+	for _, a := range []*alarm{s.scaleUp, s.scaleDown} {
+		if err := a.update(target, s.cfg.Policy.alarmSettings(target)); err != nil {
+			action.Outcome, action.Reason = "Failed", err.Error()
+			return err
+		}
+	}
+
+	action.Outcome = "Applied"
+
+	return nil
+}
+
+// reshardsSince returns the number of shard count updates at or after the minute
+func (s *simulation) reshardsSince(minute int) int {
+	count := 0
+	for _, m := range s.reshardMinutes {
+		if m >= minute {
+			count++
+		}
+	}
+
+	return count
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,128 @@
+package simulate
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/vmanikes/Nemesis/constants"
+	"github.com/vmanikes/Nemesis/scaling"
+	"strings"
+	"testing"
+)
+
+func TestRunConstantTrafficDoesNotScale(t *testing.T) {
+	profile, err := Synthetic{Shape: "constant", Minutes: 6 * 60, BytesPerSecond: 100 * 1024, RecordsPerSecond: 100}.Profile()
+	assert.NoError(t, err)
+
+	cfg := DefaultConfig()
+	cfg.InitialShardCount = 1
+
+	result, err := Run(profile, cfg)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 0, result.Reshards)
+	assert.Equal(t, 0, result.ThrottledMinutes)
+	assert.Equal(t, 6.0, result.ShardHours)
+	assert.InDelta(t, 6*0.015, result.Cost, 1e-9)
+}
+
+func TestRunRampScalesUp(t *testing.T) {
+	profile, err := Synthetic{Shape: "ramp", Minutes: 6 * 60, BytesPerSecond: 100 * 1024, RecordsPerSecond: 100, PeakFactor: 20}.Profile()
+	assert.NoError(t, err)
+
+	cfg := DefaultConfig()
+	cfg.InitialShardCount = 1
+
+	result, err := Run(profile, cfg)
+	assert.NoError(t, err)
+
+	assert.Greater(t, result.Reshards, 0)
+	assert.Greater(t, result.ShardCounts[len(result.ShardCounts)-1], 1)
+	assert.Len(t, result.ShardCounts, 6*60)
+
+	for _, action := range result.Timeline {
+		if action.Outcome == "Applied" {
+			assert.Greater(t, action.TargetCount, action.ShardCount)
+		}
+	}
+}
+
+func TestRunStrategyAndCooldowns(t *testing.T) {
+	profile, err := Synthetic{Shape: "ramp", Minutes: 6 * 60, BytesPerSecond: 100 * 1024, RecordsPerSecond: 100, PeakFactor: 20}.Profile()
+	assert.NoError(t, err)
+
+	cfg := DefaultConfig()
+	cfg.ThrottlingAlarm = false
+	cfg.Strategy = scaling.Step{ScaleUpPercent: 50, ScaleDownPercent: 25}
+	cfg.Cooldowns = scaling.Cooldowns{ScaleUpMinutes: 60}
+	cfg.InitialShardCount = 2
+
+	result, err := Run(profile, cfg)
+	assert.NoError(t, err)
+
+	var applied []Action
+	for _, action := range result.Timeline {
+		switch action.Outcome {
+		case "Applied":
+			applied = append(applied, action)
+		case "Rejected":
+			assert.Contains(t, action.Reason, "cooldown of 1h0m0s since the scale-Up")
+		}
+	}
+
+	// The step strategy adds half of the shards, and the configured cooldown holds the next scale-up back for an hour
+	if assert.NotEmpty(t, applied) {
+		assert.Equal(t, 3, applied[0].TargetCount)
+	}
+	for i := 1; i < len(applied); i++ {
+		assert.GreaterOrEqual(t, applied[i].Minute-applied[i-1].Minute, 60)
+	}
+}
+
+func TestRunRestoresConstants(t *testing.T) {
+	profile, err := Synthetic{Shape: "constant", Minutes: 60, BytesPerSecond: 10}.Profile()
+	assert.NoError(t, err)
+
+	previous := constants.ScaleUpThreshold
+
+	cfg := DefaultConfig()
+	cfg.Policy.ScaleUpThreshold = 0.5
+
+	_, err = Run(profile, cfg)
+	assert.NoError(t, err)
+
+	assert.Equal(t, previous, constants.ScaleUpThreshold)
+}
+
+func TestSyntheticUnsupportedShape(t *testing.T) {
+	_, err := Synthetic{Shape: "square", Minutes: 10}.Profile()
+	assert.Error(t, err)
+}
+
+func TestReadCSV(t *testing.T) {
+	profile, err := ReadCSV(strings.NewReader("100,10\n200,20,3000\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, Profile{
+		{Bytes: 100, Records: 10},
+		{Bytes: 200, Records: 20, IteratorAgeMilliseconds: 3000},
+	}, profile)
+
+	profile, err = ReadCSV(strings.NewReader("timestamp,records,bytes\n2022-01-01T00:00:00Z,10,100\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, Profile{{Bytes: 100, Records: 10}}, profile)
+
+	_, err = ReadCSV(strings.NewReader("timestamp,records\n2022-01-01T00:00:00Z,10\n"))
+	assert.Error(t, err)
+
+	_, err = ReadCSV(strings.NewReader("100,abc\n"))
+	assert.Error(t, err)
+}
+
+func TestRunInvalidPolicy(t *testing.T) {
+	profile, err := Synthetic{Shape: "constant", Minutes: 60, BytesPerSecond: 10}.Profile()
+	assert.NoError(t, err)
+
+	cfg := DefaultConfig()
+	cfg.Policy.ScaleDownMinIterAgeMinutes = 0
+
+	_, err = Run(profile, cfg)
+	assert.Error(t, err)
+}
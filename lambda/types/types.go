@@ -5,8 +5,13 @@ import (
 	"errors"
 	"github.com/vmanikes/Nemesis/logging"
 	"go.uber.org/zap"
+	"regexp"
+	"strconv"
 )
 
+// datapointRegex matches a single datapoint, e.g. 0.43262672424316406 (23/04/20 21:16:00), in the state reason
+var datapointRegex = regexp.MustCompile(`(-?[0-9]+(?:\.[0-9]+)?(?:[eE][-+]?[0-9]+)?) \(\d{2}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}\)`)
+
 type AlarmInformation map[string]interface{}
 
 // GetAlarmName extracts the alarm name from the event payload
@@ -68,4 +73,35 @@ func (a AlarmInformation) GetStreamName() (stream string) {
 	}
 
 	return stream
-}
\ No newline at end of file
+}
+
+// GetUsageFactors extracts the datapoints that caused the state change from the state reason of the event payload.
+// The most recent datapoint comes first
+func (a AlarmInformation) GetUsageFactors() []float64 {
+	reason, ok := a["NewStateReason"].(string)
+	if !ok {
+		return nil
+	}
+
+	usageFactors := make([]float64, 0)
+	for _, match := range datapointRegex.FindAllStringSubmatch(reason, -1) {
+		value, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			continue
+		}
+		usageFactors = append(usageFactors, value)
+	}
+
+	return usageFactors
+}
+
+// GetThreshold extracts the threshold of the alarm from the trigger of the event payload
+func (a AlarmInformation) GetThreshold() (float64, bool) {
+	trigger, ok := a["Trigger"].(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+
+	threshold, ok := trigger["Threshold"].(float64)
+	return threshold, ok
+}
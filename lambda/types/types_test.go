@@ -12,7 +12,7 @@ import (
 
 var (
 	testAlarmInfo AlarmInformation
-	badAlarmInfo AlarmInformation
+	badAlarmInfo  AlarmInformation
 )
 
 func TestMain(m *testing.M) {
@@ -92,4 +92,24 @@ func TestAlarmInformation_GetStateChangeTime_Error(t *testing.T) {
 
 func TestAlarmInformation_GetStreamNames(t *testing.T) {
 	assert.Equal(t, "test-stream", testAlarmInfo.GetStreamName())
-}
\ No newline at end of file
+}
+
+func TestAlarmInformation_GetUsageFactors(t *testing.T) {
+	assert.Equal(t, []float64{0.43262672424316406}, testAlarmInfo.GetUsageFactors())
+
+	multipleDatapoints := AlarmInformation{
+		"NewStateReason": "Threshold Crossed: 2 out of the last 2 datapoints [0.8 (23/04/20 21:16:00), 0.76 (23/04/20 21:11:00)] was greater than or equal to the threshold (0.75).",
+	}
+	assert.Equal(t, []float64{0.8, 0.76}, multipleDatapoints.GetUsageFactors())
+
+	assert.Empty(t, AlarmInformation{}.GetUsageFactors())
+}
+
+func TestAlarmInformation_GetThreshold(t *testing.T) {
+	threshold, ok := testAlarmInfo.GetThreshold()
+	assert.True(t, ok)
+	assert.Equal(t, 0.4, threshold)
+
+	_, ok = AlarmInformation{}.GetThreshold()
+	assert.False(t, ok)
+}
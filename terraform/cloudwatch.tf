@@ -8,6 +8,9 @@ locals {
   stream_scale_down_evaluation_period   = 300 / local.stream_period_mins
   stream_scale_down_datapoints_required = 285 / local.stream_period_mins
   stream_scale_down_min_iter_age_mins   = 30
+  stream_throttle_period_secs           = 60
+  stream_throttle_datapoints_required   = 3
+  stream_throttled_records_threshold    = 100
 }
 
 resource "aws_cloudwatch_metric_alarm" "nemesis_scale_up" {
@@ -20,6 +23,12 @@ resource "aws_cloudwatch_metric_alarm" "nemesis_scale_up" {
   insufficient_data_actions = []
   alarm_actions             = [aws_sns_topic.kinesis_scaling_sns_topic.arn]
 
+  # Nemesis pairs the alarms by these tags, the names only matter for the alarms that are not tagged
+  tags = {
+    ScaleAction        = "Up"
+    ComplimentaryAlarm = "${var.kinesis_datastream_name}-scale-down"
+  }
+
   metric_query {
     id         = "s1"
     label      = "ShardCount"
@@ -78,16 +87,95 @@ resource "aws_cloudwatch_metric_alarm" "nemesis_scale_up" {
     expression = "e2/(1000*60*${local.stream_period_mins}*s1)"
   }
 
+  dynamic "metric_query" {
+    for_each = var.read_side_scaling ? [1] : []
+    content {
+      id    = "m4"
+      label = "GetRecords.Bytes"
+      metric {
+        metric_name = "GetRecords.Bytes"
+        namespace   = "AWS/Kinesis"
+        period      = local.stream_period_secs
+        stat        = "Sum"
+        dimensions = {
+          StreamName = var.kinesis_datastream_name
+        }
+      }
+    }
+  }
+
+  dynamic "metric_query" {
+    for_each = var.read_side_scaling ? [1] : []
+    content {
+      id    = "m5"
+      label = "ReadProvisionedThroughputExceeded"
+      metric {
+        metric_name = "ReadProvisionedThroughputExceeded"
+        namespace   = "AWS/Kinesis"
+        period      = local.stream_period_secs
+        stat        = "Sum"
+        dimensions = {
+          StreamName = var.kinesis_datastream_name
+        }
+      }
+    }
+  }
+
+  dynamic "metric_query" {
+    for_each = var.read_side_scaling ? [1] : []
+    content {
+      id         = "e7"
+      label      = "OutgoingBytesUsageFactor"
+      expression = "FILL(m4,0)/(2*1024*1024*60*${local.stream_period_mins}*s1)"
+    }
+  }
+
+  dynamic "metric_query" {
+    for_each = var.read_side_scaling ? [1] : []
+    content {
+      id         = "e9"
+      label      = "ReadThrottleUsageFactor"
+      expression = "FILL(m5,0)/(5*60*${local.stream_period_mins}*s1)"
+    }
+  }
+
+  dynamic "metric_query" {
+    for_each = var.read_side_scaling && var.standard_consumer_count > 0 ? [1] : []
+    content {
+      id         = "e8"
+      label      = "ConsumerFanOutUsageFactor"
+      expression = "e3*s3/2"
+    }
+  }
+
+  dynamic "metric_query" {
+    for_each = var.read_side_scaling && var.standard_consumer_count > 0 ? [1] : []
+    content {
+      id         = "s3"
+      label      = "StandardConsumerCount"
+      expression = var.standard_consumer_count
+    }
+  }
+
   metric_query {
     id          = "e5"
     label       = "MaxIncomingUsageFactor"
-    expression  = "MAX([e3,e4])"
+    expression  = "MAX([${join(",", concat(["e3", "e4"], local.read_side_usage_factors))}])"
     return_data = true
   }
 
+  # Nemesis keeps its scaling metadata in these tags
   lifecycle {
     ignore_changes = [
-      tags["LastScaledTimestamp"]
+      tags["NemesisTagSchema"],
+      tags["LastScaledTimestamp"],
+      tags["LastScaledAt"],
+      tags["PreviousShardCount"],
+      tags["ShardCount"],
+      tags["LastDecisionReason"],
+      tags["LastRequestId"],
+      tags["NemesisVersion"],
+      tags["RecentActions"]
     ]
   }
 
@@ -106,6 +194,12 @@ resource "aws_cloudwatch_metric_alarm" "nemesis_scale_down" {
   insufficient_data_actions = []
   alarm_actions             = [aws_sns_topic.kinesis_scaling_sns_topic.arn]
 
+  # Nemesis pairs the alarms by these tags, the names only matter for the alarms that are not tagged
+  tags = {
+    ScaleAction        = "Down"
+    ComplimentaryAlarm = "${var.kinesis_datastream_name}-scale-up"
+  }
+
   metric_query {
     id         = "s1"
     label      = "ShardCount"
@@ -190,20 +284,174 @@ resource "aws_cloudwatch_metric_alarm" "nemesis_scale_down" {
     expression = "(FILL(m3,0)/1000/60)*(${local.stream_scale_down_threshold}/s2)"
   }
 
+  dynamic "metric_query" {
+    for_each = var.read_side_scaling ? [1] : []
+    content {
+      id    = "m4"
+      label = "GetRecords.Bytes"
+      metric {
+        metric_name = "GetRecords.Bytes"
+        namespace   = "AWS/Kinesis"
+        period      = local.stream_period_secs
+        stat        = "Sum"
+        dimensions = {
+          StreamName = var.kinesis_datastream_name
+        }
+      }
+    }
+  }
+
+  dynamic "metric_query" {
+    for_each = var.read_side_scaling ? [1] : []
+    content {
+      id    = "m5"
+      label = "ReadProvisionedThroughputExceeded"
+      metric {
+        metric_name = "ReadProvisionedThroughputExceeded"
+        namespace   = "AWS/Kinesis"
+        period      = local.stream_period_secs
+        stat        = "Sum"
+        dimensions = {
+          StreamName = var.kinesis_datastream_name
+        }
+      }
+    }
+  }
+
+  dynamic "metric_query" {
+    for_each = var.read_side_scaling ? [1] : []
+    content {
+      id         = "e7"
+      label      = "OutgoingBytesUsageFactor"
+      expression = "FILL(m4,0)/(2*1024*1024*60*${local.stream_period_mins}*s1)"
+    }
+  }
+
+  dynamic "metric_query" {
+    for_each = var.read_side_scaling ? [1] : []
+    content {
+      id         = "e9"
+      label      = "ReadThrottleUsageFactor"
+      expression = "FILL(m5,0)/(5*60*${local.stream_period_mins}*s1)"
+    }
+  }
+
+  dynamic "metric_query" {
+    for_each = var.read_side_scaling && var.standard_consumer_count > 0 ? [1] : []
+    content {
+      id         = "e8"
+      label      = "ConsumerFanOutUsageFactor"
+      expression = "e3*s3/2"
+    }
+  }
+
+  dynamic "metric_query" {
+    for_each = var.read_side_scaling && var.standard_consumer_count > 0 ? [1] : []
+    content {
+      id         = "s3"
+      label      = "StandardConsumerCount"
+      expression = var.standard_consumer_count
+    }
+  }
+
   metric_query {
     id          = "e6"
     label       = "MaxIncomingUsageFactor"
-    expression  = "MAX([e3,e4,e5])"
+    expression  = "MAX([${join(",", concat(["e3", "e4", "e5"], local.read_side_usage_factors))}])"
     return_data = true
   }
 
+  # Nemesis keeps its scaling metadata in these tags
   lifecycle {
     ignore_changes = [
-      tags["LastScaledTimestamp"]
+      tags["NemesisTagSchema"],
+      tags["LastScaledTimestamp"],
+      tags["LastScaledAt"],
+      tags["PreviousShardCount"],
+      tags["ShardCount"],
+      tags["LastDecisionReason"],
+      tags["LastRequestId"],
+      tags["NemesisVersion"],
+      tags["RecentActions"]
     ]
   }
 
   depends_on = [
     aws_lambda_function.nemesis_scaling_function
   ]
-}
\ No newline at end of file
+}
+
+resource "aws_cloudwatch_metric_alarm" "nemesis_scale_up_throttling" {
+  count                     = var.throttling_scale_up ? 1 : 0
+  alarm_name                = "${var.kinesis_datastream_name}-scale-up-throttling"
+  comparison_operator       = "GreaterThanOrEqualToThreshold"
+  evaluation_periods        = local.stream_throttle_datapoints_required
+  datapoints_to_alarm       = local.stream_throttle_datapoints_required
+  threshold                 = local.stream_throttled_records_threshold
+  alarm_description         = "Producers are being throttled, scale up bypassing the cooldown"
+  insufficient_data_actions = []
+  alarm_actions             = [aws_sns_topic.nemesis_scaling_sns_topic.arn]
+
+  # The throttling alarm is paired with the scale-up alarm
+  tags = {
+    ScaleAction        = "Emergency"
+    ComplimentaryAlarm = "${var.kinesis_datastream_name}-scale-up"
+  }
+
+  metric_query {
+    id    = "m1"
+    label = "WriteProvisionedThroughputExceeded"
+    metric {
+      metric_name = "WriteProvisionedThroughputExceeded"
+      namespace   = "AWS/Kinesis"
+      period      = local.stream_throttle_period_secs
+      stat        = "Sum"
+      dimensions = {
+        StreamName = var.kinesis_datastream_name
+      }
+    }
+  }
+
+  dynamic "metric_query" {
+    for_each = var.include_put_records_throttled_records ? [1] : []
+    content {
+      id    = "m2"
+      label = "PutRecords.ThrottledRecords"
+      metric {
+        metric_name = "PutRecords.ThrottledRecords"
+        namespace   = "AWS/Kinesis"
+        period      = local.stream_throttle_period_secs
+        stat        = "Sum"
+        dimensions = {
+          StreamName = var.kinesis_datastream_name
+        }
+      }
+    }
+  }
+
+  metric_query {
+    id          = "e1"
+    label       = "ThrottledRecords"
+    expression  = var.include_put_records_throttled_records ? "MAX([FILL(m1,0),FILL(m2,0)])" : "FILL(m1,0)"
+    return_data = true
+  }
+
+  # Nemesis migrates the metadata of the alarm that fired into these tags
+  lifecycle {
+    ignore_changes = [
+      tags["NemesisTagSchema"],
+      tags["LastScaledTimestamp"],
+      tags["LastScaledAt"],
+      tags["PreviousShardCount"],
+      tags["ShardCount"],
+      tags["LastDecisionReason"],
+      tags["LastRequestId"],
+      tags["NemesisVersion"],
+      tags["RecentActions"]
+    ]
+  }
+
+  depends_on = [
+    aws_lambda_function.nemesis_scaling_function
+  ]
+}
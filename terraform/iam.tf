@@ -23,6 +23,7 @@ data "aws_iam_policy_document" "nemesis_scaling_lambda_policy_document" {
     resources = ["*"]
 
     actions = [
+      "cloudwatch:DeleteAlarms",
       "cloudwatch:DescribeAlarms",
       "cloudwatch:GetMetricData",
       "cloudwatch:ListMetrics",
@@ -30,7 +31,8 @@ data "aws_iam_policy_document" "nemesis_scaling_lambda_policy_document" {
       "cloudwatch:PutMetricData",
       "cloudwatch:ListTagsForResource",
       "cloudwatch:SetAlarmState",
-      "cloudwatch:TagResource"
+      "cloudwatch:TagResource",
+      "cloudwatch:UntagResource"
     ]
   }
 
@@ -55,10 +57,36 @@ data "aws_iam_policy_document" "nemesis_scaling_lambda_policy_document" {
       "kinesis:DescribeStreamSummary",
       "kinesis:AddTagsToStream",
       "kinesis:ListTagsForStream",
+      "kinesis:RemoveTagsFromStream",
       "kinesis:UpdateShardCount",
     ]
   }
 
+  statement {
+    sid       = "AllowAuditTrail"
+    effect    = "Allow"
+    resources = ["*"]
+
+    actions = [
+      "dynamodb:PutItem",
+      "dynamodb:Query",
+      "s3:GetObject",
+      "s3:ListBucket",
+      "s3:PutObject",
+    ]
+  }
+
+  statement {
+    sid       = "AllowReadScalingPolicy"
+    effect    = "Allow"
+    resources = ["*"]
+
+    actions = [
+      "s3:GetObject",
+      "ssm:GetParameter",
+    ]
+  }
+
   statement {
     sid       = "AllowPublishToSNS"
     effect    = "Allow"
@@ -76,9 +104,33 @@ data "aws_iam_policy_document" "nemesis_scaling_lambda_policy_document" {
 
     actions = [
       "lambda:PutFunctionConcurrency",
-      "lambda:DeleteFunctionConcurrency"
     ]
   }
+
+  statement {
+    sid       = "AllowUpdateEventSourceMappingsForLambda"
+    effect    = "Allow"
+    resources = ["*"]
+
+    actions = [
+      "lambda:ListEventSourceMappings",
+      "lambda:UpdateEventSourceMapping",
+    ]
+  }
+
+  dynamic "statement" {
+    for_each = length(var.assume_role_arns) > 0 ? [1] : []
+
+    content {
+      sid       = "AllowAssumeCrossAccountRoles"
+      effect    = "Allow"
+      resources = var.assume_role_arns
+
+      actions = [
+        "sts:AssumeRole",
+      ]
+    }
+  }
 }
 
 resource "aws_iam_policy" "nemesis_scaling_lambda_policy" {
@@ -30,6 +30,14 @@ resource "aws_lambda_function" "nemesis_scaling_function" {
   timeout                        = 900
   memory_size                    = 512
   reserved_concurrent_executions = 1
+
+  environment {
+    variables = {
+      NEMESIS_AUDIT_STORE = var.audit_store_uri
+      NEMESIS_CONFIG      = local.nemesis_config
+      NEMESIS_POLICY      = var.scaling_policy_source
+    }
+  }
 }
 
 // TODO Check if zip can be part of terraform module
@@ -1,4 +1,29 @@
 locals {
   account_id = data.aws_caller_identity.current.account_id
   region     = data.aws_region.current.name
-}
\ No newline at end of file
+}
+
+locals {
+  # The schedules and forecast of nemesis_config take precedence over scheduled_scaling_rules and predictive_scaling
+  nemesis_config = jsonencode(merge(
+    {
+      schedules = { (var.kinesis_datastream_name) = var.scheduled_scaling_rules }
+      forecast  = { enabled = var.predictive_scaling, streams = [var.kinesis_datastream_name] }
+    },
+    jsondecode(var.nemesis_config == "" ? "{}" : var.nemesis_config),
+    {
+      readSide = {
+        enabled           = var.read_side_scaling
+        standardConsumers = var.standard_consumer_count
+      }
+    },
+  ))
+
+  # The scheduled invocations evaluate the scheduled scaling rules and the forecasts
+  scheduled_invocations = length(var.scheduled_scaling_rules) > 0 || var.predictive_scaling
+
+  read_side_usage_factors = concat(
+    var.read_side_scaling ? ["e7", "e9"] : [],
+    var.read_side_scaling && var.standard_consumer_count > 0 ? ["e8"] : [],
+  )
+}
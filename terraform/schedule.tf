@@ -0,0 +1,21 @@
+resource "aws_cloudwatch_event_rule" "nemesis_scheduled_scaling" {
+  count               = local.scheduled_invocations ? 1 : 0
+  name                = "Nemesis-${var.kinesis_datastream_name}-scheduled-scaling"
+  description         = "Evaluates the scheduled scaling rules and the forecasts of the kinesis stream"
+  schedule_expression = var.scheduled_scaling_rate
+}
+
+resource "aws_cloudwatch_event_target" "nemesis_scheduled_scaling" {
+  count = local.scheduled_invocations ? 1 : 0
+  rule  = aws_cloudwatch_event_rule.nemesis_scheduled_scaling[0].name
+  arn   = aws_lambda_function.nemesis_scaling_function.arn
+}
+
+resource "aws_lambda_permission" "nemesis_scheduled_scaling_permission" {
+  count         = local.scheduled_invocations ? 1 : 0
+  statement_id  = "AllowExecutionFromEventBridge"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.nemesis_scaling_function.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.nemesis_scheduled_scaling[0].arn
+}
@@ -4,4 +4,59 @@ variable "kinesis_datastream_name" {
 
 variable "tags" {
   description = "Custom tags for the services created with Nemesis"
-}
\ No newline at end of file
+}
+
+variable "audit_store_uri" {
+  description = "URI of the scaling audit store, e.g. dynamodb://<table> or s3://<bucket>/<prefix>. Leave empty to disable the audit trail"
+  default     = ""
+}
+
+variable "nemesis_config" {
+  description = "Nemesis configuration as JSON, e.g. notification channels"
+  default     = ""
+}
+
+variable "scaling_policy_source" {
+  description = "Source of the scaling policy document, a path in the deployment package, s3://<bucket>/<key> or ssm:<parameter name>. Leave empty to use no policy document"
+  default     = ""
+}
+
+variable "read_side_scaling" {
+  description = "Fold read-side usage factors (GetRecords.Bytes, ReadProvisionedThroughputExceeded) into the scaling alarms"
+  default     = false
+}
+
+variable "standard_consumer_count" {
+  description = "Number of standard (non enhanced fan-out) consumers reading from the stream, used by read-side scaling"
+  default     = 0
+}
+
+variable "throttling_scale_up" {
+  description = "Create the throttling alarm that scales the stream up immediately when producers are throttled"
+  default     = true
+}
+
+variable "include_put_records_throttled_records" {
+  description = "Also count PutRecords.ThrottledRecords in the throttling alarm"
+  default     = false
+}
+
+variable "scheduled_scaling_rules" {
+  description = "Scheduled scaling rules of the stream, each with a name, either a cron expression and durationMinutes or from and to (RFC3339), and a minShardCount"
+  default     = []
+}
+
+variable "scheduled_scaling_rate" {
+  description = "How often the scheduled scaling rules and forecasts are evaluated, as an EventBridge rate expression"
+  default     = "rate(5 minutes)"
+}
+
+variable "predictive_scaling" {
+  description = "Scale the stream up ahead of the peaks forecast from the last weeks of its traffic. Needs audit_store_uri"
+  default     = false
+}
+
+variable "assume_role_arns" {
+  description = "Roles in other accounts the Lambda may assume to scale the streams registered in nemesis_config"
+  default     = []
+}